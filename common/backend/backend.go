@@ -0,0 +1,13 @@
+// Package backend names storage and broker backends selected by storage.backend
+// and broker.backend of service configs, memory ones allow to run service without Postgres and Kafka.
+package backend
+
+import "errors"
+
+const (
+	Postgres = "postgres"
+	Kafka    = "kafka"
+	Memory   = "memory"
+)
+
+var ErrUnknown = errors.New("unknown backend")
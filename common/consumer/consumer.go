@@ -0,0 +1,149 @@
+// Package consumer handles msgs fetched from a topic, msgs of one partition
+// are handled one by one in order, partitions are handled in parallel.
+package consumer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Msgs fetched ahead of handling for each partition.
+const partitionBuffer = 16
+
+// Msg as fetched from topic, kept as is to be dead-lettered if it can't be handled.
+// Partition and offset are used to commit it.
+type Msg struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+}
+
+type (
+	FetchFunc  func(ctx context.Context) (*Msg, error)
+	CommitFunc func(ctx context.Context, msg *Msg) error
+	// Msg is committed when handle returns nil, otherwise it is handled again.
+	HandleFunc func(ctx context.Context, msg *Msg) error
+)
+
+type Loop struct {
+	fetch  FetchFunc
+	commit CommitFunc
+	handle HandleFunc
+	// Pause before failed fetch or handling is tried again.
+	retryDelay time.Duration
+	logger     *logrus.Entry
+}
+
+func NewLoop(fetch FetchFunc, commit CommitFunc, handle HandleFunc, retryDelay time.Duration, logger *logrus.Entry) *Loop {
+	return &Loop{
+		fetch:      fetch,
+		commit:     commit,
+		handle:     handle,
+		retryDelay: retryDelay,
+		logger:     logger,
+	}
+}
+
+// Fetches msgs and passes them to the worker of their partition, until ctx is done.
+// Slow partition stalls fetching once its buffer is full.
+func (l *Loop) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	partitions := make(map[int]chan *Msg)
+
+	for {
+		msg, err := l.fetch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			l.logger.Error("fetch msg err: ", err)
+
+			if !sleep(ctx, l.retryDelay) {
+				return
+			}
+
+			continue
+		}
+
+		msgs, exists := partitions[msg.Partition]
+		if !exists {
+			msgs = make(chan *Msg, partitionBuffer)
+			partitions[msg.Partition] = msgs
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				l.consumePartition(ctx, msgs)
+			}()
+		}
+
+		select {
+		case msgs <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (l *Loop) consumePartition(ctx context.Context, msgs <-chan *Msg) {
+	for {
+		select {
+		case msg := <-msgs:
+			if !l.process(ctx, msg) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Handles msg until it succeeds, next msg of the partition waits for it.
+// Returns false when ctx is done before msg is handled.
+func (l *Loop) process(ctx context.Context, msg *Msg) bool {
+	for {
+		err := l.handle(ctx, msg)
+		if err == nil {
+			break
+		}
+
+		if ctx.Err() != nil {
+			return false
+		}
+
+		l.logger.Error("handle msg err, it will be handled again: ", err)
+
+		if !sleep(ctx, l.retryDelay) {
+			return false
+		}
+	}
+
+	// Msg which is not committed is fetched again after restart, handlers skip processed msgs.
+	if err := l.commit(ctx, msg); err != nil {
+		l.logger.Error("commit msg err: ", err)
+	}
+
+	return true
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,172 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type testSource struct {
+	msgs chan *Msg
+
+	mu        sync.Mutex
+	committed []*Msg
+}
+
+func newTestSource(msgs ...*Msg) *testSource {
+	s := &testSource{msgs: make(chan *Msg, len(msgs))}
+	for _, msg := range msgs {
+		s.msgs <- msg
+	}
+
+	return s
+}
+
+func (s *testSource) fetch(ctx context.Context) (*Msg, error) {
+	select {
+	case msg := <-s.msgs:
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *testSource) commit(ctx context.Context, msg *Msg) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.committed = append(s.committed, msg)
+
+	return nil
+}
+
+func (s *testSource) committedOffsets(partition int) []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var offsets []int64
+
+	for _, msg := range s.committed {
+		if msg.Partition == partition {
+			offsets = append(offsets, msg.Offset)
+		}
+	}
+
+	return offsets
+}
+
+func run(t *testing.T, source *testSource, handle HandleFunc) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	loop := NewLoop(source.fetch, source.commit, handle, time.Millisecond, logrus.NewEntry(logrus.New()))
+
+	done := make(chan struct{})
+
+	go func() {
+		loop.Run(ctx)
+		close(done)
+	}()
+
+	return func() {
+		cancel()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("loop is not stopped")
+		}
+	}
+}
+
+func TestPartitionsAreHandledInParallel(t *testing.T) {
+	source := newTestSource(
+		&Msg{Partition: 0, Offset: 0},
+		&Msg{Partition: 1, Offset: 0},
+	)
+
+	// Msg of partition 0 is handled only after msg of partition 1.
+	secondHandled := make(chan struct{})
+
+	stop := run(t, source, func(ctx context.Context, msg *Msg) error {
+		if msg.Partition == 1 {
+			close(secondHandled)
+
+			return nil
+		}
+
+		select {
+		case <-secondHandled:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	defer stop()
+
+	deadline := time.Now().Add(time.Second)
+	for len(source.committedOffsets(0)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("blocked partition stalled the other one")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPartitionIsHandledInOrder(t *testing.T) {
+	source := newTestSource(
+		&Msg{Partition: 0, Offset: 0},
+		&Msg{Partition: 0, Offset: 1},
+		&Msg{Partition: 0, Offset: 2},
+	)
+
+	var (
+		mu      sync.Mutex
+		handled []int64
+		failed  bool
+	)
+
+	stop := run(t, source, func(ctx context.Context, msg *Msg) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// First msg fails once and is handled again before the next one.
+		if msg.Offset == 0 && !failed {
+			failed = true
+
+			return errors.New("db is unavailable")
+		}
+
+		handled = append(handled, msg.Offset)
+
+		return nil
+	})
+	defer stop()
+
+	deadline := time.Now().Add(time.Second)
+	for len(source.committedOffsets(0)) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("msgs are not committed", source.committedOffsets(0))
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i, offset := range handled {
+		if offset != int64(i) {
+			t.Fatal("msgs handled out of order", handled)
+		}
+	}
+
+	for i, offset := range source.committedOffsets(0) {
+		if offset != int64(i) {
+			t.Fatal("msgs committed out of order", source.committedOffsets(0))
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package deadletter
+
+import (
+	"common/web"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+type Response struct {
+	ID         uint       `json:"id"`
+	Topic      string     `json:"topic"`
+	Payload    string     `json:"payload" example:"{\"type\":\"order.new\"}"`
+	Error      string     `json:"error"`
+	Attempts   int        `json:"attempts"`
+	FailedAt   time.Time  `json:"failed_at"`
+	ReplayedAt *time.Time `json:"replayed_at,omitempty"`
+}
+
+type ErrResponse struct {
+	Message string `json:"message"`
+}
+
+// Payload is the msg as it was read, kept as text to be readable in response.
+func newResponse(letter *Letter) Response {
+	return Response{
+		ID:         letter.ID,
+		Topic:      letter.Topic,
+		Payload:    string(letter.Payload),
+		Error:      letter.Error,
+		Attempts:   letter.Attempts,
+		FailedAt:   letter.FailedAt,
+		ReplayedAt: letter.ReplayedAt,
+	}
+}
+
+// Responds with letters of the queue newest first, paged by limit and offset query params.
+func ListHandler(q *Queue) http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, err := parsePage(r)
+		if err != nil {
+			web.JSONResponse(w, ErrResponse{Message: err.Error()}, http.StatusBadRequest)
+
+			return
+		}
+
+		letters, err := q.List(r.Context(), limit, offset)
+		if err != nil {
+			web.JSONResponse(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		lettersResponse := make([]Response, 0, len(letters))
+		for _, v := range letters {
+			lettersResponse = append(lettersResponse, newResponse(v))
+		}
+
+		web.JSONResponse(w, lettersResponse, http.StatusOK)
+	}
+
+	return http.HandlerFunc(handler)
+}
+
+func parsePage(r *http.Request) (uint, uint, error) {
+	var limit, offset uint = defaultListLimit, 0
+
+	if limitStr := r.FormValue("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 || l > maxListLimit {
+			return 0, 0, errors.New("limit query param is not correct")
+		}
+
+		limit = uint(l)
+	}
+
+	if offsetStr := r.FormValue("offset"); offsetStr != "" {
+		o, err := strconv.Atoi(offsetStr)
+		if err != nil || o < 0 {
+			return 0, 0, errors.New("offset query param is not correct")
+		}
+
+		offset = uint(o)
+	}
+
+	return limit, offset, nil
+}
+
+// Replays letter with id route var, responds with 409 when it is already replayed.
+func ReplayHandler(q *Queue) http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil || id <= 0 {
+			web.JSONResponse(w, ErrResponse{Message: "dead letter id is not correct"}, http.StatusBadRequest)
+
+			return
+		}
+
+		letter, err := q.Replay(r.Context(), uint(id))
+
+		switch {
+		case errors.Is(err, ErrLetterNotFound):
+			web.JSONResponse(w, ErrResponse{Message: err.Error()}, http.StatusNotFound)
+
+			return
+		case errors.Is(err, ErrAlreadyReplayed):
+			web.JSONResponse(w, ErrResponse{Message: err.Error()}, http.StatusConflict)
+
+			return
+		case err != nil:
+			web.JSONResponse(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		web.JSONResponse(w, newResponse(letter), http.StatusOK)
+	}
+
+	return http.HandlerFunc(handler)
+}
@@ -0,0 +1,191 @@
+// Package deadletter retries failed handling of broker msgs and parks msgs
+// which still fail in a dead-letter topic, from where they can be replayed.
+package deadletter
+
+import (
+	"common/consumer"
+	"common/events"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrLetterNotFound  = errors.New("dead letter not found")
+	ErrAlreadyReplayed = errors.New("dead letter is already replayed")
+	ErrNoTopicHandler  = errors.New("no handler for topic of dead letter")
+)
+
+// Msg which handling failed after all retries.
+type Letter struct {
+	ID         uint       `json:"id"`
+	Service    string     `json:"service"`
+	Topic      string     `json:"topic"`
+	Key        []byte     `json:"key,omitempty"`
+	Payload    []byte     `json:"payload"`
+	Error      string     `json:"error"`
+	Attempts   int        `json:"attempts"`
+	FailedAt   time.Time  `json:"failed_at"`
+	ReplayedAt *time.Time `json:"replayed_at,omitempty"`
+}
+
+// Keeps letters of the service, so they can be listed and replayed.
+type Store interface {
+	Create(ctx context.Context, letter *Letter) (*Letter, error)
+	Get(ctx context.Context, service string, id uint) (*Letter, error)
+	GetList(ctx context.Context, service string, limit, offset uint) ([]*Letter, error)
+	// Fails with ErrAlreadyReplayed, so letter is replayed once.
+	MarkReplayed(ctx context.Context, service string, id uint) (*Letter, error)
+	Close()
+}
+
+// Broker side of the queue, implemented by broker clients of services.
+type Publisher interface {
+	SendDeadLetter(ctx context.Context, key, value []byte) error
+}
+
+// Handler of msgs read from a topic, the one the service consumes the topic with.
+type HandleFunc func(ctx context.Context, value []byte) error
+
+type Queue struct {
+	service   string
+	store     Store
+	publisher Publisher
+	policy    Policy
+	logger    *logrus.Entry
+
+	mu       sync.RWMutex
+	handlers map[string]HandleFunc
+}
+
+func NewQueue(service string, store Store, publisher Publisher, policy Policy, logger *logrus.Entry) *Queue {
+	return &Queue{
+		service:   service,
+		store:     store,
+		publisher: publisher,
+		policy:    policy,
+		logger:    logger,
+		handlers:  make(map[string]HandleFunc),
+	}
+}
+
+// Registers handler letters of the topic are replayed with.
+func (q *Queue) Register(topic string, handle HandleFunc) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.handlers[topic] = handle
+}
+
+// Runs handle for msg read from topic, retrying with backoff.
+// Msg is dead-lettered when handle fails with Permanent error or runs out of attempts.
+// Returns nil when msg is handled or dead-lettered, so it can be committed,
+// error means ctx is done or letter is not saved and msg should be handled again.
+func (q *Queue) Handle(ctx context.Context, topic string, key, payload []byte, handle func(ctx context.Context) error) error {
+	attempts, err := q.policy.Do(ctx, handle)
+	if err == nil {
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	q.logger.Errorf("Msg from %s failed after %d attempts, dead-lettering: %v", topic, attempts, err)
+
+	letter := &Letter{
+		Service:  q.service,
+		Topic:    topic,
+		Key:      key,
+		Payload:  payload,
+		Error:    err.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now().UTC(),
+	}
+
+	return q.add(ctx, letter)
+}
+
+// Consumes msgs of a topic until ctx is done, every msg is handled by Handle.
+// Msgs of a partition are handled one by one in order, partitions are handled in parallel.
+// Msg is committed when it is handled or dead-lettered, otherwise it is handled again after retryDelay.
+func (q *Queue) Consume(
+	ctx context.Context,
+	fetch consumer.FetchFunc,
+	commit consumer.CommitFunc,
+	handle HandleFunc,
+	retryDelay time.Duration,
+) {
+	loop := consumer.NewLoop(fetch, commit, func(ctx context.Context, msg *consumer.Msg) error {
+		return q.Handle(ctx, msg.Topic, msg.Key, msg.Value, func(ctx context.Context) error {
+			return handle(ctx, msg.Value)
+		})
+	}, retryDelay, q.logger)
+
+	loop.Run(ctx)
+}
+
+// Letter is saved first, so it can be replayed even if the topic is unavailable.
+// Failed publish is only logged, saving letter again would duplicate it.
+func (q *Queue) add(ctx context.Context, letter *Letter) error {
+	created, err := q.store.Create(ctx, letter)
+	if err != nil {
+		return err
+	}
+
+	value, err := events.Encode(events.DeadLettered, events.Meta{Producer: q.service}, created)
+	if err == nil {
+		err = q.publisher.SendDeadLetter(ctx, created.Key, value)
+	}
+
+	if err != nil {
+		q.logger.Error("Publish dead letter err: ", err)
+	}
+
+	return nil
+}
+
+func (q *Queue) Close() {
+	q.store.Close()
+}
+
+func (q *Queue) List(ctx context.Context, limit, offset uint) ([]*Letter, error) {
+	return q.store.GetList(ctx, q.service, limit, offset)
+}
+
+// Hands original payload of the letter to the handler of its topic in this service only,
+// other consumer groups of the topic don't see it again. Msg which still fails is dead-lettered
+// as a new letter. Letter is marked replayed once it is handled, so replay interrupted before
+// can be repeated; concurrent replays may both handle it, handlers skip processed msgs,
+// and the later one gets ErrAlreadyReplayed.
+func (q *Queue) Replay(ctx context.Context, id uint) (*Letter, error) {
+	letter, err := q.store.Get(ctx, q.service, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if letter.ReplayedAt != nil {
+		return nil, ErrAlreadyReplayed
+	}
+
+	q.mu.RLock()
+	handle, exists := q.handlers[letter.Topic]
+	q.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrNoTopicHandler, letter.Topic)
+	}
+
+	err = q.Handle(ctx, letter.Topic, letter.Key, letter.Payload, func(ctx context.Context) error {
+		return handle(ctx, letter.Payload)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return q.store.MarkReplayed(ctx, q.service, id)
+}
@@ -0,0 +1,210 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type testPublisher struct {
+	deadLetters [][]byte
+}
+
+func (p *testPublisher) SendDeadLetter(ctx context.Context, key, value []byte) error {
+	p.deadLetters = append(p.deadLetters, value)
+
+	return nil
+}
+
+var testPolicy = Policy{
+	Attempts:       3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     2 * time.Millisecond,
+}
+
+func newTestQueue() (*Queue, *testPublisher) {
+	publisher := &testPublisher{}
+
+	return NewQueue("wallet", NewInMemoryStore(), publisher, testPolicy, logrus.NewEntry(logrus.New())), publisher
+}
+
+func TestPolicyRetriesUntilSuccess(t *testing.T) {
+	calls := 0
+
+	attempts, err := testPolicy.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 2 {
+			return errors.New("temporary")
+		}
+
+		return nil
+	})
+
+	if err != nil || attempts != 2 {
+		t.Error("unexpected result", attempts, err)
+	}
+}
+
+func TestPolicyStopsOnPermanentError(t *testing.T) {
+	attempts, err := testPolicy.Do(context.Background(), func(ctx context.Context) error {
+		return Permanent(errors.New("malformed"))
+	})
+
+	if !IsPermanent(err) || attempts != 1 {
+		t.Error("unexpected result", attempts, err)
+	}
+}
+
+func TestHandleDeadLettersAndReplays(t *testing.T) {
+	ctx := context.Background()
+	q, publisher := newTestQueue()
+
+	calls := 0
+	err := q.Handle(ctx, "new_orders", []byte("1"), []byte(`{"order_id":1}`), func(ctx context.Context) error {
+		calls++
+
+		return errors.New("wallet not found")
+	})
+	if err != nil {
+		t.Fatal("dead-lettered msg is not reported handled", err)
+	}
+
+	if calls != testPolicy.Attempts {
+		t.Error("unexpected attempts count", calls)
+	}
+
+	if len(publisher.deadLetters) != 1 {
+		t.Fatal("dead letter is not published")
+	}
+
+	letters, err := q.List(ctx, 10, 0)
+	if err != nil || len(letters) != 1 {
+		t.Fatal("unexpected letters", letters, err)
+	}
+
+	letter := letters[0]
+	if letter.Topic != "new_orders" || letter.Error != "wallet not found" || letter.Attempts != testPolicy.Attempts {
+		t.Error("unexpected letter", letter)
+	}
+
+	if _, err := q.Replay(ctx, letter.ID); !errors.Is(err, ErrNoTopicHandler) {
+		t.Error("expected no topic handler error", err)
+	}
+
+	var replayedValues []string
+
+	q.Register("new_orders", func(ctx context.Context, value []byte) error {
+		replayedValues = append(replayedValues, string(value))
+
+		return nil
+	})
+
+	replayed, err := q.Replay(ctx, letter.ID)
+	if err != nil || replayed.ReplayedAt == nil {
+		t.Fatal("replay failed", replayed, err)
+	}
+
+	if len(replayedValues) != 1 || replayedValues[0] != `{"order_id":1}` {
+		t.Error("unexpected replayed msgs", replayedValues)
+	}
+
+	if _, err := q.Replay(ctx, letter.ID); !errors.Is(err, ErrAlreadyReplayed) {
+		t.Error("expected already replayed error", err)
+	}
+
+	if _, err := q.Replay(ctx, letter.ID+1); !errors.Is(err, ErrLetterNotFound) {
+		t.Error("expected not found error", err)
+	}
+}
+
+func TestHandleSuccessIsNotDeadLettered(t *testing.T) {
+	q, publisher := newTestQueue()
+
+	err := q.Handle(context.Background(), "new_orders", nil, []byte("{}"), func(ctx context.Context) error {
+		return nil
+	})
+
+	if err != nil || len(publisher.deadLetters) != 0 {
+		t.Error("msg handled successfully is dead-lettered")
+	}
+}
+
+func TestHandleCanceledIsNotDeadLettered(t *testing.T) {
+	q, publisher := newTestQueue()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err := q.Handle(ctx, "new_orders", nil, []byte("{}"), func(ctx context.Context) error {
+		cancel()
+
+		return errors.New("db is unavailable")
+	})
+
+	if err == nil || len(publisher.deadLetters) != 0 {
+		t.Error("msg of stopped consumer is dead-lettered", err)
+	}
+}
+
+func TestReplayFailedAgainIsDeadLettered(t *testing.T) {
+	ctx := context.Background()
+	q, publisher := newTestQueue()
+
+	handle := func(ctx context.Context, value []byte) error {
+		return errors.New("wallet not found")
+	}
+
+	q.Register("new_orders", handle)
+
+	err := q.Handle(ctx, "new_orders", []byte("1"), []byte(`{"order_id":1}`), func(ctx context.Context) error {
+		return handle(ctx, []byte(`{"order_id":1}`))
+	})
+	if err != nil {
+		t.Fatal("dead-lettered msg is not reported handled", err)
+	}
+
+	if _, err := q.Replay(ctx, 1); err != nil {
+		t.Fatal("replay failed", err)
+	}
+
+	letters, err := q.List(ctx, 10, 0)
+	if err != nil || len(letters) != 2 || len(publisher.deadLetters) != 2 {
+		t.Fatal("msg failed on replay is not dead-lettered again", letters, err)
+	}
+
+	if letters[0].ReplayedAt != nil || letters[1].ReplayedAt == nil || string(letters[0].Key) != "1" {
+		t.Error("unexpected letters", letters[0], letters[1])
+	}
+}
+
+func TestInterruptedReplayIsNotMarkedReplayed(t *testing.T) {
+	q, _ := newTestQueue()
+
+	letter, err := q.store.Create(context.Background(), &Letter{Service: "wallet", Topic: "new_orders", Payload: []byte("{}")})
+	if err != nil {
+		t.Fatal("create letter err", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	q.Register("new_orders", func(ctx context.Context, value []byte) error {
+		cancel()
+
+		return errors.New("db is unavailable")
+	})
+
+	if _, err := q.Replay(ctx, letter.ID); err == nil {
+		t.Fatal("interrupted replay is reported done")
+	}
+
+	q.Register("new_orders", func(ctx context.Context, value []byte) error {
+		return nil
+	})
+
+	replayed, err := q.Replay(context.Background(), letter.ID)
+	if err != nil || replayed.ReplayedAt == nil {
+		t.Error("interrupted replay can't be repeated", replayed, err)
+	}
+}
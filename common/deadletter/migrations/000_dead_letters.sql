@@ -0,0 +1,15 @@
+-- Msgs which services failed to handle after all retries, one table for all services.
+-- Letters are listed by service newest first and replayed once, replayed_at is set then.
+CREATE TABLE IF NOT EXISTS dead_letters (
+  id BIGSERIAL PRIMARY KEY,
+  service varchar(255) NOT NULL,
+  topic varchar(255) NOT NULL,
+  key bytea,
+  payload bytea NOT NULL,
+  error text NOT NULL,
+  attempts int NOT NULL,
+  failed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  replayed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS dead_letters_service_id_idx ON dead_letters (service, id);
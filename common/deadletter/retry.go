@@ -0,0 +1,69 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Retries of msg handling, backoff doubles after every failed attempt up to MaxBackoff.
+type Policy struct {
+	Attempts       int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Marks error which retries can't fix, e.g. malformed msg.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+
+	return errors.As(err, &permanent)
+}
+
+// Runs fn until it succeeds, fails with Permanent error, attempts are exhausted or ctx is done.
+// Returns count of made attempts and the last error.
+func (p Policy) Do(ctx context.Context, fn func(ctx context.Context) error) (int, error) {
+	backoff := p.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || IsPermanent(err) || attempt >= p.Attempts {
+			return attempt, err
+		}
+
+		timer := time.NewTimer(backoff)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+
+			return attempt, err
+		}
+
+		backoff *= 2
+		if backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package deadletter
+
+import (
+	"common/pg"
+	"context"
+	"embed"
+	"errors"
+	"io/fs"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// ------------------------------InMemoryStore------------------------------
+
+type InMemoryStore struct {
+	mu      sync.RWMutex
+	letters map[uint]*Letter
+	lastID  uint
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		letters: make(map[uint]*Letter),
+	}
+}
+
+func (s *InMemoryStore) Create(ctx context.Context, letter *Letter) (*Letter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+
+	created := *letter
+	created.ID = s.lastID
+	s.letters[created.ID] = &created
+
+	result := created
+
+	return &result, nil
+}
+
+func (s *InMemoryStore) Get(ctx context.Context, service string, id uint) (*Letter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	letter, exists := s.letters[id]
+	if !exists || letter.Service != service {
+		return nil, ErrLetterNotFound
+	}
+
+	result := *letter
+
+	return &result, nil
+}
+
+// Newest letters first.
+func (s *InMemoryStore) GetList(ctx context.Context, service string, limit, offset uint) ([]*Letter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	letters := make([]*Letter, 0, len(s.letters))
+
+	for _, v := range s.letters {
+		if v.Service == service {
+			letter := *v
+			letters = append(letters, &letter)
+		}
+	}
+
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].ID > letters[j].ID
+	})
+
+	if offset >= uint(len(letters)) {
+		return []*Letter{}, nil
+	}
+
+	letters = letters[offset:]
+	if limit < uint(len(letters)) {
+		letters = letters[:limit]
+	}
+
+	return letters, nil
+}
+
+func (s *InMemoryStore) MarkReplayed(ctx context.Context, service string, id uint) (*Letter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letter, exists := s.letters[id]
+	if !exists || letter.Service != service {
+		return nil, ErrLetterNotFound
+	}
+
+	if letter.ReplayedAt != nil {
+		return nil, ErrAlreadyReplayed
+	}
+
+	now := time.Now().UTC()
+	letter.ReplayedAt = &now
+
+	result := *letter
+
+	return &result, nil
+}
+
+func (s *InMemoryStore) Close() {
+}
+
+// ------------------------------PostgresStore------------------------------
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrations of the table are recorded with this prefix in migrations table of the service database.
+const migrationsPrefix = "deadletter_"
+
+// Letters of all services are kept in one dead_letters table,
+// the store creates it with its own migrations.
+type PostgresStore struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgresStore(ctx context.Context, db *pgxpool.Pool) (*PostgresStore, error) {
+	migrationsFS, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pg.MigrateFS(ctx, db, migrationsFS, migrationsPrefix); err != nil {
+		return nil, err
+	}
+
+	queriesMap := map[string]string{
+		"create_dead_letter": `INSERT INTO dead_letters(service, topic, key, payload, error, attempts, failed_at)
+			VALUES($1::varchar, $2::varchar, $3::bytea, $4::bytea, $5::text, $6::int, $7::timestamptz)
+			RETURNING id, service, topic, key, payload, error, attempts, failed_at, replayed_at;`,
+		"get_dead_letter": `SELECT id, service, topic, key, payload, error, attempts, failed_at, replayed_at
+			FROM dead_letters
+			WHERE service=$1::varchar AND id=$2::bigint;`,
+		"dead_letters_list": `SELECT id, service, topic, key, payload, error, attempts, failed_at, replayed_at
+			FROM dead_letters
+			WHERE service=$1::varchar
+			ORDER BY id DESC
+			LIMIT $2::bigint OFFSET $3::bigint;`,
+		"mark_dead_letter_replayed": `UPDATE dead_letters
+			SET replayed_at=NOW()
+			WHERE service=$1::varchar AND id=$2::bigint AND replayed_at IS NULL
+			RETURNING id, service, topic, key, payload, error, attempts, failed_at, replayed_at;`,
+	}
+
+	if err := pg.Prepare(ctx, db, queriesMap); err != nil {
+		return nil, err
+	}
+
+	return &PostgresStore{db: db}, nil
+}
+
+func scanLetter(row pgx.Row) (*Letter, error) {
+	var letter Letter
+
+	err := row.Scan(
+		&letter.ID,
+		&letter.Service,
+		&letter.Topic,
+		&letter.Key,
+		&letter.Payload,
+		&letter.Error,
+		&letter.Attempts,
+		&letter.FailedAt,
+		&letter.ReplayedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrLetterNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &letter, nil
+}
+
+func (s *PostgresStore) Create(ctx context.Context, letter *Letter) (*Letter, error) {
+	return scanLetter(s.db.QueryRow(
+		ctx,
+		"create_dead_letter",
+		letter.Service,
+		letter.Topic,
+		letter.Key,
+		letter.Payload,
+		letter.Error,
+		letter.Attempts,
+		letter.FailedAt,
+	))
+}
+
+func (s *PostgresStore) Get(ctx context.Context, service string, id uint) (*Letter, error) {
+	return scanLetter(s.db.QueryRow(ctx, "get_dead_letter", service, id))
+}
+
+func (s *PostgresStore) GetList(ctx context.Context, service string, limit, offset uint) ([]*Letter, error) {
+	rows, err := s.db.Query(ctx, "dead_letters_list", service, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	letters := make([]*Letter, 0, limit)
+
+	for rows.Next() {
+		letter, err := scanLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		letters = append(letters, letter)
+	}
+
+	return letters, rows.Err()
+}
+
+func (s *PostgresStore) MarkReplayed(ctx context.Context, service string, id uint) (*Letter, error) {
+	letter, err := scanLetter(s.db.QueryRow(ctx, "mark_dead_letter_replayed", service, id))
+	if !errors.Is(err, ErrLetterNotFound) {
+		return letter, err
+	}
+
+	if _, err := s.Get(ctx, service, id); err != nil {
+		return nil, err
+	}
+
+	return nil, ErrAlreadyReplayed
+}
+
+// Releases the pool the store shares with DAOs of the service.
+func (s *PostgresStore) Close() {
+	pg.Release(s.db)
+}
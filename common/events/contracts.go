@@ -0,0 +1,213 @@
+package events
+
+import (
+	"common/money"
+	"fmt"
+)
+
+// Saga participant which sent msg.
+type ServiceName uint8
+
+const (
+	Wallet ServiceName = iota
+	Storage
+	Registry
+)
+
+type CancelationReason uint8
+
+const (
+	OK CancelationReason = iota
+	NotEnoughMoney
+	OutOfStock
+	InternalError
+	Timeout
+	CanceledByUser
+	ReservationExpired
+)
+
+// ------------------------------Payloads------------------------------
+
+type NewOrderMsgItem struct {
+	OrderID      uint        `json:"order_id"`
+	ProductID    uint        `json:"product_id"`
+	Count        uint8       `json:"count"`
+	ProductPrice money.Money `json:"product_price"`
+}
+
+type NewOrderMsg struct {
+	MessageID  string            `json:"message_id"`
+	UserID     uint              `json:"user_id"`
+	OrderID    uint              `json:"order_id"`
+	OrderItems []NewOrderMsgItem `json:"order_items"`
+}
+
+// New order msg id is derived from the outbox msg id, which is stable across relay retries.
+func NewOrderMsgID(outboxMsgID uint) string {
+	return fmt.Sprintf("new_order:%d", outboxMsgID)
+}
+
+type OrderRejectedMsg struct {
+	MessageID   string            `json:"message_id"`
+	OrderID     uint              `json:"order_id"`
+	UserID      uint              `json:"user_id"`
+	Service     ServiceName       `json:"service"`
+	ReasonCode  CancelationReason `json:"reason_code"`
+	CausationID string            `json:"-"` // envelope metadata, id of the msg rejected order was reacted to
+}
+
+// Rejected msg id is the same for every send of the service decision,
+// so consumers can drop redelivered and resent msgs.
+func RejectedMsgID(service ServiceName, orderID uint) string {
+	return fmt.Sprintf("rejected:%d:%d", service, orderID)
+}
+
+// Announces order completed by all saga participants,
+// wallet captures the payment held for the order.
+type OrderCompletedMsg struct {
+	MessageID string `json:"message_id"`
+	OrderID   uint   `json:"order_id"`
+	UserID    uint   `json:"user_id"`
+}
+
+func CompletedMsgID(orderID uint) string {
+	return fmt.Sprintf("completed:%d", orderID)
+}
+
+type OrderReturnedMsgItem struct {
+	ProductID    uint        `json:"product_id"`
+	Count        uint8       `json:"count"`
+	ProductPrice money.Money `json:"product_price"`
+}
+
+// Amount is refunded by Wallet, items are taken back by Storage.
+type OrderReturnedMsg struct {
+	MessageID string                 `json:"message_id"`
+	ReturnID  uint                   `json:"return_id"`
+	OrderID   uint                   `json:"order_id"`
+	UserID    uint                   `json:"user_id"`
+	Amount    money.Money            `json:"amount"`
+	Items     []OrderReturnedMsgItem `json:"items"`
+}
+
+func ReturnedMsgID(returnID uint) string {
+	return fmt.Sprintf("returned:%d", returnID)
+}
+
+type OrderSuccessMsg struct {
+	OrderID     uint        `json:"order_id"`
+	Service     ServiceName `json:"service"`
+	CausationID string      `json:"-"` // envelope metadata, id of the msg succeeded step was reacted to
+}
+
+// Announces that the service has compensated its step of rejected or canceled order,
+// e.g. wallet released the hold or refunded the payment. Sent to the success topic.
+type OrderCompensatedMsg struct {
+	OrderID     uint        `json:"order_id"`
+	Service     ServiceName `json:"service"`
+	CausationID string      `json:"-"` // envelope metadata, id of the rejected msg compensation was reacted to
+}
+
+// ------------------------------Codecs------------------------------
+
+// Producer is the name of the sending service written to the envelope.
+func encodeOrderMsg(eventType Type, producer, id string, orderID uint, causationID string, msg interface{}) ([]byte, error) {
+	return Encode(eventType, Meta{
+		ID:            id,
+		Producer:      producer,
+		CorrelationID: OrderCorrelationID(orderID),
+		CausationID:   causationID,
+	}, msg)
+}
+
+func EncodeNewOrderMsg(producer string, msg *NewOrderMsg) ([]byte, error) {
+	return encodeOrderMsg(NewOrder, producer, msg.MessageID, msg.OrderID, "", msg)
+}
+
+func EncodeOrderRejectedMsg(producer string, msg *OrderRejectedMsg) ([]byte, error) {
+	return encodeOrderMsg(OrderRejected, producer, msg.MessageID, msg.OrderID, msg.CausationID, msg)
+}
+
+// Success msgs have no message id, envelope gets a random one.
+func EncodeOrderSuccessMsg(producer string, msg *OrderSuccessMsg) ([]byte, error) {
+	return encodeOrderMsg(OrderSucceeded, producer, "", msg.OrderID, msg.CausationID, msg)
+}
+
+// Compensated msgs have no message id, envelope gets a random one.
+func EncodeOrderCompensatedMsg(producer string, msg *OrderCompensatedMsg) ([]byte, error) {
+	return encodeOrderMsg(OrderCompensated, producer, "", msg.OrderID, msg.CausationID, msg)
+}
+
+func EncodeOrderCompletedMsg(producer string, msg *OrderCompletedMsg) ([]byte, error) {
+	return encodeOrderMsg(OrderCompleted, producer, msg.MessageID, msg.OrderID, "", msg)
+}
+
+func EncodeOrderReturnedMsg(producer string, msg *OrderReturnedMsg) ([]byte, error) {
+	return encodeOrderMsg(OrderReturned, producer, msg.MessageID, msg.OrderID, "", msg)
+}
+
+func DecodeNewOrderMsg(data []byte) (*NewOrderMsg, error) {
+	var msg NewOrderMsg
+	if _, err := Decode(data, NewOrder, &msg); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
+
+func DecodeOrderRejectedMsg(data []byte) (*OrderRejectedMsg, error) {
+	var msg OrderRejectedMsg
+
+	envelope, err := Decode(data, OrderRejected, &msg)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.CausationID = envelope.CausationID
+
+	return &msg, nil
+}
+
+func DecodeOrderSuccessMsg(data []byte) (*OrderSuccessMsg, error) {
+	var msg OrderSuccessMsg
+
+	envelope, err := Decode(data, OrderSucceeded, &msg)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.CausationID = envelope.CausationID
+
+	return &msg, nil
+}
+
+func DecodeOrderCompensatedMsg(data []byte) (*OrderCompensatedMsg, error) {
+	var msg OrderCompensatedMsg
+
+	envelope, err := Decode(data, OrderCompensated, &msg)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.CausationID = envelope.CausationID
+
+	return &msg, nil
+}
+
+func DecodeOrderCompletedMsg(data []byte) (*OrderCompletedMsg, error) {
+	var msg OrderCompletedMsg
+	if _, err := Decode(data, OrderCompleted, &msg); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
+
+func DecodeOrderReturnedMsg(data []byte) (*OrderReturnedMsg, error) {
+	var msg OrderReturnedMsg
+	if _, err := Decode(data, OrderReturned, &msg); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
@@ -0,0 +1,153 @@
+// Package events defines the envelope every broker msg of the services is wrapped in.
+package events
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Schema version of the events produced by this code.
+// Consumers upcast older versions and reject newer ones.
+const SchemaVersion = 1
+
+type Type string
+
+const (
+	NewOrder         Type = "order.new"
+	OrderRejected    Type = "order.rejected"
+	OrderSucceeded   Type = "order.step_succeeded"
+	OrderCompensated Type = "order.step_compensated"
+	OrderCompleted   Type = "order.completed"
+	OrderReturned    Type = "order.returned"
+	DeadLettered     Type = "message.dead_lettered"
+)
+
+var (
+	ErrMalformedEvent     = errors.New("malformed event")
+	ErrUnexpectedType     = errors.New("unexpected event type")
+	ErrUnsupportedVersion = errors.New("unsupported event schema version")
+)
+
+type Envelope struct {
+	ID            string          `json:"id"`
+	Type          Type            `json:"type"`
+	SchemaVersion int             `json:"schema_version"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Producer      string          `json:"producer"`
+	CorrelationID string          `json:"correlation_id"`
+	CausationID   string          `json:"causation_id,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// Envelope fields set by producer, random id is generated when ID is empty.
+type Meta struct {
+	ID            string
+	Producer      string
+	CorrelationID string
+	CausationID   string
+}
+
+// Msgs of one order saga share correlation id.
+func OrderCorrelationID(orderID uint) string {
+	return fmt.Sprintf("order:%d", orderID)
+}
+
+// Msgs of one order are keyed by order id, so they land on one partition
+// and are consumed in the order they were sent.
+func OrderKey(orderID uint) []byte {
+	return []byte(strconv.FormatUint(uint64(orderID), 10))
+}
+
+func Encode(eventType Type, meta Meta, payload interface{}) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	id := meta.ID
+	if id == "" {
+		id, err = newID()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(&Envelope{
+		ID:            id,
+		Type:          eventType,
+		SchemaVersion: SchemaVersion,
+		OccurredAt:    time.Now().UTC(),
+		Producer:      meta.Producer,
+		CorrelationID: meta.CorrelationID,
+		CausationID:   meta.CausationID,
+		Payload:       data,
+	})
+}
+
+// Type of the event, msgs sent without envelope have empty type.
+// Lets consumer of a topic with several event types choose the decoder.
+func TypeOf(data []byte) (Type, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMalformedEvent, err)
+	}
+
+	return envelope.Type, nil
+}
+
+// Decodes event of expected type and unmarshals its payload upcast to SchemaVersion into out.
+// Msgs produced before the envelope was introduced are read as version 0 of expected type.
+func Decode(data []byte, expected Type, out interface{}) (*Envelope, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedEvent, err)
+	}
+
+	if envelope.Type == "" && envelope.SchemaVersion == 0 && envelope.Payload == nil {
+		envelope = Envelope{
+			Type:    expected,
+			Payload: data,
+		}
+	}
+
+	if envelope.Type != expected {
+		return nil, fmt.Errorf("%w: got %q, expected %q", ErrUnexpectedType, envelope.Type, expected)
+	}
+
+	if envelope.SchemaVersion > SchemaVersion || envelope.SchemaVersion < 0 {
+		return nil, fmt.Errorf("%w: %s version %d", ErrUnsupportedVersion, envelope.Type, envelope.SchemaVersion)
+	}
+
+	if len(envelope.Payload) == 0 || bytes.Equal(envelope.Payload, []byte("null")) {
+		return nil, fmt.Errorf("%w: %s has no payload", ErrMalformedEvent, envelope.Type)
+	}
+
+	payload, err := upcast(envelope.Type, envelope.SchemaVersion, envelope.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope.Payload = payload
+	envelope.SchemaVersion = SchemaVersion
+
+	if err := json.Unmarshal(payload, out); err != nil {
+		return nil, fmt.Errorf("%w: %s payload: %v", ErrMalformedEvent, envelope.Type, err)
+	}
+
+	return &envelope, nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
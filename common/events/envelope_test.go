@@ -0,0 +1,126 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type testPayload struct {
+	MessageID string `json:"message_id"`
+	OrderID   uint   `json:"order_id"`
+}
+
+func TestEncodeDecode(t *testing.T) {
+	meta := Meta{
+		ID:            "new_order:1",
+		Producer:      "registry",
+		CorrelationID: OrderCorrelationID(7),
+		CausationID:   "cause",
+	}
+
+	data, err := Encode(NewOrder, meta, &testPayload{MessageID: "new_order:1", OrderID: 7})
+	if err != nil {
+		t.Fatal("encode error", err)
+	}
+
+	var payload testPayload
+
+	envelope, err := Decode(data, NewOrder, &payload)
+	if err != nil {
+		t.Fatal("decode error", err)
+	}
+
+	if payload.OrderID != 7 || payload.MessageID != "new_order:1" {
+		t.Error("unexpected payload", payload)
+	}
+
+	if envelope.ID != meta.ID || envelope.Producer != "registry" || envelope.CorrelationID != "order:7" ||
+		envelope.CausationID != "cause" || envelope.SchemaVersion != SchemaVersion || envelope.OccurredAt.IsZero() {
+		t.Error("unexpected envelope", envelope)
+	}
+}
+
+func TestEncodeGeneratesID(t *testing.T) {
+	first, err := Encode(OrderSucceeded, Meta{}, &testPayload{OrderID: 1})
+	if err != nil {
+		t.Fatal("encode error", err)
+	}
+
+	second, err := Encode(OrderSucceeded, Meta{}, &testPayload{OrderID: 1})
+	if err != nil {
+		t.Fatal("encode error", err)
+	}
+
+	var firstEnvelope, secondEnvelope Envelope
+	if err := json.Unmarshal(first, &firstEnvelope); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal(second, &secondEnvelope); err != nil {
+		t.Fatal(err)
+	}
+
+	if firstEnvelope.ID == "" || firstEnvelope.ID == secondEnvelope.ID {
+		t.Error("expected unique generated ids", firstEnvelope.ID, secondEnvelope.ID)
+	}
+}
+
+func TestDecodeLegacyMsg(t *testing.T) {
+	var payload testPayload
+
+	envelope, err := Decode([]byte(`{"message_id":"rejected:0:3","order_id":3}`), OrderRejected, &payload)
+	if err != nil {
+		t.Fatal("decode legacy msg error", err)
+	}
+
+	if payload.OrderID != 3 || payload.MessageID != "rejected:0:3" {
+		t.Error("unexpected payload", payload)
+	}
+
+	if envelope.Type != OrderRejected || envelope.SchemaVersion != SchemaVersion {
+		t.Error("legacy msg is not upcast", envelope)
+	}
+}
+
+func TestDecodeRejectsInvalidEvents(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"newer version", `{"id":"1","type":"order.new","schema_version":2,"payload":{"order_id":1}}`, ErrUnsupportedVersion},
+		{"negative version", `{"id":"1","type":"order.new","schema_version":-1,"payload":{"order_id":1}}`, ErrUnsupportedVersion},
+		{"other type", `{"id":"1","type":"order.rejected","schema_version":1,"payload":{"order_id":1}}`, ErrUnexpectedType},
+		{"no payload", `{"id":"1","type":"order.new","schema_version":1,"payload":null}`, ErrMalformedEvent},
+		{"not json", `order`, ErrMalformedEvent},
+		{"payload of wrong shape", `{"id":"1","type":"order.new","schema_version":1,"payload":[1]}`, ErrMalformedEvent},
+	}
+
+	for _, c := range cases {
+		var payload testPayload
+
+		if _, err := Decode([]byte(c.data), NewOrder, &payload); !errors.Is(err, c.err) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	data, err := EncodeOrderCompensatedMsg("wallet", &OrderCompensatedMsg{OrderID: 1, Service: Wallet})
+	if err != nil {
+		t.Fatal("encode error", err)
+	}
+
+	if eventType, err := TypeOf(data); err != nil || eventType != OrderCompensated {
+		t.Error("unexpected type", eventType, err)
+	}
+
+	if eventType, err := TypeOf([]byte(`{"order_id":1,"service":0}`)); err != nil || eventType != "" {
+		t.Error("unexpected type of msg without envelope", eventType, err)
+	}
+
+	if _, err := TypeOf([]byte("{")); !errors.Is(err, ErrMalformedEvent) {
+		t.Error("expected malformed event err, got", err)
+	}
+}
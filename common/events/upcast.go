@@ -0,0 +1,41 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Converts payload of some version to the next one.
+type upcaster func(payload json.RawMessage) (json.RawMessage, error)
+
+// Upcasters by event type and version they convert from.
+// Version 0 is bare payload sent without envelope, its schema is the same as of version 1.
+var upcasters = map[Type]map[int]upcaster{
+	NewOrder:       {0: sameSchema},
+	OrderRejected:  {0: sameSchema},
+	OrderSucceeded: {0: sameSchema},
+	OrderCompleted: {0: sameSchema},
+	OrderReturned:  {0: sameSchema},
+}
+
+func sameSchema(payload json.RawMessage) (json.RawMessage, error) {
+	return payload, nil
+}
+
+func upcast(eventType Type, version int, payload json.RawMessage) (json.RawMessage, error) {
+	for ; version < SchemaVersion; version++ {
+		up, exists := upcasters[eventType][version]
+		if !exists {
+			return nil, fmt.Errorf("%w: %s version %d can't be upcast", ErrUnsupportedVersion, eventType, version)
+		}
+
+		var err error
+
+		payload, err = up(payload)
+		if err != nil {
+			return nil, fmt.Errorf("upcast %s version %d: %w", eventType, version, err)
+		}
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,120 @@
+// Package membus delivers msgs between services running in one process,
+// it replaces Kafka topics for in-memory broker clients.
+package membus
+
+import "sync"
+
+// Consumer groups of the topic get every msg like in Kafka,
+// consumers of one group compete for them.
+type Bus interface {
+	Subscribe(topic, group string) <-chan []byte
+	Publish(topic string, value []byte)
+}
+
+// Msgs are queued until consumed, so publish never blocks
+// and msgs published before group subscribed are not delivered to it.
+type InMemoryBus struct {
+	groups map[string]map[string]*inMemoryQueue
+	done   chan struct{}
+	mu     sync.Mutex
+}
+
+func NewInMemoryBus() *InMemoryBus {
+	return &InMemoryBus{
+		groups: make(map[string]map[string]*inMemoryQueue),
+		done:   make(chan struct{}),
+	}
+}
+
+func (b *InMemoryBus) Subscribe(topic, group string) <-chan []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, exists := b.groups[topic]; !exists {
+		b.groups[topic] = make(map[string]*inMemoryQueue)
+	}
+
+	queue, exists := b.groups[topic][group]
+	if !exists {
+		queue = newInMemoryQueue()
+		b.groups[topic][group] = queue
+
+		go queue.deliver(b.done)
+	}
+
+	return queue.out
+}
+
+func (b *InMemoryBus) Publish(topic string, value []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, queue := range b.groups[topic] {
+		queue.push(value)
+	}
+}
+
+// Stops delivery, msgs left in queues are dropped.
+func (b *InMemoryBus) Close() {
+	close(b.done)
+}
+
+type inMemoryQueue struct {
+	msgs  [][]byte
+	ready chan struct{}
+	out   chan []byte
+	mu    sync.Mutex
+}
+
+func newInMemoryQueue() *inMemoryQueue {
+	return &inMemoryQueue{
+		ready: make(chan struct{}, 1),
+		out:   make(chan []byte),
+	}
+}
+
+func (q *inMemoryQueue) push(value []byte) {
+	q.mu.Lock()
+	q.msgs = append(q.msgs, value)
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *inMemoryQueue) pop() ([]byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.msgs) == 0 {
+		return nil, false
+	}
+
+	value := q.msgs[0]
+	q.msgs = q.msgs[1:]
+
+	return value, true
+}
+
+// Moves queued msgs to out one by one.
+func (q *inMemoryQueue) deliver(done <-chan struct{}) {
+	for {
+		value, ok := q.pop()
+		if !ok {
+			select {
+			case <-q.ready:
+				continue
+			case <-done:
+				return
+			}
+		}
+
+		select {
+		case q.out <- value:
+		case <-done:
+			return
+		}
+	}
+}
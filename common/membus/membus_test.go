@@ -0,0 +1,134 @@
+package membus
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+const receiveTimeout = time.Second
+
+func receive(t *testing.T, msgs <-chan []byte) string {
+	t.Helper()
+
+	select {
+	case value := <-msgs:
+		return string(value)
+	case <-time.After(receiveTimeout):
+		t.Fatal("msg is not delivered")
+
+		return ""
+	}
+}
+
+func TestEveryGroupGetsMsgsInOrder(t *testing.T) {
+	bus := NewInMemoryBus()
+	defer bus.Close()
+
+	wallet := bus.Subscribe("new_orders", "wallet")
+	storage := bus.Subscribe("new_orders", "storage")
+	other := bus.Subscribe("rejected_orders", "wallet")
+
+	// Nobody reads yet, publish must not block.
+	for i := 1; i <= 3; i++ {
+		bus.Publish("new_orders", []byte(fmt.Sprintf("order:%d", i)))
+	}
+
+	for _, msgs := range []<-chan []byte{wallet, storage} {
+		for i := 1; i <= 3; i++ {
+			if got, want := receive(t, msgs), fmt.Sprintf("order:%d", i); got != want {
+				t.Errorf("expected %s, got %s", want, got)
+			}
+		}
+	}
+
+	select {
+	case value := <-other:
+		t.Error("msg of another topic is delivered", string(value))
+	default:
+	}
+}
+
+func TestMsgsBeforeSubscribeAreNotDelivered(t *testing.T) {
+	bus := NewInMemoryBus()
+	defer bus.Close()
+
+	bus.Publish("new_orders", []byte("early"))
+
+	msgs := bus.Subscribe("new_orders", "wallet")
+
+	bus.Publish("new_orders", []byte("late"))
+
+	if got := receive(t, msgs); got != "late" {
+		t.Error("expected late msg, got", got)
+	}
+}
+
+// Consumers of one group share the channel, each msg is consumed once.
+func TestGroupConsumersCompete(t *testing.T) {
+	bus := NewInMemoryBus()
+	defer bus.Close()
+
+	first := bus.Subscribe("new_orders", "wallet")
+	second := bus.Subscribe("new_orders", "wallet")
+
+	const count = 100
+
+	for i := 0; i < count; i++ {
+		bus.Publish("new_orders", []byte(fmt.Sprintf("order:%d", i)))
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seen = make(map[string]int)
+		done = make(chan struct{})
+	)
+
+	for _, msgs := range []<-chan []byte{first, second} {
+		wg.Add(1)
+
+		go func(msgs <-chan []byte) {
+			defer wg.Done()
+
+			for {
+				select {
+				case value := <-msgs:
+					mu.Lock()
+					seen[string(value)]++
+					mu.Unlock()
+				case <-done:
+					return
+				}
+			}
+		}(msgs)
+	}
+
+	deadline := time.Now().Add(receiveTimeout)
+
+	for {
+		mu.Lock()
+		received := len(seen)
+		mu.Unlock()
+
+		if received == count || time.Now().After(deadline) {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	close(done)
+	wg.Wait()
+
+	if len(seen) != count {
+		t.Fatalf("%d msgs delivered, expected %d", len(seen), count)
+	}
+
+	for value, n := range seen {
+		if n != 1 {
+			t.Errorf("msg %s delivered %d times", value, n)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package money keeps amounts as exact count of cents.
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Count of minor units (cents) in one major unit.
+const scale = 100
+
+var ErrInvalid = errors.New("invalid money value")
+
+// Exact amount of money in minor units (cents).
+// Encoded as decimal string "12.34" in JSON and Postgres numeric.
+type Money int64
+
+// Parses decimal string, fraction beyond cents is rounded half away from zero.
+func Parse(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	parts := strings.SplitN(s, ".", 2)
+	intPart, fracPart := parts[0], ""
+
+	if len(parts) == 2 {
+		fracPart = parts[1]
+	}
+
+	if intPart == "" && fracPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+
+	if intPart == "" {
+		intPart = "0"
+	}
+
+	units, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+
+	fracPart += "000"
+
+	cents, err := strconv.ParseInt(fracPart[:2], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+
+	if fracPart[2] >= '5' {
+		cents++
+	}
+
+	m := Money(units*scale + cents)
+	if negative {
+		m = -m
+	}
+
+	return m, nil
+}
+
+func isDigits(s string) bool {
+	return strings.Trim(s, "0123456789") == ""
+}
+
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+		m = -m
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, m/scale, m%scale)
+}
+
+// Amount for count of items priced m.
+func (m Money) Mul(count uint) Money {
+	return m * Money(count)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// Accepts decimal string and JSON number,
+// number is kept for msgs produced before money became string.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n json.Number
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalid, data)
+		}
+
+		s = n.String()
+	}
+
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+
+	return nil
+}
+
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		parsed, err := Parse(v)
+		*m = parsed
+
+		return err
+	case []byte:
+		parsed, err := Parse(string(v))
+		*m = parsed
+
+		return err
+	case int64:
+		*m = Money(v * scale)
+
+		return nil
+	case float64:
+		parsed, err := Parse(strconv.FormatFloat(v, 'f', -1, 64))
+		*m = parsed
+
+		return err
+	default:
+		return fmt.Errorf("%w: can't scan %T", ErrInvalid, src)
+	}
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
@@ -0,0 +1,116 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: "12.34", want: 1234},
+		{in: "12", want: 1200},
+		{in: "0.5", want: 50},
+		{in: ".99", want: 99},
+		{in: "-1.01", want: -101},
+		{in: "1.005", want: 101},
+		{in: "1.004", want: 100},
+		{in: "", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+		{in: "--1", wantErr: true},
+		{in: "1e2", wantErr: true},
+	}
+
+	for _, c := range cases {
+		got, err := Parse(c.in)
+		if c.wantErr {
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("%q: expected invalid money err, got %v", c.in, err)
+			}
+
+			continue
+		}
+
+		if err != nil || got != c.want {
+			t.Errorf("%q: expected %d, got %d, err %v", c.in, c.want, got, err)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(Money(1205))
+	if err != nil || string(data) != `"12.05"` {
+		t.Errorf("unexpected money json %s, err %v", data, err)
+	}
+
+	var fromString, fromNumber Money
+
+	if err := json.Unmarshal([]byte(`"0.10"`), &fromString); err != nil || fromString != 10 {
+		t.Errorf("unexpected money from string %d, err %v", fromString, err)
+	}
+
+	if err := json.Unmarshal([]byte(`2.5`), &fromNumber); err != nil || fromNumber != 250 {
+		t.Errorf("unexpected money from number %d, err %v", fromNumber, err)
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	cases := map[Money]string{
+		0:     "0.00",
+		5:     "0.05",
+		1205:  "12.05",
+		-101:  "-1.01",
+		-5:    "-0.05",
+		12300: "123.00",
+	}
+
+	for m, want := range cases {
+		if got := m.String(); got != want {
+			t.Errorf("%d: expected %q, got %q", int64(m), want, got)
+		}
+	}
+
+	if got := Money(250).Mul(3); got != 750 {
+		t.Errorf("unexpected amount %s", got)
+	}
+}
+
+// Numeric columns are scanned as text, old decimal ones may come as numbers.
+func TestMoneyScan(t *testing.T) {
+	cases := []struct {
+		src  interface{}
+		want Money
+	}{
+		{src: "12.34", want: 1234},
+		{src: []byte("0.10"), want: 10},
+		{src: int64(3), want: 300},
+		{src: 2.5, want: 250},
+	}
+
+	for _, c := range cases {
+		var m Money
+
+		if err := m.Scan(c.src); err != nil || m != c.want {
+			t.Errorf("%v: expected %d, got %d, err %v", c.src, c.want, m, err)
+		}
+	}
+
+	var m Money
+
+	if err := m.Scan(nil); !errors.Is(err, ErrInvalid) {
+		t.Error("expected invalid money err for nil, got", err)
+	}
+
+	if err := m.Scan("abc"); !errors.Is(err, ErrInvalid) {
+		t.Error("expected invalid money err for text, got", err)
+	}
+
+	value, err := Money(1205).Value()
+	if err != nil || value != "12.05" {
+		t.Errorf("unexpected money value %v, err %v", value, err)
+	}
+}
@@ -0,0 +1,226 @@
+// Package pg connects services to Postgres and migrates their databases.
+package pg
+
+import (
+	"context"
+	"errors"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const connectTimeout = 10 * time.Second
+
+var ErrUnknownPool = errors.New("pool is not opened by pg.Connect")
+
+// Common part of pgxpool.Pool and pgx.Tx, lets queries run in or out of transaction.
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// Prepared statements live in a connection, so every connection of the pool
+// has to prepare all statements of the service before it is used.
+type statements struct {
+	mu      sync.RWMutex
+	queries map[string]string
+}
+
+func (s *statements) add(queries map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, sql := range queries {
+		s.queries[name] = sql
+	}
+}
+
+func (s *statements) prepareAll(ctx context.Context, conn *pgx.Conn) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return prepare(ctx, conn, s.queries)
+}
+
+// Preparing statement again with the same sql is no-op.
+func prepare(ctx context.Context, conn *pgx.Conn, queries map[string]string) error {
+	for name, sql := range queries {
+		if _, err := conn.Prepare(ctx, name, sql); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var (
+	poolsMu        sync.Mutex
+	poolStatements = make(map[*pgxpool.Pool]*statements)
+)
+
+// Opens pool and checks connection, statements passed to Prepare
+// are prepared on every new connection of the pool.
+func Connect(ctx context.Context, databaseURI string) (*pgxpool.Pool, error) {
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+
+	config, err := pgxpool.ParseConfig(databaseURI)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &statements{queries: make(map[string]string)}
+	config.AfterConnect = s.prepareAll
+
+	pool, err := pgxpool.ConnectConfig(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+
+		return nil, err
+	}
+
+	poolsMu.Lock()
+	poolStatements[pool] = s
+	poolsMu.Unlock()
+
+	return pool, nil
+}
+
+// Registers statements for new connections of the pool and prepares them on the idle ones.
+// Should be called before the pool is used, connections acquired meanwhile miss the statements.
+func Prepare(ctx context.Context, pool *pgxpool.Pool, queries map[string]string) error {
+	poolsMu.Lock()
+	s, exists := poolStatements[pool]
+	poolsMu.Unlock()
+
+	if !exists {
+		return ErrUnknownPool
+	}
+
+	s.add(queries)
+
+	var prepareErr error
+
+	for _, conn := range pool.AcquireAllIdle(ctx) {
+		if prepareErr == nil {
+			prepareErr = prepare(ctx, conn.Conn(), queries)
+		}
+
+		conn.Release()
+	}
+
+	return prepareErr
+}
+
+type openKey struct {
+	databaseURI   string
+	migrationsDir string
+}
+
+// Pool opened by Open with the count of its users, it is closed when the last one releases it.
+type openPool struct {
+	key  openKey
+	pool *pgxpool.Pool
+	refs int
+}
+
+var (
+	openMu    sync.Mutex
+	openPools = make(map[openKey]*openPool)
+	openKeys  = make(map[*pgxpool.Pool]*openPool)
+)
+
+// Pool shared by all DAOs of the service: it is opened and migrated with .sql files
+// of migrationsDir on the first call, later calls return the same pool.
+// Every call should be paired with Release.
+func Open(ctx context.Context, databaseURI, migrationsDir string) (*pgxpool.Pool, error) {
+	dir, err := filepath.Abs(migrationsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	openMu.Lock()
+	defer openMu.Unlock()
+
+	key := openKey{databaseURI: databaseURI, migrationsDir: dir}
+
+	if opened, exists := openPools[key]; exists {
+		opened.refs++
+
+		return opened.pool, nil
+	}
+
+	pool, err := Connect(ctx, databaseURI)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Migrate(ctx, pool, dir); err != nil {
+		pool.Close()
+
+		return nil, err
+	}
+
+	opened := &openPool{key: key, pool: pool, refs: 1}
+	openPools[key] = opened
+	openKeys[pool] = opened
+
+	log.Println("Connection to DB success")
+
+	return pool, nil
+}
+
+// Closes pool once all its users opened by Open release it, so the next Open connects again.
+// Pool not opened by Open is closed right away.
+func Release(pool *pgxpool.Pool) {
+	openMu.Lock()
+	defer openMu.Unlock()
+
+	opened, exists := openKeys[pool]
+	if !exists {
+		pool.Close()
+
+		return
+	}
+
+	opened.refs--
+	if opened.refs > 0 {
+		return
+	}
+
+	delete(openPools, opened.key)
+	delete(openKeys, pool)
+
+	poolsMu.Lock()
+	delete(poolStatements, pool)
+	poolsMu.Unlock()
+
+	pool.Close()
+}
+
+// Open for DAO constructors, service can't start without its database.
+func MustOpen(ctx context.Context, databaseURI, migrationsDir string) *pgxpool.Pool {
+	pool, err := Open(ctx, databaseURI, migrationsDir)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return pool
+}
+
+// Prepare for DAO constructors, statements which can't be prepared are a bug.
+func MustPrepare(ctx context.Context, pool *pgxpool.Pool, queries map[string]string) {
+	if err := Prepare(ctx, pool, queries); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,121 @@
+package pg
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func createMigrationsTable(ctx context.Context, conn *pgxpool.Pool) error {
+	createQuery := `CREATE TABLE IF NOT EXISTS migrations (
+		id SERIAL PRIMARY KEY,
+		name varchar(255) NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`
+
+	_, err := conn.Exec(ctx, createQuery)
+
+	return err
+}
+
+func getAppliedMigrations(ctx context.Context, conn *pgxpool.Pool) (map[string]struct{}, error) {
+	selectQuery := `SELECT name FROM migrations;`
+
+	rows, err := conn.Query(ctx, selectQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[string]struct{})
+
+	for rows.Next() {
+		var name string
+
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+
+		names[name] = struct{}{}
+	}
+
+	return names, rows.Err()
+}
+
+// Migration and its record are applied in one transaction.
+func applyMigration(ctx context.Context, migrationName, query string, conn *pgxpool.Pool) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if _, err := tx.Exec(ctx, query); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `INSERT INTO migrations(name) VALUES ($1::varchar);`, migrationName); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Applies .sql files of dir not applied yet, in order of their names.
+func Migrate(ctx context.Context, conn *pgxpool.Pool, dir string) error {
+	return MigrateFS(ctx, conn, os.DirFS(dir), "")
+}
+
+// Applies .sql files of fsys not applied yet, in order of their names. Migrations are
+// recorded with names prefixed, so packages which own tables, e.g. deadletter, don't clash with services.
+func MigrateFS(ctx context.Context, conn *pgxpool.Pool, fsys fs.FS, prefix string) error {
+	err := createMigrationsTable(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	appliedMigrations, err := getAppliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Applied migrations: %v\n", appliedMigrations)
+
+	// Sorted by name.
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		filename := f.Name()
+		extension := path.Ext(filename)
+
+		if extension != ".sql" {
+			continue
+		}
+
+		migrationName := prefix + strings.TrimSuffix(filename, extension)
+
+		if _, ok := appliedMigrations[migrationName]; ok {
+			continue
+		}
+
+		file, err := fs.ReadFile(fsys, filename)
+		if err != nil {
+			return err
+		}
+
+		if err := applyMigration(ctx, migrationName, string(file), conn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Seconds given to all checks when request has no timeout param.
+const defaultHealthTimeout = 15
+
+// Dependency of the service reported by health handler under its name,
+// DAOs and broker clients provide Check with their HealthCheck method.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Responds with "ok" or check error for every dependency,
+// checks are run one by one within timeout query param seconds.
+func HealthHandler(checks ...HealthCheck) http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		timeout := defaultHealthTimeout
+
+		timeoutStr := r.FormValue("timeout")
+
+		t, err := strconv.Atoi(timeoutStr)
+		if timeoutStr != "" && err == nil {
+			timeout = t
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Duration(timeout)*time.Second)
+		defer cancel()
+
+		response := make(map[string]string, len(checks))
+
+		for _, v := range checks {
+			response[v.Name] = "ok"
+
+			if err := v.Check(ctx); err != nil {
+				response[v.Name] = err.Error()
+			}
+		}
+
+		JSONResponse(w, response, http.StatusOK)
+	}
+
+	return http.HandlerFunc(handler)
+}
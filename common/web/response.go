@@ -0,0 +1,23 @@
+// Package web holds HTTP scaffolding shared by services: server run loop,
+// JSON responses and health handler.
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func JSONResponse(w http.ResponseWriter, msg interface{}, code int) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	w.WriteHeader(code)
+	_, _ = w.Write(append(body, '\n'))
+}
@@ -0,0 +1,34 @@
+package web
+
+import (
+	"common/log"
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Server with requests logged by logger.
+func NewServer(addr string, router http.Handler, logger *logrus.Entry) *http.Server {
+	return &http.Server{
+		Addr:    addr,
+		Handler: log.LoggingMiddleware(logger)(router),
+	}
+}
+
+// Serves until server is closed, background workers run meanwhile
+// and are stopped and waited for before return.
+func Serve(ctx context.Context, server *http.Server, runWorkers func(ctx context.Context, wg *sync.WaitGroup)) error {
+	ctx, cancel := context.WithCancel(ctx)
+
+	wg := sync.WaitGroup{}
+	runWorkers(ctx, &wg)
+
+	err := server.ListenAndServe()
+
+	cancel()
+	wg.Wait()
+
+	return err
+}
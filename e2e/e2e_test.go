@@ -0,0 +1,453 @@
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Order statuses and rejection reasons, same values as in registry models.
+const (
+	statusCanceled  = 3
+	statusCompleted = 4
+	statusRejected  = 5
+
+	reasonNotEnoughMoney = 1
+	reasonOutOfStock     = 2
+
+	transactionHold = 3
+)
+
+// How long sagas are waited for to finish.
+const waitTimeout = 10 * time.Second
+
+type orderItem struct {
+	ProductID uint  `json:"product_id"`
+	Count     uint8 `json:"count"`
+}
+
+type order struct {
+	ID             uint        `json:"id"`
+	UserID         uint        `json:"user_id"`
+	Status         int         `json:"status"`
+	RejectedReason int         `json:"rejected_reason"`
+	OrderItems     []orderItem `json:"order_items"`
+	Total          string      `json:"total"`
+	Compensation   *struct {
+		Wallet    bool `json:"wallet"`
+		Storage   bool `json:"storage"`
+		Completed bool `json:"completed"`
+	} `json:"compensation"`
+}
+
+type walletState struct {
+	Balance   string `json:"balance"`
+	Held      string `json:"held"`
+	Available string `json:"available"`
+}
+
+type deadLetter struct {
+	ID       uint   `json:"id"`
+	Topic    string `json:"topic"`
+	Error    string `json:"error"`
+	Attempts int    `json:"attempts"`
+}
+
+type transaction struct {
+	OrderID uint `json:"order_id"`
+	Type    int  `json:"type"`
+}
+
+type storageItem struct {
+	WarehouseID uint `json:"warehouse_id"`
+	ProductID   uint `json:"product_id"`
+	Count       uint `json:"count"`
+}
+
+func newHarness(t *testing.T, opts Options) *Harness {
+	t.Helper()
+
+	h, err := NewHarness(context.Background(), opts)
+	if err != nil {
+		t.Fatal("start services error", err)
+	}
+
+	t.Cleanup(h.Close)
+
+	return h
+}
+
+// Polls check until it returns nil or waitTimeout passes, then fails with the last error.
+func eventually(t *testing.T, check func() error) {
+	t.Helper()
+
+	deadline := time.Now().Add(waitTimeout)
+
+	for {
+		err := check()
+		if err == nil {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func cancelOrder(t *testing.T, h *Harness, orderID uint) {
+	t.Helper()
+
+	path := fmt.Sprintf("/orders/%d/cancel", orderID)
+
+	status, err := h.Do(context.Background(), h.Registry, http.MethodPost, path, nil, nil)
+	if err != nil || status != http.StatusOK {
+		t.Fatal("cancel order failed", status, err)
+	}
+}
+
+func makeOrder(t *testing.T, h *Harness, userID uint, items ...orderItem) *order {
+	t.Helper()
+
+	body := map[string]interface{}{
+		"user_id":     userID,
+		"order_items": items,
+	}
+
+	var created order
+
+	status, err := h.Do(context.Background(), h.Registry, http.MethodPost, "/orders", body, &created)
+	if err != nil || status != http.StatusCreated {
+		t.Fatal("create order failed", status, err)
+	}
+
+	return &created
+}
+
+func waitOrderStatus(t *testing.T, h *Harness, orderID uint, status int) *order {
+	t.Helper()
+
+	var got order
+
+	eventually(t, func() error {
+		code, err := h.Do(context.Background(), h.Registry, http.MethodGet, fmt.Sprintf("/orders/%d", orderID), nil, &got)
+		if err != nil || code != http.StatusOK {
+			return fmt.Errorf("get order %d failed: %d %v", orderID, code, err)
+		}
+
+		if got.Status != status {
+			return fmt.Errorf("order %d status is %d, expected %d", orderID, got.Status, status)
+		}
+
+		return nil
+	})
+
+	return &got
+}
+
+// Waits until wallet and storage acknowledge compensation of rejected or canceled order.
+func waitOrderCompensated(t *testing.T, h *Harness, orderID uint) {
+	t.Helper()
+
+	eventually(t, func() error {
+		var got order
+
+		code, err := h.Do(context.Background(), h.Registry, http.MethodGet, fmt.Sprintf("/orders/%d", orderID), nil, &got)
+		if err != nil || code != http.StatusOK {
+			return fmt.Errorf("get order %d failed: %d %v", orderID, code, err)
+		}
+
+		if got.Compensation == nil || !got.Compensation.Completed {
+			return fmt.Errorf("order %d compensation is not completed: %+v", orderID, got.Compensation)
+		}
+
+		return nil
+	})
+}
+
+func waitWallet(t *testing.T, h *Harness, userID uint, balance string, held string) {
+	t.Helper()
+
+	eventually(t, func() error {
+		var got walletState
+
+		code, err := h.Do(context.Background(), h.Wallet, http.MethodGet, fmt.Sprintf("/wallets/%d", userID), nil, &got)
+		if err != nil || code != http.StatusOK {
+			return fmt.Errorf("get wallet of user %d failed: %d %v", userID, code, err)
+		}
+
+		if got.Balance != balance || got.Held != held {
+			return fmt.Errorf("wallet of user %d is %+v, expected balance %s held %s", userID, got, balance, held)
+		}
+
+		return nil
+	})
+}
+
+// Stock of the product summed over warehouses.
+func waitStock(t *testing.T, h *Harness, productID uint, count uint) {
+	t.Helper()
+
+	eventually(t, func() error {
+		var items []storageItem
+
+		code, err := h.Do(context.Background(), h.Storage, http.MethodGet, fmt.Sprintf("/stock?product_ids=%d", productID), nil, &items)
+		if err != nil || code != http.StatusOK {
+			return fmt.Errorf("get stock of product %d failed: %d %v", productID, code, err)
+		}
+
+		var total uint
+		for _, v := range items {
+			total += v.Count
+		}
+
+		if total != count {
+			return fmt.Errorf("stock of product %d is %d, expected %d", productID, total, count)
+		}
+
+		return nil
+	})
+}
+
+func TestOrderCompleted(t *testing.T) {
+	h := newHarness(t, Options{})
+
+	created := makeOrder(t, h, 1, orderItem{ProductID: 1, Count: 2})
+
+	if created.Total != "2.00" {
+		t.Error("unexpected order total", created.Total)
+	}
+
+	waitOrderStatus(t, h, created.ID, statusCompleted)
+	waitWallet(t, h, 1, "98.00", "0.00")
+	waitStock(t, h, 1, 8)
+}
+
+func TestOrderRejectedNotEnoughMoney(t *testing.T) {
+	h := newHarness(t, Options{})
+
+	restock := map[string]interface{}{
+		"reason": "e2e",
+		"items": []map[string]interface{}{
+			{"warehouse_id": 1, "product_id": 3, "delta": 100},
+		},
+	}
+
+	status, err := h.Do(context.Background(), h.Storage, http.MethodPost, "/stock/restock", restock, nil)
+	if err != nil || status != http.StatusCreated {
+		t.Fatal("restock failed", status, err)
+	}
+
+	created := makeOrder(t, h, 2, orderItem{ProductID: 3, Count: 50})
+
+	rejected := waitOrderStatus(t, h, created.ID, statusRejected)
+	if rejected.RejectedReason != reasonNotEnoughMoney {
+		t.Error("unexpected rejected reason", rejected.RejectedReason)
+	}
+
+	waitWallet(t, h, 2, "100.00", "0.00")
+	waitStock(t, h, 3, 110)
+}
+
+func TestOrderRejectedOutOfStock(t *testing.T) {
+	h := newHarness(t, Options{})
+
+	created := makeOrder(t, h, 1, orderItem{ProductID: 2, Count: 11})
+
+	rejected := waitOrderStatus(t, h, created.ID, statusRejected)
+	if rejected.RejectedReason != reasonOutOfStock {
+		t.Error("unexpected rejected reason", rejected.RejectedReason)
+	}
+
+	waitWallet(t, h, 1, "100.00", "0.00")
+	waitStock(t, h, 2, 10)
+}
+
+// Adjustment below zero is refused with 409 and changes nothing, restocked items can be ordered.
+func TestStockAdjustmentConflict(t *testing.T) {
+	h := newHarness(t, Options{})
+
+	movement := func(path string, items ...map[string]interface{}) int {
+		body := map[string]interface{}{
+			"reason": "inventory",
+			"items":  items,
+		}
+
+		status, err := h.Do(context.Background(), h.Storage, http.MethodPost, path, body, nil)
+		if err != nil {
+			t.Fatal("stock movement failed", path, err)
+		}
+
+		return status
+	}
+
+	status := movement(
+		"/stock/adjustments",
+		map[string]interface{}{"product_id": 1, "delta": -3},
+		map[string]interface{}{"product_id": 2, "delta": -11},
+	)
+	if status != http.StatusConflict {
+		t.Error("expected adjustment conflict, got", status)
+	}
+
+	if status := movement("/stock/restock", map[string]interface{}{"product_id": 1, "delta": 0}); status != http.StatusBadRequest {
+		t.Error("expected bad restock request, got", status)
+	}
+
+	waitStock(t, h, 1, 10)
+	waitStock(t, h, 2, 10)
+
+	if status := movement("/stock/restock", map[string]interface{}{"product_id": 1, "delta": 5}); status != http.StatusCreated {
+		t.Fatal("restock failed", status)
+	}
+
+	created := makeOrder(t, h, 1, orderItem{ProductID: 1, Count: 12})
+
+	waitOrderStatus(t, h, created.ID, statusCompleted)
+	waitStock(t, h, 1, 3)
+}
+
+func TestOrderCanceled(t *testing.T) {
+	h := newHarness(t, Options{})
+
+	created := makeOrder(t, h, 3, orderItem{ProductID: 1, Count: 3})
+
+	waitOrderStatus(t, h, created.ID, statusCompleted)
+	waitWallet(t, h, 3, "97.00", "0.00")
+	waitStock(t, h, 1, 7)
+
+	cancelOrder(t, h, created.ID)
+
+	waitOrderStatus(t, h, created.ID, statusCanceled)
+	waitOrderCompensated(t, h, created.ID)
+	waitWallet(t, h, 3, "100.00", "0.00")
+	waitStock(t, h, 1, 10)
+}
+
+// Rejection of the order is consumed before its new order msg,
+// wallet and storage skip the late msg instead of holding money and reserving items.
+func TestNewOrderMsgAfterRejection(t *testing.T) {
+	h := newHarness(t, Options{})
+
+	paid := makeOrder(t, h, 1, orderItem{ProductID: 1, Count: 1})
+
+	waitOrderStatus(t, h, paid.ID, statusCompleted)
+	waitWallet(t, h, 1, "99.00", "0.00")
+	waitStock(t, h, 1, 9)
+
+	h.Bus.Pause("new_orders")
+
+	late := makeOrder(t, h, 1, orderItem{ProductID: 1, Count: 2})
+	cancelOrder(t, h, late.ID)
+	waitOrderStatus(t, h, late.ID, statusCanceled)
+
+	// Rejected msgs are consumed in order, refund of the order canceled next
+	// shows that rejection of the late order is handled.
+	cancelOrder(t, h, paid.ID)
+	waitWallet(t, h, 1, "100.00", "0.00")
+	waitStock(t, h, 1, 10)
+
+	h.Bus.Resume("new_orders")
+
+	// New order msgs are consumed in order too, the next order completes after the late msg is handled.
+	next := makeOrder(t, h, 1, orderItem{ProductID: 1, Count: 3})
+
+	waitOrderStatus(t, h, next.ID, statusCompleted)
+	waitWallet(t, h, 1, "97.00", "0.00")
+	waitStock(t, h, 1, 7)
+
+	var holds []transaction
+
+	path := fmt.Sprintf("/wallets/1/transactions?type=%d", transactionHold)
+
+	status, err := h.Do(context.Background(), h.Wallet, http.MethodGet, path, nil, &holds)
+	if err != nil || status != http.StatusOK {
+		t.Fatal("get wallet transactions failed", status, err)
+	}
+
+	for _, v := range holds {
+		if v.OrderID == late.ID {
+			t.Error("money is held for the rejected order", late.ID)
+		}
+	}
+}
+
+// Wallet can't hold money of the user without wallet, so new order msg is dead-lettered
+// and fails again after replay. Order is rejected by saga timeout, then storage releases its reservation.
+func TestNewOrderMsgDeadLettered(t *testing.T) {
+	h := newHarness(t, Options{SagaTimeout: 2})
+
+	created := makeOrder(t, h, 4, orderItem{ProductID: 1, Count: 1})
+
+	waitOrderStatus(t, h, created.ID, statusRejected)
+
+	newOrderLetters := func() ([]deadLetter, error) {
+		var letters []deadLetter
+
+		code, err := h.Do(context.Background(), h.Wallet, http.MethodGet, "/admin/dead-letters", nil, &letters)
+		if err != nil || code != http.StatusOK {
+			return nil, fmt.Errorf("get dead letters failed: %d %v", code, err)
+		}
+
+		found := make([]deadLetter, 0, len(letters))
+		for _, v := range letters {
+			if v.Topic == "new_orders" {
+				found = append(found, v)
+			}
+		}
+
+		return found, nil
+	}
+
+	var letter deadLetter
+
+	eventually(t, func() error {
+		letters, err := newOrderLetters()
+		if err != nil {
+			return err
+		}
+
+		if len(letters) != 1 {
+			return fmt.Errorf("%d new order msgs are dead-lettered, expected 1", len(letters))
+		}
+
+		letter = letters[0]
+
+		return nil
+	})
+
+	if letter.Attempts != retryAttempts || letter.Error == "" {
+		t.Errorf("unexpected dead letter %+v", letter)
+	}
+
+	path := fmt.Sprintf("/admin/dead-letters/%d/replay", letter.ID)
+
+	status, err := h.Do(context.Background(), h.Wallet, http.MethodPost, path, nil, nil)
+	if err != nil || status != http.StatusOK {
+		t.Fatal("replay dead letter failed", status, err)
+	}
+
+	status, err = h.Do(context.Background(), h.Wallet, http.MethodPost, path, nil, nil)
+	if err != nil || status != http.StatusConflict {
+		t.Error("second replay of dead letter is not rejected", status, err)
+	}
+
+	eventually(t, func() error {
+		letters, err := newOrderLetters()
+		if err != nil {
+			return err
+		}
+
+		if len(letters) != 2 {
+			return fmt.Errorf("%d new order msgs are dead-lettered, expected 2 after replay", len(letters))
+		}
+
+		return nil
+	})
+
+	waitStock(t, h, 1, 10)
+}
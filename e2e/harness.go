@@ -0,0 +1,219 @@
+// Package e2e runs registry, wallet and storage in one process on a shared in-memory bus
+// and drives them through their HTTP APIs.
+package e2e
+
+import (
+	"bytes"
+	"common/membus"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	registry "registry_service/pkg/bootstrap"
+	storage "storage_service/pkg/bootstrap"
+	wallet "wallet_service/pkg/bootstrap"
+)
+
+// Milliseconds between broker polls and outbox relay runs,
+// much shorter than in deployment so sagas finish fast.
+const loopTick = 20
+
+// Failed msgs are retried a few times with short backoff (ms),
+// so they are dead-lettered within the test wait.
+const (
+	retryAttempts = 3
+	retryBackoff  = 10
+)
+
+// Configs are read from the services dirs.
+const (
+	registryConfigPath = "../registry/config.yaml"
+	walletConfigPath   = "../wallet/config.yaml"
+	storageConfigPath  = "../storage/config.yaml"
+)
+
+// Per-test changes of the services configs, zero values keep the values from config files.
+type Options struct {
+	// Seconds before unfinished sagas are rejected, stuck orders are swept every second then.
+	SagaTimeout uint16
+}
+
+type Harness struct {
+	Registry *httptest.Server
+	Wallet   *httptest.Server
+	Storage  *httptest.Server
+	Bus      *Bus
+
+	closers []func()
+}
+
+// Starts services with fresh in-memory data, Close should be called when done.
+func NewHarness(ctx context.Context, opts Options) (*Harness, error) {
+	registryConfig, err := registry.LoadConfig(registryConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	walletConfig, err := wallet.LoadConfig(walletConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	storageConfig, err := storage.LoadConfig(storageConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	registryConfig.Kafka.ConsumeLoopTick = loopTick
+	registryConfig.Outbox.RelayInterval = loopTick
+	walletConfig.Kafka.ConsumeLoopTick = loopTick
+	storageConfig.Kafka.ConsumeLoopTick = loopTick
+
+	if opts.SagaTimeout != 0 {
+		registryConfig.Saga.Timeout = opts.SagaTimeout
+		registryConfig.Saga.SweepInterval = 1
+	}
+
+	registryConfig.Retry.Attempts = retryAttempts
+	registryConfig.Retry.InitialBackoff = retryBackoff
+	walletConfig.Retry.Attempts = retryAttempts
+	walletConfig.Retry.InitialBackoff = retryBackoff
+	storageConfig.Retry.Attempts = retryAttempts
+	storageConfig.Retry.InitialBackoff = retryBackoff
+
+	bus := NewBus(membus.NewInMemoryBus())
+
+	registryService := registry.Start(ctx, registryConfig, bus)
+	walletService := wallet.Start(ctx, walletConfig, bus)
+	storageService := storage.Start(ctx, storageConfig, bus)
+
+	h := &Harness{
+		Registry: httptest.NewServer(registryService.Handler()),
+		Wallet:   httptest.NewServer(walletService.Handler()),
+		Storage:  httptest.NewServer(storageService.Handler()),
+		Bus:      bus,
+	}
+
+	h.closers = []func(){
+		h.Registry.Close,
+		h.Wallet.Close,
+		h.Storage.Close,
+		registryService.Close,
+		walletService.Close,
+		storageService.Close,
+		bus.Close,
+	}
+
+	return h, nil
+}
+
+func (h *Harness) Close() {
+	for _, closeFunc := range h.closers {
+		closeFunc()
+	}
+}
+
+// Services bus, delivery of a topic can be paused to make its msgs arrive
+// after msgs of other topics published later.
+type Bus struct {
+	bus    *membus.InMemoryBus
+	paused map[string][][]byte // msgs held for paused topics
+	mu     sync.Mutex
+}
+
+func NewBus(bus *membus.InMemoryBus) *Bus {
+	return &Bus{
+		bus:    bus,
+		paused: make(map[string][][]byte),
+	}
+}
+
+func (b *Bus) Subscribe(topic, group string) <-chan []byte {
+	return b.bus.Subscribe(topic, group)
+}
+
+func (b *Bus) Publish(topic string, value []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if held, paused := b.paused[topic]; paused {
+		b.paused[topic] = append(held, value)
+
+		return
+	}
+
+	b.bus.Publish(topic, value)
+}
+
+// Msgs of the topic are held until Resume.
+func (b *Bus) Pause(topic string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, paused := b.paused[topic]; !paused {
+		b.paused[topic] = nil
+	}
+}
+
+// Publishes msgs held for the topic in the order they were published.
+func (b *Bus) Resume(topic string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, value := range b.paused[topic] {
+		b.bus.Publish(topic, value)
+	}
+
+	delete(b.paused, topic)
+}
+
+func (b *Bus) Close() {
+	b.bus.Close()
+}
+
+// Sends body as JSON and decodes JSON response into out if it is not nil.
+// Returns response status code.
+func (h *Harness) Do(
+	ctx context.Context,
+	server *httptest.Server,
+	method string,
+	path string,
+	body interface{},
+	out interface{},
+) (int, error) {
+	var reqBody io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, server.URL+path, reqBody)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return resp.StatusCode, nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp.StatusCode, fmt.Errorf("decode %s %s response: %w", method, path, err)
+	}
+
+	return resp.StatusCode, nil
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	_ "registry_service/docs"
 	"registry_service/internal/app/api"
 	"syscall"
 
@@ -1,14 +1,17 @@
 package api
 
 import (
-	"context"
+	"common/deadletter"
+	"common/web"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	in "registry_service/internal/app/interfaces"
+	"registry_service/internal/app/saga"
 	"strconv"
-	"time"
 
+	"github.com/gorilla/mux"
 	"gopkg.in/validator.v2"
 )
 
@@ -28,8 +31,9 @@ import (
 // @Description Create order entrypoint
 // @Produce json
 // @Tags	orders
-// @Success 200 {object} CreateOrderResponse
+// @Success 201 {object} OrderResponse
 // @Failure 400 {object} ErrResponseMsg
+// @Failure 422 {object} UnknownProductsResponse
 // @Failure 500 {string} error
 // @Param order body CreateOrderRequest true "order data"
 // @Router /orders [POST]
@@ -40,12 +44,12 @@ func (s *Server) CreateOrder() http.Handler {
 			switch {
 			case err == io.EOF:
 				msg := ErrResponseMsg{Message: "Empty body"}
-				JSONResponse(w, msg, http.StatusBadRequest)
+				web.JSONResponse(w, msg, http.StatusBadRequest)
 
 				return
 			case err != nil:
 				msg := ErrResponseMsg{Message: err.Error()}
-				JSONResponse(w, msg, http.StatusBadRequest)
+				web.JSONResponse(w, msg, http.StatusBadRequest)
 
 				return
 			}
@@ -53,7 +57,7 @@ func (s *Server) CreateOrder() http.Handler {
 
 		if errs := validator.Validate(orderData); errs != nil {
 			msg := ErrResponseMsg{Message: "Empty body"}
-			JSONResponse(w, msg, http.StatusBadRequest)
+			web.JSONResponse(w, msg, http.StatusBadRequest)
 
 			return
 		}
@@ -71,16 +75,200 @@ func (s *Server) CreateOrder() http.Handler {
 			OrderItems: orderItems,
 		}
 
-		err := s.App.OrdersService.MakeOrder(r.Context(), makeOrderData)
+		order, err := s.App.OrdersService.MakeOrder(r.Context(), makeOrderData)
+
+		var unknownProductsErr *in.UnknownProductsError
+		if errors.As(err, &unknownProductsErr) {
+			msg := UnknownProductsResponse{
+				Message:    in.ErrProductNotFound.Error(),
+				ProductIDs: unknownProductsErr.ProductIDs,
+			}
+			web.JSONResponse(w, msg, http.StatusUnprocessableEntity)
+
+			return
+		}
+
 		if err != nil {
-			JSONResponse(w, err.Error(), http.StatusBadRequest)
+			web.JSONResponse(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		web.JSONResponse(w, newOrderResponse(order), http.StatusCreated)
+	}
+
+	return http.HandlerFunc(handler)
+}
+
+// @Summary Get order
+// @Description Get order with its items by id
+// @Produce json
+// @Tags	orders
+// @Success 200 {object} OrderResponse
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 404 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Param id path int true "order id"
+// @Router /orders/{id} [GET]
+func (s *Server) GetOrder() http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil || orderID <= 0 {
+			msg := ErrResponseMsg{Message: "order id is not correct"}
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
+		}
+
+		order, err := s.App.OrdersService.GetOrder(r.Context(), uint(orderID))
+
+		switch {
+		case errors.Is(err, in.ErrOrderNotFound):
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusNotFound)
+
+			return
+		case err != nil:
+			web.JSONResponse(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		web.JSONResponse(w, newOrderResponse(order), http.StatusOK)
+	}
+
+	return http.HandlerFunc(handler)
+}
+
+// @Summary Cancel order
+// @Description Cancel order by user, payment is refunded and items are returned to storage.
+// @Description Compensation of the order shows which of them are acknowledged, get the order to follow it.
+// @Produce json
+// @Tags	orders
+// @Success 200 {object} OrderResponse
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 404 {object} ErrResponseMsg
+// @Failure 409 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Param id path int true "order id"
+// @Router /orders/{id}/cancel [POST]
+func (s *Server) CancelOrder() http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil || orderID <= 0 {
+			msg := ErrResponseMsg{Message: "order id is not correct"}
+			web.JSONResponse(w, msg, http.StatusBadRequest)
 
 			return
 		}
 
-		response := CreateOrderResponse{Status: "order request accepted"}
+		order, err := s.App.OrdersService.CancelOrder(r.Context(), uint(orderID))
+
+		switch {
+		case errors.Is(err, in.ErrOrderNotFound):
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusNotFound)
 
-		JSONResponse(w, response, http.StatusOK)
+			return
+		case errors.Is(err, in.ErrCancelWindowExpired),
+			errors.Is(err, in.ErrOrderHasReturns),
+			errors.Is(err, saga.ErrIllegalTransition),
+			errors.Is(err, in.ErrOrderStatusConflict):
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusConflict)
+
+			return
+		case err != nil:
+			web.JSONResponse(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		web.JSONResponse(w, newOrderResponse(order), http.StatusOK)
+	}
+
+	return http.HandlerFunc(handler)
+}
+
+// @Summary Return order items
+// @Description Return items of completed order, their value is refunded and items are restocked
+// @Produce json
+// @Tags	orders
+// @Success 201 {object} OrderReturnResponse
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 404 {object} ErrResponseMsg
+// @Failure 409 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Param id path int true "order id"
+// @Param return body CreateReturnRequest true "returned items"
+// @Router /orders/{id}/returns [POST]
+func (s *Server) ReturnOrderItems() http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil || orderID <= 0 {
+			msg := ErrResponseMsg{Message: "order id is not correct"}
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
+		}
+
+		var returnData CreateReturnRequest
+		if err := json.NewDecoder(r.Body).Decode(&returnData); err != nil {
+			msg := ErrResponseMsg{Message: err.Error()}
+			if err == io.EOF {
+				msg.Message = "Empty body"
+			}
+
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
+		}
+
+		if errs := validator.Validate(returnData); errs != nil {
+			msg := ErrResponseMsg{Message: errs.Error()}
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
+		}
+
+		items := make([]*in.ReturnItemDTO, 0, len(returnData.Items))
+		for _, v := range returnData.Items {
+			items = append(items, &in.ReturnItemDTO{
+				OrderItemID: v.OrderItemID,
+				Count:       v.Count,
+			})
+		}
+
+		orderReturn, err := s.App.OrdersService.ReturnOrderItems(r.Context(), &in.MakeReturnDTO{
+			OrderID: uint(orderID),
+			Items:   items,
+		})
+
+		switch {
+		case errors.Is(err, in.ErrEmptyReturnItems),
+			errors.Is(err, in.ErrOrderItemNotFound):
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
+		case errors.Is(err, in.ErrOrderNotFound):
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusNotFound)
+
+			return
+		case errors.Is(err, in.ErrOrderNotReturnable),
+			errors.Is(err, in.ErrReturnCountExceeded):
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusConflict)
+
+			return
+		case err != nil:
+			web.JSONResponse(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		web.JSONResponse(w, newOrderReturnResponse(orderReturn), http.StatusCreated)
 	}
 
 	return http.HandlerFunc(handler)
@@ -102,14 +290,14 @@ func (s *Server) OrderList() http.Handler {
 		userID, err := strconv.Atoi(userIDStr)
 		if userIDStr == "" || err != nil || userID <= 0 {
 			msg := ErrResponseMsg{Message: "user_id query param is not correct"}
-			JSONResponse(w, msg, http.StatusBadRequest)
+			web.JSONResponse(w, msg, http.StatusBadRequest)
 
 			return
 		}
 
 		orders, err := s.App.OrdersService.GetOrdersList(r.Context(), uint(userID))
 		if err != nil {
-			JSONResponse(w, err.Error(), http.StatusBadRequest)
+			web.JSONResponse(w, err.Error(), http.StatusBadRequest)
 		}
 
 		ordersReponse := make([]OrdersListResponse, 0, 10)
@@ -123,7 +311,7 @@ func (s *Server) OrderList() http.Handler {
 			})
 		}
 
-		JSONResponse(w, ordersReponse, http.StatusOK)
+		web.JSONResponse(w, ordersReponse, http.StatusOK)
 	}
 
 	return http.HandlerFunc(handler)
@@ -141,7 +329,7 @@ func (s *Server) ProductsList() http.Handler {
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		products, err := s.App.OrdersService.GetProductList(r.Context())
 		if err != nil {
-			JSONResponse(w, err.Error(), http.StatusBadRequest)
+			web.JSONResponse(w, err.Error(), http.StatusBadRequest)
 		}
 
 		productsReponse := make([]ProductsListResponse, 0, 10)
@@ -153,7 +341,7 @@ func (s *Server) ProductsList() http.Handler {
 			})
 		}
 
-		JSONResponse(w, productsReponse, http.StatusOK)
+		web.JSONResponse(w, productsReponse, http.StatusOK)
 	}
 
 	return http.HandlerFunc(handler)
@@ -168,41 +356,41 @@ func (s *Server) ProductsList() http.Handler {
 // @Failure 500 {string} error
 // @Router /health [GET]
 func (s *Server) HealthCheck() http.Handler {
-	handler := func(w http.ResponseWriter, r *http.Request) {
-		timeout := 15
-
-		timeoutStr := r.FormValue("timeout")
-
-		t, err := strconv.Atoi(timeoutStr)
-		if timeoutStr != "" && err == nil {
-			timeout = t
-		}
-
-		ctx, cancel := context.WithTimeout(r.Context(), time.Duration(timeout)*time.Second)
-		defer cancel()
-
-		errToStr := func(err error) string {
-			if err != nil {
-				return err.Error()
-			}
-
-			return "ok"
-		}
-
-		ordersDAOHealth := errToStr(s.App.OrdersDAO.HealthCheck(ctx))
-		orderItemsDAOHealth := errToStr(s.App.OrderItemsDAO.HealthCheck(ctx))
-		productPricesDAOHealth := errToStr(s.App.ProductPricesDAO.HealthCheck(ctx))
-		brokerClientHealth := errToStr(s.App.BrokerClient.HealthCheck(ctx))
-
-		response := HealthCheckResposne{
-			OrdersConn:        ordersDAOHealth,
-			OrderItemsConn:    orderItemsDAOHealth,
-			ProductPricesConn: productPricesDAOHealth,
-			BrokerConn:        brokerClientHealth,
-		}
+	return web.HealthHandler(
+		web.HealthCheck{Name: "orders_conn", Check: s.App.OrdersDAO.HealthCheck},
+		web.HealthCheck{Name: "order_items_conn", Check: s.App.OrderItemsDAO.HealthCheck},
+		web.HealthCheck{Name: "product_prices_conn", Check: s.App.ProductPricesDAO.HealthCheck},
+		web.HealthCheck{Name: "outbox_conn", Check: s.App.OutboxDAO.HealthCheck},
+		web.HealthCheck{Name: "broker_conn", Check: s.App.BrokerClient.HealthCheck},
+	)
+}
 
-		JSONResponse(w, response, http.StatusOK)
-	}
+// @Summary Dead-lettered msgs
+// @Description Msgs of the service which handling failed after all retries, newest first
+// @Produce json
+// @Tags	ops
+// @Success 200 {array} deadletter.Response
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Param limit query int false "page size, up to 100"
+// @Param offset query int false "page offset"
+// @Router /admin/dead-letters [GET]
+func (s *Server) DeadLettersList() http.Handler {
+	return deadletter.ListHandler(s.App.DeadLetters)
+}
 
-	return http.HandlerFunc(handler)
+// @Summary Replay dead-lettered msg
+// @Description Hand original payload of dead-lettered msg to the handler of its topic in this service, msg failed again is dead-lettered as a new letter.
+// @Description Letter is replayed once, the next replay responds with 409
+// @Produce json
+// @Tags	ops
+// @Success 200 {object} deadletter.Response
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 404 {object} ErrResponseMsg
+// @Failure 409 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Param id path int true "dead letter id"
+// @Router /admin/dead-letters/{id}/replay [POST]
+func (s *Server) ReplayDeadLetter() http.Handler {
+	return deadletter.ReplayHandler(s.App.DeadLetters)
 }
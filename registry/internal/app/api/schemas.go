@@ -9,6 +9,11 @@ type ErrResponseMsg struct {
 	Message string `json:"message"`
 }
 
+type UnknownProductsResponse struct {
+	Message    string `json:"message"`
+	ProductIDs []uint `json:"product_ids"`
+}
+
 type CreateOrderRequest struct {
 	UserID     uint                     `json:"user_id" validate:"min=1"`
 	OrderItems []CreateOrderRequestItem `json:"order_items" validate:"min=1"`
@@ -19,8 +24,56 @@ type CreateOrderRequestItem struct {
 	Count     uint8 `json:"count" validate:"min=1"`
 }
 
-type CreateOrderResponse struct {
-	Status string `json:"status"`
+type CreateReturnRequest struct {
+	Items []CreateReturnRequestItem `json:"items" validate:"min=1"`
+}
+
+type CreateReturnRequestItem struct {
+	OrderItemID uint  `json:"order_item_id" validate:"min=1"`
+	Count       uint8 `json:"count" validate:"min=1"`
+}
+
+type OrderResponse struct {
+	ID             uint                     `json:"id"`
+	UserID         uint                     `json:"user_id"`
+	CreatedAt      time.Time                `json:"created_at"`
+	Status         models.OrderStatus       `json:"status"`
+	RejectedReason models.CancelationReason `json:"rejected_reason"`
+	OrderItems     []OrderItemResponse      `json:"order_items"`
+	Total          models.Money             `json:"total" swaggertype:"string" example:"12.34"`
+	Compensation   *CompensationResponse    `json:"compensation,omitempty"`
+}
+
+// Acknowledgements of rejected or canceled order compensation,
+// completed once payment is refunded and items are released.
+type CompensationResponse struct {
+	Wallet    bool `json:"wallet"`
+	Storage   bool `json:"storage"`
+	Completed bool `json:"completed"`
+}
+
+type OrderItemResponse struct {
+	ID            uint                    `json:"id"`
+	ProductID     uint                    `json:"product_id"`
+	Count         uint8                   `json:"count"`
+	ProductPrice  models.Money            `json:"product_price" swaggertype:"string" example:"1.50"`
+	ReturnedCount uint8                   `json:"returned_count"`
+	ReturnStatus  models.ItemReturnStatus `json:"return_status"`
+}
+
+type OrderReturnResponse struct {
+	ID        uint                      `json:"id"`
+	OrderID   uint                      `json:"order_id"`
+	CreatedAt time.Time                 `json:"created_at"`
+	Items     []OrderReturnItemResponse `json:"items"`
+	Amount    models.Money              `json:"amount" swaggertype:"string" example:"3.00"`
+}
+
+type OrderReturnItemResponse struct {
+	OrderItemID  uint         `json:"order_item_id"`
+	ProductID    uint         `json:"product_id"`
+	Count        uint8        `json:"count"`
+	ProductPrice models.Money `json:"product_price" swaggertype:"string" example:"1.50"`
 }
 
 type OrdersListResponse struct {
@@ -32,14 +85,81 @@ type OrdersListResponse struct {
 }
 
 type ProductsListResponse struct {
-	ID    uint    `json:"id"`
-	Title string  `json:"title"`
-	Price float32 `json:"price"`
+	ID    uint         `json:"id"`
+	Title string       `json:"title"`
+	Price models.Money `json:"price" swaggertype:"string" example:"1.50"`
 }
 
 type HealthCheckResposne struct {
 	OrdersConn        string `json:"orders_conn"`
 	OrderItemsConn    string `json:"order_items_conn"`
 	ProductPricesConn string `json:"product_prices_conn"`
+	OutboxConn        string `json:"outbox_conn"`
 	BrokerConn        string `json:"broker_conn"`
 }
+
+func newOrderResponse(order *models.Order) OrderResponse {
+	items := make([]OrderItemResponse, 0, len(order.OrderItems))
+
+	var total models.Money
+
+	for _, v := range order.OrderItems {
+		items = append(items, OrderItemResponse{
+			ID:            v.ID,
+			ProductID:     v.ProductID,
+			Count:         v.Count,
+			ProductPrice:  v.ProductPrice,
+			ReturnedCount: v.ReturnedCount,
+			ReturnStatus:  v.ReturnStatus(),
+		})
+
+		total += v.ProductPrice.Mul(uint(v.Count))
+	}
+
+	return OrderResponse{
+		ID:             order.ID,
+		UserID:         order.UserID,
+		CreatedAt:      order.CreatedAt,
+		Status:         order.Status,
+		RejectedReason: order.RejectedReason,
+		OrderItems:     items,
+		Total:          total,
+		Compensation:   newCompensationResponse(order),
+	}
+}
+
+// Only rejected and canceled orders are compensated.
+func newCompensationResponse(order *models.Order) *CompensationResponse {
+	if order.Status != models.Rejected && order.Status != models.Canceled {
+		return nil
+	}
+
+	wallet, storage := order.WalletCompensated(), order.StorageCompensated()
+
+	return &CompensationResponse{
+		Wallet:    wallet,
+		Storage:   storage,
+		Completed: wallet && storage,
+	}
+}
+
+func newOrderReturnResponse(orderReturn *models.OrderReturn) OrderReturnResponse {
+	items := make([]OrderReturnItemResponse, 0, len(orderReturn.Items))
+
+	for _, v := range orderReturn.Items {
+		items = append(items, OrderReturnItemResponse{
+			OrderItemID:  v.OrderItemID,
+			ProductID:    v.ProductID,
+			Count:        v.Count,
+			ProductPrice: v.ProductPrice,
+		})
+	}
+
+	return OrderReturnResponse{
+		ID:        orderReturn.ID,
+		OrderID:   orderReturn.OrderID,
+		CreatedAt: orderReturn.CreatedAt,
+		Items:     items,
+		Amount:    orderReturn.Amount,
+	}
+}
@@ -1,13 +1,12 @@
 package api
 
 import (
+	"common/web"
 	"context"
-	"encoding/json"
+	"expvar"
 	"fmt"
 	"net/http"
-	_ "registry_service/docs"
 	"registry_service/internal/app/registry"
-	"registry_service/internal/pkg/log"
 	"sync"
 
 	"github.com/gorilla/mux"
@@ -25,40 +24,23 @@ func NewServer(app *registry.App) *Server {
 		App: app,
 	}
 
-	router := createRouter(s)
-	handler := log.LoggingMiddleware(app.Logger)(router)
-
-	server := &http.Server{
-		Addr:    app.Config.ServerAddr(),
-		Handler: handler,
-	}
-
-	s.Serv = server
+	s.Serv = web.NewServer(app.Config.ServerAddr(), createRouter(s), app.Logger)
 
 	return s
 }
 
 func (s *Server) Run(ctx context.Context) error {
-	ctx, cancel := context.WithCancel(ctx)
-
-	wg := sync.WaitGroup{}
-	wg.Add(3)
-
-	go s.App.OrdersService.EventPipeProcessor(ctx, &wg)
-	go s.App.OrdersService.ConsumeRejectedOrderMsgLoop(ctx, &wg)
-	go s.App.OrdersService.ConsumeSuccessMsgLoop(ctx, &wg)
-
-	if err := s.Serv.ListenAndServe(); err != nil {
-		cancel()
-		wg.Wait()
-
-		return err
-	}
+	return web.Serve(ctx, s.Serv, s.RunWorkers)
+}
 
-	cancel()
-	wg.Wait()
+// Starts background loops of the service, they stop when ctx is done.
+func (s *Server) RunWorkers(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(4)
 
-	return nil
+	go s.App.OrdersService.ConsumeRejectedOrderMsgLoop(ctx, wg)
+	go s.App.OrdersService.ConsumeSuccessMsgLoop(ctx, wg)
+	go s.App.OrdersService.ExpireStuckOrdersLoop(ctx, wg)
+	go s.App.OrdersService.OutboxRelayLoop(ctx, wg)
 }
 
 func (s *Server) Shutdown() {
@@ -72,7 +54,13 @@ func createRouter(s *Server) *mux.Router {
 	r.Handle("/health", s.HealthCheck()).Methods(http.MethodGet)
 	r.Handle("/orders", s.CreateOrder()).Methods(http.MethodPost)
 	r.Handle("/orders", s.OrderList()).Queries("user_id", "{[0-9]*?}").Methods(http.MethodGet)
+	r.Handle("/orders/{id:[0-9]+}", s.GetOrder()).Methods(http.MethodGet)
+	r.Handle("/orders/{id:[0-9]+}/cancel", s.CancelOrder()).Methods(http.MethodPost)
+	r.Handle("/orders/{id:[0-9]+}/returns", s.ReturnOrderItems()).Methods(http.MethodPost)
 	r.Handle("/products", s.ProductsList()).Methods(http.MethodGet)
+	r.Handle("/debug/vars", expvar.Handler()).Methods(http.MethodGet)
+	r.Handle("/admin/dead-letters", s.DeadLettersList()).Methods(http.MethodGet)
+	r.Handle("/admin/dead-letters/{id:[0-9]+}/replay", s.ReplayDeadLetter()).Methods(http.MethodPost)
 
 	r.PathPrefix("/swagger/").Handler(httpSwagger.Handler(
 		httpSwagger.URL(fmt.Sprintf("http://%s/swagger/doc.json", s.App.Config.ServerAddr())), // The url pointing to API definition
@@ -83,17 +71,3 @@ func createRouter(s *Server) *mux.Router {
 
 	return r
 }
-
-func JSONResponse(w http.ResponseWriter, msg interface{}, code int) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.Header().Set("X-Content-Type-Options", "nosniff")
-
-	err := json.NewEncoder(w).Encode(msg)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-
-		return
-	}
-
-	w.WriteHeader(code)
-}
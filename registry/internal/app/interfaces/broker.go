@@ -1,13 +1,24 @@
 package interfaces
 
 import (
+	"common/consumer"
 	"context"
 )
 
+type BrokerMsg = consumer.Msg
+
 type BrokerClient interface {
 	SendNewOrderMsg(ctx context.Context, msg *NewOrderMsg) error
-	GetOrderRejectedMsg(ctx context.Context) (*OrderRejectedMsg, error)
-	GetSuccessMsg(ctx context.Context) (*OrderSuccessMsg, error)
+	SendOrderRejectedMsg(ctx context.Context, msg *OrderRejectedMsg) error
+	SendOrderCompletedMsg(ctx context.Context, msg *OrderCompletedMsg) error
+	SendOrderReturnedMsg(ctx context.Context, msg *OrderReturnedMsg) error
+	FetchOrderRejectedMsg(ctx context.Context) (*BrokerMsg, error)
+	FetchSuccessMsg(ctx context.Context) (*BrokerMsg, error)
+	// Msg is committed after it is handled, not committed msg is fetched again after restart.
+	CommitMsg(ctx context.Context, msg *BrokerMsg) error
+
+	// Dead-letter queue, letters are replayed by handlers of the service, not through the topic.
+	SendDeadLetter(ctx context.Context, key, value []byte) error
 
 	CloseReader() error
 	CloseWriter() error
@@ -3,16 +3,35 @@ package interfaces
 import (
 	"context"
 	"registry_service/internal/app/models"
+	"time"
 )
 
-type ProductPricesMap map[uint]float32
+type ProductPricesMap map[uint]models.Money
+
+// Builds outbox msg for order, which is being created in the same transaction.
+type OutboxMsgBuilder func(order *models.Order) (*CreateOutboxMsgDTO, error)
+
+// Builds outbox msg for order return, which is being created in the same transaction.
+type ReturnOutboxMsgBuilder func(order *models.Order, orderReturn *models.OrderReturn) (*CreateOutboxMsgDTO, error)
 
 type OrdersDAO interface {
 	Create(ctx context.Context, data *CreateOrderDTO) (*models.Order, error)
+	CreateWithItems(
+		ctx context.Context,
+		data *CreateOrderDTO,
+		items []*CreateOrderItemDTO,
+		buildMsg OutboxMsgBuilder,
+	) (*models.Order, error)
 	Delete(ctx context.Context, orderID uint) error
 	GetListByUserID(ctx context.Context, userID uint) ([]*models.Order, error)
 	GetByID(ctx context.Context, orderID uint) (*models.Order, error)
-	UpdateStatus(ctx context.Context, orderID uint, status models.OrderStatus, reasonCode models.CancelationReason) (*models.Order, error)
+	GetListStuck(ctx context.Context, createdBefore time.Time, limit uint16) ([]*models.Order, error)
+	CompareAndSetStatus(ctx context.Context, data *OrderTransitionDTO) (*models.Order, error)
+	CreateReturn(
+		ctx context.Context,
+		data *CreateReturnDTO,
+		buildMsg ReturnOutboxMsgBuilder,
+	) (*models.OrderReturn, error)
 	HealthCheck(ctx context.Context) error
 	Close()
 }
@@ -26,8 +45,19 @@ type OrderItemsDAO interface {
 }
 
 type ProductPricesDAO interface {
+	// Returns prices of requested active products, other ids are absent in the map.
 	GetMap(ctx context.Context, productIDs []uint) (ProductPricesMap, error)
 	GetList(ctx context.Context) ([]*models.Product, error)
 	HealthCheck(ctx context.Context) error
 	Close()
 }
+
+type OutboxDAO interface {
+	GetPending(ctx context.Context, limit uint16) ([]*models.OutboxMsg, error)
+	Create(ctx context.Context, data *CreateOutboxMsgDTO) error
+	MarkSent(ctx context.Context, msgID uint) error
+	MarkFailed(ctx context.Context, msgID uint, reason string) error
+	GetStats(ctx context.Context) (*OutboxStats, error)
+	HealthCheck(ctx context.Context) error
+	Close()
+}
@@ -1,6 +1,10 @@
 package interfaces
 
-import "registry_service/internal/app/models"
+import (
+	"common/events"
+	"registry_service/internal/app/models"
+	"time"
+)
 
 //--------------Data Access Layer DTOs--------------
 
@@ -8,10 +12,44 @@ type CreateOrderDTO struct {
 	UserID uint
 }
 
+// Order status transition, applied only if order is still in From status.
+type OrderTransitionDTO struct {
+	OrderID uint
+	From    models.OrderStatus
+	To      models.OrderStatus
+	Steps   models.SagaStep
+	Reason  models.CancelationReason
+	Msg     *CreateOutboxMsgDTO // saved to outbox with the transition, optional
+	// Applied only if no order item is returned, returned items are refunded by the return.
+	NoReturns bool
+	// Applied only if order was completed after it, order without completion time is not.
+	CompletedAfter *time.Time
+}
+
 type CreateOrderItemDTO struct {
 	ProductID    uint
 	Count        uint8
-	ProductPrice float32
+	ProductPrice models.Money
+}
+
+type CreateOutboxMsgDTO struct {
+	EventType models.OutboxEventType
+	Payload   []byte
+}
+
+type ReturnItemDTO struct {
+	OrderItemID uint
+	Count       uint8
+}
+
+type CreateReturnDTO struct {
+	OrderID uint
+	Items   []*ReturnItemDTO
+}
+
+type OutboxStats struct {
+	Pending         uint
+	OldestCreatedAt time.Time
 }
 
 //--------------Interactors Layer DTOs--------------
@@ -29,7 +67,7 @@ type MakeOrderDTO struct {
 type NewOrderItemDTO struct {
 	ProductID    uint
 	Count        uint8
-	ProductPrice float32
+	ProductPrice models.Money
 }
 
 type NewOrderDTO struct {
@@ -37,36 +75,28 @@ type NewOrderDTO struct {
 	OrderItems []*NewOrderItemDTO
 }
 
-//--------------Broker Layer DTOs--------------
-type ServiceName uint8
-
-const (
-	Wallet ServiceName = iota
-	Storage
-	Registry
-)
-
-type NewOrderMsg struct {
-	UserID     uint              `json:"user_id"`
-	OrderID    uint              `json:"order_id"`
-	OrderItems []NewOrderMsgItem `json:"order_items"`
+type MakeReturnDTO struct {
+	OrderID uint
+	Items   []*ReturnItemDTO
 }
 
-type NewOrderMsgItem struct {
-	OrderID      uint    `json:"order_id"`
-	ProductID    uint    `json:"product_id"`
-	Count        uint8   `json:"count"`
-	ProductPrice float32 `json:"product_price"`
-}
+//--------------Broker Layer DTOs--------------
 
-type OrderRejectedMsg struct {
-	OrderID    uint                     `json:"order_id"`
-	UserID     uint                     `json:"user_id"`
-	Service    ServiceName              `json:"service"`
-	ReasonCode models.CancelationReason `json:"reason_code"`
-}
+// Msgs contracts are shared by all services.
+type (
+	ServiceName          = events.ServiceName
+	NewOrderMsg          = events.NewOrderMsg
+	NewOrderMsgItem      = events.NewOrderMsgItem
+	OrderRejectedMsg     = events.OrderRejectedMsg
+	OrderCompletedMsg    = events.OrderCompletedMsg
+	OrderReturnedMsg     = events.OrderReturnedMsg
+	OrderReturnedMsgItem = events.OrderReturnedMsgItem
+	OrderSuccessMsg      = events.OrderSuccessMsg
+	OrderCompensatedMsg  = events.OrderCompensatedMsg
+)
 
-type OrderSuccessMsg struct {
-	OrderID uint        `json:"order_id"`
-	Service ServiceName `json:"service"`
-}
+const (
+	Wallet   = events.Wallet
+	Storage  = events.Storage
+	Registry = events.Registry
+)
@@ -1,14 +1,40 @@
 package interfaces
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrEmptyOrderItems         = errors.New("got empty order items list")
 	ErrEmptyProductIDs         = errors.New("got empty product ids list")
 	ErrProductNotFound         = errors.New("product not found")
-	ErrNewOrderTimeout         = errors.New("new order channel send timeout")
 	ErrRejectedOrderTimeout    = errors.New("rejected order channel send timeout")
 	ErrOrderNotFound           = errors.New("order not found")
+	ErrOrderStatusConflict     = errors.New("order status changed concurrently")
+	ErrCancelWindowExpired     = errors.New("order cancel window expired")
+	ErrOrderHasReturns         = errors.New("order has returned items")
+	ErrOrderNotReturnable      = errors.New("only completed order items can be returned")
+	ErrEmptyReturnItems        = errors.New("got empty return items list")
+	ErrOrderItemNotFound       = errors.New("order item not found")
+	ErrReturnCountExceeded     = errors.New("return count exceeds not returned count of order item")
 	ErrInvalidBrokerConnParams = errors.New("invalid broker client params")
 	ErrBrokerConnClosed        = errors.New("broker connection closed")
+	ErrUnknownTopic            = errors.New("msg of unknown topic")
+	ErrOutboxMsgNotFound       = errors.New("outbox msg not found")
+	ErrUnknownOutboxEvent      = errors.New("unknown outbox event type")
+	ErrInvalidOutboxPayload    = errors.New("invalid outbox msg payload")
 )
+
+// Returned when order references products which don't exist or are inactive.
+type UnknownProductsError struct {
+	ProductIDs []uint
+}
+
+func (e *UnknownProductsError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrProductNotFound, e.ProductIDs)
+}
+
+func (e *UnknownProductsError) Is(target error) bool {
+	return target == ErrProductNotFound
+}
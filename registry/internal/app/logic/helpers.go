@@ -1,11 +1,20 @@
 package logic
 
 import (
+	"common/events"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	in "registry_service/internal/app/interfaces"
 	"registry_service/internal/app/models"
+	"registry_service/internal/app/saga"
+	"time"
 )
 
+// Max attempts to apply saga event on concurrently updated order.
+const maxTransitionAttempts = 5
+
 // Helper func for products prices enrichment.
 func enrichOrderItemsDataWithPrices(
 	productPricesMap in.ProductPricesMap,
@@ -26,35 +35,100 @@ func enrichOrderItemsDataWithPrices(
 	return orderItemsDTOs
 }
 
+// Returns unique ids which have no price, i.e. unknown or inactive products.
+func missingProductIDs(productPricesMap in.ProductPricesMap, productIDs []uint) []uint {
+	missing := make([]uint, 0)
+	seen := make(map[uint]struct{})
+
+	for _, id := range productIDs {
+		if _, exists := productPricesMap[id]; exists {
+			continue
+		}
+
+		if _, exists := seen[id]; exists {
+			continue
+		}
+
+		seen[id] = struct{}{}
+		missing = append(missing, id)
+	}
+
+	return missing
+}
+
+// Applies saga event to the order.
+// Transition is persisted with compare-and-set on the order status,
+// so it is recalculated when concurrent event has changed the order first.
+// Msg built by buildMsg, if any, is saved to outbox with the transition.
+func (s *OrdersService) applySagaEvent(
+	ctx context.Context,
+	orderID uint,
+	event saga.Event,
+	reason models.CancelationReason,
+	buildMsg in.OutboxMsgBuilder,
+) (*models.Order, error) {
+	for attempt := 0; attempt < maxTransitionAttempts; attempt++ {
+		order, err := s.ordersDAO.GetByID(ctx, orderID)
+		if err != nil {
+			return nil, err
+		}
+
+		transition, err := saga.Next(order, event, reason)
+		if err != nil {
+			return nil, err
+		}
+
+		if event == saga.CanceledByUser && transition.From == models.Completed {
+			completedAfter := time.Now().Add(-s.cancelWindow)
+			transition.CompletedAfter = &completedAfter
+		}
+
+		if buildMsg != nil {
+			if transition.Msg, err = buildMsg(order); err != nil {
+				return nil, err
+			}
+		}
+
+		// Completion is announced with the transition, so wallet captures the payment.
+		if transition.To == models.Completed {
+			if transition.Msg, err = orderCompletedOutboxMsg(order); err != nil {
+				return nil, err
+			}
+		}
+
+		order, err = s.ordersDAO.CompareAndSetStatus(ctx, transition)
+		if errors.Is(err, in.ErrOrderStatusConflict) {
+			s.logger.Debugf("Order %d status changed concurrently, retry transition", orderID)
+
+			continue
+		}
+
+		return order, err
+	}
+
+	return nil, in.ErrOrderStatusConflict
+}
+
 // Processes success order msgs
 func (s *OrdersService) processSuccess(ctx context.Context, msg *in.OrderSuccessMsg) error {
 	s.logger.Infof("Processing success orders: %v", msg)
 
-	order, err := s.ordersDAO.GetByID(ctx, msg.OrderID)
+	event, err := saga.SuccessEvent(msg.Service)
 	if err != nil {
-		s.logger.Errorf("Processing success orders: get by id err %v", err)
-
 		return err
 	}
 
-	switch msg.Service {
-	case in.Storage:
-		if order.Status == models.Paid {
-			order.Status = models.Completed
-		} else {
-			order.Status = models.Reserved
-		}
-	case in.Wallet:
-		if order.Status == models.Reserved {
-			order.Status = models.Completed
-		} else {
-			order.Status = models.Paid
-		}
-	case in.Registry:
-	default:
+	_, err = s.applySagaEvent(ctx, msg.OrderID, event, models.OK, nil)
+	if errors.Is(err, saga.ErrStepAlreadyDone) {
+		s.logger.Info("Processing success orders: step already done, skip")
+
+		return nil
+	}
+
+	if errors.Is(err, saga.ErrIllegalTransition) {
+		return s.compensateLateSuccess(ctx, msg)
 	}
 
-	_, err = s.ordersDAO.UpdateStatus(ctx, order.ID, order.Status, models.OK)
 	if err != nil {
 		s.logger.Errorf("Processing success orders: update status err: %v", err)
 
@@ -66,11 +140,69 @@ func (s *OrdersService) processSuccess(ctx context.Context, msg *in.OrderSuccess
 	return nil
 }
 
+// Participant step may succeed after the order was rejected or canceled,
+// e.g. payment processed after cancelation msg found nothing to refund.
+// Rejected msg is saved to outbox again, so the participant compensates the late step
+// even if the broker is unavailable now.
+func (s *OrdersService) compensateLateSuccess(ctx context.Context, msg *in.OrderSuccessMsg) error {
+	order, err := s.ordersDAO.GetByID(ctx, msg.OrderID)
+	if err != nil {
+		return err
+	}
+
+	if order.Status != models.Rejected && order.Status != models.Canceled {
+		return fmt.Errorf("%w: late success for order %d in status %d", saga.ErrIllegalTransition, order.ID, order.Status)
+	}
+
+	s.logger.Infof("Processing success orders: order %d already finished, resend rejected msg", order.ID)
+
+	rejectedMsg, err := orderRejectedOutboxMsg(order.RejectedReason)(order)
+	if err != nil {
+		return err
+	}
+
+	return s.outboxDAO.Create(ctx, rejectedMsg)
+}
+
+// Processes compensated order msgs.
+// Participant compensates its step once more when rejected msg is resent, repeated msg is skipped.
+func (s *OrdersService) processCompensation(ctx context.Context, msg *in.OrderCompensatedMsg) error {
+	s.logger.Infof("Processing compensated orders: %v", msg)
+
+	event, err := saga.CompensationEvent(msg.Service)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.applySagaEvent(ctx, msg.OrderID, event, models.OK, nil)
+	if errors.Is(err, saga.ErrStepAlreadyDone) {
+		s.logger.Info("Processing compensated orders: step already done, skip")
+
+		return nil
+	}
+
+	if err != nil {
+		s.logger.Errorf("Processing compensated orders: update steps err: %v", err)
+
+		return err
+	}
+
+	s.logger.Info("Processing compensated orders: ok")
+
+	return nil
+}
+
 // Processes cancelation msgs
 func (s *OrdersService) processCancelation(ctx context.Context, msg *in.OrderRejectedMsg) error {
 	s.logger.Infof("Processing rejected: %v", msg)
 
-	_, updateErr := s.ordersDAO.UpdateStatus(ctx, msg.OrderID, models.Rejected, msg.ReasonCode)
+	_, updateErr := s.applySagaEvent(ctx, msg.OrderID, saga.FailureEvent(msg.Service), msg.ReasonCode, nil)
+	if errors.Is(updateErr, saga.ErrStepAlreadyDone) {
+		s.logger.Info("Processing rejected: step already done, skip")
+
+		return nil
+	}
+
 	if updateErr != nil {
 		s.logger.Errorf("Processing rejected: order update err %v", updateErr)
 
@@ -82,10 +214,38 @@ func (s *OrdersService) processCancelation(ctx context.Context, msg *in.OrderRej
 	return nil
 }
 
-// Sends msg about new order to queue.
-func (s *OrdersService) sendNewOrderMsg(ctx context.Context, order *models.Order) error {
-	s.logger.Logger.Debug("Send new order msg")
+// Rejects orders whose saga has not completed within timeout.
+// Rejected msg is saved to outbox with the transition, so other services compensate their steps
+// even if the broker is unavailable. Failed order is left for the next sweep.
+func (s *OrdersService) expireStuckOrders(ctx context.Context) error {
+	orders, err := s.ordersDAO.GetListStuck(ctx, time.Now().Add(-s.sagaTimeout), s.sagaSweepBatch)
+	if err != nil {
+		return err
+	}
+
+	for _, order := range orders {
+		_, err := s.applySagaEvent(ctx, order.ID, saga.TimedOut, models.Timeout, orderRejectedOutboxMsg(models.Timeout))
+		if errors.Is(err, saga.ErrIllegalTransition) || errors.Is(err, saga.ErrStepAlreadyDone) {
+			s.logger.Infof("Expire stuck orders: order %d finished concurrently, skip", order.ID)
+
+			continue
+		}
+
+		if err != nil {
+			s.logger.Errorf("Expire stuck orders: reject order %d err: %v", order.ID, err)
+
+			continue
+		}
+
+		s.logger.Infof("Expire stuck orders: order %d rejected by timeout", order.ID)
+	}
+
+	return nil
+}
 
+// Builds outbox msg about new order,
+// it is stored in the same transaction as the order.
+func newOrderOutboxMsg(order *models.Order) (*in.CreateOutboxMsgDTO, error) {
 	items := make([]in.NewOrderMsgItem, 0, 10)
 
 	for _, v := range order.OrderItems {
@@ -103,28 +263,27 @@ func (s *OrdersService) sendNewOrderMsg(ctx context.Context, order *models.Order
 		OrderItems: items,
 	}
 
-	err := s.brokerClient.SendNewOrderMsg(ctx, msg)
+	payload, err := json.Marshal(msg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &in.CreateOutboxMsgDTO{
+		EventType: models.NewOrderEvent,
+		Payload:   payload,
+	}, nil
 }
 
-// Handles new order, deals with data layer,
-// sends new order msg to queue.
-func (s *OrdersService) processNewOrder(
+// Persists new order with its items and new order outbox msg.
+// Order stays Pending until the msg is relayed to queue and processed.
+func (s *OrdersService) createOrder(
 	ctx context.Context,
 	newOrderData *in.NewOrderDTO,
-) error {
+) (*models.Order, error) {
 	orderData := &in.CreateOrderDTO{UserID: newOrderData.UserID}
 
-	order, err := s.ordersDAO.Create(ctx, orderData)
-	if err != nil {
-		return err
-	}
-
 	orderItemsData := make([]*in.CreateOrderItemDTO, 0, 5)
+
 	for _, v := range newOrderData.OrderItems {
 		orderItemsData = append(orderItemsData, &in.CreateOrderItemDTO{
 			ProductID:    v.ProductID,
@@ -133,38 +292,213 @@ func (s *OrdersService) processNewOrder(
 		})
 	}
 
-	orderItems, err := s.orderItemsDAO.CreateBulk(ctx, order.ID, orderItemsData)
+	return s.ordersDAO.CreateWithItems(ctx, orderData, orderItemsData, newOrderOutboxMsg)
+}
+
+// Returns builder of outbox msg notifying other services that order is rejected
+// by registry or canceled by user, so they compensate their steps.
+func orderRejectedOutboxMsg(reason models.CancelationReason) in.OutboxMsgBuilder {
+	return func(order *models.Order) (*in.CreateOutboxMsgDTO, error) {
+		payload, err := json.Marshal(&in.OrderRejectedMsg{
+			MessageID:  events.RejectedMsgID(in.Registry, order.ID),
+			OrderID:    order.ID,
+			UserID:     order.UserID,
+			Service:    in.Registry,
+			ReasonCode: reason,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &in.CreateOutboxMsgDTO{
+			EventType: models.OrderRejectedEvent,
+			Payload:   payload,
+		}, nil
+	}
+}
+
+// Builds outbox msg announcing order completed by all saga participants.
+func orderCompletedOutboxMsg(order *models.Order) (*in.CreateOutboxMsgDTO, error) {
+	payload, err := json.Marshal(&in.OrderCompletedMsg{
+		MessageID: events.CompletedMsgID(order.ID),
+		OrderID:   order.ID,
+		UserID:    order.UserID,
+	})
 	if err != nil {
-		_, errUpd := s.ordersDAO.UpdateStatus(
-			ctx,
-			order.ID,
-			models.Rejected,
-			models.InternalError,
-		)
-		if errUpd != nil {
-			return errUpd
+		return nil, err
+	}
+
+	return &in.CreateOutboxMsgDTO{
+		EventType: models.OrderCompletedEvent,
+		Payload:   payload,
+	}, nil
+}
+
+// Checks return items belong to the order and are not returned yet,
+// counts of the same item are summed up.
+func validateReturnItems(order *models.Order, items []*in.ReturnItemDTO) error {
+	orderItems := make(map[uint]*models.OrderItem)
+	for _, item := range order.OrderItems {
+		orderItems[item.ID] = item
+	}
+
+	counts := make(map[uint]uint)
+
+	for _, v := range items {
+		item, exists := orderItems[v.OrderItemID]
+		if !exists {
+			return fmt.Errorf("%w: %d", in.ErrOrderItemNotFound, v.OrderItemID)
 		}
 
-		return err
+		counts[item.ID] += uint(v.Count)
+
+		if v.Count == 0 || uint(item.ReturnedCount)+counts[item.ID] > uint(item.Count) {
+			return fmt.Errorf("%w: %d", in.ErrReturnCountExceeded, v.OrderItemID)
+		}
 	}
 
-	order.OrderItems = orderItems
+	return nil
+}
+
+// Builds outbox msg about order items return,
+// it is stored in the same transaction as the return.
+func orderReturnedOutboxMsg(order *models.Order, orderReturn *models.OrderReturn) (*in.CreateOutboxMsgDTO, error) {
+	items := make([]in.OrderReturnedMsgItem, 0, len(orderReturn.Items))
+
+	for _, v := range orderReturn.Items {
+		items = append(items, in.OrderReturnedMsgItem{
+			ProductID:    v.ProductID,
+			Count:        v.Count,
+			ProductPrice: v.ProductPrice,
+		})
+	}
 
-	err = s.sendNewOrderMsg(ctx, order)
+	payload, err := json.Marshal(&in.OrderReturnedMsg{
+		MessageID: events.ReturnedMsgID(orderReturn.ID),
+		ReturnID:  orderReturn.ID,
+		OrderID:   order.ID,
+		UserID:    order.UserID,
+		Amount:    orderReturn.Amount,
+		Items:     items,
+	})
 	if err != nil {
-		_, errUpd := s.ordersDAO.UpdateStatus(
-			ctx,
-			order.ID,
-			models.Rejected,
-			models.InternalError,
-		)
+		return nil, err
+	}
+
+	return &in.CreateOutboxMsgDTO{
+		EventType: models.OrderReturnedEvent,
+		Payload:   payload,
+	}, nil
+}
+
+// Publishes outbox msg to queue according to its event type.
+func (s *OrdersService) publishOutboxMsg(ctx context.Context, msg *models.OutboxMsg) error {
+	switch msg.EventType {
+	case models.NewOrderEvent:
+		var newOrderMsg in.NewOrderMsg
+
+		if err := decodeOutboxPayload(msg, &newOrderMsg); err != nil {
+			return err
+		}
+
+		newOrderMsg.MessageID = events.NewOrderMsgID(msg.ID)
+
+		return s.brokerClient.SendNewOrderMsg(ctx, &newOrderMsg)
+	case models.OrderRejectedEvent:
+		var rejectedMsg in.OrderRejectedMsg
+
+		if err := decodeOutboxPayload(msg, &rejectedMsg); err != nil {
+			return err
+		}
+
+		return s.brokerClient.SendOrderRejectedMsg(ctx, &rejectedMsg)
+	case models.OrderCompletedEvent:
+		var completedMsg in.OrderCompletedMsg
 
-		if errUpd != nil {
-			return errUpd
+		if err := decodeOutboxPayload(msg, &completedMsg); err != nil {
+			return err
 		}
 
+		return s.brokerClient.SendOrderCompletedMsg(ctx, &completedMsg)
+	case models.OrderReturnedEvent:
+		var returnedMsg in.OrderReturnedMsg
+
+		if err := decodeOutboxPayload(msg, &returnedMsg); err != nil {
+			return err
+		}
+
+		return s.brokerClient.SendOrderReturnedMsg(ctx, &returnedMsg)
+	default:
+		return fmt.Errorf("%w: %d", in.ErrUnknownOutboxEvent, msg.EventType)
+	}
+}
+
+func decodeOutboxPayload(msg *models.OutboxMsg, v interface{}) error {
+	if err := json.Unmarshal(msg.Payload, v); err != nil {
+		return fmt.Errorf("%w: %v", in.ErrInvalidOutboxPayload, err)
+	}
+
+	return nil
+}
+
+// Publishes pending outbox msgs in creation order and marks them sent.
+// Msg is marked only after the broker accepted it, so delivery is at-least-once:
+// relay crash between send and mark leads to the msg being sent again.
+// Msg which can't be sent on retry, of unknown event or with undecodable payload,
+// is marked failed and skipped, only broker errors stop the batch.
+func (s *OrdersService) relayOutbox(ctx context.Context) error {
+	defer s.updateOutboxMetrics(ctx)
+
+	msgs, err := s.outboxDAO.GetPending(ctx, s.outboxBatch)
+	if err != nil {
 		return err
 	}
 
+	for _, msg := range msgs {
+		err := s.publishOutboxMsg(ctx, msg)
+		if errors.Is(err, in.ErrUnknownOutboxEvent) || errors.Is(err, in.ErrInvalidOutboxPayload) {
+			outboxFailed.Add(1)
+			s.logger.Errorf("Relay outbox: msg %d failed, skip: %v", msg.ID, err)
+
+			if err := s.outboxDAO.MarkFailed(ctx, msg.ID, err.Error()); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err != nil {
+			outboxErrors.Add(1)
+
+			return err
+		}
+
+		if err := s.outboxDAO.MarkSent(ctx, msg.ID); err != nil {
+			return err
+		}
+
+		outboxSent.Add(1)
+	}
+
 	return nil
 }
+
+// Refreshes outbox pending count and lag metrics.
+func (s *OrdersService) updateOutboxMetrics(ctx context.Context) {
+	stats, err := s.outboxDAO.GetStats(ctx)
+	if err != nil {
+		s.logger.Errorf("Outbox metrics: get stats err: %v", err)
+
+		return
+	}
+
+	outboxPending.Set(int64(stats.Pending))
+
+	if stats.Pending == 0 {
+		outboxLag.Set(0)
+
+		return
+	}
+
+	outboxLag.Set(time.Since(stats.OldestCreatedAt).Seconds())
+}
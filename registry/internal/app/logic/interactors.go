@@ -1,9 +1,13 @@
 package logic
 
 import (
+	"common/deadletter"
+	"common/events"
 	"context"
+	"errors"
 	in "registry_service/internal/app/interfaces"
 	"registry_service/internal/app/models"
+	"registry_service/internal/app/saga"
 	"sync"
 	"time"
 )
@@ -22,12 +26,20 @@ func (s *OrdersService) GetOrdersList(ctx context.Context, userID uint) ([]*mode
 	return orders, err
 }
 
+// Get order with its items by id
+func (s *OrdersService) GetOrder(ctx context.Context, orderID uint) (*models.Order, error) {
+	order, err := s.ordersDAO.GetByID(ctx, orderID)
+
+	return order, err
+}
+
 // Entry point for making creating an order.
-// Enriches new order data with pricing and redirects flow to NewOrdersPipeline
+// Enriches new order data with pricing and persists the order
+// together with outbox msg, which notifies other services.
 func (s *OrdersService) MakeOrder(
 	ctx context.Context,
 	makeOrderData *in.MakeOrderDTO,
-) error {
+) (*models.Order, error) {
 	s.logger.Info("Making order")
 
 	productIDs := make([]uint, 0, 5)
@@ -38,7 +50,11 @@ func (s *OrdersService) MakeOrder(
 
 	productsPricesMap, err := s.productPricesDAO.GetMap(ctx, productIDs)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if missing := missingProductIDs(productsPricesMap, productIDs); len(missing) != 0 {
+		return nil, &in.UnknownProductsError{ProductIDs: missing}
 	}
 
 	orderItemsDTOs := enrichOrderItemsDataWithPrices(productsPricesMap, makeOrderData.OrderItems)
@@ -48,17 +64,74 @@ func (s *OrdersService) MakeOrder(
 		OrderItems: orderItemsDTOs,
 	}
 
-	select {
-	case s.newOrdersPipe <- newOrderDTO:
-	case <-time.After(s.sendMsgTimeout * time.Second):
-		return in.ErrNewOrderTimeout
-	case <-ctx.Done():
-		return nil
+	order, err := s.createOrder(ctx, newOrderDTO)
+	if err != nil {
+		return nil, err
 	}
 
 	s.logger.Info("Making order success")
 
-	return nil
+	return order, nil
+}
+
+// Entry point for order cancelation by user.
+// Not completed order can be canceled any time, completed one - within cancel window
+// and only without returns, both are checked with the status change.
+// Other services are notified through outbox to refund payment and return items.
+func (s *OrdersService) CancelOrder(ctx context.Context, orderID uint) (*models.Order, error) {
+	s.logger.Info("Canceling order by user: ", orderID)
+
+	canceledOrder, err := s.applySagaEvent(ctx, orderID, saga.CanceledByUser, models.CanceledByUser, orderRejectedOutboxMsg(models.CanceledByUser))
+	if errors.Is(err, saga.ErrStepAlreadyDone) {
+		return s.ordersDAO.GetByID(ctx, orderID)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Canceling order by user success: ", orderID)
+
+	return canceledOrder, nil
+}
+
+// Entry point for return of completed order items.
+// Returned items and the return msg are persisted together,
+// wallet refunds only the returned items value and storage restocks them.
+func (s *OrdersService) ReturnOrderItems(
+	ctx context.Context,
+	returnData *in.MakeReturnDTO,
+) (*models.OrderReturn, error) {
+	s.logger.Info("Returning order items: ", returnData.OrderID)
+
+	if len(returnData.Items) == 0 {
+		return nil, in.ErrEmptyReturnItems
+	}
+
+	order, err := s.ordersDAO.GetByID(ctx, returnData.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Status != models.Completed {
+		return nil, in.ErrOrderNotReturnable
+	}
+
+	if err := validateReturnItems(order, returnData.Items); err != nil {
+		return nil, err
+	}
+
+	orderReturn, err := s.ordersDAO.CreateReturn(ctx, &in.CreateReturnDTO{
+		OrderID: returnData.OrderID,
+		Items:   returnData.Items,
+	}, orderReturnedOutboxMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Returning order items success: ", orderReturn.ID)
+
+	return orderReturn, nil
 }
 
 // Entry point for orders cancelation.
@@ -66,19 +139,9 @@ func (s *OrdersService) MakeCancelation(
 	ctx context.Context,
 	cancelData *in.OrderRejectedMsg,
 ) error {
-	s.logger.Info("Making cancelation")
+	s.logger.Info("Making cancelation: ", *cancelData)
 
-	select {
-	case s.rejectedOrdersPipe <- cancelData:
-	case <-time.After(s.sendMsgTimeout * time.Second):
-		return in.ErrNewOrderTimeout
-	case <-ctx.Done():
-		return nil
-	}
-
-	s.logger.Info("Making cancelation: send msg to chan success")
-
-	return nil
+	return s.processCancelation(ctx, cancelData)
 }
 
 // Entry point for mark order success step:
@@ -87,114 +150,126 @@ func (s *OrdersService) MarkSuccessStep(
 	ctx context.Context,
 	successData *in.OrderSuccessMsg,
 ) error {
-	s.logger.Info("Marking order as successful")
+	s.logger.Info("Marking order as successful: ", *successData)
+
+	return s.processSuccess(ctx, successData)
+}
+
+func (s *OrdersService) handleRejectedOrderMsg(ctx context.Context, value []byte) error {
+	msg, err := events.DecodeOrderRejectedMsg(value)
+	if err != nil {
+		return deadletter.Permanent(err)
+	}
+
+	if msg.Service == in.Registry {
+		s.logger.Info("Got message for registry. Skip")
 
-	select {
-	case s.successOrdersPipe <- successData:
-	case <-time.After(s.sendMsgTimeout * time.Second):
-		return in.ErrNewOrderTimeout
-	case <-ctx.Done():
 		return nil
 	}
 
-	s.logger.Info("Making cancelation: send msg to chan success")
+	s.logger.Info("Kafka rejected order msg: ", msg)
 
-	return nil
+	return s.MakeCancelation(ctx, msg)
 }
 
-// New events pipeline processor.
-// Gathers incoming item from pipe channels
-// and processes new order, cancelation and success msg.
-func (s *OrdersService) EventPipeProcessor(
+// Entry point for mark order compensated step:
+// Refunded, Released ...
+func (s *OrdersService) MarkCompensatedStep(
 	ctx context.Context,
-	wg *sync.WaitGroup,
-) {
-	defer wg.Done()
+	compensatedData *in.OrderCompensatedMsg,
+) error {
+	s.logger.Info("Marking order step as compensated: ", *compensatedData)
 
-	for {
-		select {
-		case orderData, ok := <-s.newOrdersPipe:
-			if !ok {
-				continue
-			}
+	return s.processCompensation(ctx, compensatedData)
+}
 
-			go s.newOrderProcessor(ctx, orderData)
-		case cancelData, ok := <-s.rejectedOrdersPipe:
-			if !ok {
-				continue
-			}
+// Success topic carries compensated msgs too, they are told apart by the event type.
+func (s *OrdersService) handleSuccessMsg(ctx context.Context, value []byte) error {
+	eventType, err := events.TypeOf(value)
+	if err != nil {
+		return deadletter.Permanent(err)
+	}
 
-			go s.rejectedOrderProcessor(ctx, cancelData)
-		case successData, ok := <-s.successOrdersPipe:
-			if !ok {
-				continue
-			}
+	if eventType == events.OrderCompensated {
+		return s.handleCompensatedMsg(ctx, value)
+	}
 
-			go s.successOrderProcessor(ctx, successData)
-		case <-ctx.Done():
-			return
-		}
+	msg, err := events.DecodeOrderSuccessMsg(value)
+	if err != nil {
+		return deadletter.Permanent(err)
 	}
+
+	s.logger.Info("New success order msg", msg)
+
+	return s.MarkSuccessStep(ctx, msg)
+}
+
+func (s *OrdersService) handleCompensatedMsg(ctx context.Context, value []byte) error {
+	msg, err := events.DecodeOrderCompensatedMsg(value)
+	if err != nil {
+		return deadletter.Permanent(err)
+	}
+
+	s.logger.Info("New compensated order msg", msg)
+
+	return s.MarkCompensatedStep(ctx, msg)
 }
 
 func (s *OrdersService) ConsumeRejectedOrderMsgLoop(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	ticker := time.NewTicker(s.consumeLoopTick)
-
-	for {
-		select {
-		case <-ticker.C:
-			msg, err := s.brokerClient.GetOrderRejectedMsg(ctx)
-			if err != nil {
-				s.logger.Error("got order rejected msg err: ", err)
-			}
+	s.deadLetters.Consume(
+		ctx,
+		s.brokerClient.FetchOrderRejectedMsg,
+		s.brokerClient.CommitMsg,
+		s.handleRejectedOrderMsg,
+		s.consumeLoopTick,
+	)
+}
 
-			if msg == nil {
-				continue
-			}
+func (s *OrdersService) ConsumeSuccessMsgLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
 
-			if msg.Service == in.Registry {
-				s.logger.Info("Got message for registry. Skip")
+	s.deadLetters.Consume(
+		ctx,
+		s.brokerClient.FetchSuccessMsg,
+		s.brokerClient.CommitMsg,
+		s.handleSuccessMsg,
+		s.consumeLoopTick,
+	)
+}
 
-				continue
-			}
+// Sweeps orders stuck in saga for longer than saga timeout.
+func (s *OrdersService) ExpireStuckOrdersLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
 
-			s.logger.Info("Kafka rejected order msg: ", msg)
+	ticker := time.NewTicker(s.sagaSweepInterval)
+	defer ticker.Stop()
 
-			errCancel := s.MakeCancelation(ctx, msg)
-			if errCancel != nil {
-				s.logger.Errorf("Order cancelation error: %v", errCancel)
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.expireStuckOrders(ctx); err != nil {
+				s.logger.Error("Expire stuck orders err: ", err)
 			}
-
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func (s *OrdersService) ConsumeSuccessMsgLoop(ctx context.Context, wg *sync.WaitGroup) {
+// Relays outbox msgs to queue.
+func (s *OrdersService) OutboxRelayLoop(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	ticker := time.NewTicker(s.consumeLoopTick)
+	ticker := time.NewTicker(s.outboxInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			msg, err := s.brokerClient.GetSuccessMsg(ctx)
-			if err != nil {
-				s.logger.Error("Error get success order msg from kafka: ", err)
-			}
-
-			if msg == nil {
-				continue
-			}
-
-			s.logger.Info("New success order msg", msg)
-
-			errCancel := s.MarkSuccessStep(ctx, msg)
-			if errCancel != nil {
-				s.logger.Errorf("Make success steo error: %v", errCancel)
+			if err := s.relayOutbox(ctx); err != nil {
+				s.logger.Error("Relay outbox err: ", err)
 			}
 		case <-ctx.Done():
 			return
@@ -1,8 +1,12 @@
 package logic
 
 import (
+	"common/deadletter"
+	"common/events"
 	"context"
+	"errors"
 	in "registry_service/internal/app/interfaces"
+	"registry_service/internal/app/models"
 	"registry_service/internal/pkg/broker"
 	"registry_service/internal/pkg/conf"
 	"registry_service/internal/pkg/db"
@@ -11,9 +15,38 @@ import (
 	"time"
 
 	"github.com/creasty/defaults"
+	"github.com/segmentio/kafka-go"
 	"github.com/sirupsen/logrus"
 )
 
+func newDeadLetters(config *conf.Config, brokerClient in.BrokerClient, logEntry *logrus.Entry) *deadletter.Queue {
+	return deadletter.NewQueue(
+		config.Kafka.GroupID,
+		deadletter.NewInMemoryStore(),
+		brokerClient,
+		config.RetryPolicy(),
+		logEntry,
+	)
+}
+
+// Kafka tests need a running broker, so they are skipped when it is unreachable.
+func newKafkaClientOrSkip(t *testing.T, config *conf.Config) *broker.KafkaClient {
+	t.Helper()
+
+	conn, err := kafka.Dial("tcp", config.Kafka.Brokers[0])
+	if err != nil {
+		t.Skip("kafka is unreachable: ", err)
+	}
+	conn.Close()
+
+	brokerClient, err := broker.NewKafkaClient(config)
+	if err != nil {
+		t.Fatal("create kafka client err", err)
+	}
+
+	return brokerClient
+}
+
 func TestMakeOrder(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -28,12 +61,14 @@ func TestMakeOrder(t *testing.T) {
 	config.Kafka.Brokers = []string{"localhost:9093"}
 	config.Kafka.NewOrdersTopic = "new_orders"
 	config.Kafka.RejectedOrdersTopic = "rejected_orders"
+	config.Kafka.SuccessTopic = "success_topic"
 	config.Kafka.GroupID = "registry"
 	config.Kafka.ExternalClientsPort = 9092
 	config.Kafka.InternalClientsPort = 9093
 
-	orderDAO := db.NewInMemoryOrdersDAO()
 	orderItemsDAO := db.NewInMemoryOrderItemsDAO()
+	outboxDAO := db.NewInMemoryOutboxDAO()
+	orderDAO := db.NewInMemoryOrdersDAO(orderItemsDAO, outboxDAO)
 	productPricesDAO := db.NewInMemoryProductPricesDAO()
 	brokerClient := broker.NewInMemoryBrokerClient()
 
@@ -41,19 +76,13 @@ func TestMakeOrder(t *testing.T) {
 		orderDAO,
 		orderItemsDAO,
 		productPricesDAO,
+		outboxDAO,
 		brokerClient,
+		newDeadLetters(config, brokerClient, logEntry),
 		logEntry,
 		config,
 	)
 
-	wg := sync.WaitGroup{}
-
-	stop := make(chan struct{})
-	go func(stop chan struct{}) {
-		service.EventPipeProcessor(ctx, &wg)
-		stop <- struct{}{}
-	}(stop)
-
 	makeOrderData := &in.MakeOrderDTO{
 		UserID: 1,
 		OrderItems: []*in.MakeOrderItemDTO{
@@ -64,13 +93,47 @@ func TestMakeOrder(t *testing.T) {
 		},
 	}
 
-	if err := service.MakeOrder(ctx, makeOrderData); err != nil {
-		t.Error("make order error", err)
+	order, err := service.MakeOrder(ctx, makeOrderData)
+	if err != nil {
+		t.Fatal("make order error", err)
+	}
+
+	if order.ID == 0 || len(order.OrderItems) != 1 {
+		t.Fatal("make order returned not persisted order", order)
+	}
+
+	if order.OrderItems[0].ProductPrice != 100 {
+		t.Error("order item is not priced by product", order.OrderItems[0].ProductPrice)
+	}
+
+	storedOrder, err := service.GetOrder(ctx, order.ID)
+	if err != nil {
+		t.Error("get order error", err)
+	}
+
+	if storedOrder.ID != order.ID || len(storedOrder.OrderItems) != 1 {
+		t.Error("get order returned wrong order", storedOrder)
+	}
+
+	if _, err := service.GetOrder(ctx, order.ID+1); !errors.Is(err, in.ErrOrderNotFound) {
+		t.Error("expected order not found error, got", err)
+	}
+
+	stats, err := outboxDAO.GetStats(ctx)
+	if err != nil || stats.Pending != 1 {
+		t.Fatal("new order msg is not stored in outbox", stats, err)
+	}
+
+	if err := service.relayOutbox(ctx); err != nil {
+		t.Fatal("relay outbox error", err)
+	}
+
+	stats, err = outboxDAO.GetStats(ctx)
+	if err != nil || stats.Pending != 0 {
+		t.Error("outbox msg is not marked sent after relay", stats, err)
 	}
 
 	cancel()
-	<-stop
-	wg.Wait()
 
 	if len(orderDAO.OrdersKVStore) == 0 {
 		t.Error("empty orders")
@@ -81,6 +144,63 @@ func TestMakeOrder(t *testing.T) {
 	}
 }
 
+func TestRelayOutboxSkipsInvalidPayload(t *testing.T) {
+	ctx := context.Background()
+
+	config := &conf.Config{}
+	if err := defaults.Set(config); err != nil {
+		t.Error("err config set defaults", err)
+	}
+
+	logEntry := logrus.NewEntry(logrus.New())
+
+	orderItemsDAO := db.NewInMemoryOrderItemsDAO()
+	outboxDAO := db.NewInMemoryOutboxDAO()
+	orderDAO := db.NewInMemoryOrdersDAO(orderItemsDAO, outboxDAO)
+	brokerClient := broker.NewInMemoryBrokerClient()
+
+	service := NewOrdersService(
+		orderDAO,
+		orderItemsDAO,
+		db.NewInMemoryProductPricesDAO(),
+		outboxDAO,
+		brokerClient,
+		newDeadLetters(config, brokerClient, logEntry),
+		logEntry,
+		config,
+	)
+
+	makeOrderData := &in.MakeOrderDTO{
+		UserID:     1,
+		OrderItems: []*in.MakeOrderItemDTO{{ProductID: 1, Count: 1}},
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := service.MakeOrder(ctx, makeOrderData); err != nil {
+			t.Fatal("make order error", err)
+		}
+	}
+
+	outboxDAO.OutboxKVStore[1].Payload = []byte("{")
+
+	if err := service.relayOutbox(ctx); err != nil {
+		t.Fatal("relay outbox error", err)
+	}
+
+	if outboxDAO.OutboxKVStore[1].FailedAt == nil {
+		t.Error("outbox msg with invalid payload is not marked failed")
+	}
+
+	if outboxDAO.OutboxKVStore[2].SentAt == nil {
+		t.Error("outbox msg after the invalid one is not sent")
+	}
+
+	stats, err := outboxDAO.GetStats(ctx)
+	if err != nil || stats.Pending != 0 {
+		t.Error("failed outbox msg is counted as pending", stats, err)
+	}
+}
+
 func TestMakeOrderWithKafka(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -95,34 +215,27 @@ func TestMakeOrderWithKafka(t *testing.T) {
 	config.Kafka.Brokers = []string{"localhost:9093"}
 	config.Kafka.NewOrdersTopic = "new_orders"
 	config.Kafka.RejectedOrdersTopic = "rejected_orders"
+	config.Kafka.SuccessTopic = "success_topic"
 	config.Kafka.GroupID = "registry"
 	config.Kafka.ExternalClientsPort = 9092
 	config.Kafka.InternalClientsPort = 9093
 
-	orderDAO := db.NewInMemoryOrdersDAO()
 	orderItemsDAO := db.NewInMemoryOrderItemsDAO()
+	outboxDAO := db.NewInMemoryOutboxDAO()
+	orderDAO := db.NewInMemoryOrdersDAO(orderItemsDAO, outboxDAO)
 	productPricesDAO := db.NewInMemoryProductPricesDAO()
-	brokerClient, err := broker.NewKafkaClient(config)
-	if err != nil {
-		t.Error("create kafka client err", err)
-	}
+	brokerClient := newKafkaClientOrSkip(t, config)
 	service := NewOrdersService(
 		orderDAO,
 		orderItemsDAO,
 		productPricesDAO,
+		outboxDAO,
 		brokerClient,
+		newDeadLetters(config, brokerClient, logEntry),
 		logEntry,
 		config,
 	)
 
-	wg := sync.WaitGroup{}
-
-	stop := make(chan struct{})
-	go func(stop chan struct{}) {
-		service.EventPipeProcessor(ctx, &wg)
-		stop <- struct{}{}
-	}(stop)
-
 	makeOrderData := &in.MakeOrderDTO{
 		UserID: 1,
 		OrderItems: []*in.MakeOrderItemDTO{
@@ -133,15 +246,17 @@ func TestMakeOrderWithKafka(t *testing.T) {
 		},
 	}
 
-	if err := service.MakeOrder(ctx, makeOrderData); err != nil {
+	if _, err := service.MakeOrder(ctx, makeOrderData); err != nil {
 		t.Error("make order error", err)
 	}
 
+	if err := service.relayOutbox(ctx); err != nil {
+		t.Error("relay outbox error", err)
+	}
+
 	// TODO sync problems
 	time.Sleep(3 * time.Second)
 	cancel()
-	<-stop
-	wg.Wait()
 
 	if len(orderDAO.OrdersKVStore) == 0 {
 		t.Error("empty orders")
@@ -166,39 +281,32 @@ func TestMakeOrderWithKafkaAndConsumeRejected(t *testing.T) {
 	config.Kafka.Brokers = []string{"localhost:9093"}
 	config.Kafka.NewOrdersTopic = "new_orders"
 	config.Kafka.RejectedOrdersTopic = "rejected_orders"
+	config.Kafka.SuccessTopic = "success_topic"
 	config.Kafka.GroupID = "registry"
 	config.Kafka.ExternalClientsPort = 9092
 	config.Kafka.InternalClientsPort = 9093
 
-	orderDAO := db.NewInMemoryOrdersDAO()
 	orderItemsDAO := db.NewInMemoryOrderItemsDAO()
+	outboxDAO := db.NewInMemoryOutboxDAO()
+	orderDAO := db.NewInMemoryOrdersDAO(orderItemsDAO, outboxDAO)
 	productPricesDAO := db.NewInMemoryProductPricesDAO()
-	brokerClient, err := broker.NewKafkaClient(config)
-	if err != nil {
-		t.Error("create kafka client err", err)
-	}
+	brokerClient := newKafkaClientOrSkip(t, config)
 
 	service := NewOrdersService(
 		orderDAO,
 		orderItemsDAO,
 		productPricesDAO,
+		outboxDAO,
 		brokerClient,
+		newDeadLetters(config, brokerClient, logEntry),
 		logEntry,
 		config,
 	)
 
 	wg := sync.WaitGroup{}
+	wg.Add(1)
 
-	stop := make(chan struct{})
-	go func(stop chan struct{}) {
-		service.EventPipeProcessor(ctx, &wg)
-		stop <- struct{}{}
-	}(stop)
-
-	go func(stop chan struct{}) {
-		go service.ConsumeRejectedOrderMsgLoop(ctx, &wg)
-		stop <- struct{}{}
-	}(stop)
+	go service.ConsumeRejectedOrderMsgLoop(ctx, &wg)
 
 	makeOrderData := &in.MakeOrderDTO{
 		UserID: 1,
@@ -210,15 +318,17 @@ func TestMakeOrderWithKafkaAndConsumeRejected(t *testing.T) {
 		},
 	}
 
-	if err := service.MakeOrder(ctx, makeOrderData); err != nil {
+	if _, err := service.MakeOrder(ctx, makeOrderData); err != nil {
 		t.Error("make order error", err)
 	}
 
+	if err := service.relayOutbox(ctx); err != nil {
+		t.Error("relay outbox error", err)
+	}
+
 	// TODO sync problems
 	time.Sleep(8 * time.Second)
 	cancel()
-	<-stop
-	<-stop
 	wg.Wait()
 
 	if len(orderDAO.OrdersKVStore) == 0 {
@@ -229,3 +339,575 @@ func TestMakeOrderWithKafkaAndConsumeRejected(t *testing.T) {
 		t.Error("empty order items")
 	}
 }
+
+func TestExpireStuckOrders(t *testing.T) {
+	ctx := context.Background()
+
+	config := &conf.Config{}
+	if err := defaults.Set(config); err != nil {
+		t.Error("err config set defaults", err)
+	}
+
+	config.Saga.Timeout = 0
+
+	logger := logrus.New()
+	logEntry := logrus.NewEntry(logger)
+
+	orderItemsDAO := db.NewInMemoryOrderItemsDAO()
+	outboxDAO := db.NewInMemoryOutboxDAO()
+	orderDAO := db.NewInMemoryOrdersDAO(orderItemsDAO, outboxDAO)
+	productPricesDAO := db.NewInMemoryProductPricesDAO()
+	brokerClient := broker.NewInMemoryBrokerClient()
+
+	service := NewOrdersService(
+		orderDAO,
+		orderItemsDAO,
+		productPricesDAO,
+		outboxDAO,
+		brokerClient,
+		newDeadLetters(config, brokerClient, logEntry),
+		logEntry,
+		config,
+	)
+
+	newOrderData := &in.NewOrderDTO{
+		UserID: 1,
+		OrderItems: []*in.NewOrderItemDTO{
+			{
+				ProductID:    1,
+				Count:        1,
+				ProductPrice: 100,
+			},
+		},
+	}
+
+	order, err := service.createOrder(ctx, newOrderData)
+	if err != nil {
+		t.Fatal("create order error", err)
+	}
+
+	if err := service.expireStuckOrders(ctx); err != nil {
+		t.Fatal("expire stuck orders error", err)
+	}
+
+	expiredOrder, err := service.GetOrder(ctx, order.ID)
+	if err != nil {
+		t.Fatal("get order error", err)
+	}
+
+	if expiredOrder.Status != models.Rejected || expiredOrder.RejectedReason != models.Timeout {
+		t.Error("stuck order is not rejected by timeout", expiredOrder)
+	}
+
+	// Rejected msg is sent by outbox relay.
+	if err := service.relayOutbox(ctx); err != nil {
+		t.Fatal("relay outbox error", err)
+	}
+
+	msg, err := brokerClient.GetOrderRejectedMsg(ctx)
+	if err != nil {
+		t.Fatal("get rejected msg error", err)
+	}
+
+	if msg.OrderID != order.ID || msg.ReasonCode != models.Timeout || msg.Service != in.Registry {
+		t.Error("unexpected rejected msg", msg)
+	}
+}
+
+func TestMakeOrderWithUnknownProducts(t *testing.T) {
+	ctx := context.Background()
+
+	config := &conf.Config{}
+	if err := defaults.Set(config); err != nil {
+		t.Error("err config set defaults", err)
+	}
+
+	logger := logrus.New()
+	logEntry := logrus.NewEntry(logger)
+
+	orderItemsDAO := db.NewInMemoryOrderItemsDAO()
+	outboxDAO := db.NewInMemoryOutboxDAO()
+	orderDAO := db.NewInMemoryOrdersDAO(orderItemsDAO, outboxDAO)
+	productPricesDAO := db.NewInMemoryProductPricesDAO()
+	brokerClient := broker.NewInMemoryBrokerClient()
+
+	service := NewOrdersService(
+		orderDAO,
+		orderItemsDAO,
+		productPricesDAO,
+		outboxDAO,
+		brokerClient,
+		newDeadLetters(config, brokerClient, logEntry),
+		logEntry,
+		config,
+	)
+
+	makeOrderData := &in.MakeOrderDTO{
+		UserID: 1,
+		OrderItems: []*in.MakeOrderItemDTO{
+			{ProductID: 1, Count: 1},
+			{ProductID: 100, Count: 1},
+			{ProductID: 100, Count: 2},
+		},
+	}
+
+	_, err := service.MakeOrder(ctx, makeOrderData)
+
+	var unknownProductsErr *in.UnknownProductsError
+	if !errors.As(err, &unknownProductsErr) || !errors.Is(err, in.ErrProductNotFound) {
+		t.Fatal("expected unknown products error, got", err)
+	}
+
+	if len(unknownProductsErr.ProductIDs) != 1 || unknownProductsErr.ProductIDs[0] != 100 {
+		t.Error("unexpected unknown product ids", unknownProductsErr.ProductIDs)
+	}
+
+	if len(orderDAO.OrdersKVStore) != 0 {
+		t.Error("order with unknown products is created")
+	}
+}
+
+func TestCancelOrder(t *testing.T) {
+	ctx := context.Background()
+
+	config := &conf.Config{}
+	if err := defaults.Set(config); err != nil {
+		t.Error("err config set defaults", err)
+	}
+
+	logger := logrus.New()
+	logEntry := logrus.NewEntry(logger)
+
+	orderItemsDAO := db.NewInMemoryOrderItemsDAO()
+	outboxDAO := db.NewInMemoryOutboxDAO()
+	orderDAO := db.NewInMemoryOrdersDAO(orderItemsDAO, outboxDAO)
+	productPricesDAO := db.NewInMemoryProductPricesDAO()
+	brokerClient := broker.NewInMemoryBrokerClient()
+
+	service := NewOrdersService(
+		orderDAO,
+		orderItemsDAO,
+		productPricesDAO,
+		outboxDAO,
+		brokerClient,
+		newDeadLetters(config, brokerClient, logEntry),
+		logEntry,
+		config,
+	)
+
+	makeOrderData := &in.MakeOrderDTO{
+		UserID:     1,
+		OrderItems: []*in.MakeOrderItemDTO{{ProductID: 1, Count: 1}},
+	}
+
+	order, err := service.MakeOrder(ctx, makeOrderData)
+	if err != nil {
+		t.Fatal("make order error", err)
+	}
+
+	canceledOrder, err := service.CancelOrder(ctx, order.ID)
+	if err != nil {
+		t.Fatal("cancel order error", err)
+	}
+
+	if canceledOrder.Status != models.Canceled || canceledOrder.RejectedReason != models.CanceledByUser {
+		t.Error("order is not canceled", canceledOrder)
+	}
+
+	if _, err := service.CancelOrder(ctx, order.ID); err != nil {
+		t.Error("second cancel must be no-op, got", err)
+	}
+
+	if err := service.relayOutbox(ctx); err != nil {
+		t.Fatal("relay outbox error", err)
+	}
+
+	msg, err := brokerClient.GetOrderRejectedMsg(ctx)
+	if err != nil {
+		t.Fatal("get rejected msg error", err)
+	}
+
+	if msg.OrderID != order.ID || msg.ReasonCode != models.CanceledByUser || msg.Service != in.Registry {
+		t.Error("unexpected rejected msg", msg)
+	}
+}
+
+func TestCancelOrderCompensated(t *testing.T) {
+	ctx := context.Background()
+
+	config := &conf.Config{}
+	if err := defaults.Set(config); err != nil {
+		t.Error("err config set defaults", err)
+	}
+
+	logEntry := logrus.NewEntry(logrus.New())
+
+	orderItemsDAO := db.NewInMemoryOrderItemsDAO()
+	outboxDAO := db.NewInMemoryOutboxDAO()
+	orderDAO := db.NewInMemoryOrdersDAO(orderItemsDAO, outboxDAO)
+	brokerClient := broker.NewInMemoryBrokerClient()
+
+	service := NewOrdersService(
+		orderDAO,
+		orderItemsDAO,
+		db.NewInMemoryProductPricesDAO(),
+		outboxDAO,
+		brokerClient,
+		newDeadLetters(config, brokerClient, logEntry),
+		logEntry,
+		config,
+	)
+
+	order, err := service.MakeOrder(ctx, &in.MakeOrderDTO{
+		UserID:     1,
+		OrderItems: []*in.MakeOrderItemDTO{{ProductID: 1, Count: 1}},
+	})
+	if err != nil {
+		t.Fatal("make order error", err)
+	}
+
+	if _, err := service.CancelOrder(ctx, order.ID); err != nil {
+		t.Fatal("cancel order error", err)
+	}
+
+	// Compensated msgs share the success topic, wallet one is delivered twice.
+	for _, participant := range []in.ServiceName{in.Wallet, in.Wallet, in.Storage} {
+		value, err := events.EncodeOrderCompensatedMsg("test", &in.OrderCompensatedMsg{
+			OrderID: order.ID,
+			Service: participant,
+		})
+		if err != nil {
+			t.Fatal("encode compensated msg error", err)
+		}
+
+		if err := service.handleSuccessMsg(ctx, value); err != nil {
+			t.Fatal("handle compensated msg error", err)
+		}
+	}
+
+	compensatedOrder, err := orderDAO.GetByID(ctx, order.ID)
+	if err != nil {
+		t.Fatal("get order error", err)
+	}
+
+	if compensatedOrder.Status != models.Canceled ||
+		!compensatedOrder.WalletCompensated() ||
+		!compensatedOrder.StorageCompensated() {
+		t.Error("order compensation is not recorded", compensatedOrder)
+	}
+}
+
+func TestCancelCompletedOrderAfterWindow(t *testing.T) {
+	ctx := context.Background()
+
+	config := &conf.Config{}
+	if err := defaults.Set(config); err != nil {
+		t.Error("err config set defaults", err)
+	}
+
+	config.Saga.CancelWindow = 0
+
+	logger := logrus.New()
+	logEntry := logrus.NewEntry(logger)
+
+	orderItemsDAO := db.NewInMemoryOrderItemsDAO()
+	outboxDAO := db.NewInMemoryOutboxDAO()
+	orderDAO := db.NewInMemoryOrdersDAO(orderItemsDAO, outboxDAO)
+	productPricesDAO := db.NewInMemoryProductPricesDAO()
+	brokerClient := broker.NewInMemoryBrokerClient()
+
+	service := NewOrdersService(
+		orderDAO,
+		orderItemsDAO,
+		productPricesDAO,
+		outboxDAO,
+		brokerClient,
+		newDeadLetters(config, brokerClient, logEntry),
+		logEntry,
+		config,
+	)
+
+	makeOrderData := &in.MakeOrderDTO{
+		UserID:     1,
+		OrderItems: []*in.MakeOrderItemDTO{{ProductID: 1, Count: 1}},
+	}
+
+	order, err := service.MakeOrder(ctx, makeOrderData)
+	if err != nil {
+		t.Fatal("make order error", err)
+	}
+
+	for _, srv := range []in.ServiceName{in.Wallet, in.Storage} {
+		if err := service.processSuccess(ctx, &in.OrderSuccessMsg{OrderID: order.ID, Service: srv}); err != nil {
+			t.Fatal("process success error", err)
+		}
+	}
+
+	if _, err := service.CancelOrder(ctx, order.ID); !errors.Is(err, in.ErrCancelWindowExpired) {
+		t.Error("expected cancel window expired error, got", err)
+	}
+
+	// Order completed before completion time was saved is out of any window.
+	service.cancelWindow = time.Hour
+	orderDAO.OrdersKVStore[order.ID].CompletedAt = nil
+
+	if _, err := service.CancelOrder(ctx, order.ID); !errors.Is(err, in.ErrCancelWindowExpired) {
+		t.Error("expected cancel window expired error for order without completion time, got", err)
+	}
+}
+
+func TestLateSuccessCompensated(t *testing.T) {
+	ctx := context.Background()
+
+	config := &conf.Config{}
+	if err := defaults.Set(config); err != nil {
+		t.Error("err config set defaults", err)
+	}
+
+	logEntry := logrus.NewEntry(logrus.New())
+
+	orderItemsDAO := db.NewInMemoryOrderItemsDAO()
+	outboxDAO := db.NewInMemoryOutboxDAO()
+	orderDAO := db.NewInMemoryOrdersDAO(orderItemsDAO, outboxDAO)
+	brokerClient := broker.NewInMemoryBrokerClient()
+
+	service := NewOrdersService(
+		orderDAO,
+		orderItemsDAO,
+		db.NewInMemoryProductPricesDAO(),
+		outboxDAO,
+		brokerClient,
+		newDeadLetters(config, brokerClient, logEntry),
+		logEntry,
+		config,
+	)
+
+	order, err := service.MakeOrder(ctx, &in.MakeOrderDTO{
+		UserID:     1,
+		OrderItems: []*in.MakeOrderItemDTO{{ProductID: 1, Count: 1}},
+	})
+	if err != nil {
+		t.Fatal("make order error", err)
+	}
+
+	if _, err := service.CancelOrder(ctx, order.ID); err != nil {
+		t.Fatal("cancel order error", err)
+	}
+
+	if err := service.relayOutbox(ctx); err != nil {
+		t.Fatal("relay outbox error", err)
+	}
+
+	if _, err := brokerClient.GetOrderRejectedMsg(ctx); err != nil {
+		t.Fatal("get rejected msg error", err)
+	}
+
+	// Wallet holds money after it has handled the cancelation.
+	if err := service.processSuccess(ctx, &in.OrderSuccessMsg{OrderID: order.ID, Service: in.Wallet}); err != nil {
+		t.Fatal("process late success error", err)
+	}
+
+	stats, err := outboxDAO.GetStats(ctx)
+	if err != nil || stats.Pending != 1 {
+		t.Fatal("rejected msg is not saved to outbox again", stats, err)
+	}
+
+	if err := service.relayOutbox(ctx); err != nil {
+		t.Fatal("relay outbox error", err)
+	}
+
+	msg, err := brokerClient.GetOrderRejectedMsg(ctx)
+	if err != nil {
+		t.Fatal("get rejected msg error", err)
+	}
+
+	if msg.OrderID != order.ID || msg.ReasonCode != models.CanceledByUser {
+		t.Error("unexpected rejected msg", msg)
+	}
+}
+
+func TestCompletedOrderAnnounced(t *testing.T) {
+	ctx := context.Background()
+
+	config := &conf.Config{}
+	if err := defaults.Set(config); err != nil {
+		t.Error("err config set defaults", err)
+	}
+
+	logger := logrus.New()
+	logEntry := logrus.NewEntry(logger)
+
+	orderItemsDAO := db.NewInMemoryOrderItemsDAO()
+	outboxDAO := db.NewInMemoryOutboxDAO()
+	orderDAO := db.NewInMemoryOrdersDAO(orderItemsDAO, outboxDAO)
+	productPricesDAO := db.NewInMemoryProductPricesDAO()
+	brokerClient := broker.NewInMemoryBrokerClient()
+
+	service := NewOrdersService(
+		orderDAO,
+		orderItemsDAO,
+		productPricesDAO,
+		outboxDAO,
+		brokerClient,
+		newDeadLetters(config, brokerClient, logEntry),
+		logEntry,
+		config,
+	)
+
+	makeOrderData := &in.MakeOrderDTO{
+		UserID:     1,
+		OrderItems: []*in.MakeOrderItemDTO{{ProductID: 1, Count: 1}},
+	}
+
+	order, err := service.MakeOrder(ctx, makeOrderData)
+	if err != nil {
+		t.Fatal("make order error", err)
+	}
+
+	for _, srv := range []in.ServiceName{in.Wallet, in.Storage, in.Wallet} {
+		if err := service.processSuccess(ctx, &in.OrderSuccessMsg{OrderID: order.ID, Service: srv}); err != nil {
+			t.Fatal("process success error", err)
+		}
+	}
+
+	if err := service.relayOutbox(ctx); err != nil {
+		t.Fatal("relay outbox error", err)
+	}
+
+	msg, err := brokerClient.GetOrderCompletedMsg(ctx)
+	if err != nil {
+		t.Fatal("get completed msg error", err)
+	}
+
+	if msg.OrderID != order.ID || msg.UserID != order.UserID || msg.MessageID != events.CompletedMsgID(order.ID) {
+		t.Error("unexpected completed msg", msg)
+	}
+
+	stats, err := outboxDAO.GetStats(ctx)
+	if err != nil {
+		t.Fatal("get outbox stats error", err)
+	}
+
+	if stats.Pending != 0 {
+		t.Error("duplicated success must not announce completion twice, pending", stats.Pending)
+	}
+}
+
+func TestReturnOrderItems(t *testing.T) {
+	ctx := context.Background()
+
+	config := &conf.Config{}
+	if err := defaults.Set(config); err != nil {
+		t.Error("err config set defaults", err)
+	}
+
+	logger := logrus.New()
+	logEntry := logrus.NewEntry(logger)
+
+	orderItemsDAO := db.NewInMemoryOrderItemsDAO()
+	outboxDAO := db.NewInMemoryOutboxDAO()
+	orderDAO := db.NewInMemoryOrdersDAO(orderItemsDAO, outboxDAO)
+	productPricesDAO := db.NewInMemoryProductPricesDAO()
+	brokerClient := broker.NewInMemoryBrokerClient()
+
+	service := NewOrdersService(
+		orderDAO,
+		orderItemsDAO,
+		productPricesDAO,
+		outboxDAO,
+		brokerClient,
+		newDeadLetters(config, brokerClient, logEntry),
+		logEntry,
+		config,
+	)
+
+	makeOrderData := &in.MakeOrderDTO{
+		UserID: 1,
+		OrderItems: []*in.MakeOrderItemDTO{
+			{ProductID: 1, Count: 2},
+			{ProductID: 2, Count: 1},
+		},
+	}
+
+	order, err := service.MakeOrder(ctx, makeOrderData)
+	if err != nil {
+		t.Fatal("make order error", err)
+	}
+
+	firstItem := order.OrderItems[0]
+
+	returnData := &in.MakeReturnDTO{
+		OrderID: order.ID,
+		Items:   []*in.ReturnItemDTO{{OrderItemID: firstItem.ID, Count: 1}},
+	}
+
+	if _, err := service.ReturnOrderItems(ctx, returnData); !errors.Is(err, in.ErrOrderNotReturnable) {
+		t.Error("expected not completed order to be not returnable, got", err)
+	}
+
+	for _, srv := range []in.ServiceName{in.Wallet, in.Storage} {
+		if err := service.processSuccess(ctx, &in.OrderSuccessMsg{OrderID: order.ID, Service: srv}); err != nil {
+			t.Fatal("process success error", err)
+		}
+	}
+
+	orderReturn, err := service.ReturnOrderItems(ctx, returnData)
+	if err != nil {
+		t.Fatal("return order items error", err)
+	}
+
+	if orderReturn.Amount != firstItem.ProductPrice || len(orderReturn.Items) != 1 {
+		t.Error("return must refund only returned items", orderReturn)
+	}
+
+	returnedOrder, err := service.GetOrder(ctx, order.ID)
+	if err != nil {
+		t.Fatal("get order error", err)
+	}
+
+	if returnedOrder.OrderItems[0].ReturnStatus() != models.PartiallyReturned ||
+		returnedOrder.OrderItems[1].ReturnStatus() != models.NotReturned {
+		t.Error("unexpected items return status", returnedOrder.OrderItems[0], returnedOrder.OrderItems[1])
+	}
+
+	exceedingData := &in.MakeReturnDTO{
+		OrderID: order.ID,
+		Items:   []*in.ReturnItemDTO{{OrderItemID: firstItem.ID, Count: 2}},
+	}
+
+	if _, err := service.ReturnOrderItems(ctx, exceedingData); !errors.Is(err, in.ErrReturnCountExceeded) {
+		t.Error("expected return count exceeded error, got", err)
+	}
+
+	// DAO checks items itself, not only the logic.
+	unknownItemData := &in.CreateReturnDTO{
+		OrderID: order.ID,
+		Items:   []*in.ReturnItemDTO{{OrderItemID: 100, Count: 1}},
+	}
+
+	if _, err := orderDAO.CreateReturn(ctx, unknownItemData, orderReturnedOutboxMsg); !errors.Is(err, in.ErrOrderItemNotFound) {
+		t.Error("expected order item not found error, got", err)
+	}
+
+	if _, err := service.CancelOrder(ctx, order.ID); !errors.Is(err, in.ErrOrderHasReturns) {
+		t.Error("expected order with returns not to be canceled, got", err)
+	}
+
+	if err := service.relayOutbox(ctx); err != nil {
+		t.Fatal("relay outbox error", err)
+	}
+
+	msg, err := brokerClient.GetOrderReturnedMsg(ctx)
+	if err != nil {
+		t.Fatal("get returned msg error", err)
+	}
+
+	if msg.MessageID != events.ReturnedMsgID(orderReturn.ID) ||
+		msg.OrderID != order.ID ||
+		msg.Amount != orderReturn.Amount ||
+		len(msg.Items) != 1 ||
+		msg.Items[0].ProductID != firstItem.ProductID ||
+		msg.Items[0].Count != 1 {
+		t.Error("unexpected returned msg", msg)
+	}
+}
@@ -0,0 +1,12 @@
+package logic
+
+import "expvar"
+
+// Outbox relay metrics, served by expvar handler.
+var (
+	outboxPending = expvar.NewInt("outbox_pending")
+	outboxLag     = expvar.NewFloat("outbox_lag_seconds")
+	outboxSent    = expvar.NewInt("outbox_sent_total")
+	outboxErrors  = expvar.NewInt("outbox_errors_total")
+	outboxFailed  = expvar.NewInt("outbox_failed_total")
+)
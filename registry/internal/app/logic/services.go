@@ -1,6 +1,7 @@
 package logic
 
 import (
+	"common/deadletter"
 	in "registry_service/internal/app/interfaces"
 	"registry_service/internal/pkg/conf"
 	"time"
@@ -9,46 +10,52 @@ import (
 )
 
 type OrdersService struct {
-	ordersDAO          in.OrdersDAO
-	orderItemsDAO      in.OrderItemsDAO
-	productPricesDAO   in.ProductPricesDAO
-	brokerClient       in.BrokerClient
-	newOrdersPipe      chan *in.NewOrderDTO
-	rejectedOrdersPipe chan *in.OrderRejectedMsg
-	successOrdersPipe  chan *in.OrderSuccessMsg
-	sendMsgTimeout     time.Duration
-	consumeLoopTick    time.Duration
-	logger             *logrus.Entry
+	ordersDAO         in.OrdersDAO
+	orderItemsDAO     in.OrderItemsDAO
+	productPricesDAO  in.ProductPricesDAO
+	outboxDAO         in.OutboxDAO
+	brokerClient      in.BrokerClient
+	deadLetters       *deadletter.Queue
+	consumeLoopTick   time.Duration
+	sagaTimeout       time.Duration
+	sagaSweepInterval time.Duration
+	sagaSweepBatch    uint16
+	cancelWindow      time.Duration
+	outboxInterval    time.Duration
+	outboxBatch       uint16
+	logger            *logrus.Entry
 }
 
 func NewOrdersService(
 	ordersDAO in.OrdersDAO,
 	orderItemsDAO in.OrderItemsDAO,
 	productPricesDAO in.ProductPricesDAO,
+	outboxDAO in.OutboxDAO,
 	brokerClient in.BrokerClient,
+	deadLetters *deadletter.Queue,
 	logger *logrus.Entry,
 	config *conf.Config,
 ) *OrdersService {
-	newOrdersPipe := make(chan *in.NewOrderDTO, config.Server.NewOrdersPipeCapacity)
-	rejectedOrdersPipe := make(chan *in.OrderRejectedMsg, config.Server.NewOrdersPipeCapacity)
-	successOrdersPipe := make(chan *in.OrderSuccessMsg, config.Server.NewOrdersPipeCapacity)
-
-	return &OrdersService{
-		ordersDAO:          ordersDAO,
-		orderItemsDAO:      orderItemsDAO,
-		productPricesDAO:   productPricesDAO,
-		brokerClient:       brokerClient,
-		newOrdersPipe:      newOrdersPipe,
-		rejectedOrdersPipe: rejectedOrdersPipe,
-		successOrdersPipe:  successOrdersPipe,
-		sendMsgTimeout:     time.Duration(config.Kafka.SendMsgTimeout) * time.Second,
-		consumeLoopTick:    time.Duration(config.Kafka.ConsumeLoopTick) * time.Millisecond,
-		logger:             logger,
+	s := &OrdersService{
+		ordersDAO:         ordersDAO,
+		orderItemsDAO:     orderItemsDAO,
+		productPricesDAO:  productPricesDAO,
+		outboxDAO:         outboxDAO,
+		brokerClient:      brokerClient,
+		deadLetters:       deadLetters,
+		consumeLoopTick:   time.Duration(config.Kafka.ConsumeLoopTick) * time.Millisecond,
+		sagaTimeout:       time.Duration(config.Saga.Timeout) * time.Second,
+		sagaSweepInterval: time.Duration(config.Saga.SweepInterval) * time.Second,
+		sagaSweepBatch:    config.Saga.SweepBatch,
+		cancelWindow:      time.Duration(config.Saga.CancelWindow) * time.Second,
+		outboxInterval:    time.Duration(config.Outbox.RelayInterval) * time.Millisecond,
+		outboxBatch:       config.Outbox.Batch,
+		logger:            logger,
 	}
-}
 
-func (s *OrdersService) Close() {
-	close(s.newOrdersPipe)
-	close(s.rejectedOrdersPipe)
-	close(s.successOrdersPipe)
+	// Letters are replayed by the handlers msgs of their topics are consumed with.
+	deadLetters.Register(config.Kafka.RejectedOrdersTopic, s.handleRejectedOrderMsg)
+	deadLetters.Register(config.Kafka.SuccessTopic, s.handleSuccessMsg)
+
+	return s
 }
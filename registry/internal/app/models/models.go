@@ -1,11 +1,23 @@
 package models
 
-import "time"
+import (
+	"common/events"
+	"common/money"
+	"time"
+)
+
+type (
+	OrderStatus      uint8
+	TransactionType  uint8
+	SagaStep         uint8
+	OutboxEventType  uint8
+	ItemReturnStatus uint8
+)
 
+// Shared with other services through msgs.
 type (
-	OrderStatus       uint8
-	TransactionType   uint8
-	CancelationReason uint8
+	Money             = money.Money
+	CancelationReason = events.CancelationReason
 )
 
 const (
@@ -23,10 +35,37 @@ const (
 )
 
 const (
-	OK CancelationReason = iota
-	NotEnoughMoney
-	OutOfStock
-	InternalError
+	OK                 = events.OK
+	NotEnoughMoney     = events.NotEnoughMoney
+	OutOfStock         = events.OutOfStock
+	InternalError      = events.InternalError
+	Timeout            = events.Timeout
+	CanceledByUser     = events.CanceledByUser
+	ReservationExpired = events.ReservationExpired
+)
+
+// Order saga participants step results, stored as bit flags.
+// Compensated steps are acknowledged by participants after order is rejected or canceled.
+const (
+	WalletPaid SagaStep = 1 << iota
+	WalletFailed
+	StorageReserved
+	StorageFailed
+	WalletCompensated
+	StorageCompensated
+)
+
+const (
+	NewOrderEvent OutboxEventType = iota
+	OrderRejectedEvent
+	OrderCompletedEvent
+	OrderReturnedEvent
+)
+
+const (
+	NotReturned ItemReturnStatus = iota
+	PartiallyReturned
+	Returned
 )
 
 type Order struct {
@@ -36,18 +75,69 @@ type Order struct {
 	Status         OrderStatus
 	OrderItems     []*OrderItem
 	RejectedReason CancelationReason
+	Steps          SagaStep
+	CompletedAt    *time.Time
+}
+
+// Participant which failed its step has nothing to compensate.
+func (o *Order) WalletCompensated() bool {
+	return o.Steps&(WalletCompensated|WalletFailed) != 0
+}
+
+func (o *Order) StorageCompensated() bool {
+	return o.Steps&(StorageCompensated|StorageFailed) != 0
 }
 
 type OrderItem struct {
-	ID           uint
-	OrderID      uint
+	ID            uint
+	OrderID       uint
+	ProductID     uint
+	Count         uint8
+	ProductPrice  Money
+	ReturnedCount uint8
+}
+
+func (i *OrderItem) ReturnStatus() ItemReturnStatus {
+	switch {
+	case i.ReturnedCount == 0:
+		return NotReturned
+	case i.ReturnedCount < i.Count:
+		return PartiallyReturned
+	default:
+		return Returned
+	}
+}
+
+// Return of some items of completed order,
+// amount is refunded to user and items are restocked.
+type OrderReturn struct {
+	ID        uint
+	OrderID   uint
+	Items     []*OrderReturnItem
+	Amount    Money
+	CreatedAt time.Time
+}
+
+type OrderReturnItem struct {
+	OrderItemID  uint
 	ProductID    uint
 	Count        uint8
-	ProductPrice float32 // TODO consider as decimal
+	ProductPrice Money
 }
 
 type Product struct {
-	ID    uint
-	Title string
-	Price float32 // TODO consider as decimal
+	ID     uint
+	Title  string
+	Price  Money
+	Active bool
+}
+
+// Event waiting in outbox to be published to the broker.
+type OutboxMsg struct {
+	ID        uint
+	EventType OutboxEventType
+	Payload   []byte
+	CreatedAt time.Time
+	SentAt    *time.Time
+	FailedAt  *time.Time // msg which can't be sent, e.g. with undecodable payload
 }
@@ -1,7 +1,10 @@
 package registry
 
 import (
+	"common/backend"
+	"common/deadletter"
 	"context"
+	"fmt"
 	in "registry_service/internal/app/interfaces"
 	"registry_service/internal/app/logic"
 	"registry_service/internal/pkg/broker"
@@ -15,8 +18,10 @@ type App struct {
 	OrdersDAO        in.OrdersDAO
 	OrderItemsDAO    in.OrderItemsDAO
 	ProductPricesDAO in.ProductPricesDAO
+	OutboxDAO        in.OutboxDAO
 	BrokerClient     in.BrokerClient
 
+	DeadLetters   *deadletter.Queue
 	OrdersService *logic.OrdersService
 
 	Logger *logrus.Entry
@@ -25,6 +30,17 @@ type App struct {
 
 func NewRegistryApp(ctx context.Context) *App {
 	config := conf.New()
+
+	brokerClient, err := newBrokerClient(config)
+	if err != nil {
+		panic(err)
+	}
+
+	return NewRegistryAppWithBroker(ctx, config, brokerClient)
+}
+
+// Builds app around given broker client, used to run services in one process.
+func NewRegistryAppWithBroker(ctx context.Context, config *conf.Config, brokerClient in.BrokerClient) *App {
 	logger := logrus.New()
 	// logger.SetFormatter(&logrus.JSONFormatter{})
 	logEntry := logrus.NewEntry(logger)
@@ -32,25 +48,31 @@ func NewRegistryApp(ctx context.Context) *App {
 		parseLogLevel(config.Logger.LogLevel),
 	)
 
-	brokerClient, err := broker.NewKafkaClient(config)
+	appDAOs, err := newDAOs(ctx, config)
 	if err != nil {
 		panic(err)
 	}
 
-	// brokerClient := broker.NewInMemoryBrokerClient()
-	// ordersDAO := db.NewInMemoryOrdersDAO()
-	// orderItemsDAO := db.NewInMemoryOrderItemsDAO()
-	// productPricesDAO := db.NewInMemoryProductPricesDAO()
+	ordersDAO := appDAOs.OrdersDAO
+	orderItemsDAO := appDAOs.OrderItemsDAO
+	productPricesDAO := appDAOs.ProductPricesDAO
+	outboxDAO := appDAOs.OutboxDAO
 
-	ordersDAO := db.NewPostgresOrdersDAO(ctx, config)
-	orderItemsDAO := db.NewPostgresOrderItemsDAO(ctx, config)
-	productPricesDAO := db.NewPostgresProductPricesDAO(ctx, config)
+	deadLetters := deadletter.NewQueue(
+		config.Kafka.GroupID,
+		appDAOs.DeadLettersStore,
+		brokerClient,
+		config.RetryPolicy(),
+		logEntry,
+	)
 
 	ordersService := logic.NewOrdersService(
 		ordersDAO,
 		orderItemsDAO,
 		productPricesDAO,
+		outboxDAO,
 		brokerClient,
+		deadLetters,
 		logEntry,
 		config,
 	)
@@ -62,17 +84,65 @@ func NewRegistryApp(ctx context.Context) *App {
 		OrdersDAO:        ordersDAO,
 		OrderItemsDAO:    orderItemsDAO,
 		ProductPricesDAO: productPricesDAO,
+		OutboxDAO:        outboxDAO,
+		DeadLetters:      deadLetters,
 		OrdersService:    ordersService,
 	}
 
 	return &app
 }
 
+func newBrokerClient(config *conf.Config) (in.BrokerClient, error) {
+	switch config.Broker.Backend {
+	case backend.Kafka:
+		return broker.NewKafkaClient(config)
+	case backend.Memory:
+		return broker.NewInMemoryBrokerClient(), nil
+	default:
+		return nil, fmt.Errorf("%w: broker %q", backend.ErrUnknown, config.Broker.Backend)
+	}
+}
+
+type daos struct {
+	OrdersDAO        in.OrdersDAO
+	OrderItemsDAO    in.OrderItemsDAO
+	ProductPricesDAO in.ProductPricesDAO
+	OutboxDAO        in.OutboxDAO
+	DeadLettersStore deadletter.Store
+}
+
+func newDAOs(ctx context.Context, config *conf.Config) (*daos, error) {
+	switch config.Storage.Backend {
+	case backend.Postgres:
+		return &daos{
+			OrdersDAO:        db.NewPostgresOrdersDAO(ctx, config),
+			OrderItemsDAO:    db.NewPostgresOrderItemsDAO(ctx, config),
+			ProductPricesDAO: db.NewPostgresProductPricesDAO(ctx, config),
+			OutboxDAO:        db.NewPostgresOutboxDAO(ctx, config),
+			DeadLettersStore: db.NewPostgresDeadLettersDAO(ctx, config),
+		}, nil
+	case backend.Memory:
+		orderItemsDAO := db.NewInMemoryOrderItemsDAO()
+		outboxDAO := db.NewInMemoryOutboxDAO()
+
+		return &daos{
+			OrdersDAO:        db.NewInMemoryOrdersDAO(orderItemsDAO, outboxDAO),
+			OrderItemsDAO:    orderItemsDAO,
+			ProductPricesDAO: db.NewInMemoryProductPricesDAO(),
+			OutboxDAO:        outboxDAO,
+			DeadLettersStore: deadletter.NewInMemoryStore(),
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: storage %q", backend.ErrUnknown, config.Storage.Backend)
+	}
+}
+
 func (app *App) Close() {
-	app.OrdersService.Close()
 	app.BrokerClient.CloseReader()
 	app.BrokerClient.CloseWriter()
 	app.OrdersDAO.Close()
 	app.OrderItemsDAO.Close()
 	app.ProductPricesDAO.Close()
+	app.OutboxDAO.Close()
+	app.DeadLetters.Close()
 }
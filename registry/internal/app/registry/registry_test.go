@@ -0,0 +1,55 @@
+package registry
+
+import (
+	"common/backend"
+	"context"
+	"errors"
+	"registry_service/internal/pkg/broker"
+	"registry_service/internal/pkg/conf"
+	"registry_service/internal/pkg/db"
+	"testing"
+
+	"github.com/creasty/defaults"
+)
+
+func TestMemoryBackends(t *testing.T) {
+	config := &conf.Config{}
+	if err := defaults.Set(config); err != nil {
+		t.Fatal("err config set defaults", err)
+	}
+
+	config.Storage.Backend = backend.Memory
+	config.Broker.Backend = backend.Memory
+
+	brokerClient, err := newBrokerClient(config)
+	if err != nil {
+		t.Fatal("new broker client err", err)
+	}
+
+	if _, ok := brokerClient.(*broker.InMemoryBrokerClient); !ok {
+		t.Errorf("expected in-memory broker client, got %T", brokerClient)
+	}
+
+	appDAOs, err := newDAOs(context.Background(), config)
+	if err != nil {
+		t.Fatal("new daos err", err)
+	}
+
+	if _, ok := appDAOs.OrdersDAO.(*db.InMemoryOrdersDAO); !ok {
+		t.Errorf("expected in-memory daos, got %T", appDAOs.OrdersDAO)
+	}
+}
+
+func TestUnknownBackend(t *testing.T) {
+	config := &conf.Config{}
+	config.Storage.Backend = "mysql"
+	config.Broker.Backend = "rabbitmq"
+
+	if _, err := newBrokerClient(config); !errors.Is(err, backend.ErrUnknown) {
+		t.Error("expected unknown broker backend err, got", err)
+	}
+
+	if _, err := newDAOs(context.Background(), config); !errors.Is(err, backend.ErrUnknown) {
+		t.Error("expected unknown storage backend err, got", err)
+	}
+}
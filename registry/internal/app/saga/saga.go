@@ -0,0 +1,194 @@
+package saga
+
+import (
+	"errors"
+	"fmt"
+	in "registry_service/internal/app/interfaces"
+	"registry_service/internal/app/models"
+)
+
+// Saga event: result of a participant step or a decision of the registry itself.
+type Event uint8
+
+const (
+	PaymentSucceeded Event = iota
+	PaymentFailed
+	ReservationSucceeded
+	ReservationFailed
+	Aborted
+	TimedOut
+	CanceledByUser
+	PaymentCompensated
+	ReservationCompensated
+)
+
+var (
+	ErrIllegalTransition = errors.New("illegal order status transition")
+	ErrStepAlreadyDone   = errors.New("saga step already done")
+)
+
+// Returned when event can't be applied to the order in its current status.
+type TransitionError struct {
+	OrderID uint
+	From    models.OrderStatus
+	Event   Event
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf(
+		"%v: order %d, status %d, event %d",
+		ErrIllegalTransition, e.OrderID, e.From, e.Event,
+	)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
+
+// Legal transitions: event -> from status -> to status.
+var transitions = map[Event]map[models.OrderStatus]models.OrderStatus{
+	PaymentSucceeded: {
+		models.Pending:  models.Paid,
+		models.Reserved: models.Completed,
+	},
+	ReservationSucceeded: {
+		models.Pending: models.Reserved,
+		models.Paid:    models.Completed,
+	},
+	PaymentFailed: {
+		models.Pending:  models.Rejected,
+		models.Paid:     models.Rejected,
+		models.Reserved: models.Rejected,
+		models.Rejected: models.Rejected,
+		models.Canceled: models.Canceled,
+	},
+	ReservationFailed: {
+		models.Pending:  models.Rejected,
+		models.Paid:     models.Rejected,
+		models.Reserved: models.Rejected,
+		models.Rejected: models.Rejected,
+		models.Canceled: models.Canceled,
+	},
+	Aborted: {
+		models.Pending:  models.Rejected,
+		models.Paid:     models.Rejected,
+		models.Reserved: models.Rejected,
+	},
+	TimedOut: {
+		models.Pending:  models.Rejected,
+		models.Paid:     models.Rejected,
+		models.Reserved: models.Rejected,
+	},
+	CanceledByUser: {
+		models.Pending:   models.Canceled,
+		models.Paid:      models.Canceled,
+		models.Reserved:  models.Canceled,
+		models.Completed: models.Canceled,
+	},
+	// Compensation only records the step, participant may compensate the rejection
+	// of the other one before registry rejects the order.
+	PaymentCompensated:     compensationTransitions,
+	ReservationCompensated: compensationTransitions,
+}
+
+var compensationTransitions = map[models.OrderStatus]models.OrderStatus{
+	models.Pending:  models.Pending,
+	models.Paid:     models.Paid,
+	models.Reserved: models.Reserved,
+	models.Rejected: models.Rejected,
+	models.Canceled: models.Canceled,
+}
+
+// Participant step result recorded by the event.
+var eventSteps = map[Event]models.SagaStep{
+	PaymentSucceeded:       models.WalletPaid,
+	PaymentFailed:          models.WalletFailed,
+	ReservationSucceeded:   models.StorageReserved,
+	ReservationFailed:      models.StorageFailed,
+	PaymentCompensated:     models.WalletCompensated,
+	ReservationCompensated: models.StorageCompensated,
+}
+
+// Computes the transition of the order caused by the event.
+// Order itself is not changed, transition should be persisted
+// with compare-and-set on its From status.
+func Next(
+	order *models.Order,
+	event Event,
+	reason models.CancelationReason,
+) (*in.OrderTransitionDTO, error) {
+	step := eventSteps[event]
+
+	if step != 0 && order.Steps&step != 0 {
+		return nil, ErrStepAlreadyDone
+	}
+
+	if (event == Aborted || event == TimedOut) &&
+		(order.Status == models.Rejected || order.Status == models.Canceled) {
+		return nil, ErrStepAlreadyDone
+	}
+
+	if event == CanceledByUser && order.Status == models.Canceled {
+		return nil, ErrStepAlreadyDone
+	}
+
+	to, legal := transitions[event][order.Status]
+	if !legal {
+		return nil, &TransitionError{
+			OrderID: order.ID,
+			From:    order.Status,
+			Event:   event,
+		}
+	}
+
+	// Order rejected or canceled earlier keeps the first reason.
+	if to == order.Status || (to != models.Rejected && to != models.Canceled) {
+		reason = order.RejectedReason
+	}
+
+	return &in.OrderTransitionDTO{
+		OrderID: order.ID,
+		From:    order.Status,
+		To:      to,
+		Steps:   order.Steps | step,
+		Reason:  reason,
+		// Cancelation refunds the whole completed order, so it is refused once items are returned.
+		NoReturns: event == CanceledByUser && order.Status == models.Completed,
+	}, nil
+}
+
+// Maps rejection msg producer to the saga event.
+func FailureEvent(service in.ServiceName) Event {
+	switch service {
+	case in.Wallet:
+		return PaymentFailed
+	case in.Storage:
+		return ReservationFailed
+	default:
+		return Aborted
+	}
+}
+
+// Maps success msg producer to the saga event.
+func SuccessEvent(service in.ServiceName) (Event, error) {
+	switch service {
+	case in.Wallet:
+		return PaymentSucceeded, nil
+	case in.Storage:
+		return ReservationSucceeded, nil
+	default:
+		return 0, fmt.Errorf("%w: unexpected success msg from service %d", ErrIllegalTransition, service)
+	}
+}
+
+// Maps compensated msg producer to the saga event.
+func CompensationEvent(service in.ServiceName) (Event, error) {
+	switch service {
+	case in.Wallet:
+		return PaymentCompensated, nil
+	case in.Storage:
+		return ReservationCompensated, nil
+	default:
+		return 0, fmt.Errorf("%w: unexpected compensated msg from service %d", ErrIllegalTransition, service)
+	}
+}
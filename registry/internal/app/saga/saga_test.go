@@ -0,0 +1,203 @@
+package saga
+
+import (
+	"errors"
+	"registry_service/internal/app/models"
+	"testing"
+)
+
+func TestNext(t *testing.T) {
+	cases := []struct {
+		name       string
+		order      models.Order
+		event      Event
+		reason     models.CancelationReason
+		wantStatus models.OrderStatus
+		wantSteps  models.SagaStep
+		wantReason models.CancelationReason
+		// Transition must be refused if order has returns.
+		wantNoReturns bool
+		wantErr       error
+	}{
+		{
+			name:       "payment first",
+			order:      models.Order{Status: models.Pending},
+			event:      PaymentSucceeded,
+			wantStatus: models.Paid,
+			wantSteps:  models.WalletPaid,
+		},
+		{
+			name:       "reservation after payment completes order",
+			order:      models.Order{Status: models.Paid, Steps: models.WalletPaid},
+			event:      ReservationSucceeded,
+			wantStatus: models.Completed,
+			wantSteps:  models.WalletPaid | models.StorageReserved,
+		},
+		{
+			name:       "payment after reservation completes order",
+			order:      models.Order{Status: models.Reserved, Steps: models.StorageReserved},
+			event:      PaymentSucceeded,
+			wantStatus: models.Completed,
+			wantSteps:  models.WalletPaid | models.StorageReserved,
+		},
+		{
+			name:    "duplicated payment",
+			order:   models.Order{Status: models.Paid, Steps: models.WalletPaid},
+			event:   PaymentSucceeded,
+			wantErr: ErrStepAlreadyDone,
+		},
+		{
+			name:       "reservation failure rejects paid order",
+			order:      models.Order{Status: models.Paid, Steps: models.WalletPaid},
+			event:      ReservationFailed,
+			reason:     models.OutOfStock,
+			wantStatus: models.Rejected,
+			wantSteps:  models.WalletPaid | models.StorageFailed,
+			wantReason: models.OutOfStock,
+		},
+		{
+			name:       "expired reservation rejects reserved order",
+			order:      models.Order{Status: models.Reserved, Steps: models.StorageReserved},
+			event:      ReservationFailed,
+			reason:     models.ReservationExpired,
+			wantStatus: models.Rejected,
+			wantSteps:  models.StorageReserved | models.StorageFailed,
+			wantReason: models.ReservationExpired,
+		},
+		{
+			name: "second failure keeps first reason",
+			order: models.Order{
+				Status:         models.Rejected,
+				Steps:          models.WalletFailed,
+				RejectedReason: models.NotEnoughMoney,
+			},
+			event:      ReservationFailed,
+			reason:     models.OutOfStock,
+			wantStatus: models.Rejected,
+			wantSteps:  models.WalletFailed | models.StorageFailed,
+			wantReason: models.NotEnoughMoney,
+		},
+		{
+			name:    "late success can't resurrect rejected order",
+			order:   models.Order{Status: models.Rejected, Steps: models.WalletFailed},
+			event:   ReservationSucceeded,
+			wantErr: ErrIllegalTransition,
+		},
+		{
+			name:    "completed order can't be rejected",
+			order:   models.Order{Status: models.Completed, Steps: models.WalletPaid | models.StorageReserved},
+			event:   Aborted,
+			wantErr: ErrIllegalTransition,
+		},
+		{
+			name:       "user cancels paid order",
+			order:      models.Order{Status: models.Paid, Steps: models.WalletPaid},
+			event:      CanceledByUser,
+			reason:     models.CanceledByUser,
+			wantStatus: models.Canceled,
+			wantSteps:  models.WalletPaid,
+			wantReason: models.CanceledByUser,
+		},
+		{
+			name:          "user cancels completed order without returns",
+			order:         models.Order{Status: models.Completed, Steps: models.WalletPaid | models.StorageReserved},
+			event:         CanceledByUser,
+			reason:        models.CanceledByUser,
+			wantStatus:    models.Canceled,
+			wantSteps:     models.WalletPaid | models.StorageReserved,
+			wantReason:    models.CanceledByUser,
+			wantNoReturns: true,
+		},
+		{
+			name:       "late failure keeps canceled order",
+			order:      models.Order{Status: models.Canceled, RejectedReason: models.CanceledByUser},
+			event:      ReservationFailed,
+			reason:     models.OutOfStock,
+			wantStatus: models.Canceled,
+			wantSteps:  models.StorageFailed,
+			wantReason: models.CanceledByUser,
+		},
+		{
+			name:    "rejected order can't be canceled",
+			order:   models.Order{Status: models.Rejected},
+			event:   CanceledByUser,
+			wantErr: ErrIllegalTransition,
+		},
+		{
+			name:    "canceled twice",
+			order:   models.Order{Status: models.Canceled},
+			event:   CanceledByUser,
+			wantErr: ErrStepAlreadyDone,
+		},
+		{
+			name:    "aborted twice",
+			order:   models.Order{Status: models.Rejected},
+			event:   Aborted,
+			wantErr: ErrStepAlreadyDone,
+		},
+		{
+			name: "refund recorded on canceled order",
+			order: models.Order{
+				Status:         models.Canceled,
+				Steps:          models.WalletPaid | models.StorageReserved,
+				RejectedReason: models.CanceledByUser,
+			},
+			event:      PaymentCompensated,
+			wantStatus: models.Canceled,
+			wantSteps:  models.WalletPaid | models.StorageReserved | models.WalletCompensated,
+			wantReason: models.CanceledByUser,
+		},
+		{
+			name:       "release before rejection keeps order pending",
+			order:      models.Order{Status: models.Pending},
+			event:      ReservationCompensated,
+			wantStatus: models.Pending,
+			wantSteps:  models.StorageCompensated,
+		},
+		{
+			name:    "duplicated release",
+			order:   models.Order{Status: models.Rejected, Steps: models.StorageCompensated},
+			event:   ReservationCompensated,
+			wantErr: ErrStepAlreadyDone,
+		},
+		{
+			name:    "completed order has nothing to compensate",
+			order:   models.Order{Status: models.Completed},
+			event:   PaymentCompensated,
+			wantErr: ErrIllegalTransition,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+
+		t.Run(c.name, func(t *testing.T) {
+			order := c.order
+
+			transition, err := Next(&order, c.event, c.reason)
+			if c.wantErr != nil {
+				if !errors.Is(err, c.wantErr) {
+					t.Fatalf("expected err %v, got %v", c.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal("unexpected err", err)
+			}
+
+			if transition.From != c.order.Status ||
+				transition.To != c.wantStatus ||
+				transition.Steps != c.wantSteps ||
+				transition.Reason != c.wantReason ||
+				transition.NoReturns != c.wantNoReturns {
+				t.Errorf("unexpected transition %+v", *transition)
+			}
+
+			if order.Status != c.order.Status || order.Steps != c.order.Steps {
+				t.Error("order must not be changed by Next")
+			}
+		})
+	}
+}
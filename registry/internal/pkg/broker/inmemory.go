@@ -1,62 +1,200 @@
 package broker
 
 import (
+	"common/events"
+	"common/membus"
 	"context"
-	"encoding/json"
 	in "registry_service/internal/app/interfaces"
+	"registry_service/internal/pkg/conf"
 )
 
 type InMemoryBrokerClient struct {
-	newOrdersChan      chan []byte
-	rejectedOrdersChan chan []byte
+	bus                  membus.Bus
+	newOrdersTopic       string
+	rejectedOrdersTopic  string
+	successTopic         string
+	completedOrdersTopic string
+	returnedOrdersTopic  string
+	deadLettersTopic     string
+	rejectedOrders       <-chan []byte
+	success              <-chan []byte
+	completedOrders      <-chan []byte
+	returnedOrders       <-chan []byte
+	readerClosed         chan struct{}
+	writerClosed         chan struct{}
 }
 
+// Client on its own bus, msgs are consumed by the same client. Used by tests.
 func NewInMemoryBrokerClient() *InMemoryBrokerClient {
-	c := InMemoryBrokerClient{
-		newOrdersChan:      make(chan []byte, 10),
-		rejectedOrdersChan: make(chan []byte, 10),
+	config := &conf.Config{}
+	config.Kafka.NewOrdersTopic = "new_orders"
+	config.Kafka.RejectedOrdersTopic = "rejected_orders"
+	config.Kafka.SuccessTopic = "success_topic"
+	config.Kafka.CompletedOrdersTopic = "completed_orders"
+	config.Kafka.ReturnedOrdersTopic = "returned_orders"
+	config.Kafka.DeadLettersTopic = "dead_letters"
+	config.Kafka.GroupID = "registry"
+
+	return NewInMemoryBusClient(membus.NewInMemoryBus(), config)
+}
+
+// Client on the bus shared with other services running in the same process,
+// topics and consumer group are taken from Kafka config.
+func NewInMemoryBusClient(bus membus.Bus, config *conf.Config) *InMemoryBrokerClient {
+	c := config.Kafka
+
+	return &InMemoryBrokerClient{
+		bus:                  bus,
+		newOrdersTopic:       c.NewOrdersTopic,
+		rejectedOrdersTopic:  c.RejectedOrdersTopic,
+		successTopic:         c.SuccessTopic,
+		completedOrdersTopic: c.CompletedOrdersTopic,
+		returnedOrdersTopic:  c.ReturnedOrdersTopic,
+		deadLettersTopic:     c.DeadLettersTopic,
+		rejectedOrders:       bus.Subscribe(c.RejectedOrdersTopic, c.GroupID),
+		success:              bus.Subscribe(c.SuccessTopic, c.GroupID),
+		completedOrders:      bus.Subscribe(c.CompletedOrdersTopic, c.GroupID),
+		returnedOrders:       bus.Subscribe(c.ReturnedOrdersTopic, c.GroupID),
+		readerClosed:         make(chan struct{}),
+		writerClosed:         make(chan struct{}),
+	}
+}
+
+func (c *InMemoryBrokerClient) send(topic string, value []byte) error {
+	select {
+	case <-c.writerClosed:
+		return in.ErrBrokerConnClosed
+	default:
 	}
 
-	return &c
+	c.bus.Publish(topic, value)
+
+	return nil
+}
+
+func (c *InMemoryBrokerClient) receive(ctx context.Context, topic <-chan []byte) ([]byte, error) {
+	select {
+	case value := <-topic:
+		return value, nil
+	case <-c.readerClosed:
+		return nil, in.ErrBrokerConnClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *InMemoryBrokerClient) fetch(ctx context.Context, topic string, msgs <-chan []byte) (*in.BrokerMsg, error) {
+	value, err := c.receive(ctx, msgs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &in.BrokerMsg{Topic: topic, Value: value}, nil
 }
 
 func (c *InMemoryBrokerClient) SendNewOrderMsg(ctx context.Context, msg *in.NewOrderMsg) error {
-	value, err := json.Marshal(msg)
+	value, err := events.EncodeNewOrderMsg(producer, msg)
+	if err != nil {
+		return err
+	}
+
+	return c.send(c.newOrdersTopic, value)
+}
+
+func (c *InMemoryBrokerClient) SendOrderRejectedMsg(ctx context.Context, msg *in.OrderRejectedMsg) error {
+	value, err := events.EncodeOrderRejectedMsg(producer, msg)
 	if err != nil {
 		return err
 	}
 
-	c.newOrdersChan <- value
+	return c.send(c.rejectedOrdersTopic, value)
+}
 
-	return err
+func (c *InMemoryBrokerClient) SendOrderCompletedMsg(ctx context.Context, msg *in.OrderCompletedMsg) error {
+	value, err := events.EncodeOrderCompletedMsg(producer, msg)
+	if err != nil {
+		return err
+	}
+
+	return c.send(c.completedOrdersTopic, value)
 }
 
+// Registry doesn't consume completed orders, reader is used by tests.
+func (c *InMemoryBrokerClient) GetOrderCompletedMsg(ctx context.Context) (*in.OrderCompletedMsg, error) {
+	value, err := c.receive(ctx, c.completedOrders)
+	if err != nil {
+		return nil, err
+	}
+
+	return events.DecodeOrderCompletedMsg(value)
+}
+
+func (c *InMemoryBrokerClient) SendOrderReturnedMsg(ctx context.Context, msg *in.OrderReturnedMsg) error {
+	value, err := events.EncodeOrderReturnedMsg(producer, msg)
+	if err != nil {
+		return err
+	}
+
+	return c.send(c.returnedOrdersTopic, value)
+}
+
+// Registry doesn't consume returned orders, reader is used by tests.
+func (c *InMemoryBrokerClient) GetOrderReturnedMsg(ctx context.Context) (*in.OrderReturnedMsg, error) {
+	value, err := c.receive(ctx, c.returnedOrders)
+	if err != nil {
+		return nil, err
+	}
+
+	return events.DecodeOrderReturnedMsg(value)
+}
+
+func (c *InMemoryBrokerClient) FetchOrderRejectedMsg(ctx context.Context) (*in.BrokerMsg, error) {
+	return c.fetch(ctx, c.rejectedOrdersTopic, c.rejectedOrders)
+}
+
+// Reader of decoded msgs is used by tests.
 func (c *InMemoryBrokerClient) GetOrderRejectedMsg(ctx context.Context) (*in.OrderRejectedMsg, error) {
-	data, ok := <-c.rejectedOrdersChan
-	if !ok {
-		return nil, in.ErrBrokerConnClosed
+	value, err := c.receive(ctx, c.rejectedOrders)
+	if err != nil {
+		return nil, err
+	}
+
+	return events.DecodeOrderRejectedMsg(value)
+}
+
+// Registry doesn't produce success msgs, writer is used by tests.
+func (c *InMemoryBrokerClient) SendSuccessMsg(ctx context.Context, msg *in.OrderSuccessMsg) error {
+	value, err := events.EncodeOrderSuccessMsg(producer, msg)
+	if err != nil {
+		return err
 	}
 
-	var msg in.OrderRejectedMsg
-	err := json.Unmarshal(data, &msg)
+	return c.send(c.successTopic, value)
+}
+
+// Bus delivers every msg once, there are no offsets to commit.
+func (c *InMemoryBrokerClient) CommitMsg(ctx context.Context, msg *in.BrokerMsg) error {
+	return nil
+}
 
-	return &msg, err
+func (c *InMemoryBrokerClient) SendDeadLetter(ctx context.Context, key, value []byte) error {
+	return c.send(c.deadLettersTopic, value)
 }
 
 func (c *InMemoryBrokerClient) CloseReader() error {
-	close(c.rejectedOrdersChan)
+	close(c.readerClosed)
 
 	return nil
 }
 
 func (c *InMemoryBrokerClient) CloseWriter() error {
-	close(c.newOrdersChan)
+	close(c.writerClosed)
 
 	return nil
 }
 
-func (c *InMemoryBrokerClient) GetSuccessMsg(ctx context.Context) (*in.OrderSuccessMsg, error) {
-	panic("not impl")
+func (c *InMemoryBrokerClient) FetchSuccessMsg(ctx context.Context) (*in.BrokerMsg, error) {
+	return c.fetch(ctx, c.successTopic, c.success)
 }
 
 func (c *InMemoryBrokerClient) ProduceHealthCheckMsg(ctx context.Context) error {
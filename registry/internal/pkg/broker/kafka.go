@@ -1,9 +1,10 @@
 package broker
 
 import (
+	"common/events"
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	in "registry_service/internal/app/interfaces"
 	"registry_service/internal/pkg/conf"
 	"time"
@@ -11,11 +12,19 @@ import (
 	"github.com/segmentio/kafka-go"
 )
 
+// Producer name written to envelopes of the msgs sent by the service.
+const producer = "registry"
+
 type KafkaClient struct {
 	ReaderSuccess *kafka.Reader
 	ReaderFail    *kafka.Reader
 
-	Writer *kafka.Writer
+	Writer          *kafka.Writer
+	WriterRejected  *kafka.Writer
+	WriterCompleted *kafka.Writer
+	WriterReturned  *kafka.Writer
+
+	WriterDeadLetters *kafka.Writer
 
 	brokers          []string
 	healthCheckTopic string
@@ -29,6 +38,9 @@ func NewKafkaClient(config *conf.Config) (*KafkaClient, error) {
 		c.NewOrdersTopic == "" ||
 		c.RejectedOrdersTopic == "" ||
 		c.SuccessTopic == "" ||
+		c.CompletedOrdersTopic == "" ||
+		c.ReturnedOrdersTopic == "" ||
+		c.DeadLettersTopic == "" ||
 		c.GroupID == "" {
 		return nil, in.ErrInvalidBrokerConnParams
 	}
@@ -61,10 +73,43 @@ func NewKafkaClient(config *conf.Config) (*KafkaClient, error) {
 		DualStack: true,
 	}
 
+	// Order msgs are keyed by order id, Hash balancer writes msgs of one order to one partition.
 	client.Writer = kafka.NewWriter(kafka.WriterConfig{
 		Brokers:      c.Brokers,
 		Topic:        c.NewOrdersTopic,
-		Balancer:     &kafka.LeastBytes{},
+		Balancer:     &kafka.Hash{},
+		Dialer:       dialer,
+		RequiredAcks: -1,
+	})
+
+	client.WriterRejected = kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      c.Brokers,
+		Topic:        c.RejectedOrdersTopic,
+		Balancer:     &kafka.Hash{},
+		Dialer:       dialer,
+		RequiredAcks: -1,
+	})
+
+	client.WriterCompleted = kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      c.Brokers,
+		Topic:        c.CompletedOrdersTopic,
+		Balancer:     &kafka.Hash{},
+		Dialer:       dialer,
+		RequiredAcks: -1,
+	})
+
+	client.WriterReturned = kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      c.Brokers,
+		Topic:        c.ReturnedOrdersTopic,
+		Balancer:     &kafka.Hash{},
+		Dialer:       dialer,
+		RequiredAcks: -1,
+	})
+
+	client.WriterDeadLetters = kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      c.Brokers,
+		Topic:        c.DeadLettersTopic,
+		Balancer:     &kafka.Hash{},
 		Dialer:       dialer,
 		RequiredAcks: -1,
 	})
@@ -73,12 +118,13 @@ func NewKafkaClient(config *conf.Config) (*KafkaClient, error) {
 }
 
 func (c *KafkaClient) SendNewOrderMsg(ctx context.Context, msg *in.NewOrderMsg) error {
-	value, err := json.Marshal(msg)
+	value, err := events.EncodeNewOrderMsg(producer, msg)
 	if err != nil {
 		return err
 	}
 
 	data := kafka.Message{
+		Key:   events.OrderKey(msg.OrderID),
 		Value: value,
 	}
 
@@ -87,28 +133,110 @@ func (c *KafkaClient) SendNewOrderMsg(ctx context.Context, msg *in.NewOrderMsg)
 	return err
 }
 
-func (c *KafkaClient) GetOrderRejectedMsg(ctx context.Context) (*in.OrderRejectedMsg, error) {
-	data, err := c.ReaderFail.ReadMessage(ctx)
+func (c *KafkaClient) SendOrderRejectedMsg(ctx context.Context, msg *in.OrderRejectedMsg) error {
+	value, err := events.EncodeOrderRejectedMsg(producer, msg)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	data := kafka.Message{
+		Key:   events.OrderKey(msg.OrderID),
+		Value: value,
+	}
+
+	err = c.WriterRejected.WriteMessages(ctx, data)
+
+	return err
+}
+
+func (c *KafkaClient) SendOrderCompletedMsg(ctx context.Context, msg *in.OrderCompletedMsg) error {
+	value, err := events.EncodeOrderCompletedMsg(producer, msg)
+	if err != nil {
+		return err
+	}
+
+	data := kafka.Message{
+		Key:   events.OrderKey(msg.OrderID),
+		Value: value,
+	}
+
+	err = c.WriterCompleted.WriteMessages(ctx, data)
+
+	return err
+}
+
+func (c *KafkaClient) SendOrderReturnedMsg(ctx context.Context, msg *in.OrderReturnedMsg) error {
+	value, err := events.EncodeOrderReturnedMsg(producer, msg)
+	if err != nil {
+		return err
 	}
 
-	var msg in.OrderRejectedMsg
-	err = json.Unmarshal(data.Value, &msg)
+	data := kafka.Message{
+		Key:   events.OrderKey(msg.OrderID),
+		Value: value,
+	}
+
+	err = c.WriterReturned.WriteMessages(ctx, data)
+
+	return err
+}
+
+func (c *KafkaClient) FetchOrderRejectedMsg(ctx context.Context) (*in.BrokerMsg, error) {
+	return fetch(ctx, c.ReaderFail)
+}
 
-	return &msg, err
+func (c *KafkaClient) FetchSuccessMsg(ctx context.Context) (*in.BrokerMsg, error) {
+	return fetch(ctx, c.ReaderSuccess)
 }
 
-func (c *KafkaClient) GetSuccessMsg(ctx context.Context) (*in.OrderSuccessMsg, error) {
-	data, err := c.ReaderSuccess.ReadMessage(ctx)
+// Offset of fetched msg is not committed, consumer commits it by CommitMsg after handling.
+func fetch(ctx context.Context, reader *kafka.Reader) (*in.BrokerMsg, error) {
+	data, err := reader.FetchMessage(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	var msg in.OrderSuccessMsg
-	err = json.Unmarshal(data.Value, &msg)
+	return &in.BrokerMsg{
+		Topic:     data.Topic,
+		Partition: data.Partition,
+		Offset:    data.Offset,
+		Key:       data.Key,
+		Value:     data.Value,
+	}, nil
+}
+
+func (c *KafkaClient) CommitMsg(ctx context.Context, msg *in.BrokerMsg) error {
+	reader, err := c.reader(msg.Topic)
+	if err != nil {
+		return err
+	}
+
+	return reader.CommitMessages(ctx, kafka.Message{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+	})
+}
+
+// Offsets are committed by the group of the reader which fetched msg.
+func (c *KafkaClient) reader(topic string) (*kafka.Reader, error) {
+	for _, reader := range []*kafka.Reader{
+		c.ReaderFail,
+		c.ReaderSuccess,
+	} {
+		if reader.Config().Topic == topic {
+			return reader, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", in.ErrUnknownTopic, topic)
+}
 
-	return &msg, err
+func (c *KafkaClient) SendDeadLetter(ctx context.Context, key, value []byte) error {
+	return c.WriterDeadLetters.WriteMessages(ctx, kafka.Message{
+		Key:   key,
+		Value: value,
+	})
 }
 
 func (c *KafkaClient) CloseReader() error {
@@ -123,9 +251,27 @@ func (c *KafkaClient) CloseReader() error {
 }
 
 func (c *KafkaClient) CloseWriter() error {
-	err := c.Writer.Close()
+	if err := c.Writer.Close(); err != nil {
+		return err
+	}
 
-	return err
+	if err := c.WriterRejected.Close(); err != nil {
+		return err
+	}
+
+	if err := c.WriterCompleted.Close(); err != nil {
+		return err
+	}
+
+	if err := c.WriterReturned.Close(); err != nil {
+		return err
+	}
+
+	if err := c.WriterDeadLetters.Close(); err != nil {
+		return err
+	}
+
+	return nil
 }
 
 func (c *KafkaClient) ProduceHealthCheckMsg(ctx context.Context) error {
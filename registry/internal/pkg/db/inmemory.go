@@ -2,64 +2,296 @@ package db
 
 import (
 	"context"
+	"fmt"
 	in "registry_service/internal/app/interfaces"
 	"registry_service/internal/app/models"
+	"sort"
+	"sync"
+	"time"
 )
 
+// Stored orders and items are never returned, callers get copies,
+// so they can't change stored state bypassing the lock.
+func copyOrder(order *models.Order) *models.Order {
+	orderCopy := *order
+
+	if order.OrderItems != nil {
+		orderCopy.OrderItems = copyOrderItems(order.OrderItems)
+	}
+
+	return &orderCopy
+}
+
+func copyOrderItems(items []*models.OrderItem) []*models.OrderItem {
+	itemsCopy := make([]*models.OrderItem, 0, len(items))
+	for _, item := range items {
+		itemCopy := *item
+		itemsCopy = append(itemsCopy, &itemCopy)
+	}
+
+	return itemsCopy
+}
+
 // ------------------------------OrdersDAO------------------------------
 
 type InMemoryOrdersDAO struct {
 	OrdersKVStore map[uint]*models.Order
 	lastOrderID   uint
+	lastReturnID  uint
+	orderItemsDAO *InMemoryOrderItemsDAO
+	outboxDAO     *InMemoryOutboxDAO
+	mu            sync.RWMutex
 }
 
 func (dao *InMemoryOrdersDAO) Create(ctx context.Context, data *in.CreateOrderDTO) (*models.Order, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+
 	dao.lastOrderID++
 
 	order := &models.Order{
-		ID:     dao.lastOrderID,
-		UserID: data.UserID,
+		ID:        dao.lastOrderID,
+		UserID:    data.UserID,
+		CreatedAt: time.Now(),
 	}
 
 	dao.OrdersKVStore[dao.lastOrderID] = order
 
-	return order, nil
+	return copyOrder(order), nil
 }
 
+func (dao *InMemoryOrdersDAO) CreateWithItems(
+	ctx context.Context,
+	data *in.CreateOrderDTO,
+	items []*in.CreateOrderItemDTO,
+	buildMsg in.OutboxMsgBuilder,
+) (*models.Order, error) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+
+	order := &models.Order{
+		ID:        dao.lastOrderID + 1,
+		UserID:    data.UserID,
+		CreatedAt: time.Now(),
+	}
+
+	orderItems, err := dao.orderItemsDAO.CreateBulk(ctx, order.ID, items)
+	if err != nil {
+		return nil, err
+	}
+
+	order.OrderItems = orderItems
+
+	msg, err := buildMsg(order)
+	if err != nil {
+		dao.orderItemsDAO.deleteBulk(orderItems)
+
+		return nil, err
+	}
+
+	dao.outboxDAO.create(msg)
+
+	dao.lastOrderID++
+	dao.OrdersKVStore[order.ID] = order
+
+	return copyOrder(order), nil
+}
+
+// Orders of the user without items, oldest first.
 func (dao *InMemoryOrdersDAO) GetListByUserID(ctx context.Context, userID uint) ([]*models.Order, error) {
-	panic("not implemented")
+	dao.mu.RLock()
+	defer dao.mu.RUnlock()
+
+	orders := make([]*models.Order, 0, 10)
+
+	for id := uint(1); id <= dao.lastOrderID; id++ {
+		order, exists := dao.OrdersKVStore[id]
+		if !exists || order.UserID != userID {
+			continue
+		}
+
+		orderCopy := *order
+		orderCopy.OrderItems = nil
+		orders = append(orders, &orderCopy)
+	}
+
+	return orders, nil
 }
 
 func (dao *InMemoryOrdersDAO) GetByID(ctx context.Context, orderID uint) (*models.Order, error) {
-	panic("not implemented")
+	dao.mu.RLock()
+	defer dao.mu.RUnlock()
+
+	order, exists := dao.OrdersKVStore[orderID]
+	if !exists {
+		return nil, in.ErrOrderNotFound
+	}
+
+	return copyOrder(order), nil
+}
+
+func (dao *InMemoryOrdersDAO) GetListStuck(
+	ctx context.Context,
+	createdBefore time.Time,
+	limit uint16,
+) ([]*models.Order, error) {
+	dao.mu.RLock()
+	defer dao.mu.RUnlock()
+
+	orders := make([]*models.Order, 0, 10)
+
+	for _, order := range dao.OrdersKVStore {
+		notCompleted := order.Status == models.Pending ||
+			order.Status == models.Paid ||
+			order.Status == models.Reserved
+
+		if notCompleted && order.CreatedAt.Before(createdBefore) {
+			orderCopy := *order
+			orderCopy.OrderItems = nil
+			orders = append(orders, &orderCopy)
+		}
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+	})
+
+	if len(orders) > int(limit) {
+		orders = orders[:limit]
+	}
+
+	return orders, nil
 }
 
 func (dao *InMemoryOrdersDAO) Delete(ctx context.Context, orderID uint) error {
-	_, ok := dao.OrdersKVStore[orderID]
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+
+	order, ok := dao.OrdersKVStore[orderID]
 	if !ok {
 		return in.ErrOrderNotFound
 	}
 
+	dao.orderItemsDAO.deleteBulk(order.OrderItems)
 	delete(dao.OrdersKVStore, orderID)
 
 	return nil
 }
 
-func (dao *InMemoryOrdersDAO) UpdateStatus(
+func (dao *InMemoryOrdersDAO) CompareAndSetStatus(
 	ctx context.Context,
-	orderID uint,
-	status models.OrderStatus,
-	reasonCode models.CancelationReason,
+	data *in.OrderTransitionDTO,
 ) (*models.Order, error) {
-	order, exists := dao.OrdersKVStore[orderID]
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+
+	order, exists := dao.OrdersKVStore[data.OrderID]
 	if !exists {
 		return nil, in.ErrOrderNotFound
 	}
 
-	order.Status = status
-	order.RejectedReason = reasonCode
+	if order.Status != data.From {
+		return nil, in.ErrOrderStatusConflict
+	}
+
+	if data.CompletedAfter != nil && (order.CompletedAt == nil || !order.CompletedAt.After(*data.CompletedAfter)) {
+		return nil, in.ErrCancelWindowExpired
+	}
+
+	if data.NoReturns {
+		for _, item := range order.OrderItems {
+			if item.ReturnedCount != 0 {
+				return nil, in.ErrOrderHasReturns
+			}
+		}
+	}
+
+	order.Status = data.To
+	order.Steps = data.Steps
+	order.RejectedReason = data.Reason
 
-	return order, nil
+	if data.To == models.Completed {
+		completedAt := time.Now()
+		order.CompletedAt = &completedAt
+	}
+
+	if data.Msg != nil {
+		dao.outboxDAO.create(data.Msg)
+	}
+
+	return copyOrder(order), nil
+}
+
+func (dao *InMemoryOrdersDAO) CreateReturn(
+	ctx context.Context,
+	data *in.CreateReturnDTO,
+	buildMsg in.ReturnOutboxMsgBuilder,
+) (*models.OrderReturn, error) {
+	if len(data.Items) == 0 {
+		return nil, in.ErrEmptyReturnItems
+	}
+
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+
+	order, exists := dao.OrdersKVStore[data.OrderID]
+	if !exists {
+		return nil, in.ErrOrderNotFound
+	}
+
+	if order.Status != models.Completed {
+		return nil, in.ErrOrderNotReturnable
+	}
+
+	orderItems := make(map[uint]*models.OrderItem)
+	for _, item := range order.OrderItems {
+		orderItems[item.ID] = item
+	}
+
+	returnedCounts := make(map[uint]uint)
+
+	orderReturn := &models.OrderReturn{
+		ID:        dao.lastReturnID + 1,
+		OrderID:   order.ID,
+		Items:     make([]*models.OrderReturnItem, 0, len(data.Items)),
+		CreatedAt: time.Now(),
+	}
+
+	for _, v := range data.Items {
+		item, exists := orderItems[v.OrderItemID]
+		if !exists {
+			return nil, fmt.Errorf("%w: %d", in.ErrOrderItemNotFound, v.OrderItemID)
+		}
+
+		returnedCounts[item.ID] += uint(v.Count)
+		if uint(item.ReturnedCount)+returnedCounts[item.ID] > uint(item.Count) {
+			return nil, in.ErrReturnCountExceeded
+		}
+
+		orderReturn.Items = append(orderReturn.Items, &models.OrderReturnItem{
+			OrderItemID:  item.ID,
+			ProductID:    item.ProductID,
+			Count:        v.Count,
+			ProductPrice: item.ProductPrice,
+		})
+		orderReturn.Amount += item.ProductPrice.Mul(uint(v.Count))
+	}
+
+	msg, err := buildMsg(order, orderReturn)
+	if err != nil {
+		return nil, err
+	}
+
+	dao.outboxDAO.create(msg)
+
+	for id, count := range returnedCounts {
+		orderItems[id].ReturnedCount += uint8(count)
+		dao.orderItemsDAO.addReturnedCount(id, uint8(count))
+	}
+
+	dao.lastReturnID++
+
+	return orderReturn, nil
 }
 
 func (dao *InMemoryOrdersDAO) HealthCheck(ctx context.Context) error {
@@ -69,10 +301,15 @@ func (dao *InMemoryOrdersDAO) HealthCheck(ctx context.Context) error {
 func (dao *InMemoryOrdersDAO) Close() {
 }
 
-func NewInMemoryOrdersDAO() *InMemoryOrdersDAO {
+func NewInMemoryOrdersDAO(
+	orderItemsDAO *InMemoryOrderItemsDAO,
+	outboxDAO *InMemoryOutboxDAO,
+) *InMemoryOrdersDAO {
 	return &InMemoryOrdersDAO{
 		OrdersKVStore: make(map[uint]*models.Order),
 		lastOrderID:   0,
+		orderItemsDAO: orderItemsDAO,
+		outboxDAO:     outboxDAO,
 	}
 }
 
@@ -81,6 +318,7 @@ func NewInMemoryOrdersDAO() *InMemoryOrdersDAO {
 type InMemoryOrderItemsDAO struct {
 	OrderItemsKVStore map[uint]*models.OrderItem
 	lastOrderItemID   uint
+	mu                sync.RWMutex
 }
 
 func (dao *InMemoryOrderItemsDAO) CreateBulk(
@@ -92,6 +330,9 @@ func (dao *InMemoryOrderItemsDAO) CreateBulk(
 		return nil, in.ErrEmptyOrderItems
 	}
 
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+
 	orderItems := make([]*models.OrderItem, 0, 10)
 
 	for _, item := range items {
@@ -110,7 +351,27 @@ func (dao *InMemoryOrderItemsDAO) CreateBulk(
 		orderItems = append(orderItems, orderItem)
 	}
 
-	return orderItems, nil
+	return copyOrderItems(orderItems), nil
+}
+
+// Rolls back items created by CreateBulk.
+func (dao *InMemoryOrderItemsDAO) deleteBulk(items []*models.OrderItem) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+
+	for _, item := range items {
+		delete(dao.OrderItemsKVStore, item.ID)
+	}
+}
+
+// Keeps returned count of the item in line with the order copy.
+func (dao *InMemoryOrderItemsDAO) addReturnedCount(orderItemID uint, count uint8) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+
+	if item, exists := dao.OrderItemsKVStore[orderItemID]; exists {
+		item.ReturnedCount += count
+	}
 }
 
 func (dao *InMemoryOrderItemsDAO) Create(
@@ -118,11 +379,26 @@ func (dao *InMemoryOrderItemsDAO) Create(
 	orderID uint,
 	data *in.CreateOrderItemDTO,
 ) (*models.OrderItem, error) {
-	panic("not implemented")
+	items, err := dao.CreateBulk(ctx, orderID, []*in.CreateOrderItemDTO{data})
+	if err != nil {
+		return nil, err
+	}
+
+	return items[0], nil
 }
 
 func (dao *InMemoryOrderItemsDAO) GetByID(ctx context.Context, orderItemID uint) (*models.OrderItem, error) {
-	panic("not implemented")
+	dao.mu.RLock()
+	defer dao.mu.RUnlock()
+
+	item, exists := dao.OrderItemsKVStore[orderItemID]
+	if !exists {
+		return nil, in.ErrOrderItemNotFound
+	}
+
+	itemCopy := *item
+
+	return &itemCopy, nil
 }
 
 func (dao *InMemoryOrderItemsDAO) HealthCheck(ctx context.Context) error {
@@ -142,7 +418,8 @@ func NewInMemoryOrderItemsDAO() *InMemoryOrderItemsDAO {
 // ---------------------------- ProductPricesDAO----------------------------
 
 type InMemoryProductPricesDAO struct {
-	ProductPricesKVStore map[uint]float32
+	ProductsKVStore map[uint]*models.Product
+	mu              sync.RWMutex
 }
 
 func (dao *InMemoryProductPricesDAO) GetMap(ctx context.Context, productIDs []uint) (in.ProductPricesMap, error) {
@@ -150,22 +427,44 @@ func (dao *InMemoryProductPricesDAO) GetMap(ctx context.Context, productIDs []ui
 		return nil, in.ErrEmptyProductIDs
 	}
 
-	pricesMap := make(map[uint]float32)
+	dao.mu.RLock()
+	defer dao.mu.RUnlock()
+
+	pricesMap := make(in.ProductPricesMap)
 
 	for _, id := range productIDs {
-		val, exists := dao.ProductPricesKVStore[id]
-		if !exists {
-			return nil, in.ErrProductNotFound
+		product, exists := dao.ProductsKVStore[id]
+		if !exists || !product.Active {
+			continue
 		}
 
-		pricesMap[id] = val
+		pricesMap[id] = product.Price
 	}
 
 	return pricesMap, nil
 }
 
+// Active products ordered by id.
 func (dao *InMemoryProductPricesDAO) GetList(ctx context.Context) ([]*models.Product, error) {
-	panic("not implemented")
+	dao.mu.RLock()
+	defer dao.mu.RUnlock()
+
+	products := make([]*models.Product, 0, len(dao.ProductsKVStore))
+
+	for _, product := range dao.ProductsKVStore {
+		if !product.Active {
+			continue
+		}
+
+		productCopy := *product
+		products = append(products, &productCopy)
+	}
+
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].ID < products[j].ID
+	})
+
+	return products, nil
 }
 
 func (dao *InMemoryProductPricesDAO) HealthCheck(ctx context.Context) error {
@@ -176,14 +475,128 @@ func (dao *InMemoryProductPricesDAO) Close() {
 }
 
 func NewInMemoryProductPricesDAO() *InMemoryProductPricesDAO {
-	productPrices := map[uint]float32{
-		1: 1.0,
-		2: 2.0,
-		3: 3.0,
-		4: 4.0,
+	products := map[uint]*models.Product{
+		1: {ID: 1, Title: "A", Price: 100, Active: true},
+		2: {ID: 2, Title: "B", Price: 200, Active: true},
+		3: {ID: 3, Title: "C", Price: 300, Active: true},
+		4: {ID: 4, Title: "D", Price: 400, Active: true},
 	}
 
 	return &InMemoryProductPricesDAO{
-		ProductPricesKVStore: productPrices,
+		ProductsKVStore: products,
+	}
+}
+
+// ---------------------------- OutboxDAO----------------------------
+
+type InMemoryOutboxDAO struct {
+	OutboxKVStore map[uint]*models.OutboxMsg
+	lastMsgID     uint
+	mu            sync.RWMutex
+}
+
+func (dao *InMemoryOutboxDAO) create(data *in.CreateOutboxMsgDTO) {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+
+	dao.lastMsgID++
+
+	dao.OutboxKVStore[dao.lastMsgID] = &models.OutboxMsg{
+		ID:        dao.lastMsgID,
+		EventType: data.EventType,
+		Payload:   data.Payload,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Saves msg which is not bound to a status change.
+func (dao *InMemoryOutboxDAO) Create(ctx context.Context, data *in.CreateOutboxMsgDTO) error {
+	dao.create(data)
+
+	return nil
+}
+
+func (dao *InMemoryOutboxDAO) GetPending(ctx context.Context, limit uint16) ([]*models.OutboxMsg, error) {
+	dao.mu.RLock()
+	defer dao.mu.RUnlock()
+
+	msgs := make([]*models.OutboxMsg, 0, 10)
+
+	for id := uint(1); id <= dao.lastMsgID && len(msgs) < int(limit); id++ {
+		msg, exists := dao.OutboxKVStore[id]
+		if !exists || msg.SentAt != nil || msg.FailedAt != nil {
+			continue
+		}
+
+		msgCopy := *msg
+		msgs = append(msgs, &msgCopy)
+	}
+
+	return msgs, nil
+}
+
+func (dao *InMemoryOutboxDAO) MarkSent(ctx context.Context, msgID uint) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+
+	msg, exists := dao.OutboxKVStore[msgID]
+	if !exists {
+		return in.ErrOutboxMsgNotFound
+	}
+
+	sentAt := time.Now()
+	msg.SentAt = &sentAt
+
+	return nil
+}
+
+// Reason is not kept in memory, relay logs it.
+func (dao *InMemoryOutboxDAO) MarkFailed(ctx context.Context, msgID uint, reason string) error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+
+	msg, exists := dao.OutboxKVStore[msgID]
+	if !exists {
+		return in.ErrOutboxMsgNotFound
+	}
+
+	failedAt := time.Now()
+	msg.FailedAt = &failedAt
+
+	return nil
+}
+
+func (dao *InMemoryOutboxDAO) GetStats(ctx context.Context) (*in.OutboxStats, error) {
+	dao.mu.RLock()
+	defer dao.mu.RUnlock()
+
+	var stats in.OutboxStats
+
+	for _, msg := range dao.OutboxKVStore {
+		if msg.SentAt != nil || msg.FailedAt != nil {
+			continue
+		}
+
+		stats.Pending++
+
+		if stats.OldestCreatedAt.IsZero() || msg.CreatedAt.Before(stats.OldestCreatedAt) {
+			stats.OldestCreatedAt = msg.CreatedAt
+		}
+	}
+
+	return &stats, nil
+}
+
+func (dao *InMemoryOutboxDAO) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+func (dao *InMemoryOutboxDAO) Close() {
+}
+
+func NewInMemoryOutboxDAO() *InMemoryOutboxDAO {
+	return &InMemoryOutboxDAO{
+		OutboxKVStore: make(map[uint]*models.OutboxMsg),
+		lastMsgID:     0,
 	}
 }
@@ -0,0 +1 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS saga_steps smallint NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS orders_status_created_at_idx ON orders(status, created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE products ALTER COLUMN price TYPE numeric(12, 2);
+ALTER TABLE order_items ALTER COLUMN product_price TYPE numeric(12, 2);
@@ -0,0 +1 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS active boolean NOT NULL DEFAULT TRUE;
@@ -0,0 +1,19 @@
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS returned_count smallint NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD CONSTRAINT order_items_returned_count_check
+  CHECK (returned_count >= 0 AND returned_count <= count);
+
+CREATE TABLE IF NOT EXISTS order_returns (
+  id SERIAL PRIMARY KEY,
+  order_id bigint NOT NULL REFERENCES orders ON DELETE CASCADE,
+  amount numeric(12, 2) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS order_returns_order_id_idx ON order_returns (order_id);
+
+CREATE TABLE IF NOT EXISTS order_return_items (
+  id SERIAL PRIMARY KEY,
+  return_id bigint NOT NULL REFERENCES order_returns ON DELETE CASCADE,
+  order_item_id bigint NOT NULL REFERENCES order_items ON DELETE CASCADE,
+  count smallint NOT NULL CHECK (count > 0)
+);
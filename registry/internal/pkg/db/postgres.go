@@ -1,17 +1,22 @@
 package db
 
 import (
+	"common/deadletter"
+	"common/pg"
 	"context"
+	"errors"
 	"fmt"
 	in "registry_service/internal/app/interfaces"
 	"registry_service/internal/app/models"
 	"registry_service/internal/pkg/conf"
 	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-var migrationsApplied bool
+const migrationsDir = "./internal/pkg/db/migrations"
 
 // ------------------------------OrdersDAO------------------------------
 
@@ -29,11 +34,62 @@ func (dao *PostgresOrdersDAO) Create(ctx context.Context, data *in.CreateOrderDT
 		&order.Status,
 		&order.RejectedReason,
 		&order.CreatedAt,
+		&order.Steps,
+		&order.CompletedAt,
 	)
 
 	return &order, err
 }
 
+// Creates order, its items and outbox msg about the order in one transaction.
+func (dao *PostgresOrdersDAO) CreateWithItems(
+	ctx context.Context,
+	data *in.CreateOrderDTO,
+	items []*in.CreateOrderItemDTO,
+	buildMsg in.OutboxMsgBuilder,
+) (*models.Order, error) {
+	tx, err := dao.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	var order models.Order
+
+	err = tx.QueryRow(ctx, "create_order", data.UserID, models.Pending).Scan(
+		&order.ID,
+		&order.UserID,
+		&order.Status,
+		&order.RejectedReason,
+		&order.CreatedAt,
+		&order.Steps,
+		&order.CompletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	order.OrderItems, err = insertOrderItems(ctx, tx, order.ID, items)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := buildMsg(&order)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, "create_outbox_msg", msg.EventType, msg.Payload); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
 func (dao *PostgresOrdersDAO) GetListByUserID(ctx context.Context, userID uint) ([]*models.Order, error) {
 	rows, err := dao.db.Query(ctx, "orders_list_by_user_id", userID)
 	if err != nil {
@@ -51,6 +107,8 @@ func (dao *PostgresOrdersDAO) GetListByUserID(ctx context.Context, userID uint)
 			&order.Status,
 			&order.RejectedReason,
 			&order.CreatedAt,
+			&order.Steps,
+			&order.CompletedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -75,7 +133,13 @@ func (dao *PostgresOrdersDAO) GetByID(ctx context.Context, orderID uint) (*model
 		&order.Status,
 		&order.RejectedReason,
 		&order.CreatedAt,
+		&order.Steps,
+		&order.CompletedAt,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, in.ErrOrderNotFound
+	}
+
 	if err != nil {
 		return nil, err
 	}
@@ -96,6 +160,7 @@ func (dao *PostgresOrdersDAO) GetByID(ctx context.Context, orderID uint) (*model
 			&item.ProductID,
 			&item.Count,
 			&item.ProductPrice,
+			&item.ReturnedCount,
 		)
 		if err != nil {
 			return nil, err
@@ -106,7 +171,49 @@ func (dao *PostgresOrdersDAO) GetByID(ctx context.Context, orderID uint) (*model
 
 	order.OrderItems = items
 
-	return &order, err
+	return &order, rows.Err()
+}
+
+func (dao *PostgresOrdersDAO) GetListStuck(
+	ctx context.Context,
+	createdBefore time.Time,
+	limit uint16,
+) ([]*models.Order, error) {
+	rows, err := dao.db.Query(
+		ctx,
+		"orders_list_stuck",
+		models.Pending,
+		models.Paid,
+		models.Reserved,
+		createdBefore,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]*models.Order, 0, 10)
+
+	for rows.Next() {
+		var order models.Order
+
+		err = rows.Scan(
+			&order.ID,
+			&order.UserID,
+			&order.Status,
+			&order.RejectedReason,
+			&order.CreatedAt,
+			&order.Steps,
+			&order.CompletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		orders = append(orders, &order)
+	}
+
+	return orders, rows.Err()
 }
 
 func (dao *PostgresOrdersDAO) Delete(ctx context.Context, orderID uint) error {
@@ -115,69 +222,288 @@ func (dao *PostgresOrdersDAO) Delete(ctx context.Context, orderID uint) error {
 	return err
 }
 
-func (dao *PostgresOrdersDAO) UpdateStatus(
+// Sets order status if it is still equal to transition From status.
+// Transition msg is saved to outbox in the same transaction.
+func (dao *PostgresOrdersDAO) CompareAndSetStatus(
 	ctx context.Context,
-	orderID uint,
-	status models.OrderStatus,
-	reasonCode models.CancelationReason,
+	data *in.OrderTransitionDTO,
 ) (*models.Order, error) {
+	tx, err := dao.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if data.NoReturns {
+		if err := checkNoReturns(ctx, tx, data.OrderID); err != nil {
+			return nil, err
+		}
+	}
+
 	var order models.Order
 
-	err := dao.db.QueryRow(ctx, "update_order_status", status, orderID, reasonCode).Scan(
+	err = tx.QueryRow(
+		ctx,
+		"compare_and_set_order_status",
+		data.OrderID,
+		data.From,
+		data.To,
+		data.Steps,
+		data.Reason,
+		models.Completed,
+		data.CompletedAfter,
+	).Scan(
 		&order.ID,
 		&order.UserID,
 		&order.Status,
 		&order.RejectedReason,
 		&order.CreatedAt,
+		&order.Steps,
+		&order.CompletedAt,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, transitionConflict(ctx, tx, data)
+	}
 
-	return &order, err
+	if err != nil {
+		return nil, err
+	}
+
+	if data.Msg != nil {
+		if _, err := tx.Exec(ctx, "create_outbox_msg", data.Msg.EventType, data.Msg.Payload); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &order, nil
 }
 
-func (dao *PostgresOrdersDAO) HealthCheck(ctx context.Context) error {
-	if err := dao.db.Ping(ctx); err != nil {
+// Transition is not applied either because order status has changed
+// or because order was completed before CompletedAfter.
+func transitionConflict(ctx context.Context, tx pgx.Tx, data *in.OrderTransitionDTO) error {
+	if data.CompletedAfter == nil {
+		return in.ErrOrderStatusConflict
+	}
+
+	var status models.OrderStatus
+
+	err := tx.QueryRow(ctx, "order_status_by_id", data.OrderID).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return in.ErrOrderNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if status == data.From {
+		return in.ErrCancelWindowExpired
+	}
+
+	return in.ErrOrderStatusConflict
+}
+
+// Order row is locked like CreateReturn does, so returns committed
+// before the lock are seen and new ones wait for the transition.
+func checkNoReturns(ctx context.Context, tx pgx.Tx, orderID uint) error {
+	var hasReturns bool
+
+	if _, err := tx.Exec(ctx, "lock_order", orderID); err != nil {
+		return err
+	}
+
+	if err := tx.QueryRow(ctx, "order_has_returns", orderID).Scan(&hasReturns); err != nil {
 		return err
 	}
 
+	if hasReturns {
+		return in.ErrOrderHasReturns
+	}
+
 	return nil
 }
 
-func (dao *PostgresOrdersDAO) Close() {
-	dao.db.Close()
+// Item is not returned either because it is not an item of the order
+// or because it would be returned more times than ordered.
+func returnItemConflict(ctx context.Context, tx pgx.Tx, orderItemID, orderID uint) error {
+	var exists bool
+
+	if err := tx.QueryRow(ctx, "order_item_exists", orderItemID, orderID).Scan(&exists); err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("%w: %d", in.ErrOrderItemNotFound, orderItemID)
+	}
+
+	return in.ErrReturnCountExceeded
 }
 
-func NewPostgresOrdersDAO(ctx context.Context, config *conf.Config) *PostgresOrdersDAO {
-	dbConn := GetPostgresConnection(ctx, config.RegistryDatabaseURI())
+// Marks order items returned and records the return with its outbox msg in one transaction.
+// Order row is locked, so return can't race with order status change,
+// ErrReturnCountExceeded is returned if any item would be returned more times than ordered,
+// ErrOrderItemNotFound if it is not an item of the order.
+func (dao *PostgresOrdersDAO) CreateReturn(
+	ctx context.Context,
+	data *in.CreateReturnDTO,
+	buildMsg in.ReturnOutboxMsgBuilder,
+) (*models.OrderReturn, error) {
+	if len(data.Items) == 0 {
+		return nil, in.ErrEmptyReturnItems
+	}
+
+	tx, err := dao.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	var order models.Order
+
+	err = tx.QueryRow(ctx, "lock_order_by_id", data.OrderID).Scan(
+		&order.ID,
+		&order.UserID,
+		&order.Status,
+		&order.RejectedReason,
+		&order.CreatedAt,
+		&order.Steps,
+		&order.CompletedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, in.ErrOrderNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Status != models.Completed {
+		return nil, in.ErrOrderNotReturnable
+	}
+
+	orderReturn := models.OrderReturn{
+		OrderID: order.ID,
+		Items:   make([]*models.OrderReturnItem, 0, len(data.Items)),
+	}
+
+	for _, v := range data.Items {
+		item := models.OrderReturnItem{
+			OrderItemID: v.OrderItemID,
+			Count:       v.Count,
+		}
+
+		err := tx.QueryRow(ctx, "return_order_item", v.OrderItemID, order.ID, v.Count).Scan(
+			&item.ProductID,
+			&item.ProductPrice,
+		)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, returnItemConflict(ctx, tx, v.OrderItemID, order.ID)
+		}
 
-	if !migrationsApplied {
-		err := Migrate(ctx, dbConn)
 		if err != nil {
-			panic(err)
+			return nil, err
+		}
+
+		orderReturn.Items = append(orderReturn.Items, &item)
+		orderReturn.Amount += item.ProductPrice.Mul(uint(item.Count))
+	}
+
+	err = tx.QueryRow(ctx, "create_order_return", order.ID, orderReturn.Amount).Scan(
+		&orderReturn.ID,
+		&orderReturn.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range orderReturn.Items {
+		if _, err := tx.Exec(ctx, "create_order_return_item", orderReturn.ID, item.OrderItemID, item.Count); err != nil {
+			return nil, err
 		}
 	}
 
-	defer func() { migrationsApplied = true }()
+	msg, err := buildMsg(&order, &orderReturn)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, "create_outbox_msg", msg.EventType, msg.Payload); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &orderReturn, nil
+}
+
+func (dao *PostgresOrdersDAO) HealthCheck(ctx context.Context) error {
+	if err := dao.db.Ping(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (dao *PostgresOrdersDAO) Close() {
+	pg.Release(dao.db)
+}
+
+func NewPostgresOrdersDAO(ctx context.Context, config *conf.Config) *PostgresOrdersDAO {
+	dbConn := pg.MustOpen(ctx, config.RegistryDatabaseURI(), migrationsDir)
 
 	queriesMap := map[string]string{
 		"create_order": `INSERT INTO orders(user_id, status) 
 			VALUES($1::bigint, $2::smallint) 
-			RETURNING id, user_id, status, rejected_reason, created_at;`,
+			RETURNING id, user_id, status, rejected_reason, created_at, saga_steps, completed_at;`,
 		"orders_list_by_user_id": `SELECT id, user_id, status, 
-			rejected_reason, created_at FROM orders WHERE user_id=$1::bigint;`,
-		"get_order_by_id": `SELECT id, user_id, status, rejected_reason, created_at
+			rejected_reason, created_at, saga_steps, completed_at FROM orders WHERE user_id=$1::bigint;`,
+		"get_order_by_id": `SELECT id, user_id, status, rejected_reason, created_at, saga_steps, completed_at
 			FROM orders
 			WHERE id=$1::bigint;`,
-		"get_order_items_by_order_id": `SELECT id, order_id, product_id, count, product_price
+		"get_order_items_by_order_id": `SELECT id, order_id, product_id, count, product_price, returned_count
 			FROM order_items
-			WHERE order_id=$1::bigint;`,
-		"update_order_status": `UPDATE orders 
-			SET status=$1::smallint, rejected_reason=$3::smallint 
-			WHERE id=$2::bigint 
-			returning id, user_id, status, rejected_reason, created_at;`,
+			WHERE order_id=$1::bigint
+			ORDER BY id;`,
+		"compare_and_set_order_status": `UPDATE orders 
+			SET status=$3::smallint, saga_steps=$4::smallint, rejected_reason=$5::smallint,
+				completed_at=CASE WHEN $3::smallint=$6::smallint THEN NOW() ELSE completed_at END
+			WHERE id=$1::bigint AND status=$2::smallint
+				AND ($7::timestamptz IS NULL OR completed_at > $7::timestamptz)
+			RETURNING id, user_id, status, rejected_reason, created_at, saga_steps, completed_at;`,
+		"order_status_by_id": `SELECT status FROM orders WHERE id=$1::bigint;`,
+		"orders_list_stuck": `SELECT id, user_id, status, rejected_reason, created_at, saga_steps, completed_at
+			FROM orders
+			WHERE status IN ($1::smallint, $2::smallint, $3::smallint) AND created_at < $4::timestamptz
+			ORDER BY created_at
+			LIMIT $5::int;`,
 		"delete_order": `DELETE FROM orders WHERE id=$1::bigint;`,
+		"create_outbox_msg": `INSERT INTO outbox(event_type, payload)
+			VALUES($1::smallint, $2::jsonb);`,
+		"lock_order_by_id": `SELECT id, user_id, status, rejected_reason, created_at, saga_steps, completed_at
+			FROM orders
+			WHERE id=$1::bigint
+			FOR UPDATE;`,
+		"lock_order":        `SELECT id FROM orders WHERE id=$1::bigint FOR UPDATE;`,
+		"order_item_exists": `SELECT EXISTS(SELECT 1 FROM order_items WHERE id=$1::bigint AND order_id=$2::bigint);`,
+		"order_has_returns": `SELECT EXISTS(SELECT 1 FROM order_items WHERE order_id=$1::bigint AND returned_count > 0);`,
+		"return_order_item": `UPDATE order_items
+			SET returned_count=returned_count + $3::smallint
+			WHERE id=$1::bigint AND order_id=$2::bigint AND returned_count + $3::smallint <= count
+			RETURNING product_id, product_price;`,
+		"create_order_return": `INSERT INTO order_returns(order_id, amount)
+			VALUES($1::bigint, $2::decimal)
+			RETURNING id, created_at;`,
+		"create_order_return_item": `INSERT INTO order_return_items(return_id, order_item_id, count)
+			VALUES($1::bigint, $2::bigint, $3::smallint);`,
 	}
 
-	submitPreparedStatements(ctx, queriesMap, dbConn)
+	pg.MustPrepare(ctx, dbConn, queriesMap)
 
 	return &PostgresOrdersDAO{
 		db:          dbConn,
@@ -197,6 +523,19 @@ func (dao *PostgresOrderItemsDAO) CreateBulk(
 	orderID uint,
 	items []*in.CreateOrderItemDTO,
 ) ([]*models.OrderItem, error) {
+	return insertOrderItems(ctx, dao.db, orderID, items)
+}
+
+func insertOrderItems(
+	ctx context.Context,
+	db pg.Querier,
+	orderID uint,
+	items []*in.CreateOrderItemDTO,
+) ([]*models.OrderItem, error) {
+	if len(items) == 0 {
+		return nil, in.ErrEmptyOrderItems
+	}
+
 	var query strings.Builder
 
 	query.WriteString(`INSERT INTO order_items(order_id, product_id, count, product_price) VALUES `)
@@ -216,10 +555,11 @@ func (dao *PostgresOrderItemsDAO) CreateBulk(
 
 	query.WriteString(" RETURNING id, order_id, product_id, count, product_price;")
 
-	rows, err := dao.db.Query(ctx, query.String())
+	rows, err := db.Query(ctx, query.String())
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	orderItems := make([]*models.OrderItem, 0, 10)
 
@@ -264,16 +604,7 @@ func (dao *PostgresOrderItemsDAO) HealthCheck(ctx context.Context) error {
 }
 
 func NewPostgresOrderItemsDAO(ctx context.Context, config *conf.Config) *PostgresOrderItemsDAO {
-	dbConn := GetPostgresConnection(ctx, config.RegistryDatabaseURI())
-
-	if !migrationsApplied {
-		err := Migrate(ctx, dbConn)
-		if err != nil {
-			panic(err)
-		}
-	}
-
-	defer func() { migrationsApplied = true }()
+	dbConn := pg.MustOpen(ctx, config.RegistryDatabaseURI(), migrationsDir)
 
 	queriesMap := map[string]string{
 		"orders_list_by_user_id": `SELECT id, user_id, status, 
@@ -281,7 +612,7 @@ func NewPostgresOrderItemsDAO(ctx context.Context, config *conf.Config) *Postgre
 		"delete_order": `DELETE FROM orders WHERE id=$1::bigint;`,
 	}
 
-	submitPreparedStatements(ctx, queriesMap, dbConn)
+	pg.MustPrepare(ctx, dbConn, queriesMap)
 
 	return &PostgresOrderItemsDAO{
 		db:              dbConn,
@@ -290,7 +621,7 @@ func NewPostgresOrderItemsDAO(ctx context.Context, config *conf.Config) *Postgre
 }
 
 func (dao *PostgresOrderItemsDAO) Close() {
-	dao.db.Close()
+	pg.Release(dao.db)
 }
 
 // ---------------------------- ProductPricesDAO----------------------------
@@ -305,26 +636,25 @@ func (dao *PostgresProductPricesDAO) GetMap(ctx context.Context, productIDs []ui
 		return nil, in.ErrEmptyProductIDs
 	}
 
-	pricesMap := make(map[uint]float32)
+	pricesMap := make(in.ProductPricesMap)
 
-	rows, err := dao.db.Query(ctx, "products_list")
+	rows, err := dao.db.Query(ctx, "active_product_prices_by_ids", productIDs)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var product models.Product
-
-		err = rows.Scan(
-			&product.ID,
-			&product.Title,
-			&product.Price,
+		var (
+			productID uint
+			price     models.Money
 		)
-		if err != nil {
+
+		if err := rows.Scan(&productID, &price); err != nil {
 			return nil, err
 		}
 
-		pricesMap[product.ID] = product.Price
+		pricesMap[productID] = price
 	}
 
 	return pricesMap, rows.Err()
@@ -335,6 +665,7 @@ func (dao *PostgresProductPricesDAO) GetList(ctx context.Context) ([]*models.Pro
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	products := make([]*models.Product, 0, 10)
 
@@ -345,6 +676,7 @@ func (dao *PostgresProductPricesDAO) GetList(ctx context.Context) ([]*models.Pro
 			&product.ID,
 			&product.Title,
 			&product.Price,
+			&product.Active,
 		)
 		if err != nil {
 			return nil, err
@@ -353,7 +685,7 @@ func (dao *PostgresProductPricesDAO) GetList(ctx context.Context) ([]*models.Pro
 		products = append(products, &product)
 	}
 
-	return products, nil
+	return products, rows.Err()
 }
 
 func (dao *PostgresProductPricesDAO) HealthCheck(ctx context.Context) error {
@@ -365,29 +697,156 @@ func (dao *PostgresProductPricesDAO) HealthCheck(ctx context.Context) error {
 }
 
 func (dao *PostgresProductPricesDAO) Close() {
-	dao.db.Close()
+	pg.Release(dao.db)
 }
 
 func NewPostgresProductPricesDAO(ctx context.Context, config *conf.Config) *PostgresProductPricesDAO {
-	dbConn := GetPostgresConnection(ctx, config.RegistryDatabaseURI())
+	dbConn := pg.MustOpen(ctx, config.RegistryDatabaseURI(), migrationsDir)
+
+	queriesMap := map[string]string{
+		"products_list": `SELECT id, title, price, active FROM products WHERE active;`,
+		"active_product_prices_by_ids": `SELECT id, price
+			FROM products
+			WHERE id=ANY($1::bigint[]) AND active;`,
+	}
+
+	pg.MustPrepare(ctx, dbConn, queriesMap)
+
+	return &PostgresProductPricesDAO{
+		db:            dbConn,
+		productsTable: config.RegistryDatabase.ProductsTable,
+	}
+}
+
+// ---------------------------- OutboxDAO----------------------------
+
+type PostgresOutboxDAO struct {
+	db *pgxpool.Pool
+}
+
+func (dao *PostgresOutboxDAO) GetPending(ctx context.Context, limit uint16) ([]*models.OutboxMsg, error) {
+	rows, err := dao.db.Query(ctx, "outbox_pending_list", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := make([]*models.OutboxMsg, 0, 10)
+
+	for rows.Next() {
+		var msg models.OutboxMsg
 
-	if !migrationsApplied {
-		err := Migrate(ctx, dbConn)
+		err = rows.Scan(
+			&msg.ID,
+			&msg.EventType,
+			&msg.Payload,
+			&msg.CreatedAt,
+		)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
+
+		msgs = append(msgs, &msg)
+	}
+
+	return msgs, rows.Err()
+}
+
+// Saves msg which is not bound to a status change.
+func (dao *PostgresOutboxDAO) Create(ctx context.Context, data *in.CreateOutboxMsgDTO) error {
+	_, err := dao.db.Exec(ctx, "create_outbox_msg", data.EventType, data.Payload)
+
+	return err
+}
+
+func (dao *PostgresOutboxDAO) MarkSent(ctx context.Context, msgID uint) error {
+	tag, err := dao.db.Exec(ctx, "outbox_mark_sent", msgID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return in.ErrOutboxMsgNotFound
+	}
+
+	return nil
+}
+
+func (dao *PostgresOutboxDAO) MarkFailed(ctx context.Context, msgID uint, reason string) error {
+	tag, err := dao.db.Exec(ctx, "outbox_mark_failed", msgID, reason)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return in.ErrOutboxMsgNotFound
+	}
+
+	return nil
+}
+
+func (dao *PostgresOutboxDAO) GetStats(ctx context.Context) (*in.OutboxStats, error) {
+	var (
+		stats  in.OutboxStats
+		oldest *time.Time
+	)
+
+	err := dao.db.QueryRow(ctx, "outbox_stats").Scan(&stats.Pending, &oldest)
+	if err != nil {
+		return nil, err
+	}
+
+	if oldest != nil {
+		stats.OldestCreatedAt = *oldest
+	}
+
+	return &stats, nil
+}
+
+func (dao *PostgresOutboxDAO) HealthCheck(ctx context.Context) error {
+	if err := dao.db.Ping(ctx); err != nil {
+		return err
 	}
 
-	defer func() { migrationsApplied = true }()
+	return nil
+}
+
+func (dao *PostgresOutboxDAO) Close() {
+	pg.Release(dao.db)
+}
+
+func NewPostgresOutboxDAO(ctx context.Context, config *conf.Config) *PostgresOutboxDAO {
+	dbConn := pg.MustOpen(ctx, config.RegistryDatabaseURI(), migrationsDir)
 
 	queriesMap := map[string]string{
-		"products_list": `SELECT id, title, price FROM products;`,
+		"outbox_pending_list": `SELECT id, event_type, payload, created_at
+			FROM outbox
+			WHERE sent_at IS NULL AND failed_at IS NULL
+			ORDER BY id
+			LIMIT $1::int;`,
+		"outbox_mark_sent": `UPDATE outbox SET sent_at=NOW() WHERE id=$1::bigint;`,
+		"outbox_mark_failed": `UPDATE outbox SET failed_at=NOW(), error=$2::text
+			WHERE id=$1::bigint;`,
+		"outbox_stats": `SELECT COUNT(*), MIN(created_at) FROM outbox
+			WHERE sent_at IS NULL AND failed_at IS NULL;`,
 	}
 
-	submitPreparedStatements(ctx, queriesMap, dbConn)
+	pg.MustPrepare(ctx, dbConn, queriesMap)
 
-	return &PostgresProductPricesDAO{
-		db:            dbConn,
-		productsTable: config.RegistryDatabase.ProductsTable,
+	return &PostgresOutboxDAO{
+		db: dbConn,
 	}
 }
+
+// ------------------------------DeadLettersDAO------------------------------
+
+func NewPostgresDeadLettersDAO(ctx context.Context, config *conf.Config) *deadletter.PostgresStore {
+	dbConn := pg.MustOpen(ctx, config.RegistryDatabaseURI(), migrationsDir)
+
+	store, err := deadletter.NewPostgresStore(ctx, dbConn)
+	if err != nil {
+		panic(err)
+	}
+
+	return store
+}
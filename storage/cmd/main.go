@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	_ "storage_service/docs"
 	"storage_service/internal/app/api"
 	"syscall"
 
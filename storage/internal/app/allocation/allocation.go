@@ -0,0 +1,166 @@
+package allocation
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Names of the strategies in config.
+const (
+	SingleWarehouse = "single"
+	Split           = "split"
+	Priority        = "priority"
+)
+
+var (
+	ErrInsufficientStock = errors.New("insufficient stock for allocation")
+	ErrUnknownStrategy   = errors.New("unknown allocation strategy")
+)
+
+// Count of product requested by the order, products are not repeated.
+type Request struct {
+	ProductID uint
+	Count     int
+}
+
+// Count of product available in warehouse.
+type Stock struct {
+	WarehouseID uint
+	ProductID   uint
+	Count       int
+}
+
+// Count of product taken from warehouse.
+type Allocation struct {
+	WarehouseID uint
+	ProductID   uint
+	Count       int
+}
+
+// Decides which warehouses order items are taken from.
+// Stock is ordered by warehouse priority, nearest warehouse first.
+// Either every request is allocated in full or ErrInsufficientStock is returned.
+type Strategy interface {
+	Allocate(requests []Request, stock []Stock) ([]Allocation, error)
+}
+
+func New(name string) (Strategy, error) {
+	switch name {
+	case SingleWarehouse:
+		return singleWarehouseStrategy{}, nil
+	case Split:
+		return splitStrategy{}, nil
+	case Priority:
+		return priorityStrategy{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStrategy, name)
+	}
+}
+
+// Takes items from the nearest warehouse which has them,
+// the rest is taken from the next ones.
+type priorityStrategy struct{}
+
+func (priorityStrategy) Allocate(requests []Request, stock []Stock) ([]Allocation, error) {
+	return take(requests, stock)
+}
+
+// Takes each line first from the warehouses holding the most of the product.
+type splitStrategy struct{}
+
+func (splitStrategy) Allocate(requests []Request, stock []Stock) ([]Allocation, error) {
+	sorted := make([]Stock, len(stock))
+	copy(sorted, stock)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Count > sorted[j].Count
+	})
+
+	return take(requests, sorted)
+}
+
+// Ships the whole order from the nearest warehouse which has every item,
+// falls back to priority order when no single warehouse can.
+type singleWarehouseStrategy struct{}
+
+func (singleWarehouseStrategy) Allocate(requests []Request, stock []Stock) ([]Allocation, error) {
+	available := make(map[uint]map[uint]int)
+	warehouseIDs := make([]uint, 0, 10)
+
+	for _, v := range stock {
+		if _, exists := available[v.WarehouseID]; !exists {
+			available[v.WarehouseID] = make(map[uint]int)
+			warehouseIDs = append(warehouseIDs, v.WarehouseID)
+		}
+
+		available[v.WarehouseID][v.ProductID] += v.Count
+	}
+
+	for _, warehouseID := range warehouseIDs {
+		if !covers(available[warehouseID], requests) {
+			continue
+		}
+
+		allocations := make([]Allocation, 0, len(requests))
+		for _, v := range requests {
+			allocations = append(allocations, Allocation{
+				WarehouseID: warehouseID,
+				ProductID:   v.ProductID,
+				Count:       v.Count,
+			})
+		}
+
+		return allocations, nil
+	}
+
+	return take(requests, stock)
+}
+
+func covers(available map[uint]int, requests []Request) bool {
+	for _, v := range requests {
+		if available[v.ProductID] < v.Count {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Greedily takes requested counts from stock in its order.
+func take(requests []Request, stock []Stock) ([]Allocation, error) {
+	allocations := make([]Allocation, 0, len(requests))
+
+	for _, request := range requests {
+		remaining := request.Count
+
+		for _, v := range stock {
+			if remaining == 0 {
+				break
+			}
+
+			if v.ProductID != request.ProductID || v.Count <= 0 {
+				continue
+			}
+
+			count := v.Count
+			if count > remaining {
+				count = remaining
+			}
+
+			allocations = append(allocations, Allocation{
+				WarehouseID: v.WarehouseID,
+				ProductID:   v.ProductID,
+				Count:       count,
+			})
+
+			remaining -= count
+		}
+
+		if remaining > 0 {
+			return nil, fmt.Errorf("%w: product %d is short of %d", ErrInsufficientStock, request.ProductID, remaining)
+		}
+	}
+
+	return allocations, nil
+}
@@ -0,0 +1,153 @@
+package allocation
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Warehouse 1 has the highest priority, stock is passed in priority order.
+var testStock = []Stock{
+	{WarehouseID: 1, ProductID: 1, Count: 2},
+	{WarehouseID: 1, ProductID: 2, Count: 5},
+	{WarehouseID: 2, ProductID: 1, Count: 6},
+	{WarehouseID: 2, ProductID: 2, Count: 1},
+	{WarehouseID: 3, ProductID: 1, Count: 4},
+	{WarehouseID: 3, ProductID: 2, Count: 4},
+}
+
+type allocationCase struct {
+	name     string
+	requests []Request
+	want     []Allocation
+	wantErr  error
+}
+
+func runCases(t *testing.T, strategyName string, cases []allocationCase) {
+	t.Helper()
+
+	strategy, err := New(strategyName)
+	if err != nil {
+		t.Fatal("new strategy err", err)
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := strategy.Allocate(tc.requests, testStock)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected err %v, got %v", tc.wantErr, err)
+			}
+
+			if tc.wantErr == nil && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected allocations %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSingleWarehouseStrategy(t *testing.T) {
+	runCases(t, SingleWarehouse, []allocationCase{
+		{
+			name:     "nearest warehouse has every item",
+			requests: []Request{{ProductID: 1, Count: 2}, {ProductID: 2, Count: 3}},
+			want: []Allocation{
+				{WarehouseID: 1, ProductID: 1, Count: 2},
+				{WarehouseID: 1, ProductID: 2, Count: 3},
+			},
+		},
+		{
+			name:     "farther warehouse has every item",
+			requests: []Request{{ProductID: 1, Count: 3}, {ProductID: 2, Count: 4}},
+			want: []Allocation{
+				{WarehouseID: 3, ProductID: 1, Count: 3},
+				{WarehouseID: 3, ProductID: 2, Count: 4},
+			},
+		},
+		{
+			name:     "no warehouse has every item, take in priority order",
+			requests: []Request{{ProductID: 1, Count: 7}, {ProductID: 2, Count: 5}},
+			want: []Allocation{
+				{WarehouseID: 1, ProductID: 1, Count: 2},
+				{WarehouseID: 2, ProductID: 1, Count: 5},
+				{WarehouseID: 1, ProductID: 2, Count: 5},
+			},
+		},
+		{
+			name:     "insufficient stock",
+			requests: []Request{{ProductID: 1, Count: 13}},
+			wantErr:  ErrInsufficientStock,
+		},
+	})
+}
+
+func TestSplitStrategy(t *testing.T) {
+	runCases(t, Split, []allocationCase{
+		{
+			name:     "warehouse with the most stock first",
+			requests: []Request{{ProductID: 1, Count: 3}},
+			want:     []Allocation{{WarehouseID: 2, ProductID: 1, Count: 3}},
+		},
+		{
+			name:     "rest is taken from the next largest stock",
+			requests: []Request{{ProductID: 1, Count: 9}, {ProductID: 2, Count: 6}},
+			want: []Allocation{
+				{WarehouseID: 2, ProductID: 1, Count: 6},
+				{WarehouseID: 3, ProductID: 1, Count: 3},
+				{WarehouseID: 1, ProductID: 2, Count: 5},
+				{WarehouseID: 3, ProductID: 2, Count: 1},
+			},
+		},
+		{
+			name:     "insufficient stock of one product rejects all",
+			requests: []Request{{ProductID: 1, Count: 1}, {ProductID: 2, Count: 11}},
+			wantErr:  ErrInsufficientStock,
+		},
+	})
+}
+
+func TestPriorityStrategy(t *testing.T) {
+	runCases(t, Priority, []allocationCase{
+		{
+			name:     "nearest warehouse first",
+			requests: []Request{{ProductID: 2, Count: 5}},
+			want:     []Allocation{{WarehouseID: 1, ProductID: 2, Count: 5}},
+		},
+		{
+			name:     "rest is taken from the next warehouses",
+			requests: []Request{{ProductID: 1, Count: 10}},
+			want: []Allocation{
+				{WarehouseID: 1, ProductID: 1, Count: 2},
+				{WarehouseID: 2, ProductID: 1, Count: 6},
+				{WarehouseID: 3, ProductID: 1, Count: 2},
+			},
+		},
+		{
+			name:     "unknown product",
+			requests: []Request{{ProductID: 3, Count: 1}},
+			wantErr:  ErrInsufficientStock,
+		},
+	})
+}
+
+func TestEmptyStockIsSkipped(t *testing.T) {
+	stock := []Stock{
+		{WarehouseID: 1, ProductID: 1, Count: 0},
+		{WarehouseID: 2, ProductID: 1, Count: 3},
+	}
+
+	got, err := priorityStrategy{}.Allocate([]Request{{ProductID: 1, Count: 2}}, stock)
+	if err != nil {
+		t.Fatal("allocate err", err)
+	}
+
+	want := []Allocation{{WarehouseID: 2, ProductID: 1, Count: 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected allocations %+v, got %+v", want, got)
+	}
+}
+
+func TestUnknownStrategy(t *testing.T) {
+	if _, err := New("nearest"); !errors.Is(err, ErrUnknownStrategy) {
+		t.Error("expected unknown strategy err, got", err)
+	}
+}
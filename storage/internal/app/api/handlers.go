@@ -1,10 +1,27 @@
 package api
 
 import (
+	"common/deadletter"
+	"common/web"
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	in "storage_service/internal/app/interfaces"
+	"storage_service/internal/app/models"
 	"strconv"
-	"time"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultItemsLimit = 50
+	maxItemsLimit     = 500
+
+	defaultDeadLettersLimit = 20
+	maxDeadLettersLimit     = 100
 )
 
 // @title Storage service
@@ -19,48 +36,385 @@ import (
 // @license.name Apache 2.0
 // @license.url http://www.apache.org/licenses/LICENSE-2.0.html
 
-// @Summary Healthcheck
-// @Description Check DB and broker client connections
+// @Summary List storage items
+// @Description Page of storage items with stock levels per warehouse ordered by product id
 // @Produce json
-// @Tags	ops
-// @Success 200 {object} HealthCheckResposne
+// @Tags	inventory
+// @Success 200 {array} StorageItemResponse
 // @Failure 400 {object} ErrResponseMsg
 // @Failure 500 {string} error
-// @Router /health [GET]
-func (s *Server) HealthCheck() http.Handler {
+// @Param limit query int false "page size, 50 by default, 500 max"
+// @Param offset query int false "page offset"
+// @Param warehouse_id query int false "items of the warehouse only"
+// @Router /items [GET]
+func (s *Server) StorageItemsList() http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		filter := &in.StorageItemsFilterDTO{Limit: defaultItemsLimit}
+
+		if limitStr := r.FormValue("limit"); limitStr != "" {
+			limit, err := strconv.Atoi(limitStr)
+			if err != nil || limit <= 0 || limit > maxItemsLimit {
+				msg := ErrResponseMsg{Message: "limit query param is not correct"}
+				web.JSONResponse(w, msg, http.StatusBadRequest)
+
+				return
+			}
+
+			filter.Limit = uint(limit)
+		}
+
+		if offsetStr := r.FormValue("offset"); offsetStr != "" {
+			offset, err := strconv.Atoi(offsetStr)
+			if err != nil || offset < 0 {
+				msg := ErrResponseMsg{Message: "offset query param is not correct"}
+				web.JSONResponse(w, msg, http.StatusBadRequest)
+
+				return
+			}
+
+			filter.Offset = uint(offset)
+		}
+
+		if warehouseStr := r.FormValue("warehouse_id"); warehouseStr != "" {
+			warehouseID, err := strconv.Atoi(warehouseStr)
+			if err != nil || warehouseID <= 0 {
+				msg := ErrResponseMsg{Message: "warehouse_id query param is not correct"}
+				web.JSONResponse(w, msg, http.StatusBadRequest)
+
+				return
+			}
+
+			filter.WarehouseID = uint(warehouseID)
+		}
+
+		items, err := s.App.StorageService.GetStorageItems(r.Context(), filter)
+		if err != nil {
+			web.JSONResponse(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		web.JSONResponse(w, newStorageItemsResponse(items), http.StatusOK)
+	}
+
+	return http.HandlerFunc(handler)
+}
+
+// @Summary Get stock
+// @Description Stock levels of given products per warehouse, unknown products are omitted
+// @Produce json
+// @Tags	inventory
+// @Success 200 {array} StorageItemResponse
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Param product_ids query string true "comma separated product ids, e.g. 1,2,3"
+// @Router /stock [GET]
+func (s *Server) GetStock() http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		productIDs, err := parseProductIDs(r.FormValue("product_ids"))
+		if err != nil {
+			msg := ErrResponseMsg{Message: "product_ids query param is not correct"}
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
+		}
+
+		items, err := s.App.StorageService.GetStock(r.Context(), productIDs)
+		if err != nil {
+			web.JSONResponse(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		web.JSONResponse(w, newStorageItemsResponse(items), http.StatusOK)
+	}
+
+	return http.HandlerFunc(handler)
+}
+
+// @Summary Restock products
+// @Description Add delivered items to stock, deltas must be positive.
+// @Description Products missing in the warehouse are added.
+// @Accept json
+// @Produce json
+// @Tags	inventory
+// @Success 201 {object} StockMovementResponse
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 404 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Param movement body StockMovementRequest true "restock data"
+// @Router /stock/restock [POST]
+func (s *Server) Restock() http.Handler {
+	return s.stockMovementHandler(s.App.StorageService.Restock)
+}
+
+// @Summary Adjust stock
+// @Description Correct stock levels after inventory count, write-off etc., deltas may be negative.
+// @Description Adjustment is rejected as a whole if any count would become negative.
+// @Accept json
+// @Produce json
+// @Tags	inventory
+// @Success 201 {object} StockMovementResponse
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 404 {object} ErrResponseMsg
+// @Failure 409 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Param movement body StockMovementRequest true "adjustment data"
+// @Router /stock/adjustments [POST]
+func (s *Server) Adjust() http.Handler {
+	return s.stockMovementHandler(s.App.StorageService.Adjust)
+}
+
+type stockMovementFunc func(
+	ctx context.Context,
+	reason string,
+	items []*in.StockMovementItemDTO,
+) (*models.StorageTransaction, error)
+
+func (s *Server) stockMovementHandler(apply stockMovementFunc) http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var movementData StockMovementRequest
+		if err := json.NewDecoder(r.Body).Decode(&movementData); err != nil {
+			msg := ErrResponseMsg{Message: err.Error()}
+			if err == io.EOF {
+				msg.Message = "Empty body"
+			}
+
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
+		}
+
+		items := make([]*in.StockMovementItemDTO, 0, len(movementData.Items))
+		for _, v := range movementData.Items {
+			items = append(items, &in.StockMovementItemDTO{
+				WarehouseID: v.WarehouseID,
+				ProductID:   v.ProductID,
+				Delta:       v.Delta,
+			})
+		}
+
+		trans, err := apply(r.Context(), movementData.Reason, items)
+
+		switch {
+		case errors.Is(err, in.ErrInvalidStockMovement):
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
+		case errors.Is(err, in.ErrProductNotFoundByID), errors.Is(err, in.ErrWarehouseNotFound):
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusNotFound)
+
+			return
+		case errors.Is(err, in.ErrOutOfStock):
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusConflict)
+
+			return
+		case err != nil:
+			web.JSONResponse(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		web.JSONResponse(w, newStockMovementResponse(trans), http.StatusCreated)
+	}
+
+	return http.HandlerFunc(handler)
+}
+
+// @Summary List warehouses
+// @Description Warehouses in allocation order: reserved items are taken from warehouses with lower priority first
+// @Produce json
+// @Tags	warehouses
+// @Success 200 {array} WarehouseResponse
+// @Failure 500 {string} error
+// @Router /warehouses [GET]
+func (s *Server) WarehousesList() http.Handler {
 	handler := func(w http.ResponseWriter, r *http.Request) {
-		timeout := 15
+		warehouses, err := s.App.StorageService.GetWarehouses(r.Context())
+		if err != nil {
+			web.JSONResponse(w, err.Error(), http.StatusInternalServerError)
 
-		timeoutStr := r.FormValue("timeout")
+			return
+		}
+
+		web.JSONResponse(w, newWarehousesResponse(warehouses), http.StatusOK)
+	}
 
-		t, err := strconv.Atoi(timeoutStr)
-		if timeoutStr != "" && err == nil {
-			timeout = t
+	return http.HandlerFunc(handler)
+}
+
+// @Summary Create warehouse
+// @Description Add warehouse, its stock is added by restock
+// @Accept json
+// @Produce json
+// @Tags	warehouses
+// @Success 201 {object} WarehouseResponse
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Param warehouse body CreateWarehouseRequest true "warehouse data"
+// @Router /warehouses [POST]
+func (s *Server) CreateWarehouse() http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var warehouseData CreateWarehouseRequest
+		if err := json.NewDecoder(r.Body).Decode(&warehouseData); err != nil {
+			msg := ErrResponseMsg{Message: err.Error()}
+			if err == io.EOF {
+				msg.Message = "Empty body"
+			}
+
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
+		}
+
+		warehouse, err := s.App.StorageService.CreateWarehouse(r.Context(), &in.CreateWarehouseDTO{
+			Title:    warehouseData.Title,
+			Priority: warehouseData.Priority,
+		})
+
+		switch {
+		case errors.Is(err, in.ErrInvalidWarehouse):
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
+		case err != nil:
+			web.JSONResponse(w, err.Error(), http.StatusInternalServerError)
+
+			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), time.Duration(timeout)*time.Second)
-		defer cancel()
+		web.JSONResponse(w, newWarehouseResponse(warehouse), http.StatusCreated)
+	}
+
+	return http.HandlerFunc(handler)
+}
+
+// @Summary Update warehouse
+// @Description Change warehouse priority or deactivate it, inactive warehouse keeps its stock
+// @Description but is not used for new reservations.
+// @Accept json
+// @Produce json
+// @Tags	warehouses
+// @Success 200 {object} WarehouseResponse
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 404 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Param id path int true "warehouse id"
+// @Param warehouse body UpdateWarehouseRequest true "changed fields"
+// @Router /warehouses/{id} [PATCH]
+func (s *Server) UpdateWarehouse() http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		warehouseID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil || warehouseID <= 0 {
+			msg := ErrResponseMsg{Message: "warehouse id is not correct"}
+			web.JSONResponse(w, msg, http.StatusBadRequest)
 
-		errToStr := func(err error) string {
-			if err != nil {
-				return err.Error()
+			return
+		}
+
+		var warehouseData UpdateWarehouseRequest
+		if err := json.NewDecoder(r.Body).Decode(&warehouseData); err != nil {
+			msg := ErrResponseMsg{Message: err.Error()}
+			if err == io.EOF {
+				msg.Message = "Empty body"
 			}
 
-			return "ok"
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
 		}
 
-		walletsDAOHealth := errToStr(s.App.StorageItemsDAO.HealthCheck(ctx))
-		walletTransDAOHealth := errToStr(s.App.StorageTransactionsDAO.HealthCheck(ctx))
-		brokerClientHealth := errToStr(s.App.BrokerClient.HealthCheck(ctx))
+		warehouse, err := s.App.StorageService.UpdateWarehouse(r.Context(), &in.UpdateWarehouseDTO{
+			ID:       uint(warehouseID),
+			Priority: warehouseData.Priority,
+			Active:   warehouseData.Active,
+		})
+
+		switch {
+		case errors.Is(err, in.ErrInvalidWarehouse):
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
+		case errors.Is(err, in.ErrWarehouseNotFound):
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusNotFound)
 
-		response := HealthCheckResposne{
-			WalletsConn:     walletsDAOHealth,
-			WalletTransConn: walletTransDAOHealth,
-			BrokerConn:      brokerClientHealth,
+			return
+		case err != nil:
+			web.JSONResponse(w, err.Error(), http.StatusInternalServerError)
+
+			return
 		}
 
-		JSONResponse(w, response, http.StatusOK)
+		web.JSONResponse(w, newWarehouseResponse(warehouse), http.StatusOK)
 	}
 
 	return http.HandlerFunc(handler)
 }
+
+func parseProductIDs(value string) ([]uint, error) {
+	productIDs := make([]uint, 0, 10)
+
+	for _, v := range strings.Split(value, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+		if err != nil || id == 0 {
+			return nil, errors.New("product id is not correct")
+		}
+
+		productIDs = append(productIDs, uint(id))
+	}
+
+	return productIDs, nil
+}
+
+// @Summary Healthcheck
+// @Description Check DB and broker client connections
+// @Produce json
+// @Tags	ops
+// @Success 200 {object} HealthCheckResposne
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Router /health [GET]
+func (s *Server) HealthCheck() http.Handler {
+	return web.HealthHandler(
+		web.HealthCheck{Name: "storage_items_conn", Check: s.App.StorageItemsDAO.HealthCheck},
+		web.HealthCheck{Name: "storage_trans_conn", Check: s.App.StorageTransactionsDAO.HealthCheck},
+		web.HealthCheck{Name: "warehouses_conn", Check: s.App.WarehousesDAO.HealthCheck},
+		web.HealthCheck{Name: "broker_conn", Check: s.App.BrokerClient.HealthCheck},
+	)
+}
+
+// @Summary Dead-lettered msgs
+// @Description Msgs of the service which handling failed after all retries, newest first
+// @Produce json
+// @Tags	ops
+// @Success 200 {array} deadletter.Response
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Param limit query int false "page size, up to 100"
+// @Param offset query int false "page offset"
+// @Router /admin/dead-letters [GET]
+func (s *Server) DeadLettersList() http.Handler {
+	return deadletter.ListHandler(s.App.DeadLetters)
+}
+
+// @Summary Replay dead-lettered msg
+// @Description Hand original payload of dead-lettered msg to the handler of its topic in this service, msg failed again is dead-lettered as a new letter.
+// @Description Letter is replayed once, the next replay responds with 409
+// @Produce json
+// @Tags	ops
+// @Success 200 {object} deadletter.Response
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 404 {object} ErrResponseMsg
+// @Failure 409 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Param id path int true "dead letter id"
+// @Router /admin/dead-letters/{id}/replay [POST]
+func (s *Server) ReplayDeadLetter() http.Handler {
+	return deadletter.ReplayHandler(s.App.DeadLetters)
+}
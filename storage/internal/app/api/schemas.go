@@ -1,5 +1,10 @@
 package api
 
+import (
+	"storage_service/internal/app/models"
+	"time"
+)
+
 type ErrResponseMsg struct {
 	Message string `json:"message"`
 }
@@ -19,7 +24,111 @@ type CreateOrderResponse struct {
 }
 
 type HealthCheckResposne struct {
-	WalletsConn     string `json:"wallets_conn"`
-	WalletTransConn string `json:"wallet_trans_conn"`
-	BrokerConn      string `json:"broker_conn"`
+	StorageItemsConn string `json:"storage_items_conn"`
+	StorageTransConn string `json:"storage_trans_conn"`
+	WarehousesConn   string `json:"warehouses_conn"`
+	BrokerConn       string `json:"broker_conn"`
+}
+
+type StorageItemResponse struct {
+	ID          uint `json:"id"`
+	WarehouseID uint `json:"warehouse_id"`
+	ProductID   uint `json:"product_id"`
+	Count       uint `json:"count"`
+}
+
+type CreateWarehouseRequest struct {
+	Title    string `json:"title" example:"north"`
+	Priority int    `json:"priority" example:"10"`
+}
+
+type UpdateWarehouseRequest struct {
+	Priority *int  `json:"priority,omitempty" example:"10"`
+	Active   *bool `json:"active,omitempty" example:"false"`
+}
+
+type WarehouseResponse struct {
+	ID        uint      `json:"id"`
+	Title     string    `json:"title"`
+	Priority  int       `json:"priority"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type StockMovementRequest struct {
+	Reason string                     `json:"reason" example:"supplier delivery #42"`
+	Items  []StockMovementRequestItem `json:"items"`
+}
+
+// Default warehouse is used if warehouse id is omitted.
+type StockMovementRequestItem struct {
+	WarehouseID uint `json:"warehouse_id" example:"1"`
+	ProductID   uint `json:"product_id"`
+	Delta       int  `json:"delta" example:"5"`
+}
+
+type StockMovementResponse struct {
+	ID        uint                        `json:"id"`
+	Type      models.TransactionType      `json:"type"`
+	Reason    string                      `json:"reason"`
+	CreatedAt time.Time                   `json:"created_at"`
+	Items     []StockMovementResponseItem `json:"items"`
+}
+
+type StockMovementResponseItem struct {
+	WarehouseID uint `json:"warehouse_id"`
+	ProductID   uint `json:"product_id"`
+	Delta       int  `json:"delta"`
+}
+
+func newStorageItemsResponse(items []*models.StorageItem) []StorageItemResponse {
+	response := make([]StorageItemResponse, 0, len(items))
+	for _, v := range items {
+		response = append(response, StorageItemResponse{
+			ID:          v.ID,
+			WarehouseID: v.WarehouseID,
+			ProductID:   v.ProductID,
+			Count:       v.Count,
+		})
+	}
+
+	return response
+}
+
+func newStockMovementResponse(trans *models.StorageTransaction) StockMovementResponse {
+	items := make([]StockMovementResponseItem, 0, len(trans.Items))
+	for _, v := range trans.Items {
+		items = append(items, StockMovementResponseItem{
+			WarehouseID: v.WarehouseID,
+			ProductID:   v.ProductID,
+			Delta:       v.Count,
+		})
+	}
+
+	return StockMovementResponse{
+		ID:        trans.ID,
+		Type:      trans.Type,
+		Reason:    trans.Reason,
+		CreatedAt: trans.CreatedAt,
+		Items:     items,
+	}
+}
+
+func newWarehouseResponse(warehouse *models.Warehouse) WarehouseResponse {
+	return WarehouseResponse{
+		ID:        warehouse.ID,
+		Title:     warehouse.Title,
+		Priority:  warehouse.Priority,
+		Active:    warehouse.Active,
+		CreatedAt: warehouse.CreatedAt,
+	}
+}
+
+func newWarehousesResponse(warehouses []*models.Warehouse) []WarehouseResponse {
+	response := make([]WarehouseResponse, 0, len(warehouses))
+	for _, v := range warehouses {
+		response = append(response, newWarehouseResponse(v))
+	}
+
+	return response
 }
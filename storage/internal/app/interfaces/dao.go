@@ -2,19 +2,51 @@ package interfaces
 
 import (
 	"context"
+	"storage_service/internal/app/allocation"
 	"storage_service/internal/app/models"
+	"time"
 )
 
 type StorageItemsDAO interface {
+	GetList(ctx context.Context, filter *StorageItemsFilterDTO) ([]*models.StorageItem, error)
 	GetListByProductIDs(ctx context.Context, prodIDs []uint) ([]*models.StorageItem, error)
-	UpdateCountBulk(ctx context.Context, items []*models.StorageItem) error
+	ApplyMovement(ctx context.Context, movement *CreateStockMovementDTO) (*models.StorageTransaction, error)
+	Reserve(
+		ctx context.Context,
+		trans *CreateStorageTransactionDTO,
+		strategy allocation.Strategy,
+	) (*models.StorageTransaction, error)
+	Release(ctx context.Context, trans *CreateStorageTransactionDTO) (*models.StorageTransaction, error)
+	ReleaseExpired(
+		ctx context.Context,
+		reservationID uint,
+		trans *CreateStorageTransactionDTO,
+	) (*models.StorageTransaction, error)
+	Return(ctx context.Context, trans *CreateStorageTransactionDTO) (*models.StorageTransaction, error)
+	MarkOrderRejected(ctx context.Context, orderID uint) error
+	HealthCheck(ctx context.Context) error
+	Close()
+}
+
+type WarehousesDAO interface {
+	GetList(ctx context.Context) ([]*models.Warehouse, error)
+	Create(ctx context.Context, warehouse *CreateWarehouseDTO) (*models.Warehouse, error)
+	Update(ctx context.Context, warehouse *UpdateWarehouseDTO) (*models.Warehouse, error)
 	HealthCheck(ctx context.Context) error
 	Close()
 }
 
 type StorageTransactionsDAO interface {
 	GetByOrderID(ctx context.Context, orderID uint) (*models.StorageTransaction, error)
-	GetItemsByOrderID(ctx context.Context, orderID uint) ([]*models.StorageTransactionItem, error)
+	GetItemsByOrderID(
+		ctx context.Context,
+		orderID uint,
+		transType models.TransactionType,
+	) ([]*models.StorageTransactionItem, error)
+	GetListExpired(ctx context.Context, now time.Time, limit uint16) ([]*models.StorageTransaction, error)
+	GetListExpiryNotAnnounced(ctx context.Context, limit uint16) ([]*models.StorageTransaction, error)
+	MarkExpiryAnnounced(ctx context.Context, reservationID uint) error
+	ClearReservationExpiry(ctx context.Context, orderID uint) error
 	Create(ctx context.Context, trans *CreateStorageTransactionDTO) (*models.StorageTransaction, error)
 	HealthCheck(ctx context.Context) error
 	Close()
@@ -1,18 +1,60 @@
 package interfaces
 
-import "storage_service/internal/app/models"
+import (
+	"common/events"
+	"storage_service/internal/app/models"
+	"time"
+)
 
 //--------------Data Access Layer DTOs--------------
 
 type CreateStorageTransactionDTO struct {
-	OrderID uint
-	Items   []*CreateStorageTransactionItemDTO
-	Type    models.TransactionType
+	OrderID   uint
+	UserID    uint
+	Items     []*CreateStorageTransactionItemDTO
+	Type      models.TransactionType
+	MessageID string
+	ExpiresAt *time.Time // reservation only
 }
 
+// Warehouse is chosen by allocation strategy on reservation.
 type CreateStorageTransactionItemDTO struct {
-	ProductID uint
-	Count     uint16
+	WarehouseID uint
+	ProductID   uint
+	Count       uint16
+}
+
+// Restock or adjustment of storage items made without order.
+type CreateStockMovementDTO struct {
+	Type   models.TransactionType
+	Reason string
+	Items  []*StockMovementItemDTO
+}
+
+// Delta is added to the storage item count.
+type StockMovementItemDTO struct {
+	WarehouseID uint
+	ProductID   uint
+	Delta       int
+}
+
+// Zero warehouse id lists items of all warehouses.
+type StorageItemsFilterDTO struct {
+	WarehouseID uint
+	Limit       uint
+	Offset      uint
+}
+
+type CreateWarehouseDTO struct {
+	Title    string
+	Priority int
+}
+
+// Nil fields are not changed.
+type UpdateWarehouseDTO struct {
+	ID       uint
+	Priority *int
+	Active   *bool
 }
 
 //--------------Interactors Layer DTOs--------------
@@ -20,62 +62,60 @@ type CreateStorageTransactionItemDTO struct {
 type OrderItemDTO struct {
 	ProductID    uint
 	Count        uint16
-	ProductPrice float32
+	ProductPrice models.Money
 }
 
 type OrderDTO struct {
+	MessageID  string
 	OrderID    uint
 	UserID     uint
 	OrderItems []*OrderItemDTO
 }
 
 type CancelOrderDTO struct {
-	OrderID uint
-	UserID  uint
+	MessageID string
+	OrderID   uint
+	UserID    uint
+}
+
+type ReturnOrderDTO struct {
+	MessageID string
+	OrderID   uint
+	UserID    uint
+	Items     []*OrderItemDTO
 }
 
 type Transaction struct {
-	OrderID uint
-	UserID  uint
-	Items   []*TransactionItem
-	Type    models.TransactionType
+	MessageID string
+	OrderID   uint
+	UserID    uint
+	Items     []*TransactionItem
+	Type      models.TransactionType
 }
 
 type TransactionItem struct {
-	ProductID uint
-	Count     uint16
+	WarehouseID uint
+	ProductID   uint
+	Count       uint16
 }
 
 //--------------Broker Layer DTOs--------------
-type ServiceName uint8
 
-const (
-	Wallet ServiceName = iota
-	Storage
-	Registry
+// Msgs contracts are shared by all services.
+type (
+	ServiceName          = events.ServiceName
+	NewOrderMsg          = events.NewOrderMsg
+	NewOrderMsgItem      = events.NewOrderMsgItem
+	OrderRejectedMsg     = events.OrderRejectedMsg
+	OrderCompletedMsg    = events.OrderCompletedMsg
+	OrderReturnedMsg     = events.OrderReturnedMsg
+	OrderReturnedMsgItem = events.OrderReturnedMsgItem
+	OrderSuccessMsg      = events.OrderSuccessMsg
+	OrderCompensatedMsg  = events.OrderCompensatedMsg
 )
 
-type NewOrderMsg struct {
-	UserID     uint              `json:"user_id"`
-	OrderID    uint              `json:"order_id"`
-	OrderItems []NewOrderMsgItem `json:"order_items"`
-}
-
-type NewOrderMsgItem struct {
-	OrderID      uint    `json:"order_id"`
-	ProductID    uint    `json:"product_id"`
-	Count        uint8   `json:"count"`
-	ProductPrice float32 `json:"product_price"`
-}
-
-type OrderRejectedMsg struct {
-	OrderID    uint                     `json:"order_id"`
-	UserID     uint                     `json:"user_id"`
-	Service    ServiceName              `json:"service"`
-	ReasonCode models.CancelationReason `json:"reason_code"`
-}
-
-type OrderSuccessMsg struct {
-	OrderID uint        `json:"order_id"`
-	Service ServiceName `json:"service"`
-}
+const (
+	Wallet   = events.Wallet
+	Storage  = events.Storage
+	Registry = events.Registry
+)
@@ -3,11 +3,17 @@ package interfaces
 import "errors"
 
 var (
-	ErrNotEnoughMoney             = errors.New("not enough money")
-	ErrNewTransactionTimeoutError = errors.New("new trans timeout error")
-	ErrInvalidBrokerConnParams    = errors.New("invalid broker client params")
-	ErrBrokerConnClosed           = errors.New("broker connection closed")
-	ErrProductNotFoundByID        = errors.New("product not found by id")
-	ErrOutOfStock                 = errors.New("product out of stock")
-	ErrTransNotFound              = errors.New("transaction not found")
+	ErrNotEnoughMoney          = errors.New("not enough money")
+	ErrInvalidBrokerConnParams = errors.New("invalid broker client params")
+	ErrBrokerConnClosed        = errors.New("broker connection closed")
+	ErrUnknownTopic            = errors.New("msg of unknown topic")
+	ErrProductNotFoundByID     = errors.New("product not found by id")
+	ErrOutOfStock              = errors.New("product out of stock")
+	ErrTransNotFound           = errors.New("transaction not found")
+	ErrMsgAlreadyProcessed     = errors.New("msg already processed")
+	ErrInvalidStockMovement    = errors.New("invalid stock movement")
+	ErrWarehouseNotFound       = errors.New("warehouse not found")
+	ErrInvalidWarehouse        = errors.New("invalid warehouse")
+	ErrReservationNotExpired   = errors.New("reservation is not expired")
+	ErrOrderRejected           = errors.New("order already rejected")
 )
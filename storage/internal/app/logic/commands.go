@@ -2,40 +2,38 @@ package logic
 
 import (
 	"context"
+	"errors"
 	in "storage_service/internal/app/interfaces"
 	"storage_service/internal/app/models"
 )
 
-func (s *StorageService) reservationProcessor(ctx context.Context, trans *in.Transaction) {
+// Reservation rejected for lack of stock is rolled back and announced to other services,
+// other errors are returned, so msg is retried and dead-lettered if it still fails.
+// Msg is handled when success or rejected msg is sent, so failed send is retried.
+// Order rejected before its new order msg arrived is skipped, nothing was reserved for it.
+func (s *StorageService) reservationProcessor(ctx context.Context, trans *in.Transaction) error {
 	code, err := s.processReservation(ctx, trans)
-	if err != nil {
-		s.logger.Error("got process reservation error: ", err, code)
+	if errors.Is(err, in.ErrOrderRejected) {
+		s.logger.Infof("Processing reservation: order %d already rejected, skip", trans.OrderID)
+
+		return nil
+	}
+
+	if errors.Is(err, in.ErrOutOfStock) {
+		s.logger.Info("Processing reservation: rejected, ", err)
 
 		trans.Type = models.Cancelation
-		s.transactionsPipe <- trans
 
-		errSend := s.sendRejectedMsg(ctx, code, trans)
-		if errSend != nil {
-			s.logger.Error("send rejected msg error: ", errSend)
+		if errCancel := s.processCancelation(ctx, trans); errCancel != nil {
+			s.logger.Error("got process cancellation error: ", errCancel)
 		}
-	}
 
-	errSend := s.sendSuccessMsg(ctx, trans)
-	if errSend != nil {
-		s.logger.Error("send success msg error: ", errSend)
+		return s.sendRejectedMsg(ctx, code, trans)
 	}
-}
 
-func (s *StorageService) cancelationProcessor(ctx context.Context, trans *in.Transaction) {
-	err := s.processCancelation(ctx, trans)
 	if err != nil {
-		s.logger.Error("got process cancellation error: ", err)
+		return err
 	}
-}
-
-func (s *StorageService) invalidTransProcessor(trans *in.Transaction) {
-	s.logger.Error("Invalid transaction type")
 
-	trans.Type = models.Cancelation
-	s.transactionsPipe <- trans
+	return s.sendSuccessMsg(ctx, trans)
 }
@@ -1,36 +1,20 @@
 package logic
 
 import (
+	"common/events"
 	"context"
 	"errors"
+	"sort"
 	in "storage_service/internal/app/interfaces"
 	"storage_service/internal/app/models"
+	"time"
 )
 
-func makeStorageItemsMap(items []*models.StorageItem) map[uint]*models.StorageItem {
-	m := make(map[uint]*models.StorageItem)
-
-	for _, v := range items {
-		m[v.ProductID] = v
-	}
-
-	return m
-}
-
-func makeTransItemsMap(items []*in.CreateStorageTransactionItemDTO) map[uint]*in.CreateStorageTransactionItemDTO {
-	m := make(map[uint]*in.CreateStorageTransactionItemDTO)
-
-	for _, v := range items {
-		m[v.ProductID] = v
-	}
-
-	return m
-}
-
 func (s *StorageService) sendSuccessMsg(ctx context.Context, data *in.Transaction) error {
 	err := s.brokerClient.SendReservationSuccess(ctx, &in.OrderSuccessMsg{
-		OrderID: data.OrderID,
-		Service: in.Storage,
+		OrderID:     data.OrderID,
+		Service:     in.Storage,
+		CausationID: data.MessageID,
 	})
 
 	return err
@@ -40,29 +24,29 @@ func (s *StorageService) sendRejectedMsg(ctx context.Context, reasonCode models.
 	s.logger.Info("Kafka Send rejected message: ", data, reasonCode)
 
 	err := s.brokerClient.SendOrderRejectedMsg(ctx, &in.OrderRejectedMsg{
-		OrderID:    data.OrderID,
-		UserID:     data.UserID,
-		ReasonCode: reasonCode,
-		Service:    in.Storage,
+		MessageID:   events.RejectedMsgID(in.Storage, data.OrderID),
+		OrderID:     data.OrderID,
+		UserID:      data.UserID,
+		ReasonCode:  reasonCode,
+		Service:     in.Storage,
+		CausationID: data.MessageID,
 	})
 
 	return err
 }
 
+// Registry records the acknowledgement, so the outcome of order cancelation can be seen on the order.
+func (s *StorageService) sendCompensatedMsg(ctx context.Context, msg *in.OrderRejectedMsg) error {
+	return s.brokerClient.SendCompensatedMsg(ctx, &in.OrderCompensatedMsg{
+		OrderID:     msg.OrderID,
+		Service:     in.Storage,
+		CausationID: msg.MessageID,
+	})
+}
+
 func (s *StorageService) processReservation(ctx context.Context, data *in.Transaction) (models.CancelationReason, error) {
 	s.logger.Info("Processing reservation")
 
-	existingTrans, err := s.storageTransactionsDAO.GetByOrderID(ctx, data.OrderID)
-	if err != nil && !errors.Is(err, in.ErrTransNotFound) {
-		s.logger.Error("got process reservation err: ", err)
-
-		return models.InternalError, err
-	}
-
-	if existingTrans != nil {
-		return models.OK, nil
-	}
-
 	items := make([]*in.CreateStorageTransactionItemDTO, 0, 10)
 	for _, v := range data.Items {
 		items = append(items, &in.CreateStorageTransactionItemDTO{
@@ -71,55 +55,30 @@ func (s *StorageService) processReservation(ctx context.Context, data *in.Transa
 		})
 	}
 
-	productIDs := make([]uint, 0, 10)
-	for _, v := range data.Items {
-		productIDs = append(productIDs, v.ProductID)
-	}
-
-	storageItems, err := s.storageItemsDAO.GetListByProductIDs(ctx, productIDs)
-	if err != nil {
-		return models.InternalError, err
-	}
-
-	storageItemsMap := makeStorageItemsMap(storageItems)
-	transItemsMap := makeTransItemsMap(items)
+	expiresAt := time.Now().Add(s.reservationTTL)
 
-	for k, v := range transItemsMap {
-		product, exists := storageItemsMap[k]
-		if !exists {
-			return models.InternalError, in.ErrProductNotFoundByID
-		}
-
-		if product.Count < v.Count {
-			return models.OutOfStock, in.ErrOutOfStock
-		}
-
-		product.Count -= v.Count
-	}
+	_, err := s.storageItemsDAO.Reserve(ctx, &in.CreateStorageTransactionDTO{
+		OrderID:   data.OrderID,
+		UserID:    data.UserID,
+		Items:     items,
+		Type:      data.Type,
+		MessageID: data.MessageID,
+		ExpiresAt: &expiresAt,
+	}, s.allocationStrategy)
+	if errors.Is(err, in.ErrMsgAlreadyProcessed) {
+		s.logger.Info("Processing reservation: msg already processed, skip")
 
-	_, err = s.storageTransactionsDAO.Create(ctx, &in.CreateStorageTransactionDTO{
-		OrderID: data.OrderID,
-		Items:   items,
-		Type:    data.Type,
-	})
-	if err != nil {
-		return models.InternalError, err
+		return models.OK, nil
 	}
 
-	if errUpd := s.storageItemsDAO.UpdateCountBulk(ctx, storageItems); errUpd != nil {
-		s.logger.Error("got process reservation update count err:", errUpd)
-
-		return models.InternalError, errUpd
+	if errors.Is(err, in.ErrOutOfStock) {
+		return models.OutOfStock, err
 	}
 
-	s.logger.Info("Processing reservation: update count success")
-
-	err = s.brokerClient.SendReservationSuccess(ctx, &in.OrderSuccessMsg{
-		OrderID: data.OrderID,
-		Service: in.Storage,
-	})
 	if err != nil {
-		s.logger.Info("Send reservation msg error")
+		s.logger.Error("got process reservation err: ", err)
+
+		return models.InternalError, err
 	}
 
 	s.logger.Info("Processing reservation success")
@@ -130,8 +89,7 @@ func (s *StorageService) processReservation(ctx context.Context, data *in.Transa
 func (s *StorageService) processCancelation(ctx context.Context, data *in.Transaction) error {
 	s.logger.Info("Processing cancelation")
 
-	existingTrans, err := s.storageTransactionsDAO.GetByOrderID(ctx, data.OrderID)
-
+	_, err := s.storageTransactionsDAO.GetByOrderID(ctx, data.OrderID)
 	if errors.Is(err, in.ErrTransNotFound) {
 		s.logger.Info("Processing cancelation success: order not found")
 
@@ -140,56 +98,261 @@ func (s *StorageService) processCancelation(ctx context.Context, data *in.Transa
 		return err
 	}
 
-	if existingTrans != nil && existingTrans.Type == models.Cancelation {
+	if len(data.Items) == 0 {
+		s.logger.Info("Processing cancelation success: nothing to release")
+
 		return nil
 	}
 
 	items := make([]*in.CreateStorageTransactionItemDTO, 0, 10)
 	for _, v := range data.Items {
 		items = append(items, &in.CreateStorageTransactionItemDTO{
-			ProductID: v.ProductID,
-			Count:     v.Count,
+			WarehouseID: v.WarehouseID,
+			ProductID:   v.ProductID,
+			Count:       v.Count,
 		})
 	}
 
-	productIDs := make([]uint, 0, 10)
-	for _, v := range data.Items {
-		productIDs = append(productIDs, v.ProductID)
+	_, err = s.storageItemsDAO.Release(ctx, &in.CreateStorageTransactionDTO{
+		OrderID:   data.OrderID,
+		Items:     items,
+		Type:      data.Type,
+		MessageID: data.MessageID,
+	})
+	if errors.Is(err, in.ErrMsgAlreadyProcessed) {
+		s.logger.Info("Processing cancelation: msg already processed, skip")
+
+		return nil
+	}
+
+	if err != nil {
+		s.logger.Error("got process cancelation err: ", err)
+
+		return err
+	}
+
+	s.logger.Info("Processing cancelation success")
+
+	return nil
+}
+
+func (s *StorageService) processReturn(ctx context.Context, data *in.Transaction) error {
+	s.logger.Info("Processing return")
+
+	reservedItems, err := s.storageTransactionsDAO.GetItemsByOrderID(ctx, data.OrderID, models.Reservation)
+	if err != nil {
+		return err
 	}
 
-	storageItems, err := s.storageItemsDAO.GetListByProductIDs(ctx, productIDs)
+	returnedItems, err := s.storageTransactionsDAO.GetItemsByOrderID(ctx, data.OrderID, models.Return)
 	if err != nil {
 		return err
 	}
 
-	storageItemsMap := makeStorageItemsMap(storageItems)
-	transItemsMap := makeTransItemsMap(items)
+	items := returnItems(data.Items, reservedItems, returnedItems)
+
+	_, err = s.storageItemsDAO.Return(ctx, &in.CreateStorageTransactionDTO{
+		OrderID:   data.OrderID,
+		Items:     items,
+		Type:      data.Type,
+		MessageID: data.MessageID,
+	})
+	if errors.Is(err, in.ErrMsgAlreadyProcessed) {
+		s.logger.Info("Processing return: msg already processed, skip")
 
-	for k, v := range transItemsMap {
-		product, exists := storageItemsMap[k]
-		if !exists {
-			return in.ErrProductNotFoundByID
+		return nil
+	}
+
+	if err != nil {
+		s.logger.Error("got process return err: ", err)
+
+		return err
+	}
+
+	s.logger.Info("Processing return success")
+
+	return nil
+}
+
+// Returned items are restocked to the warehouses they were reserved from. Item split
+// across warehouses is returned to each of them in proportion to what is still not returned there,
+// rounding leftovers go to the largest fractional shares. Item reserved before warehouses
+// were introduced goes to the default warehouse.
+func returnItems(
+	items []*in.TransactionItem,
+	reservedItems []*models.StorageTransactionItem,
+	returnedItems []*models.StorageTransactionItem,
+) []*in.CreateStorageTransactionItemDTO {
+	type (
+		stockKey struct {
+			warehouseID uint
+			productID   uint
+		}
+		returnable struct {
+			warehouseID uint
+			count       int
+		}
+	)
+
+	returned := make(map[stockKey]int)
+	for _, v := range returnedItems {
+		returned[stockKey{v.WarehouseID, v.ProductID}] += v.Count
+	}
+
+	returnables := make(map[uint][]*returnable)
+
+	for _, v := range reservedItems {
+		count := v.Count - returned[stockKey{v.WarehouseID, v.ProductID}]
+		if count < 0 {
+			count = 0
+		}
+
+		returnables[v.ProductID] = append(returnables[v.ProductID], &returnable{v.WarehouseID, count})
+	}
+
+	result := make([]*in.CreateStorageTransactionItemDTO, 0, len(items))
+
+	for _, item := range items {
+		total := 0
+		for _, v := range returnables[item.ProductID] {
+			total += v.count
+		}
+
+		if total == 0 {
+			result = append(result, &in.CreateStorageTransactionItemDTO{
+				WarehouseID: models.DefaultWarehouseID,
+				ProductID:   item.ProductID,
+				Count:       item.Count,
+			})
+
+			continue
+		}
+
+		count := int(item.Count)
+		shares := make([]int, len(returnables[item.ProductID]))
+		fractions := make([]int, len(shares))
+		left := count
+
+		for i, v := range returnables[item.ProductID] {
+			shares[i] = count * v.count / total
+			fractions[i] = count * v.count % total
+			left -= shares[i]
+		}
+
+		order := make([]int, len(shares))
+		for i := range order {
+			order[i] = i
+		}
+
+		sort.SliceStable(order, func(i, j int) bool {
+			return fractions[order[i]] > fractions[order[j]]
+		})
+
+		for i := 0; left > 0; i = (i + 1) % len(order) {
+			shares[order[i]]++
+			left--
+		}
+
+		for i, v := range returnables[item.ProductID] {
+			if shares[i] == 0 {
+				continue
+			}
+
+			v.count -= shares[i]
+
+			result = append(result, &in.CreateStorageTransactionItemDTO{
+				WarehouseID: v.warehouseID,
+				ProductID:   item.ProductID,
+				Count:       uint16(shares[i]),
+			})
+		}
+	}
+
+	return result
+}
+
+// Releases reservations of orders which were neither completed nor rejected in time,
+// e.g. when registry msg is lost. Rejected msg makes registry reject the order.
+// Failed reservation is logged and left for the next sweep, so it doesn't stop the batch.
+func (s *StorageService) expireReservations(ctx context.Context) error {
+	reservations, err := s.storageTransactionsDAO.GetListExpired(ctx, time.Now(), s.reservationsSweepBatch)
+	if err != nil {
+		return err
+	}
+
+	for _, reservation := range reservations {
+		if err := s.releaseExpiredReservation(ctx, reservation); err != nil {
+			s.logger.Errorf("Expire reservations: release reservation of order %d err: %v", reservation.OrderID, err)
 		}
+	}
 
-		product.Count += v.Count
+	return s.announceExpiredReservations(ctx)
+}
+
+func (s *StorageService) releaseExpiredReservation(ctx context.Context, reservation *models.StorageTransaction) error {
+	transItems, err := s.storageTransactionsDAO.GetItemsByOrderID(ctx, reservation.OrderID, models.Reservation)
+	if err != nil {
+		return err
+	}
+
+	items := make([]*in.CreateStorageTransactionItemDTO, 0, 10)
+	for _, v := range transItems {
+		items = append(items, &in.CreateStorageTransactionItemDTO{
+			WarehouseID: v.WarehouseID,
+			ProductID:   v.ProductID,
+			Count:       uint16(v.Count),
+		})
 	}
 
-	_, err = s.storageTransactionsDAO.Create(ctx, &in.CreateStorageTransactionDTO{
-		OrderID: data.OrderID,
+	_, err = s.storageItemsDAO.ReleaseExpired(ctx, reservation.ID, &in.CreateStorageTransactionDTO{
+		OrderID: reservation.OrderID,
 		Items:   items,
-		Type:    data.Type,
+		Type:    models.Cancelation,
 	})
+	if errors.Is(err, in.ErrReservationNotExpired) {
+		s.logger.Infof("Expire reservations: order %d completed or released concurrently, skip", reservation.OrderID)
+
+		return nil
+	}
+
+	if errors.Is(err, in.ErrMsgAlreadyProcessed) {
+		s.logger.Infof("Expire reservations: order %d released concurrently, skip", reservation.OrderID)
+
+		return s.storageTransactionsDAO.ClearReservationExpiry(ctx, reservation.OrderID)
+	}
+
 	if err != nil {
 		return err
 	}
 
-	if err := s.storageItemsDAO.UpdateCountBulk(ctx, storageItems); err != nil {
-		s.logger.Error("got process cancelation update count err: ", err)
+	s.logger.Warnf("Expire reservations: reservation of order %d released by timeout", reservation.OrderID)
+
+	return nil
+}
 
+// Sends rejected msgs for reservations released by timeout. Release is recorded with the reservation,
+// so msg failed to send, e.g. because of the restart, is sent again by the next sweep.
+func (s *StorageService) announceExpiredReservations(ctx context.Context) error {
+	reservations, err := s.storageTransactionsDAO.GetListExpiryNotAnnounced(ctx, s.reservationsSweepBatch)
+	if err != nil {
 		return err
 	}
 
-	s.logger.Info("Processing cancelation success")
+	for _, reservation := range reservations {
+		err := s.sendRejectedMsg(ctx, models.ReservationExpired, &in.Transaction{
+			OrderID: reservation.OrderID,
+			UserID:  reservation.UserID,
+		})
+		if err != nil {
+			s.logger.Error("Expire reservations: send rejected msg error: ", err)
+
+			continue
+		}
+
+		if err := s.storageTransactionsDAO.MarkExpiryAnnounced(ctx, reservation.ID); err != nil {
+			s.logger.Error("Expire reservations: mark expiry announced error: ", err)
+		}
+	}
 
 	return nil
 }
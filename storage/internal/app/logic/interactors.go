@@ -1,14 +1,131 @@
 package logic
 
 import (
+	"common/deadletter"
+	"common/events"
 	"context"
 	"errors"
+	"fmt"
 	in "storage_service/internal/app/interfaces"
 	"storage_service/internal/app/models"
+	"strings"
 	"sync"
 	"time"
 )
 
+// Page of storage items with stock levels
+func (s *StorageService) GetStorageItems(
+	ctx context.Context,
+	filter *in.StorageItemsFilterDTO,
+) ([]*models.StorageItem, error) {
+	return s.storageItemsDAO.GetList(ctx, filter)
+}
+
+// Stock levels of given products, unknown products are omitted
+func (s *StorageService) GetStock(ctx context.Context, productIDs []uint) ([]*models.StorageItem, error) {
+	return s.storageItemsDAO.GetListByProductIDs(ctx, productIDs)
+}
+
+// Warehouses in allocation order, nearest first
+func (s *StorageService) GetWarehouses(ctx context.Context) ([]*models.Warehouse, error) {
+	return s.warehousesDAO.GetList(ctx)
+}
+
+// Entry point to add warehouse, it is stocked by restock
+func (s *StorageService) CreateWarehouse(
+	ctx context.Context,
+	data *in.CreateWarehouseDTO,
+) (*models.Warehouse, error) {
+	s.logger.Info("Creating warehouse: ", data.Title)
+
+	data.Title = strings.TrimSpace(data.Title)
+	if data.Title == "" {
+		return nil, fmt.Errorf("%w: title is required", in.ErrInvalidWarehouse)
+	}
+
+	return s.warehousesDAO.Create(ctx, data)
+}
+
+// Entry point to change warehouse priority or take it out of allocation
+func (s *StorageService) UpdateWarehouse(
+	ctx context.Context,
+	data *in.UpdateWarehouseDTO,
+) (*models.Warehouse, error) {
+	s.logger.Info("Updating warehouse: ", data.ID)
+
+	if data.Priority == nil && data.Active == nil {
+		return nil, fmt.Errorf("%w: nothing to update", in.ErrInvalidWarehouse)
+	}
+
+	return s.warehousesDAO.Update(ctx, data)
+}
+
+// Entry point to restock products, counts of items must be positive
+func (s *StorageService) Restock(
+	ctx context.Context,
+	reason string,
+	items []*in.StockMovementItemDTO,
+) (*models.StorageTransaction, error) {
+	for _, v := range items {
+		if v.Delta <= 0 {
+			return nil, fmt.Errorf("%w: restock count of product %d must be positive", in.ErrInvalidStockMovement, v.ProductID)
+		}
+	}
+
+	return s.applyStockMovement(ctx, models.Restock, reason, items)
+}
+
+// Entry point to adjust stock levels after inventory count, write-off etc.
+func (s *StorageService) Adjust(
+	ctx context.Context,
+	reason string,
+	items []*in.StockMovementItemDTO,
+) (*models.StorageTransaction, error) {
+	for _, v := range items {
+		if v.Delta == 0 {
+			return nil, fmt.Errorf("%w: adjustment delta of product %d is zero", in.ErrInvalidStockMovement, v.ProductID)
+		}
+	}
+
+	return s.applyStockMovement(ctx, models.Adjustment, reason, items)
+}
+
+func (s *StorageService) applyStockMovement(
+	ctx context.Context,
+	transType models.TransactionType,
+	reason string,
+	items []*in.StockMovementItemDTO,
+) (*models.StorageTransaction, error) {
+	s.logger.Infof("Applying stock movement %d: %s", transType, reason)
+
+	if strings.TrimSpace(reason) == "" {
+		return nil, fmt.Errorf("%w: reason is required", in.ErrInvalidStockMovement)
+	}
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: no items", in.ErrInvalidStockMovement)
+	}
+
+	for _, v := range items {
+		if v.WarehouseID == 0 {
+			v.WarehouseID = models.DefaultWarehouseID
+		}
+	}
+
+	trans, err := s.storageItemsDAO.ApplyMovement(ctx, &in.CreateStockMovementDTO{
+		Type:   transType,
+		Reason: reason,
+		Items:  items,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Applying stock movement success: ", trans.ID)
+
+	return trans, nil
+}
+
 // Entry point to reserve product items in storage
 func (s *StorageService) MakeReservation(
 	ctx context.Context,
@@ -25,21 +142,14 @@ func (s *StorageService) MakeReservation(
 	}
 
 	trans := &in.Transaction{
-		OrderID: orderData.OrderID,
-		UserID:  orderData.UserID,
-		Items:   items,
-		Type:    models.Reservation,
+		MessageID: orderData.MessageID,
+		OrderID:   orderData.OrderID,
+		UserID:    orderData.UserID,
+		Items:     items,
+		Type:      models.Reservation,
 	}
 
-	select {
-	case s.transactionsPipe <- trans:
-	case <-time.After(s.sendMsgTimeout * time.Second):
-		return in.ErrNewTransactionTimeoutError
-	}
-
-	s.logger.Info("Reservation: send msg to chan success")
-
-	return nil
+	return s.reservationProcessor(ctx, trans)
 }
 
 // Entry point to cancel reservation
@@ -49,13 +159,44 @@ func (s *StorageService) MakeCancelation(
 ) error {
 	s.logger.Info("Making cancelation")
 
-	transItems, err := s.storageTransactionsDAO.GetItemsByOrderID(ctx, orderData.OrderID)
+	// Rejection may arrive before the new order msg, mark stops the later reservation.
+	if err := s.storageItemsDAO.MarkOrderRejected(ctx, orderData.OrderID); err != nil {
+		return err
+	}
+
+	transItems, err := s.storageTransactionsDAO.GetItemsByOrderID(ctx, orderData.OrderID, models.Reservation)
 	if err != nil && !errors.Is(err, in.ErrTransNotFound) {
 		return err
 	}
 
 	items := make([]*in.TransactionItem, 0, 10)
 	for _, v := range transItems {
+		items = append(items, &in.TransactionItem{
+			WarehouseID: v.WarehouseID,
+			ProductID:   v.ProductID,
+			Count:       uint16(v.Count),
+		})
+	}
+
+	trans := &in.Transaction{
+		MessageID: orderData.MessageID,
+		OrderID:   orderData.OrderID,
+		Items:     items,
+		Type:      models.Cancelation,
+	}
+
+	return s.processCancelation(ctx, trans)
+}
+
+// Entry point to restock returned order items
+func (s *StorageService) MakeReturn(
+	ctx context.Context,
+	returnData *in.ReturnOrderDTO,
+) error {
+	s.logger.Info("Making return: ", returnData.OrderID)
+
+	items := make([]*in.TransactionItem, 0, 10)
+	for _, v := range returnData.Items {
 		items = append(items, &in.TransactionItem{
 			ProductID: v.ProductID,
 			Count:     v.Count,
@@ -63,123 +204,174 @@ func (s *StorageService) MakeCancelation(
 	}
 
 	trans := &in.Transaction{
-		OrderID: orderData.OrderID,
-		Items:   items,
-		Type:    models.Cancelation,
+		MessageID: returnData.MessageID,
+		OrderID:   returnData.OrderID,
+		UserID:    returnData.UserID,
+		Items:     items,
+		Type:      models.Return,
+	}
+
+	return s.processReturn(ctx, trans)
+}
+
+// Completed order keeps its reservation, so it is not released by expiry.
+func (s *StorageService) ConfirmReservation(ctx context.Context, orderID uint) error {
+	s.logger.Info("Confirming reservation: ", orderID)
+
+	return s.storageTransactionsDAO.ClearReservationExpiry(ctx, orderID)
+}
+
+func (s *StorageService) handleNewOrderMsg(ctx context.Context, value []byte) error {
+	msg, err := events.DecodeNewOrderMsg(value)
+	if err != nil {
+		return deadletter.Permanent(err)
 	}
 
-	select {
-	case s.transactionsPipe <- trans:
-	case <-time.After(s.sendMsgTimeout * time.Second):
-		return in.ErrNewTransactionTimeoutError
+	s.logger.Debug("Kafka new order msg: ", msg)
+
+	orderItemsData := make([]*in.OrderItemDTO, 0, 10)
+	for _, v := range msg.OrderItems {
+		orderItemsData = append(orderItemsData, &in.OrderItemDTO{
+			ProductID:    v.ProductID,
+			Count:        uint16(v.Count),
+			ProductPrice: v.ProductPrice,
+		})
 	}
 
-	s.logger.Info("Cancelation: send msg to chan success")
+	orderData := in.OrderDTO{
+		MessageID:  msg.MessageID,
+		OrderID:    msg.OrderID,
+		UserID:     msg.UserID,
+		OrderItems: orderItemsData,
+	}
 
-	return nil
+	return s.MakeReservation(ctx, &orderData)
 }
 
-func (s *StorageService) EventPipeProcessor(ctx context.Context, wg *sync.WaitGroup) {
-	defer wg.Done()
+func (s *StorageService) handleRejectedOrderMsg(ctx context.Context, value []byte) error {
+	msg, err := events.DecodeOrderRejectedMsg(value)
+	if err != nil {
+		return deadletter.Permanent(err)
+	}
 
-	for {
-		select {
-		case trans, ok := <-s.transactionsPipe:
-			if !ok {
-				continue
-			}
+	s.logger.Debug("Kafka rejected order msg: ", msg)
 
-			switch trans.Type {
-			case models.Reservation:
-				go s.reservationProcessor(ctx, trans)
+	if msg.Service == in.Storage {
+		s.logger.Info("Got message for storage. Skip")
 
-			case models.Cancelation:
-				go s.cancelationProcessor(ctx, trans)
+		return nil
+	}
 
-			default:
-				go s.invalidTransProcessor(trans)
-			}
-		case <-ctx.Done():
-			return
-		}
+	cancelOrderData := in.CancelOrderDTO{
+		MessageID: msg.MessageID,
+		OrderID:   msg.OrderID,
+		UserID:    msg.UserID,
 	}
-}
 
-func (s *StorageService) ConsumeNewOrderMsgLoop(ctx context.Context, wg *sync.WaitGroup) {
-	defer wg.Done()
+	if err := s.MakeCancelation(ctx, cancelOrderData); err != nil {
+		return err
+	}
 
-	ticker := time.NewTicker(s.consumeLoopTick)
+	return s.sendCompensatedMsg(ctx, msg)
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			msg, err := s.brokerClient.GetNewOrderMsg(ctx)
-			if err != nil {
-				s.logger.Error("got new order msg err: ", err)
-			}
+func (s *StorageService) handleReturnedOrderMsg(ctx context.Context, value []byte) error {
+	msg, err := events.DecodeOrderReturnedMsg(value)
+	if err != nil {
+		return deadletter.Permanent(err)
+	}
 
-			if msg == nil {
-				continue
-			}
+	s.logger.Debug("Kafka returned order msg: ", msg)
 
-			s.logger.Debug("Kafka new order msg: ", msg)
+	items := make([]*in.OrderItemDTO, 0, 10)
+	for _, v := range msg.Items {
+		items = append(items, &in.OrderItemDTO{
+			ProductID:    v.ProductID,
+			Count:        uint16(v.Count),
+			ProductPrice: v.ProductPrice,
+		})
+	}
 
-			orderItemsData := make([]*in.OrderItemDTO, 0, 10)
-			for _, v := range msg.OrderItems {
-				orderItemsData = append(orderItemsData, &in.OrderItemDTO{
-					ProductID:    v.ProductID,
-					Count:        uint16(v.Count),
-					ProductPrice: v.ProductPrice,
-				})
-			}
+	returnData := &in.ReturnOrderDTO{
+		MessageID: msg.MessageID,
+		OrderID:   msg.OrderID,
+		UserID:    msg.UserID,
+		Items:     items,
+	}
 
-			orderData := in.OrderDTO{
-				OrderID:    msg.OrderID,
-				UserID:     msg.UserID,
-				OrderItems: orderItemsData,
-			}
+	return s.MakeReturn(ctx, returnData)
+}
 
-			if purchaseErr := s.MakeReservation(ctx, &orderData); purchaseErr != nil {
-				s.logger.Error("new order make purchase err: ", purchaseErr)
-			}
-		case <-ctx.Done():
-			return
-		}
+func (s *StorageService) handleCompletedOrderMsg(ctx context.Context, value []byte) error {
+	msg, err := events.DecodeOrderCompletedMsg(value)
+	if err != nil {
+		return deadletter.Permanent(err)
 	}
+
+	s.logger.Debug("Kafka completed order msg: ", msg)
+
+	return s.ConfirmReservation(ctx, msg.OrderID)
+}
+
+func (s *StorageService) ConsumeNewOrderMsgLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	s.deadLetters.Consume(
+		ctx,
+		s.brokerClient.FetchNewOrderMsg,
+		s.brokerClient.CommitMsg,
+		s.handleNewOrderMsg,
+		s.consumeLoopTick,
+	)
 }
 
 func (s *StorageService) ConsumeRejectedOrderMsgLoop(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	ticker := time.NewTicker(s.consumeLoopTick)
+	s.deadLetters.Consume(
+		ctx,
+		s.brokerClient.FetchOrderRejectedMsg,
+		s.brokerClient.CommitMsg,
+		s.handleRejectedOrderMsg,
+		s.consumeLoopTick,
+	)
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			msg, err := s.brokerClient.GetOrderRejectedMsg(ctx)
-			if err != nil {
-				s.logger.Error("get order rejected msg err: ", err)
-			}
+func (s *StorageService) ConsumeReturnedOrderMsgLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
 
-			if msg == nil {
-				continue
-			}
+	s.deadLetters.Consume(
+		ctx,
+		s.brokerClient.FetchOrderReturnedMsg,
+		s.brokerClient.CommitMsg,
+		s.handleReturnedOrderMsg,
+		s.consumeLoopTick,
+	)
+}
 
-			s.logger.Debug("Kafka rejected order msg: ", msg)
+func (s *StorageService) ConsumeCompletedOrderMsgLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
 
-			if msg.Service == in.Storage {
-				s.logger.Info("Got message for storage. Skip")
+	s.deadLetters.Consume(
+		ctx,
+		s.brokerClient.FetchOrderCompletedMsg,
+		s.brokerClient.CommitMsg,
+		s.handleCompletedOrderMsg,
+		s.consumeLoopTick,
+	)
+}
 
-				continue
-			}
+func (s *StorageService) ExpireReservationsLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
 
-			cancelOrderData := &in.CancelOrderDTO{
-				OrderID: msg.OrderID,
-				UserID:  msg.UserID,
-			}
+	ticker := time.NewTicker(s.reservationsSweepInterval)
+	defer ticker.Stop()
 
-			if cancelErr := s.MakeCancelation(ctx, *cancelOrderData); cancelErr != nil {
-				s.logger.Error("rejected order update err: ", cancelErr)
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.expireReservations(ctx); err != nil {
+				s.logger.Error("Expire reservations err: ", err)
 			}
 		case <-ctx.Done():
 			return
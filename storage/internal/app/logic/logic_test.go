@@ -0,0 +1,301 @@
+package logic
+
+import (
+	"common/deadletter"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"storage_service/internal/app/allocation"
+	in "storage_service/internal/app/interfaces"
+	"storage_service/internal/app/models"
+	"storage_service/internal/pkg/broker"
+	"storage_service/internal/pkg/conf"
+	"storage_service/internal/pkg/db"
+	"sync"
+	"testing"
+
+	"github.com/creasty/defaults"
+	"github.com/sirupsen/logrus"
+)
+
+// Service on in-memory DAOs, products 1-3 have 10 items each in the main warehouse.
+func newStorageService(t *testing.T) *StorageService {
+	t.Helper()
+
+	config := &conf.Config{}
+	if err := defaults.Set(config); err != nil {
+		t.Fatal("err config set defaults", err)
+	}
+
+	strategy, err := allocation.New(config.Allocation.Strategy)
+	if err != nil {
+		t.Fatal("new allocation strategy err", err)
+	}
+
+	logEntry := logrus.NewEntry(logrus.New())
+	store := db.NewInMemoryStore()
+	brokerClient := broker.NewInMemoryBrokerClient()
+
+	return NewStorageService(
+		db.NewInMemoryStorageItemsDAO(store),
+		db.NewInMemoryStorageTransDAO(store),
+		db.NewInMemoryWarehousesDAO(store),
+		brokerClient,
+		deadletter.NewQueue(
+			config.Kafka.GroupID,
+			deadletter.NewInMemoryStore(),
+			brokerClient,
+			config.RetryPolicy(),
+			logEntry,
+		),
+		strategy,
+		logEntry,
+		config,
+	)
+}
+
+func reserve(t *testing.T, s *StorageService, messageID string, orderID uint, items ...*in.OrderItemDTO) {
+	t.Helper()
+
+	err := s.MakeReservation(context.Background(), &in.OrderDTO{
+		MessageID:  messageID,
+		OrderID:    orderID,
+		UserID:     1,
+		OrderItems: items,
+	})
+	if err != nil {
+		t.Fatal("make reservation err", err)
+	}
+}
+
+func checkStock(t *testing.T, s *StorageService, productID uint, count uint) {
+	t.Helper()
+
+	stock, err := s.GetStock(context.Background(), []uint{productID})
+	if err != nil {
+		t.Fatal("get stock err", err)
+	}
+
+	var got uint
+	for _, v := range stock {
+		got += v.Count
+	}
+
+	if got != count {
+		t.Errorf("product %d stock %d, expected %d", productID, got, count)
+	}
+}
+
+// Redelivered new order msg is found in the inbox, the order is reserved once.
+func TestRedeliveredNewOrderMsgReservedOnce(t *testing.T) {
+	s := newStorageService(t)
+
+	for _, messageID := range []string{"new_order:1", "new_order:1", "new_order:1:resent"} {
+		reserve(t, s, messageID, 1, &in.OrderItemDTO{ProductID: 1, Count: 3})
+	}
+
+	checkStock(t, s, 1, 7)
+}
+
+// Order with one short line is rejected, stock of its other lines is left as is.
+func TestShortLineRejectsWholeReservation(t *testing.T) {
+	s := newStorageService(t)
+
+	reserve(
+		t,
+		s,
+		"new_order:1",
+		1,
+		&in.OrderItemDTO{ProductID: 1, Count: 3},
+		&in.OrderItemDTO{ProductID: 2, Count: 11},
+	)
+
+	checkStock(t, s, 1, 10)
+	checkStock(t, s, 2, 10)
+
+	items, err := s.storageTransactionsDAO.GetItemsByOrderID(context.Background(), 1, models.Reservation)
+	if err != nil && !errors.Is(err, in.ErrTransNotFound) {
+		t.Fatal("get reservation items err", err)
+	}
+
+	if len(items) != 0 {
+		t.Error("reservation of rejected order is recorded", items)
+	}
+}
+
+// Concurrent reservations decrement stock relatively, so it is not oversold.
+func TestConcurrentReservationsDoNotOversell(t *testing.T) {
+	s := newStorageService(t)
+
+	var wg sync.WaitGroup
+
+	for orderID := uint(1); orderID <= 10; orderID++ {
+		wg.Add(1)
+
+		go func(orderID uint) {
+			defer wg.Done()
+
+			err := s.MakeReservation(context.Background(), &in.OrderDTO{
+				MessageID:  fmt.Sprintf("new_order:%d", orderID),
+				OrderID:    orderID,
+				UserID:     1,
+				OrderItems: []*in.OrderItemDTO{{ProductID: 1, Count: 3}},
+			})
+			if err != nil {
+				t.Error("make reservation err", err)
+			}
+		}(orderID)
+	}
+
+	wg.Wait()
+
+	checkStock(t, s, 1, 1)
+}
+
+func TestStockMovementValidation(t *testing.T) {
+	ctx := context.Background()
+	s := newStorageService(t)
+
+	cases := []struct {
+		name   string
+		apply  func(ctx context.Context, reason string, items []*in.StockMovementItemDTO) (*models.StorageTransaction, error)
+		reason string
+		items  []*in.StockMovementItemDTO
+	}{
+		{
+			name:   "restock without reason",
+			apply:  s.Restock,
+			reason: " ",
+			items:  []*in.StockMovementItemDTO{{ProductID: 1, Delta: 1}},
+		},
+		{
+			name:   "restock without items",
+			apply:  s.Restock,
+			reason: "delivery",
+		},
+		{
+			name:   "negative restock",
+			apply:  s.Restock,
+			reason: "delivery",
+			items:  []*in.StockMovementItemDTO{{ProductID: 1, Delta: -1}},
+		},
+		{
+			name:   "zero adjustment",
+			apply:  s.Adjust,
+			reason: "inventory",
+			items:  []*in.StockMovementItemDTO{{ProductID: 1, Delta: 0}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := tc.apply(ctx, tc.reason, tc.items); !errors.Is(err, in.ErrInvalidStockMovement) {
+				t.Error("expected invalid stock movement err, got", err)
+			}
+		})
+	}
+
+	checkStock(t, s, 1, 10)
+}
+
+// Adjustment which would make any count negative is rejected as a whole, API responds with 409.
+func TestAdjustmentBelowZeroIsRejected(t *testing.T) {
+	ctx := context.Background()
+	s := newStorageService(t)
+
+	if _, err := s.Restock(ctx, "delivery", []*in.StockMovementItemDTO{{ProductID: 1, Delta: 5}}); err != nil {
+		t.Fatal("restock err", err)
+	}
+
+	checkStock(t, s, 1, 15)
+
+	_, err := s.Adjust(ctx, "write-off", []*in.StockMovementItemDTO{
+		{ProductID: 1, Delta: -3},
+		{ProductID: 2, Delta: -11},
+	})
+	if !errors.Is(err, in.ErrOutOfStock) {
+		t.Error("expected out of stock err, got", err)
+	}
+
+	checkStock(t, s, 1, 15)
+	checkStock(t, s, 2, 10)
+
+	if _, err := s.Adjust(ctx, "write-off", []*in.StockMovementItemDTO{{ProductID: 2, Delta: -10}}); err != nil {
+		t.Fatal("adjust err", err)
+	}
+
+	checkStock(t, s, 2, 0)
+}
+
+func TestReturnItems(t *testing.T) {
+	// Product 1 is split 6/3/1 across warehouses 1-3, product 2 is reserved in warehouse 2 only.
+	reserved := []*models.StorageTransactionItem{
+		{WarehouseID: 1, ProductID: 1, Count: 6},
+		{WarehouseID: 2, ProductID: 1, Count: 3},
+		{WarehouseID: 3, ProductID: 1, Count: 1},
+		{WarehouseID: 2, ProductID: 2, Count: 2},
+	}
+
+	cases := []struct {
+		name     string
+		items    []*in.TransactionItem
+		returned []*models.StorageTransactionItem
+		want     []*in.CreateStorageTransactionItemDTO
+	}{
+		{
+			name:  "whole split item",
+			items: []*in.TransactionItem{{ProductID: 1, Count: 10}},
+			want: []*in.CreateStorageTransactionItemDTO{
+				{WarehouseID: 1, ProductID: 1, Count: 6},
+				{WarehouseID: 2, ProductID: 1, Count: 3},
+				{WarehouseID: 3, ProductID: 1, Count: 1},
+			},
+		},
+		{
+			name:  "part of split item, leftover goes to the largest fraction",
+			items: []*in.TransactionItem{{ProductID: 1, Count: 5}},
+			want: []*in.CreateStorageTransactionItemDTO{
+				{WarehouseID: 1, ProductID: 1, Count: 3},
+				{WarehouseID: 2, ProductID: 1, Count: 2},
+			},
+		},
+		{
+			name:  "rest of split item after earlier return",
+			items: []*in.TransactionItem{{ProductID: 1, Count: 5}},
+			returned: []*models.StorageTransactionItem{
+				{WarehouseID: 1, ProductID: 1, Count: 3},
+				{WarehouseID: 2, ProductID: 1, Count: 2},
+			},
+			want: []*in.CreateStorageTransactionItemDTO{
+				{WarehouseID: 1, ProductID: 1, Count: 3},
+				{WarehouseID: 2, ProductID: 1, Count: 1},
+				{WarehouseID: 3, ProductID: 1, Count: 1},
+			},
+		},
+		{
+			name:  "item from one warehouse",
+			items: []*in.TransactionItem{{ProductID: 2, Count: 1}},
+			want: []*in.CreateStorageTransactionItemDTO{
+				{WarehouseID: 2, ProductID: 2, Count: 1},
+			},
+		},
+		{
+			name:  "item reserved before warehouses",
+			items: []*in.TransactionItem{{ProductID: 3, Count: 2}},
+			want: []*in.CreateStorageTransactionItemDTO{
+				{WarehouseID: models.DefaultWarehouseID, ProductID: 3, Count: 2},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := returnItems(tc.items, reserved, tc.returned)
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package logic
 
 import (
+	"common/deadletter"
+	"storage_service/internal/app/allocation"
 	in "storage_service/internal/app/interfaces"
 	"storage_service/internal/pkg/conf"
 	"time"
@@ -11,34 +13,47 @@ import (
 type StorageService struct {
 	storageItemsDAO        in.StorageItemsDAO
 	storageTransactionsDAO in.StorageTransactionsDAO
+	warehousesDAO          in.WarehousesDAO
 	brokerClient           in.BrokerClient
-	transactionsPipe       chan *in.Transaction
+	allocationStrategy     allocation.Strategy
+	deadLetters            *deadletter.Queue
 
-	sendMsgTimeout  time.Duration
-	consumeLoopTick time.Duration
-	logger          *logrus.Entry
+	consumeLoopTick           time.Duration
+	reservationTTL            time.Duration
+	reservationsSweepInterval time.Duration
+	reservationsSweepBatch    uint16
+	logger                    *logrus.Entry
 }
 
 func NewStorageService(
 	storageItemsDAO in.StorageItemsDAO,
 	storageTransactionsDAO in.StorageTransactionsDAO,
+	warehousesDAO in.WarehousesDAO,
 	brokerClient in.BrokerClient,
+	deadLetters *deadletter.Queue,
+	allocationStrategy allocation.Strategy,
 	logger *logrus.Entry,
 	config *conf.Config,
 ) *StorageService {
-	transactionsPipe := make(chan *in.Transaction, config.Server.TransactionsPipeCapacity)
-
-	return &StorageService{
-		storageItemsDAO:        storageItemsDAO,
-		storageTransactionsDAO: storageTransactionsDAO,
-		brokerClient:           brokerClient,
-		transactionsPipe:       transactionsPipe,
-		sendMsgTimeout:         time.Duration(config.Kafka.SendMsgTimeout) * time.Second,
-		consumeLoopTick:        time.Duration(config.Kafka.ConsumeLoopTick) * time.Millisecond,
-		logger:                 logger,
+	s := &StorageService{
+		storageItemsDAO:           storageItemsDAO,
+		storageTransactionsDAO:    storageTransactionsDAO,
+		warehousesDAO:             warehousesDAO,
+		brokerClient:              brokerClient,
+		allocationStrategy:        allocationStrategy,
+		deadLetters:               deadLetters,
+		consumeLoopTick:           time.Duration(config.Kafka.ConsumeLoopTick) * time.Millisecond,
+		reservationTTL:            time.Duration(config.Reservations.TTL) * time.Second,
+		reservationsSweepInterval: time.Duration(config.Reservations.SweepInterval) * time.Second,
+		reservationsSweepBatch:    config.Reservations.SweepBatch,
+		logger:                    logger,
 	}
-}
 
-func (s *StorageService) Close() {
-	close(s.transactionsPipe)
+	// Letters are replayed by the handlers msgs of their topics are consumed with.
+	deadLetters.Register(config.Kafka.NewOrdersTopic, s.handleNewOrderMsg)
+	deadLetters.Register(config.Kafka.RejectedOrdersTopic, s.handleRejectedOrderMsg)
+	deadLetters.Register(config.Kafka.ReturnedOrdersTopic, s.handleReturnedOrderMsg)
+	deadLetters.Register(config.Kafka.CompletedOrdersTopic, s.handleCompletedOrderMsg)
+
+	return s
 }
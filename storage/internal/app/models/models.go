@@ -1,9 +1,20 @@
 package models
 
+import (
+	"common/events"
+	"common/money"
+	"time"
+)
+
+type (
+	OrderStatus     uint8
+	TransactionType uint8
+)
+
+// Shared with other services through msgs.
 type (
-	OrderStatus       uint8
-	TransactionType   uint8
-	CancelationReason uint8
+	Money             = money.Money
+	CancelationReason = events.CancelationReason
 )
 
 const (
@@ -16,32 +27,64 @@ const (
 const (
 	Reservation TransactionType = iota
 	Cancelation
+	Restock
+	Adjustment
+	Return
 )
 
 const (
-	OK CancelationReason = iota
-	NotEnoughMoney
-	OutOfStock
-	InternalError
+	OK                 = events.OK
+	NotEnoughMoney     = events.NotEnoughMoney
+	OutOfStock         = events.OutOfStock
+	InternalError      = events.InternalError
+	Timeout            = events.Timeout
+	CanceledByUser     = events.CanceledByUser
+	ReservationExpired = events.ReservationExpired
 )
 
-type StorageItem struct {
+// Warehouse created by migrations, stock kept before warehouses were introduced belongs to it.
+const DefaultWarehouseID uint = 1
+
+// Warehouses with lower priority are nearer and allocated first,
+// inactive warehouse keeps its stock but is not used for new reservations.
+type Warehouse struct {
 	ID        uint
-	ProductID uint
-	Count     uint16
+	Title     string
+	Priority  int
+	Active    bool
+	CreatedAt time.Time
 }
 
+// Stock of product in warehouse.
+type StorageItem struct {
+	ID          uint
+	WarehouseID uint
+	ProductID   uint
+	Count       uint
+}
+
+// Order reservation, its cancelation or return of order items,
+// restock and adjustment are stock movements made by warehouse without order.
+// Reservation expires if the order is neither completed nor rejected in time.
 type StorageTransaction struct {
-	ID      uint
-	OrderID uint
-	Items   []*StorageTransactionItem
-	Type    TransactionType
+	ID        uint
+	OrderID   uint
+	UserID    uint
+	Items     []*StorageTransactionItem
+	Type      TransactionType
+	Reason    string
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+	ExpiredAt *time.Time // set when reservation is released by timeout
 }
 
+// Count is negative for adjustment which decreases stock.
+// Reserved items are released to the warehouse they were taken from.
 type StorageTransactionItem struct {
 	ID            uint
+	WarehouseID   uint
 	ProductID     uint
 	TransactionID uint
 	OrderID       uint
-	Count         uint16
+	Count         int
 }
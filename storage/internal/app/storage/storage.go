@@ -1,7 +1,11 @@
 package storage
 
 import (
+	"common/backend"
+	"common/deadletter"
 	"context"
+	"fmt"
+	"storage_service/internal/app/allocation"
 	in "storage_service/internal/app/interfaces"
 	"storage_service/internal/app/logic"
 	"storage_service/internal/pkg/broker"
@@ -14,8 +18,10 @@ import (
 type App struct {
 	StorageItemsDAO        in.StorageItemsDAO
 	StorageTransactionsDAO in.StorageTransactionsDAO
+	WarehousesDAO          in.WarehousesDAO
 	BrokerClient           in.BrokerClient
 
+	DeadLetters    *deadletter.Queue
 	StorageService *logic.StorageService
 
 	Logger *logrus.Entry
@@ -24,6 +30,17 @@ type App struct {
 
 func NewStorageApp(ctx context.Context) *App {
 	config := conf.New()
+
+	brokerClient, err := newBrokerClient(config)
+	if err != nil {
+		panic(err)
+	}
+
+	return NewStorageAppWithBroker(ctx, config, brokerClient)
+}
+
+// Builds app around given broker client, used to run services in one process.
+func NewStorageAppWithBroker(ctx context.Context, config *conf.Config, brokerClient in.BrokerClient) *App {
 	logger := logrus.New()
 	// logger.SetFormatter(&logrus.JSONFormatter{})
 	logEntry := logrus.NewEntry(logger)
@@ -31,18 +48,35 @@ func NewStorageApp(ctx context.Context) *App {
 		parseLogLevel(config.Logger.LogLevel),
 	)
 
-	brokerClient, err := broker.NewKafkaClient(config)
+	allocationStrategy, err := allocation.New(config.Allocation.Strategy)
 	if err != nil {
 		panic(err)
 	}
 
-	storageItemsDAO := db.NewPostgresStorageItemsDAO(ctx, config)
-	storageTransactionsDAO := db.NewPostgresStorageTransDAO(ctx, config)
+	appDAOs, err := newDAOs(ctx, config)
+	if err != nil {
+		panic(err)
+	}
+
+	storageItemsDAO := appDAOs.StorageItemsDAO
+	storageTransactionsDAO := appDAOs.StorageTransactionsDAO
+	warehousesDAO := appDAOs.WarehousesDAO
+
+	deadLetters := deadletter.NewQueue(
+		config.Kafka.GroupID,
+		appDAOs.DeadLettersStore,
+		brokerClient,
+		config.RetryPolicy(),
+		logEntry,
+	)
 
 	storageService := logic.NewStorageService(
 		storageItemsDAO,
 		storageTransactionsDAO,
+		warehousesDAO,
 		brokerClient,
+		deadLetters,
+		allocationStrategy,
 		logEntry,
 		config,
 	)
@@ -53,16 +87,60 @@ func NewStorageApp(ctx context.Context) *App {
 		BrokerClient:           brokerClient,
 		StorageItemsDAO:        storageItemsDAO,
 		StorageTransactionsDAO: storageTransactionsDAO,
+		WarehousesDAO:          warehousesDAO,
+		DeadLetters:            deadLetters,
 		StorageService:         storageService,
 	}
 
 	return &app
 }
 
+func newBrokerClient(config *conf.Config) (in.BrokerClient, error) {
+	switch config.Broker.Backend {
+	case backend.Kafka:
+		return broker.NewKafkaClient(config)
+	case backend.Memory:
+		return broker.NewInMemoryBrokerClient(), nil
+	default:
+		return nil, fmt.Errorf("%w: broker %q", backend.ErrUnknown, config.Broker.Backend)
+	}
+}
+
+type daos struct {
+	StorageItemsDAO        in.StorageItemsDAO
+	StorageTransactionsDAO in.StorageTransactionsDAO
+	WarehousesDAO          in.WarehousesDAO
+	DeadLettersStore       deadletter.Store
+}
+
+func newDAOs(ctx context.Context, config *conf.Config) (*daos, error) {
+	switch config.Storage.Backend {
+	case backend.Postgres:
+		return &daos{
+			StorageItemsDAO:        db.NewPostgresStorageItemsDAO(ctx, config),
+			StorageTransactionsDAO: db.NewPostgresStorageTransDAO(ctx, config),
+			WarehousesDAO:          db.NewPostgresWarehousesDAO(ctx, config),
+			DeadLettersStore:       db.NewPostgresDeadLettersDAO(ctx, config),
+		}, nil
+	case backend.Memory:
+		store := db.NewInMemoryStore()
+
+		return &daos{
+			StorageItemsDAO:        db.NewInMemoryStorageItemsDAO(store),
+			StorageTransactionsDAO: db.NewInMemoryStorageTransDAO(store),
+			WarehousesDAO:          db.NewInMemoryWarehousesDAO(store),
+			DeadLettersStore:       deadletter.NewInMemoryStore(),
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: storage %q", backend.ErrUnknown, config.Storage.Backend)
+	}
+}
+
 func (app *App) Close() {
-	app.StorageService.Close()
 	app.BrokerClient.CloseReader()
 	app.BrokerClient.CloseWriter()
 	app.StorageItemsDAO.Close()
 	app.StorageTransactionsDAO.Close()
+	app.WarehousesDAO.Close()
+	app.DeadLetters.Close()
 }
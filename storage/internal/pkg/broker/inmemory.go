@@ -0,0 +1,209 @@
+package broker
+
+import (
+	"common/events"
+	"common/membus"
+	"context"
+	in "storage_service/internal/app/interfaces"
+	"storage_service/internal/pkg/conf"
+)
+
+type InMemoryBrokerClient struct {
+	bus                  membus.Bus
+	newOrdersTopic       string
+	rejectedOrdersTopic  string
+	successTopic         string
+	completedOrdersTopic string
+	returnedOrdersTopic  string
+	deadLettersTopic     string
+	newOrders            <-chan []byte
+	rejectedOrders       <-chan []byte
+	completedOrders      <-chan []byte
+	returnedOrders       <-chan []byte
+	success              <-chan []byte
+	readerClosed         chan struct{}
+	writerClosed         chan struct{}
+}
+
+// Client on its own bus, msgs are consumed by the same client. Used by tests.
+func NewInMemoryBrokerClient() *InMemoryBrokerClient {
+	config := &conf.Config{}
+	config.Kafka.NewOrdersTopic = "new_orders"
+	config.Kafka.RejectedOrdersTopic = "rejected_orders"
+	config.Kafka.SuccessTopic = "success_topic"
+	config.Kafka.CompletedOrdersTopic = "completed_orders"
+	config.Kafka.ReturnedOrdersTopic = "returned_orders"
+	config.Kafka.DeadLettersTopic = "dead_letters"
+	config.Kafka.GroupID = "storage"
+
+	return NewInMemoryBusClient(membus.NewInMemoryBus(), config)
+}
+
+// Client on the bus shared with other services running in the same process,
+// topics and consumer group are taken from Kafka config.
+func NewInMemoryBusClient(bus membus.Bus, config *conf.Config) *InMemoryBrokerClient {
+	c := config.Kafka
+
+	return &InMemoryBrokerClient{
+		bus:                  bus,
+		newOrdersTopic:       c.NewOrdersTopic,
+		rejectedOrdersTopic:  c.RejectedOrdersTopic,
+		successTopic:         c.SuccessTopic,
+		completedOrdersTopic: c.CompletedOrdersTopic,
+		returnedOrdersTopic:  c.ReturnedOrdersTopic,
+		deadLettersTopic:     c.DeadLettersTopic,
+		newOrders:            bus.Subscribe(c.NewOrdersTopic, c.GroupID),
+		rejectedOrders:       bus.Subscribe(c.RejectedOrdersTopic, c.GroupID),
+		completedOrders:      bus.Subscribe(c.CompletedOrdersTopic, c.GroupID),
+		returnedOrders:       bus.Subscribe(c.ReturnedOrdersTopic, c.GroupID),
+		success:              bus.Subscribe(c.SuccessTopic, c.GroupID),
+		readerClosed:         make(chan struct{}),
+		writerClosed:         make(chan struct{}),
+	}
+}
+
+func (c *InMemoryBrokerClient) send(topic string, value []byte) error {
+	select {
+	case <-c.writerClosed:
+		return in.ErrBrokerConnClosed
+	default:
+	}
+
+	c.bus.Publish(topic, value)
+
+	return nil
+}
+
+func (c *InMemoryBrokerClient) receive(ctx context.Context, topic <-chan []byte) ([]byte, error) {
+	select {
+	case value := <-topic:
+		return value, nil
+	case <-c.readerClosed:
+		return nil, in.ErrBrokerConnClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *InMemoryBrokerClient) fetch(ctx context.Context, topic string, msgs <-chan []byte) (*in.BrokerMsg, error) {
+	value, err := c.receive(ctx, msgs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &in.BrokerMsg{Topic: topic, Value: value}, nil
+}
+
+func (c *InMemoryBrokerClient) FetchNewOrderMsg(ctx context.Context) (*in.BrokerMsg, error) {
+	return c.fetch(ctx, c.newOrdersTopic, c.newOrders)
+}
+
+func (c *InMemoryBrokerClient) FetchOrderRejectedMsg(ctx context.Context) (*in.BrokerMsg, error) {
+	return c.fetch(ctx, c.rejectedOrdersTopic, c.rejectedOrders)
+}
+
+func (c *InMemoryBrokerClient) FetchOrderCompletedMsg(ctx context.Context) (*in.BrokerMsg, error) {
+	return c.fetch(ctx, c.completedOrdersTopic, c.completedOrders)
+}
+
+func (c *InMemoryBrokerClient) FetchOrderReturnedMsg(ctx context.Context) (*in.BrokerMsg, error) {
+	return c.fetch(ctx, c.returnedOrdersTopic, c.returnedOrders)
+}
+
+func (c *InMemoryBrokerClient) SendOrderRejectedMsg(ctx context.Context, msg *in.OrderRejectedMsg) error {
+	value, err := events.EncodeOrderRejectedMsg(producer, msg)
+	if err != nil {
+		return err
+	}
+
+	return c.send(c.rejectedOrdersTopic, value)
+}
+
+func (c *InMemoryBrokerClient) SendReservationSuccess(ctx context.Context, msg *in.OrderSuccessMsg) error {
+	value, err := events.EncodeOrderSuccessMsg(producer, msg)
+	if err != nil {
+		return err
+	}
+
+	return c.send(c.successTopic, value)
+}
+
+func (c *InMemoryBrokerClient) SendCompensatedMsg(ctx context.Context, msg *in.OrderCompensatedMsg) error {
+	value, err := events.EncodeOrderCompensatedMsg(producer, msg)
+	if err != nil {
+		return err
+	}
+
+	return c.send(c.successTopic, value)
+}
+
+// Storage doesn't produce orders msgs, writers are used by tests.
+func (c *InMemoryBrokerClient) SendNewOrderMsg(ctx context.Context, msg *in.NewOrderMsg) error {
+	value, err := events.EncodeNewOrderMsg(producer, msg)
+	if err != nil {
+		return err
+	}
+
+	return c.send(c.newOrdersTopic, value)
+}
+
+func (c *InMemoryBrokerClient) SendOrderCompletedMsg(ctx context.Context, msg *in.OrderCompletedMsg) error {
+	value, err := events.EncodeOrderCompletedMsg(producer, msg)
+	if err != nil {
+		return err
+	}
+
+	return c.send(c.completedOrdersTopic, value)
+}
+
+func (c *InMemoryBrokerClient) SendOrderReturnedMsg(ctx context.Context, msg *in.OrderReturnedMsg) error {
+	value, err := events.EncodeOrderReturnedMsg(producer, msg)
+	if err != nil {
+		return err
+	}
+
+	return c.send(c.returnedOrdersTopic, value)
+}
+
+// Storage doesn't consume success msgs, reader is used by tests.
+func (c *InMemoryBrokerClient) GetSuccessMsg(ctx context.Context) (*in.OrderSuccessMsg, error) {
+	value, err := c.receive(ctx, c.success)
+	if err != nil {
+		return nil, err
+	}
+
+	return events.DecodeOrderSuccessMsg(value)
+}
+
+// Bus delivers every msg once, there are no offsets to commit.
+func (c *InMemoryBrokerClient) CommitMsg(ctx context.Context, msg *in.BrokerMsg) error {
+	return nil
+}
+
+func (c *InMemoryBrokerClient) SendDeadLetter(ctx context.Context, key, value []byte) error {
+	return c.send(c.deadLettersTopic, value)
+}
+
+func (c *InMemoryBrokerClient) CloseReader() error {
+	close(c.readerClosed)
+
+	return nil
+}
+
+func (c *InMemoryBrokerClient) CloseWriter() error {
+	close(c.writerClosed)
+
+	return nil
+}
+
+func (c *InMemoryBrokerClient) ProduceHealthCheckMsg(ctx context.Context) error {
+	return nil
+}
+
+func (c *InMemoryBrokerClient) ConsumeHealthCheckMsg(ctx context.Context) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (c *InMemoryBrokerClient) HealthCheck(ctx context.Context) error {
+	return nil
+}
@@ -1,8 +1,10 @@
 package conf
 
 import (
+	"common/deadletter"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/creasty/defaults"
 	"gopkg.in/yaml.v2"
@@ -11,12 +13,11 @@ import (
 // App config
 type Config struct {
 	Server struct {
-		Port                     string `default:"8002" yaml:"port"`
-		Host                     string `default:"localhost" yaml:"host"`
-		Prefix                   string `yaml:"prefix"`
-		JWTAccessSecret          string `yaml:"jwt_access_secret"`
-		JWTRefreshSecret         string `yaml:"jwt_refresh_secret"`
-		TransactionsPipeCapacity uint16 `yaml:"transactions_pipe_cap"`
+		Port             string `default:"8002" yaml:"port"`
+		Host             string `default:"localhost" yaml:"host"`
+		Prefix           string `yaml:"prefix"`
+		JWTAccessSecret  string `yaml:"jwt_access_secret"`
+		JWTRefreshSecret string `yaml:"jwt_refresh_secret"`
 	} `yaml:"server"`
 	StorageDatabase struct {
 		Host              string `default:"localhost" yaml:"host"`
@@ -28,27 +29,58 @@ type Config struct {
 		Password          string `yaml:"password"`
 	} `yaml:"storage_database"`
 	Kafka struct {
-		NewOrdersTopic      string   `yaml:"new_orders_topic"`
-		RejectedOrdersTopic string   `yaml:"rejected_orders_topic"`
-		SuccessTopic        string   `yaml:"success_topic"`
-		GroupID             string   `default:"registry" yaml:"group_id"`
-		Brokers             []string `yaml:"brokers"`
-		ExternalClientsPort uint16   `yaml:"external_clients_port"`
-		InternalClientsPort uint16   `yaml:"internal_clients_port"`
-		MaxWait             uint8    `default:"200" yaml:"max_wait"`
-		SendMsgTimeout      uint8    `default:"5" yaml:"send_msg_timeout"`
-		ConsumeLoopTick     uint16   `default:"500" yaml:"consume_loop_tick"`
+		NewOrdersTopic       string   `yaml:"new_orders_topic"`
+		RejectedOrdersTopic  string   `yaml:"rejected_orders_topic"`
+		SuccessTopic         string   `yaml:"success_topic"`
+		ReturnedOrdersTopic  string   `yaml:"returned_orders_topic"`
+		CompletedOrdersTopic string   `yaml:"completed_orders_topic"`
+		GroupID              string   `default:"registry" yaml:"group_id"`
+		Brokers              []string `yaml:"brokers"`
+		ExternalClientsPort  uint16   `yaml:"external_clients_port"`
+		InternalClientsPort  uint16   `yaml:"internal_clients_port"`
+		MaxWait              uint8    `default:"200" yaml:"max_wait"`
+		ConsumeLoopTick      uint16   `default:"500" yaml:"consume_loop_tick"`
+		DeadLettersTopic     string   `default:"dead_letters" yaml:"dead_letters_topic"`
 	} `yaml:"kafka"`
+	Reservations struct {
+		TTL           uint32 `default:"900" yaml:"ttl"`
+		SweepInterval uint16 `default:"30" yaml:"sweep_interval"`
+		SweepBatch    uint16 `default:"100" yaml:"sweep_batch"`
+	} `yaml:"reservations"`
+	Allocation struct {
+		Strategy string `default:"single" yaml:"strategy"`
+	} `yaml:"allocation"`
+	Retry struct {
+		Attempts       uint8  `default:"5" yaml:"attempts"`
+		InitialBackoff uint16 `default:"100" yaml:"initial_backoff"`
+		MaxBackoff     uint16 `default:"5000" yaml:"max_backoff"`
+	} `yaml:"retry"`
+	Storage struct {
+		Backend string `default:"postgres" yaml:"backend"`
+	} `yaml:"storage"`
+	Broker struct {
+		Backend string `default:"kafka" yaml:"backend"`
+	} `yaml:"broker"`
 	Logger struct {
 		LogLevel string `default:"INFO" yaml:"log_level"`
 	} `yaml:"logger"`
 }
 
 func New() *Config {
-	f, err := os.Open("./config.yaml")
+	cfg, err := Load("./config.yaml")
 	if err != nil {
 		panic(err)
 	}
+
+	return cfg
+}
+
+// Reads config from yaml file, missing values are set to defaults.
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
 	defer f.Close()
 
 	var cfg Config
@@ -57,31 +89,40 @@ func New() *Config {
 
 	err = decoder.Decode(&cfg)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	if err := defaults.Set(&cfg); err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return &cfg
+	return &cfg, nil
+}
+
+// Retries of consumed msg handling before the msg is dead-lettered.
+func (c *Config) RetryPolicy() deadletter.Policy {
+	return deadletter.Policy{
+		Attempts:       int(c.Retry.Attempts),
+		InitialBackoff: time.Duration(c.Retry.InitialBackoff) * time.Millisecond,
+		MaxBackoff:     time.Duration(c.Retry.MaxBackoff) * time.Millisecond,
+	}
 }
 
 func (c *Config) ServerAddr() string {
 	return fmt.Sprintf("%s:%s", c.Server.Host, c.Server.Port)
 }
 
-func (c *Config) WalletDatabaseURI() string {
+func (c *Config) StorageDatabaseURI() string {
 	return fmt.Sprintf(
 		"postgres://%s:%s@%s:%s/%s",
 		c.StorageDatabase.Username,
 		c.StorageDatabase.Password,
 		c.StorageDatabase.Host,
 		c.StorageDatabase.Port,
-		c.WalletDatabaseDBName(),
+		c.StorageDatabaseDBName(),
 	)
 }
 
-func (c *Config) WalletDatabaseDBName() string {
+func (c *Config) StorageDatabaseDBName() string {
 	return c.StorageDatabase.DBName
 }
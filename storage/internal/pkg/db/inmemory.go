@@ -0,0 +1,786 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"storage_service/internal/app/allocation"
+	in "storage_service/internal/app/interfaces"
+	"storage_service/internal/app/models"
+	"sync"
+	"time"
+)
+
+// ------------------------------InMemoryStore------------------------------
+
+// Tables shared by in-memory DAOs. Every DAO method holds the store lock
+// for its whole run and validates before changing anything,
+// so it is applied atomically like a db transaction.
+type InMemoryStore struct {
+	warehouses      map[uint]*models.Warehouse
+	items           map[stockKey]*models.StorageItem
+	transactions    []*models.StorageTransaction
+	processedMsgs   map[string]struct{}
+	processedSteps  map[inMemoryStep]struct{}
+	announced       map[uint]struct{} // ids of expired reservations which rejected msg is sent for
+	rejectedOrders  map[uint]struct{}
+	lastWarehouseID uint
+	lastItemID      uint
+	lastTransItemID uint
+	mu              sync.RWMutex
+}
+
+type inMemoryStep struct {
+	orderID uint
+	step    models.TransactionType
+}
+
+// Seeds the same warehouse and stock as migrations do.
+func NewInMemoryStore() *InMemoryStore {
+	store := &InMemoryStore{
+		warehouses:     make(map[uint]*models.Warehouse),
+		items:          make(map[stockKey]*models.StorageItem),
+		processedMsgs:  make(map[string]struct{}),
+		processedSteps: make(map[inMemoryStep]struct{}),
+		announced:      make(map[uint]struct{}),
+		rejectedOrders: make(map[uint]struct{}),
+	}
+
+	store.createWarehouse(&in.CreateWarehouseDTO{Title: "main"})
+
+	for productID := uint(1); productID <= 3; productID++ {
+		store.ensureItem(stockKey{models.DefaultWarehouseID, productID}).Count = 10
+	}
+
+	return store
+}
+
+// Inbox check, returns ErrMsgAlreadyProcessed for the msg id or order step seen before.
+// Returns are unique by msg id only, order may have several of them.
+func (s *InMemoryStore) checkProcessedMsg(data *in.CreateStorageTransactionDTO) error {
+	if _, exists := s.processedMsgs[data.MessageID]; exists && data.MessageID != "" {
+		return in.ErrMsgAlreadyProcessed
+	}
+
+	step := inMemoryStep{orderID: data.OrderID, step: data.Type}
+	if _, exists := s.processedSteps[step]; exists && data.Type != models.Return {
+		return in.ErrMsgAlreadyProcessed
+	}
+
+	return nil
+}
+
+// Saves msg to inbox, should be called after checkProcessedMsg.
+func (s *InMemoryStore) saveProcessedMsg(data *in.CreateStorageTransactionDTO) {
+	if data.MessageID != "" {
+		s.processedMsgs[data.MessageID] = struct{}{}
+	}
+
+	if data.Type != models.Return {
+		s.processedSteps[inMemoryStep{orderID: data.OrderID, step: data.Type}] = struct{}{}
+	}
+}
+
+func (s *InMemoryStore) createWarehouse(data *in.CreateWarehouseDTO) *models.Warehouse {
+	s.lastWarehouseID++
+
+	warehouse := &models.Warehouse{
+		ID:        s.lastWarehouseID,
+		Title:     data.Title,
+		Priority:  data.Priority,
+		Active:    true,
+		CreatedAt: time.Now(),
+	}
+
+	s.warehouses[warehouse.ID] = warehouse
+
+	return warehouse
+}
+
+func (s *InMemoryStore) ensureItem(key stockKey) *models.StorageItem {
+	item, exists := s.items[key]
+	if !exists {
+		s.lastItemID++
+
+		item = &models.StorageItem{
+			ID:          s.lastItemID,
+			WarehouseID: key.warehouseID,
+			ProductID:   key.productID,
+		}
+
+		s.items[key] = item
+	}
+
+	return item
+}
+
+// Changes counts of storage items by sign*count of transaction items
+// and records the transaction, items should be checked before.
+func (s *InMemoryStore) writeTransaction(
+	data *in.CreateStorageTransactionDTO,
+	items []*in.CreateStorageTransactionItemDTO,
+	sign int,
+) *models.StorageTransaction {
+	for _, v := range items {
+		item := s.items[stockKey{v.WarehouseID, v.ProductID}]
+		item.Count = uint(int(item.Count) + sign*int(v.Count))
+	}
+
+	// Released reservation must not be released again by expiry.
+	if data.Type == models.Cancelation {
+		s.clearReservationExpiry(data.OrderID)
+	}
+
+	transItems := make([]*in.StockMovementItemDTO, 0, len(items))
+	for _, v := range items {
+		transItems = append(transItems, &in.StockMovementItemDTO{
+			WarehouseID: v.WarehouseID,
+			ProductID:   v.ProductID,
+			Delta:       int(v.Count),
+		})
+	}
+
+	return s.createTransaction(data.OrderID, data.UserID, data.Type, "", data.ExpiresAt, transItems)
+}
+
+// Items counts are stored as given, storage transaction item count is never negative
+// except for adjustment which decreases stock.
+func (s *InMemoryStore) createTransaction(
+	orderID uint,
+	userID uint,
+	transType models.TransactionType,
+	reason string,
+	expiresAt *time.Time,
+	items []*in.StockMovementItemDTO,
+) *models.StorageTransaction {
+	trans := &models.StorageTransaction{
+		ID:        uint(len(s.transactions)) + 1,
+		OrderID:   orderID,
+		UserID:    userID,
+		Type:      transType,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+		Items:     make([]*models.StorageTransactionItem, 0, len(items)),
+	}
+
+	for _, v := range items {
+		s.lastTransItemID++
+
+		trans.Items = append(trans.Items, &models.StorageTransactionItem{
+			ID:            s.lastTransItemID,
+			WarehouseID:   v.WarehouseID,
+			ProductID:     v.ProductID,
+			TransactionID: trans.ID,
+			OrderID:       orderID,
+			Count:         v.Delta,
+		})
+	}
+
+	s.transactions = append(s.transactions, trans)
+
+	return copyTransaction(trans)
+}
+
+func (s *InMemoryStore) clearReservationExpiry(orderID uint) {
+	for _, trans := range s.transactions {
+		if trans.OrderID == orderID && trans.Type == models.Reservation {
+			trans.ExpiresAt = nil
+		}
+	}
+}
+
+// Puts items back to their warehouses, store lock should be held.
+func (s *InMemoryStore) applyTransaction(data *in.CreateStorageTransactionDTO) (*models.StorageTransaction, error) {
+	if err := s.checkProcessedMsg(data); err != nil {
+		return nil, err
+	}
+
+	for _, v := range data.Items {
+		if _, exists := s.items[stockKey{v.WarehouseID, v.ProductID}]; !exists {
+			return nil, in.ErrProductNotFoundByID
+		}
+	}
+
+	s.saveProcessedMsg(data)
+
+	return s.writeTransaction(data, data.Items, 1), nil
+}
+
+// Stored transactions are never returned, callers get copies.
+func copyTransaction(trans *models.StorageTransaction) *models.StorageTransaction {
+	transCopy := *trans
+
+	transCopy.Items = make([]*models.StorageTransactionItem, 0, len(trans.Items))
+	for _, v := range trans.Items {
+		itemCopy := *v
+		transCopy.Items = append(transCopy.Items, &itemCopy)
+	}
+
+	if trans.ExpiresAt != nil {
+		expiresAt := *trans.ExpiresAt
+		transCopy.ExpiresAt = &expiresAt
+	}
+
+	if trans.ExpiredAt != nil {
+		expiredAt := *trans.ExpiredAt
+		transCopy.ExpiredAt = &expiredAt
+	}
+
+	return &transCopy
+}
+
+func copyStorageItems(items []*models.StorageItem) []*models.StorageItem {
+	itemsCopy := make([]*models.StorageItem, 0, len(items))
+	for _, v := range items {
+		itemCopy := *v
+		itemsCopy = append(itemsCopy, &itemCopy)
+	}
+
+	return itemsCopy
+}
+
+// ------------------------------StorageItemsDAO------------------------------
+
+type InMemoryStorageItemsDAO struct {
+	store *InMemoryStore
+}
+
+// Storage items page ordered by product and warehouse.
+func (dao *InMemoryStorageItemsDAO) GetList(
+	ctx context.Context,
+	filter *in.StorageItemsFilterDTO,
+) ([]*models.StorageItem, error) {
+	dao.store.mu.RLock()
+	defer dao.store.mu.RUnlock()
+
+	items := make([]*models.StorageItem, 0, len(dao.store.items))
+
+	for _, item := range dao.store.items {
+		if filter.WarehouseID == 0 || item.WarehouseID == filter.WarehouseID {
+			items = append(items, item)
+		}
+	}
+
+	sortStorageItems(items)
+
+	if uint(len(items)) <= filter.Offset {
+		return items[:0], nil
+	}
+
+	items = items[filter.Offset:]
+	if uint(len(items)) > filter.Limit {
+		items = items[:filter.Limit]
+	}
+
+	return copyStorageItems(items), nil
+}
+
+func (dao *InMemoryStorageItemsDAO) GetListByProductIDs(ctx context.Context, prodIDs []uint) ([]*models.StorageItem, error) {
+	dao.store.mu.RLock()
+	defer dao.store.mu.RUnlock()
+
+	return copyStorageItems(dao.store.itemsByProductIDs(prodIDs)), nil
+}
+
+// Stock of products in every warehouse, ordered by product and warehouse.
+func (s *InMemoryStore) itemsByProductIDs(prodIDs []uint) []*models.StorageItem {
+	products := make(map[uint]struct{}, len(prodIDs))
+	for _, id := range prodIDs {
+		products[id] = struct{}{}
+	}
+
+	items := make([]*models.StorageItem, 0, len(prodIDs))
+
+	for _, item := range s.items {
+		if _, exists := products[item.ProductID]; exists {
+			items = append(items, item)
+		}
+	}
+
+	sortStorageItems(items)
+
+	return items
+}
+
+func sortStorageItems(items []*models.StorageItem) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].ProductID != items[j].ProductID {
+			return items[i].ProductID < items[j].ProductID
+		}
+
+		return items[i].WarehouseID < items[j].WarehouseID
+	})
+}
+
+// Same checks as the Postgres one: inbox, unknown products and allocation of every item.
+func (dao *InMemoryStorageItemsDAO) Reserve(
+	ctx context.Context,
+	data *in.CreateStorageTransactionDTO,
+	strategy allocation.Strategy,
+) (*models.StorageTransaction, error) {
+	counts := make(map[uint]int)
+	productIDs := make([]uint, 0, 10)
+
+	for _, v := range data.Items {
+		if _, exists := counts[v.ProductID]; !exists {
+			productIDs = append(productIDs, v.ProductID)
+		}
+
+		counts[v.ProductID] += int(v.Count)
+	}
+
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	if err := dao.store.checkProcessedMsg(data); err != nil {
+		return nil, err
+	}
+
+	if _, rejected := dao.store.rejectedOrders[data.OrderID]; rejected {
+		return nil, in.ErrOrderRejected
+	}
+
+	items := dao.store.itemsByProductIDs(productIDs)
+
+	known := make(map[uint]struct{})
+	for _, v := range items {
+		known[v.ProductID] = struct{}{}
+	}
+
+	requests := make([]allocation.Request, 0, len(productIDs))
+
+	for _, productID := range productIDs {
+		if _, exists := known[productID]; !exists {
+			return nil, in.ErrProductNotFoundByID
+		}
+
+		requests = append(requests, allocation.Request{
+			ProductID: productID,
+			Count:     counts[productID],
+		})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].WarehouseID != items[j].WarehouseID {
+			return items[i].WarehouseID < items[j].WarehouseID
+		}
+
+		return items[i].ProductID < items[j].ProductID
+	})
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return dao.store.warehouses[items[i].WarehouseID].Priority < dao.store.warehouses[items[j].WarehouseID].Priority
+	})
+
+	stock := make([]allocation.Stock, 0, len(items))
+
+	for _, v := range items {
+		if !dao.store.warehouses[v.WarehouseID].Active {
+			continue
+		}
+
+		stock = append(stock, allocation.Stock{
+			WarehouseID: v.WarehouseID,
+			ProductID:   v.ProductID,
+			Count:       int(v.Count),
+		})
+	}
+
+	allocations, err := strategy.Allocate(requests, stock)
+	if errors.Is(err, allocation.ErrInsufficientStock) {
+		return nil, in.ErrOutOfStock
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	reserved := make([]*in.CreateStorageTransactionItemDTO, 0, len(allocations))
+	for _, v := range allocations {
+		reserved = append(reserved, &in.CreateStorageTransactionItemDTO{
+			WarehouseID: v.WarehouseID,
+			ProductID:   v.ProductID,
+			Count:       uint16(v.Count),
+		})
+	}
+
+	dao.store.saveProcessedMsg(data)
+
+	return dao.store.writeTransaction(data, reserved, -1), nil
+}
+
+// Later reservations of the order are refused with ErrOrderRejected.
+func (dao *InMemoryStorageItemsDAO) MarkOrderRejected(ctx context.Context, orderID uint) error {
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	dao.store.rejectedOrders[orderID] = struct{}{}
+
+	return nil
+}
+
+// Releases items reserved earlier to the warehouses they were reserved from.
+func (dao *InMemoryStorageItemsDAO) Release(
+	ctx context.Context,
+	data *in.CreateStorageTransactionDTO,
+) (*models.StorageTransaction, error) {
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	return dao.store.applyTransaction(data)
+}
+
+// Releases expired reservation like Release,
+// ErrReservationNotExpired is returned when order was completed or released meanwhile.
+func (dao *InMemoryStorageItemsDAO) ReleaseExpired(
+	ctx context.Context,
+	reservationID uint,
+	data *in.CreateStorageTransactionDTO,
+) (*models.StorageTransaction, error) {
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	now := time.Now()
+
+	if reservationID == 0 || reservationID > uint(len(dao.store.transactions)) {
+		return nil, in.ErrReservationNotExpired
+	}
+
+	reservation := dao.store.transactions[reservationID-1]
+	if reservation.ExpiresAt == nil || !reservation.ExpiresAt.Before(now) {
+		return nil, in.ErrReservationNotExpired
+	}
+
+	trans, err := dao.store.applyTransaction(data)
+	if err != nil {
+		return nil, err
+	}
+
+	reservation.ExpiresAt = nil
+	reservation.ExpiredAt = &now
+
+	return trans, nil
+}
+
+// Restocks returned order items.
+func (dao *InMemoryStorageItemsDAO) Return(
+	ctx context.Context,
+	data *in.CreateStorageTransactionDTO,
+) (*models.StorageTransaction, error) {
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	return dao.store.applyTransaction(data)
+}
+
+// Restock creates storage items for new products of the warehouse, adjustment is applied
+// to existing ones only and fails as a whole with ErrOutOfStock if any count would become negative.
+func (dao *InMemoryStorageItemsDAO) ApplyMovement(
+	ctx context.Context,
+	data *in.CreateStockMovementDTO,
+) (*models.StorageTransaction, error) {
+	deltas := make(map[stockKey]int)
+	keys := make([]stockKey, 0, 10)
+
+	for _, v := range data.Items {
+		key := stockKey{v.WarehouseID, v.ProductID}
+		if _, exists := deltas[key]; !exists {
+			keys = append(keys, key)
+		}
+
+		deltas[key] += v.Delta
+	}
+
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	for _, key := range keys {
+		if _, exists := dao.store.warehouses[key.warehouseID]; !exists {
+			return nil, in.ErrWarehouseNotFound
+		}
+	}
+
+	for _, key := range keys {
+		item, exists := dao.store.items[key]
+		if !exists && data.Type != models.Restock {
+			return nil, in.ErrProductNotFoundByID
+		}
+
+		var available int
+		if exists {
+			available = int(item.Count)
+		}
+
+		if available+deltas[key] < 0 {
+			return nil, in.ErrOutOfStock
+		}
+	}
+
+	movementItems := make([]*in.StockMovementItemDTO, 0, len(keys))
+
+	for _, key := range keys {
+		item := dao.store.ensureItem(key)
+		item.Count = uint(int(item.Count) + deltas[key])
+
+		if deltas[key] == 0 {
+			continue
+		}
+
+		movementItems = append(movementItems, &in.StockMovementItemDTO{
+			WarehouseID: key.warehouseID,
+			ProductID:   key.productID,
+			Delta:       deltas[key],
+		})
+	}
+
+	return dao.store.createTransaction(0, 0, data.Type, data.Reason, nil, movementItems), nil
+}
+
+func (dao *InMemoryStorageItemsDAO) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+func (dao *InMemoryStorageItemsDAO) Close() {
+}
+
+func NewInMemoryStorageItemsDAO(store *InMemoryStore) *InMemoryStorageItemsDAO {
+	return &InMemoryStorageItemsDAO{
+		store: store,
+	}
+}
+
+// ------------------------------TransactionsDAO------------------------------
+
+type InMemoryTransactionsDAO struct {
+	store *InMemoryStore
+}
+
+// First transaction of the order.
+func (dao *InMemoryTransactionsDAO) GetByOrderID(ctx context.Context, orderID uint) (*models.StorageTransaction, error) {
+	dao.store.mu.RLock()
+	defer dao.store.mu.RUnlock()
+
+	for _, trans := range dao.store.transactions {
+		if trans.OrderID == orderID && orderID != 0 {
+			return copyTransaction(trans), nil
+		}
+	}
+
+	return nil, in.ErrTransNotFound
+}
+
+// Items reserved for the order.
+// Items of the order transactions of the type, e.g. reserved or returned ones.
+func (dao *InMemoryTransactionsDAO) GetItemsByOrderID(
+	ctx context.Context,
+	orderID uint,
+	transType models.TransactionType,
+) ([]*models.StorageTransactionItem, error) {
+	dao.store.mu.RLock()
+	defer dao.store.mu.RUnlock()
+
+	items := make([]*models.StorageTransactionItem, 0, 10)
+
+	for _, trans := range dao.store.transactions {
+		if trans.OrderID != orderID || trans.Type != transType {
+			continue
+		}
+
+		items = append(items, copyTransaction(trans).Items...)
+	}
+
+	return items, nil
+}
+
+// Reservations which expired before now, oldest first.
+func (dao *InMemoryTransactionsDAO) GetListExpired(
+	ctx context.Context,
+	now time.Time,
+	limit uint16,
+) ([]*models.StorageTransaction, error) {
+	dao.store.mu.RLock()
+	defer dao.store.mu.RUnlock()
+
+	transactions := make([]*models.StorageTransaction, 0, limit)
+
+	for _, trans := range dao.store.transactions {
+		if trans.Type == models.Reservation && trans.ExpiresAt != nil && trans.ExpiresAt.Before(now) {
+			transCopy := copyTransaction(trans)
+			transCopy.Items = nil
+			transactions = append(transactions, transCopy)
+		}
+	}
+
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactions[i].ExpiresAt.Before(*transactions[j].ExpiresAt)
+	})
+
+	if len(transactions) > int(limit) {
+		transactions = transactions[:limit]
+	}
+
+	return transactions, nil
+}
+
+// Reservations released by timeout, which rejected msg is not sent for yet, oldest first.
+func (dao *InMemoryTransactionsDAO) GetListExpiryNotAnnounced(
+	ctx context.Context,
+	limit uint16,
+) ([]*models.StorageTransaction, error) {
+	dao.store.mu.RLock()
+	defer dao.store.mu.RUnlock()
+
+	transactions := make([]*models.StorageTransaction, 0, limit)
+
+	for _, trans := range dao.store.transactions {
+		if _, announced := dao.store.announced[trans.ID]; announced || trans.ExpiredAt == nil {
+			continue
+		}
+
+		transCopy := copyTransaction(trans)
+		transCopy.Items = nil
+		transactions = append(transactions, transCopy)
+	}
+
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactions[i].ExpiredAt.Before(*transactions[j].ExpiredAt)
+	})
+
+	if len(transactions) > int(limit) {
+		transactions = transactions[:limit]
+	}
+
+	return transactions, nil
+}
+
+func (dao *InMemoryTransactionsDAO) MarkExpiryAnnounced(ctx context.Context, reservationID uint) error {
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	dao.store.announced[reservationID] = struct{}{}
+
+	return nil
+}
+
+// Reservation of completed or released order is kept forever.
+func (dao *InMemoryTransactionsDAO) ClearReservationExpiry(ctx context.Context, orderID uint) error {
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	dao.store.clearReservationExpiry(orderID)
+
+	return nil
+}
+
+// Records transaction without changing stock.
+func (dao *InMemoryTransactionsDAO) Create(
+	ctx context.Context,
+	data *in.CreateStorageTransactionDTO,
+) (*models.StorageTransaction, error) {
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	items := make([]*in.StockMovementItemDTO, 0, len(data.Items))
+	for _, v := range data.Items {
+		items = append(items, &in.StockMovementItemDTO{
+			WarehouseID: v.WarehouseID,
+			ProductID:   v.ProductID,
+			Delta:       int(v.Count),
+		})
+	}
+
+	return dao.store.createTransaction(data.OrderID, data.UserID, data.Type, "", data.ExpiresAt, items), nil
+}
+
+func (dao *InMemoryTransactionsDAO) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+func (dao *InMemoryTransactionsDAO) Close() {
+}
+
+func NewInMemoryStorageTransDAO(store *InMemoryStore) *InMemoryTransactionsDAO {
+	return &InMemoryTransactionsDAO{
+		store: store,
+	}
+}
+
+// ------------------------------WarehousesDAO------------------------------
+
+type InMemoryWarehousesDAO struct {
+	store *InMemoryStore
+}
+
+// Warehouses in allocation order, nearest first.
+func (dao *InMemoryWarehousesDAO) GetList(ctx context.Context) ([]*models.Warehouse, error) {
+	dao.store.mu.RLock()
+	defer dao.store.mu.RUnlock()
+
+	warehouses := make([]*models.Warehouse, 0, len(dao.store.warehouses))
+
+	for _, warehouse := range dao.store.warehouses {
+		warehouseCopy := *warehouse
+		warehouses = append(warehouses, &warehouseCopy)
+	}
+
+	sort.Slice(warehouses, func(i, j int) bool {
+		if warehouses[i].Priority != warehouses[j].Priority {
+			return warehouses[i].Priority < warehouses[j].Priority
+		}
+
+		return warehouses[i].ID < warehouses[j].ID
+	})
+
+	return warehouses, nil
+}
+
+func (dao *InMemoryWarehousesDAO) Create(
+	ctx context.Context,
+	data *in.CreateWarehouseDTO,
+) (*models.Warehouse, error) {
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	warehouseCopy := *dao.store.createWarehouse(data)
+
+	return &warehouseCopy, nil
+}
+
+func (dao *InMemoryWarehousesDAO) Update(
+	ctx context.Context,
+	data *in.UpdateWarehouseDTO,
+) (*models.Warehouse, error) {
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	warehouse, exists := dao.store.warehouses[data.ID]
+	if !exists {
+		return nil, in.ErrWarehouseNotFound
+	}
+
+	if data.Priority != nil {
+		warehouse.Priority = *data.Priority
+	}
+
+	if data.Active != nil {
+		warehouse.Active = *data.Active
+	}
+
+	warehouseCopy := *warehouse
+
+	return &warehouseCopy, nil
+}
+
+func (dao *InMemoryWarehousesDAO) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+func (dao *InMemoryWarehousesDAO) Close() {
+}
+
+func NewInMemoryWarehousesDAO(store *InMemoryStore) *InMemoryWarehousesDAO {
+	return &InMemoryWarehousesDAO{
+		store: store,
+	}
+}
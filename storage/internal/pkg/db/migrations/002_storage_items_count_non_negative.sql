@@ -0,0 +1,2 @@
+ALTER TABLE storage_items DROP CONSTRAINT IF EXISTS storage_items_count_check;
+ALTER TABLE storage_items ADD CONSTRAINT storage_items_count_non_negative CHECK (count >= 0);
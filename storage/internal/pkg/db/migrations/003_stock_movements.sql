@@ -0,0 +1,8 @@
+ALTER TABLE storage_transactions ALTER COLUMN order_id DROP NOT NULL;
+ALTER TABLE storage_transactions ADD COLUMN IF NOT EXISTS reason varchar(255) NOT NULL DEFAULT '';
+
+ALTER TABLE storage_transaction_items ALTER COLUMN order_id DROP NOT NULL;
+ALTER TABLE storage_transaction_items DROP CONSTRAINT IF EXISTS storage_transaction_items_count_check;
+ALTER TABLE storage_transaction_items ADD CONSTRAINT storage_transaction_items_count_non_zero CHECK (count <> 0);
+
+CREATE UNIQUE INDEX IF NOT EXISTS storage_items_product_id_key ON storage_items (product_id);
@@ -0,0 +1,6 @@
+-- Reservations made before expiry was introduced have no expires_at and are never released by timeout.
+ALTER TABLE storage_transactions ADD COLUMN IF NOT EXISTS user_id bigint;
+ALTER TABLE storage_transactions ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS storage_transactions_expires_at_idx
+  ON storage_transactions (expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS warehouses (
+  id SERIAL PRIMARY KEY,
+  title varchar(255) NOT NULL,
+  priority int NOT NULL DEFAULT 0,
+  active boolean NOT NULL DEFAULT true,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Stock and reservations made before warehouses were introduced belong to the default warehouse.
+INSERT INTO warehouses(id, title) VALUES (1, 'main') ON CONFLICT DO NOTHING;
+SELECT setval('warehouses_id_seq', (SELECT MAX(id) FROM warehouses));
+
+ALTER TABLE storage_items ADD COLUMN IF NOT EXISTS warehouse_id bigint NOT NULL DEFAULT 1 REFERENCES warehouses;
+ALTER TABLE storage_items ALTER COLUMN warehouse_id DROP DEFAULT;
+
+DROP INDEX IF EXISTS storage_items_product_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS storage_items_warehouse_id_product_id_key
+  ON storage_items (warehouse_id, product_id);
+
+ALTER TABLE storage_transaction_items ADD COLUMN IF NOT EXISTS warehouse_id bigint REFERENCES warehouses;
+UPDATE storage_transaction_items SET warehouse_id=1 WHERE warehouse_id IS NULL;
+ALTER TABLE storage_transaction_items ALTER COLUMN warehouse_id SET NOT NULL;
@@ -0,0 +1,7 @@
+-- Reservation released by timeout keeps expired_at, rejected msg about it
+-- is sent until expiry_announced_at is set, so the msg survives restarts.
+ALTER TABLE storage_transactions ADD COLUMN IF NOT EXISTS expired_at TIMESTAMPTZ;
+ALTER TABLE storage_transactions ADD COLUMN IF NOT EXISTS expiry_announced_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS storage_transactions_expiry_not_announced_idx
+  ON storage_transactions (expired_at) WHERE expired_at IS NOT NULL AND expiry_announced_at IS NULL;
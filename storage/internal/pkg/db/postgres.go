@@ -1,11 +1,16 @@
 package db
 
 import (
+	"common/deadletter"
+	"common/pg"
 	"context"
 	"errors"
+	"sort"
+	"storage_service/internal/app/allocation"
 	in "storage_service/internal/app/interfaces"
 	"storage_service/internal/app/models"
 	"storage_service/internal/pkg/conf"
+	"time"
 
 	"github.com/lib/pq"
 
@@ -13,7 +18,7 @@ import (
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-var migrationsApplied bool
+const migrationsDir = "./internal/pkg/db/migrations"
 
 // ------------------------------WalletsDAO------------------------------
 
@@ -22,6 +27,38 @@ type PostgresStorageItemsDAO struct {
 	storageItemsTable string
 }
 
+// Storage items page ordered by product and warehouse.
+func (dao *PostgresStorageItemsDAO) GetList(
+	ctx context.Context,
+	filter *in.StorageItemsFilterDTO,
+) ([]*models.StorageItem, error) {
+	rows, err := dao.db.Query(ctx, "storage_items_list", filter.WarehouseID, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*models.StorageItem, 0, filter.Limit)
+
+	for rows.Next() {
+		var item models.StorageItem
+
+		err = rows.Scan(
+			&item.ID,
+			&item.WarehouseID,
+			&item.ProductID,
+			&item.Count,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, &item)
+	}
+
+	return items, rows.Err()
+}
+
 func (dao *PostgresStorageItemsDAO) GetListByProductIDs(ctx context.Context, prodIDs []uint) ([]*models.StorageItem, error) {
 	rows, err := dao.db.Query(ctx, "storage_items_list_by_prod_ids", pq.Array(prodIDs))
 	if err != nil {
@@ -35,6 +72,7 @@ func (dao *PostgresStorageItemsDAO) GetListByProductIDs(ctx context.Context, pro
 
 		err = rows.Scan(
 			&item.ID,
+			&item.WarehouseID,
 			&item.ProductID,
 			&item.Count,
 		)
@@ -61,6 +99,7 @@ func (dao *PostgresStorageItemsDAO) GetListByOrderID(ctx context.Context, orderI
 
 		err = rows.Scan(
 			&item.ID,
+			&item.WarehouseID,
 			&item.ProductID,
 			&item.Count,
 		)
@@ -74,23 +113,510 @@ func (dao *PostgresStorageItemsDAO) GetListByOrderID(ctx context.Context, orderI
 	return items, rows.Err()
 }
 
-func (dao *PostgresStorageItemsDAO) UpdateCountBulk(ctx context.Context, items []*models.StorageItem) error {
+// Reserves order items: takes them from warehouses chosen by allocation strategy,
+// decrements storage items counts and creates reservation transaction in one db transaction.
+// Storage items are locked, so concurrent reservations can't oversell,
+// reservation fails as a whole with ErrOutOfStock if any item is short.
+// Inactive warehouses are not used for reservations.
+func (dao *PostgresStorageItemsDAO) Reserve(
+	ctx context.Context,
+	data *in.CreateStorageTransactionDTO,
+	strategy allocation.Strategy,
+) (*models.StorageTransaction, error) {
+	counts := make(map[uint]int)
+	productIDs := make([]uint, 0, 10)
+
+	for _, v := range data.Items {
+		if _, exists := counts[v.ProductID]; !exists {
+			productIDs = append(productIDs, v.ProductID)
+		}
+
+		counts[v.ProductID] += int(v.Count)
+	}
+
+	tx, err := dao.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if err := saveProcessedMsg(ctx, tx, data); err != nil {
+		return nil, err
+	}
+
+	if err := checkOrderNotRejected(ctx, tx, data.OrderID); err != nil {
+		return nil, err
+	}
+
+	locked, err := lockStorageItems(ctx, tx, productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[uint]struct{})
+	for _, v := range locked {
+		known[v.productID] = struct{}{}
+	}
+
+	requests := make([]allocation.Request, 0, len(productIDs))
+
+	for _, productID := range productIDs {
+		if _, exists := known[productID]; !exists {
+			return nil, in.ErrProductNotFoundByID
+		}
+
+		requests = append(requests, allocation.Request{
+			ProductID: productID,
+			Count:     counts[productID],
+		})
+	}
+
+	sort.SliceStable(locked, func(i, j int) bool {
+		return locked[i].priority < locked[j].priority
+	})
+
+	stock := make([]allocation.Stock, 0, len(locked))
+
+	for _, v := range locked {
+		if !v.active {
+			continue
+		}
+
+		stock = append(stock, allocation.Stock{
+			WarehouseID: v.warehouseID,
+			ProductID:   v.productID,
+			Count:       v.count,
+		})
+	}
+
+	allocations, err := strategy.Allocate(requests, stock)
+	if errors.Is(err, allocation.ErrInsufficientStock) {
+		return nil, in.ErrOutOfStock
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*in.CreateStorageTransactionItemDTO, 0, len(allocations))
+	for _, v := range allocations {
+		items = append(items, &in.CreateStorageTransactionItemDTO{
+			WarehouseID: v.WarehouseID,
+			ProductID:   v.ProductID,
+			Count:       uint16(v.Count),
+		})
+	}
+
+	return writeTransaction(ctx, tx, data, items, -1)
+}
+
+// Rejection may be consumed before the new order msg, later reservations of the order
+// are refused with ErrOrderRejected. Order lock makes the mark and Reserve serial,
+// so reservation made concurrently is committed before the caller looks for it.
+func (dao *PostgresStorageItemsDAO) MarkOrderRejected(ctx context.Context, orderID uint) error {
 	tx, err := dao.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if _, err := tx.Exec(ctx, "lock_rejected_order", orderID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "create_rejected_order", orderID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func checkOrderNotRejected(ctx context.Context, tx pgx.Tx, orderID uint) error {
+	if _, err := tx.Exec(ctx, "lock_rejected_order", orderID); err != nil {
+		return err
+	}
+
+	var rejected bool
+
+	if err := tx.QueryRow(ctx, "order_rejected", orderID).Scan(&rejected); err != nil {
+		return err
+	}
+
+	if rejected {
+		return in.ErrOrderRejected
+	}
 
+	return nil
+}
+
+// Releases items reserved earlier: increments storage items counts
+// and creates cancelation transaction in one db transaction.
+// Items are released to the warehouses they were reserved from.
+func (dao *PostgresStorageItemsDAO) Release(
+	ctx context.Context,
+	data *in.CreateStorageTransactionDTO,
+) (*models.StorageTransaction, error) {
+	return dao.applyTransaction(ctx, data, nil)
+}
+
+// Releases expired reservation like Release. Reservation is claimed in the same db transaction,
+// so ErrReservationNotExpired is returned when order was completed or released meanwhile.
+func (dao *PostgresStorageItemsDAO) ReleaseExpired(
+	ctx context.Context,
+	reservationID uint,
+	data *in.CreateStorageTransactionDTO,
+) (*models.StorageTransaction, error) {
+	return dao.applyTransaction(ctx, data, func(ctx context.Context, tx pgx.Tx) error {
+		var id uint
+
+		err := tx.QueryRow(ctx, "claim_expired_reservation", reservationID).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return in.ErrReservationNotExpired
+		}
+
+		return err
+	})
+}
+
+// Restocks returned order items: increments storage items counts
+// and creates return transaction in one db transaction.
+func (dao *PostgresStorageItemsDAO) Return(
+	ctx context.Context,
+	data *in.CreateStorageTransactionDTO,
+) (*models.StorageTransaction, error) {
+	return dao.applyTransaction(ctx, data, nil)
+}
+
+// Puts items back to their warehouses, claim, if any, runs first in the same db transaction.
+func (dao *PostgresStorageItemsDAO) applyTransaction(
+	ctx context.Context,
+	data *in.CreateStorageTransactionDTO,
+	claim func(ctx context.Context, tx pgx.Tx) error,
+) (*models.StorageTransaction, error) {
+	productIDs := make([]uint, 0, 10)
+	seen := make(map[uint]struct{})
+
+	for _, v := range data.Items {
+		if _, exists := seen[v.ProductID]; !exists {
+			seen[v.ProductID] = struct{}{}
+			productIDs = append(productIDs, v.ProductID)
+		}
+	}
+
+	tx, err := dao.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if claim != nil {
+		if err := claim(ctx, tx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := saveProcessedMsg(ctx, tx, data); err != nil {
+		return nil, err
+	}
+
+	locked, err := lockStorageItems(ctx, tx, productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	stock := stockByKey(locked)
+
+	for _, v := range data.Items {
+		if _, exists := stock[stockKey{v.WarehouseID, v.ProductID}]; !exists {
+			return nil, in.ErrProductNotFoundByID
+		}
+	}
+
+	return writeTransaction(ctx, tx, data, data.Items, 1)
+}
+
+// Msg which caused the transaction is saved to inbox in the same db transaction,
+// ErrMsgAlreadyProcessed is returned for the msg id or order step seen before.
+// Returns are repeatable steps, unique by msg id only.
+func saveProcessedMsg(ctx context.Context, tx pgx.Tx, data *in.CreateStorageTransactionDTO) error {
+	var msgID uint
+
+	err := tx.QueryRow(
+		ctx,
+		"create_processed_msg",
+		data.MessageID,
+		data.OrderID,
+		data.Type,
+		data.Type == models.Return,
+	).Scan(&msgID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return in.ErrMsgAlreadyProcessed
+	}
+
+	return err
+}
+
+// Changes counts of locked storage items by sign*count of transaction items,
+// records the transaction and commits db transaction.
+func writeTransaction(
+	ctx context.Context,
+	tx pgx.Tx,
+	data *in.CreateStorageTransactionDTO,
+	items []*in.CreateStorageTransactionItemDTO,
+	sign int,
+) (*models.StorageTransaction, error) {
 	for _, v := range items {
-		if _, err := tx.Exec(ctx, "update_storage_item_count", v.Count, v.ProductID); err != nil {
-			return err
+		if _, err := tx.Exec(ctx, "add_storage_item_count", sign*int(v.Count), v.WarehouseID, v.ProductID); err != nil {
+			return nil, err
 		}
 	}
 
+	var trans models.StorageTransaction
+
+	err := tx.QueryRow(
+		ctx,
+		"insert_storage_transaction",
+		data.OrderID,
+		data.Type,
+		data.UserID,
+		data.ExpiresAt,
+	).Scan(
+		&trans.ID,
+		&trans.OrderID,
+		&trans.UserID,
+		&trans.Type,
+		&trans.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Released reservation must not be released again by expiry.
+	if data.Type == models.Cancelation {
+		if _, err := tx.Exec(ctx, "clear_reservation_expiry", data.OrderID, models.Reservation); err != nil {
+			return nil, err
+		}
+	}
+
+	transItems := make([]*models.StorageTransactionItem, 0, len(items))
+
+	for _, v := range items {
+		var item models.StorageTransactionItem
+
+		err = tx.QueryRow(
+			ctx,
+			"insert_storage_transaction_item",
+			v.WarehouseID,
+			v.ProductID,
+			trans.ID,
+			trans.OrderID,
+			v.Count,
+		).Scan(
+			&item.ID,
+			&item.WarehouseID,
+			&item.ProductID,
+			&item.TransactionID,
+			&item.Count,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		transItems = append(transItems, &item)
+	}
+
 	if err := tx.Commit(ctx); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	trans.Items = transItems
+
+	return &trans, nil
+}
+
+// Applies restock or adjustment: changes storage items counts by deltas
+// and records the movement as storage transaction in one db transaction.
+// Restock creates storage items for new products of the warehouse, adjustment is applied
+// to existing ones only and fails as a whole with ErrOutOfStock if any count would become negative.
+func (dao *PostgresStorageItemsDAO) ApplyMovement(
+	ctx context.Context,
+	data *in.CreateStockMovementDTO,
+) (*models.StorageTransaction, error) {
+	deltas := make(map[stockKey]int)
+	keys := make([]stockKey, 0, 10)
+	productIDs := make([]uint, 0, 10)
+	warehouseIDs := make([]uint, 0, 10)
+
+	for _, v := range data.Items {
+		key := stockKey{v.WarehouseID, v.ProductID}
+		if _, exists := deltas[key]; !exists {
+			keys = append(keys, key)
+			productIDs = append(productIDs, v.ProductID)
+			warehouseIDs = append(warehouseIDs, v.WarehouseID)
+		}
+
+		deltas[key] += v.Delta
+	}
+
+	tx, err := dao.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	var foundWarehouses int
+
+	err = tx.QueryRow(ctx, "count_warehouses_by_ids", pq.Array(warehouseIDs)).Scan(&foundWarehouses)
+	if err != nil {
+		return nil, err
+	}
+
+	if foundWarehouses != len(uniqueIDs(warehouseIDs)) {
+		return nil, in.ErrWarehouseNotFound
+	}
+
+	if data.Type == models.Restock {
+		for _, key := range keys {
+			if _, err := tx.Exec(ctx, "ensure_storage_item", key.warehouseID, key.productID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	locked, err := lockStorageItems(ctx, tx, productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	stock := stockByKey(locked)
+
+	for _, key := range keys {
+		available, exists := stock[key]
+		if !exists {
+			return nil, in.ErrProductNotFoundByID
+		}
+
+		if available+deltas[key] < 0 {
+			return nil, in.ErrOutOfStock
+		}
+
+		if _, err := tx.Exec(ctx, "add_storage_item_count", deltas[key], key.warehouseID, key.productID); err != nil {
+			return nil, err
+		}
+	}
+
+	var trans models.StorageTransaction
+
+	err = tx.QueryRow(ctx, "insert_stock_movement", data.Type, data.Reason).Scan(
+		&trans.ID,
+		&trans.OrderID,
+		&trans.Type,
+		&trans.Reason,
+		&trans.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*models.StorageTransactionItem, 0, len(keys))
+
+	for _, key := range keys {
+		if deltas[key] == 0 {
+			continue
+		}
+
+		var item models.StorageTransactionItem
+
+		err = tx.QueryRow(
+			ctx,
+			"insert_stock_movement_item",
+			key.warehouseID,
+			key.productID,
+			trans.ID,
+			deltas[key],
+		).Scan(
+			&item.ID,
+			&item.WarehouseID,
+			&item.ProductID,
+			&item.TransactionID,
+			&item.Count,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, &item)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	trans.Items = items
+
+	return &trans, nil
+}
+
+// Storage item is the stock of product in warehouse.
+type stockKey struct {
+	warehouseID uint
+	productID   uint
+}
+
+type lockedStorageItem struct {
+	stockKey
+	count    int
+	priority int
+	active   bool
+}
+
+// Locks storage items rows of products in every warehouse until the end of transaction.
+// Rows are locked in (warehouse, product) order to avoid deadlocks between concurrent reservations.
+func lockStorageItems(ctx context.Context, tx pgx.Tx, productIDs []uint) ([]*lockedStorageItem, error) {
+	rows, err := tx.Query(ctx, "lock_storage_items", pq.Array(productIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*lockedStorageItem, 0, len(productIDs))
+
+	for rows.Next() {
+		var item lockedStorageItem
+
+		err := rows.Scan(
+			&item.warehouseID,
+			&item.productID,
+			&item.count,
+			&item.priority,
+			&item.active,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, &item)
+	}
+
+	return items, rows.Err()
+}
+
+func stockByKey(items []*lockedStorageItem) map[stockKey]int {
+	stock := make(map[stockKey]int, len(items))
+	for _, v := range items {
+		stock[v.stockKey] = v.count
+	}
+
+	return stock
+}
+
+func uniqueIDs(ids []uint) map[uint]struct{} {
+	unique := make(map[uint]struct{}, len(ids))
+	for _, v := range ids {
+		unique[v] = struct{}{}
+	}
+
+	return unique
 }
 
 func (dao *PostgresStorageItemsDAO) HealthCheck(ctx context.Context) error {
@@ -102,31 +628,66 @@ func (dao *PostgresStorageItemsDAO) HealthCheck(ctx context.Context) error {
 }
 
 func (dao *PostgresStorageItemsDAO) Close() {
-	dao.db.Close()
+	pg.Release(dao.db)
 }
 
 func NewPostgresStorageItemsDAO(ctx context.Context, config *conf.Config) *PostgresStorageItemsDAO {
-	dbConn := GetPostgresConnection(ctx, config.WalletDatabaseURI())
-
-	if !migrationsApplied {
-		err := Migrate(ctx, dbConn)
-		if err != nil {
-			panic(err)
-		}
-	}
-
-	defer func() { migrationsApplied = true }()
+	dbConn := pg.MustOpen(ctx, config.StorageDatabaseURI(), migrationsDir)
 
 	queriesMap := map[string]string{
-		"storage_items_list_by_prod_ids": `SELECT id, product_id, count 
-			FROM storage_items WHERE product_id=ANY($1::bigint[]);`,
-		"storage_items_list_by_order_id": `SELECT id, product_id, count 
+		"storage_items_list": `SELECT id, warehouse_id, product_id, count
+			FROM storage_items
+			WHERE $1::bigint=0 OR warehouse_id=$1::bigint
+			ORDER BY product_id, warehouse_id
+			LIMIT $2::bigint OFFSET $3::bigint;`,
+		"storage_items_list_by_prod_ids": `SELECT id, warehouse_id, product_id, count 
+			FROM storage_items WHERE product_id=ANY($1::bigint[])
+			ORDER BY product_id, warehouse_id;`,
+		"storage_items_list_by_order_id": `SELECT id, warehouse_id, product_id, count 
 			FROM storage_items WHERE product_id=ANY($1::bigint[]);`,
-		"update_storage_item_count": `UPDATE storage_items 
-			SET count=$1::int WHERE product_id=$2::int;`,
+		"lock_storage_items": `SELECT s.warehouse_id, s.product_id, s.count, w.priority, w.active
+			FROM storage_items s
+			JOIN warehouses w ON w.id=s.warehouse_id
+			WHERE s.product_id=ANY($1::bigint[])
+			ORDER BY s.warehouse_id, s.product_id
+			FOR UPDATE OF s;`,
+		"add_storage_item_count": `UPDATE storage_items
+			SET count=count + $1::int WHERE warehouse_id=$2::bigint AND product_id=$3::bigint;`,
+		"ensure_storage_item": `INSERT INTO storage_items(warehouse_id, product_id, count)
+			VALUES ($1::bigint, $2::bigint, 0)
+			ON CONFLICT (warehouse_id, product_id) DO NOTHING;`,
+		"count_warehouses_by_ids": `SELECT COUNT(*) FROM warehouses WHERE id=ANY($1::bigint[]);`,
+		"insert_stock_movement": `INSERT INTO storage_transactions(type, reason)
+			VALUES($1::smallint, $2::varchar)
+			RETURNING id, COALESCE(order_id, 0), type, reason, created_at;`,
+		"insert_stock_movement_item": `INSERT INTO
+			storage_transaction_items(warehouse_id, product_id, transaction_id, count)
+			VALUES($1::bigint, $2::int, $3::bigint, $4::int)
+			RETURNING id, warehouse_id, product_id, transaction_id, count;`,
+		"create_processed_msg": `INSERT INTO storage_processed_messages(message_id, order_id, step, repeatable)
+			VALUES (NULLIF($1::varchar, ''), $2::bigint, $3::smallint, $4::boolean)
+			ON CONFLICT DO NOTHING
+			RETURNING id;`,
+		"insert_storage_transaction": `INSERT INTO storage_transactions(order_id, type, user_id, expires_at)
+			VALUES($1::bigint, $2::smallint, NULLIF($3::bigint, 0), $4::timestamptz)
+			RETURNING id, order_id, COALESCE(user_id, 0), type, expires_at;`,
+		"clear_reservation_expiry": `UPDATE storage_transactions SET expires_at=NULL
+			WHERE order_id=$1::bigint AND type=$2::smallint AND expires_at IS NOT NULL;`,
+		"claim_expired_reservation": `UPDATE storage_transactions SET expires_at=NULL, expired_at=NOW()
+			WHERE id=$1::bigint AND expires_at < NOW()
+			RETURNING id;`,
+		"insert_storage_transaction_item": `INSERT INTO
+			storage_transaction_items(warehouse_id, product_id, transaction_id, order_id, count)
+			VALUES($1::bigint, $2::int, $3::bigint, $4::bigint, $5::int)
+			RETURNING id, warehouse_id, product_id, transaction_id, count;`,
+		"lock_rejected_order": `SELECT pg_advisory_xact_lock('storage_rejected_orders'::regclass::oid::int, $1::int);`,
+		"create_rejected_order": `INSERT INTO storage_rejected_orders(order_id)
+			VALUES ($1::bigint)
+			ON CONFLICT DO NOTHING;`,
+		"order_rejected": `SELECT EXISTS(SELECT 1 FROM storage_rejected_orders WHERE order_id=$1::bigint);`,
 	}
 
-	submitPreparedStatements(ctx, queriesMap, dbConn)
+	pg.MustPrepare(ctx, dbConn, queriesMap)
 
 	return &PostgresStorageItemsDAO{
 		db:                dbConn,
@@ -144,7 +705,7 @@ type PostgresTransactionsDAO struct {
 func (dao *PostgresTransactionsDAO) GetByOrderID(ctx context.Context, orderID uint) (*models.StorageTransaction, error) {
 	var trans models.StorageTransaction
 
-	err := dao.db.QueryRow(ctx, "transaction_by_id", orderID).Scan(
+	err := dao.db.QueryRow(ctx, "transaction_by_order_id", orderID).Scan(
 		&trans.ID,
 		&trans.OrderID,
 		&trans.Type,
@@ -153,6 +714,10 @@ func (dao *PostgresTransactionsDAO) GetByOrderID(ctx context.Context, orderID ui
 		return nil, in.ErrTransNotFound
 	}
 
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := dao.db.Query(ctx, "transaction_items_by_trans_id", trans.ID)
 	if err != nil {
 		return nil, err
@@ -165,6 +730,7 @@ func (dao *PostgresTransactionsDAO) GetByOrderID(ctx context.Context, orderID ui
 
 		err = rows.Scan(
 			&item.ID,
+			&item.WarehouseID,
 			&item.ProductID,
 			&item.TransactionID,
 			&item.Count,
@@ -181,11 +747,17 @@ func (dao *PostgresTransactionsDAO) GetByOrderID(ctx context.Context, orderID ui
 	return &trans, rows.Err()
 }
 
-func (dao *PostgresTransactionsDAO) GetItemsByOrderID(ctx context.Context, orderID uint) ([]*models.StorageTransactionItem, error) {
-	rows, err := dao.db.Query(ctx, "transaction_by_order_id", orderID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, in.ErrTransNotFound
+// Items of the order transactions of the type, e.g. reserved or returned ones.
+func (dao *PostgresTransactionsDAO) GetItemsByOrderID(
+	ctx context.Context,
+	orderID uint,
+	transType models.TransactionType,
+) ([]*models.StorageTransactionItem, error) {
+	rows, err := dao.db.Query(ctx, "items_by_order_id", orderID, transType)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
 	items := make([]*models.StorageTransactionItem, 0, 10)
 
@@ -194,6 +766,7 @@ func (dao *PostgresTransactionsDAO) GetItemsByOrderID(ctx context.Context, order
 
 		err = rows.Scan(
 			&item.ID,
+			&item.WarehouseID,
 			&item.ProductID,
 			&item.TransactionID,
 			&item.Count,
@@ -208,6 +781,88 @@ func (dao *PostgresTransactionsDAO) GetItemsByOrderID(ctx context.Context, order
 	return items, rows.Err()
 }
 
+// Reservations which expired before now, oldest first.
+func (dao *PostgresTransactionsDAO) GetListExpired(
+	ctx context.Context,
+	now time.Time,
+	limit uint16,
+) ([]*models.StorageTransaction, error) {
+	rows, err := dao.db.Query(ctx, "expired_reservations_list", models.Reservation, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := make([]*models.StorageTransaction, 0, limit)
+
+	for rows.Next() {
+		var trans models.StorageTransaction
+
+		err = rows.Scan(
+			&trans.ID,
+			&trans.OrderID,
+			&trans.UserID,
+			&trans.Type,
+			&trans.CreatedAt,
+			&trans.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		transactions = append(transactions, &trans)
+	}
+
+	return transactions, rows.Err()
+}
+
+// Reservations released by timeout, which rejected msg is not sent for yet, oldest first.
+func (dao *PostgresTransactionsDAO) GetListExpiryNotAnnounced(
+	ctx context.Context,
+	limit uint16,
+) ([]*models.StorageTransaction, error) {
+	rows, err := dao.db.Query(ctx, "expiry_not_announced_list", models.Reservation, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := make([]*models.StorageTransaction, 0, limit)
+
+	for rows.Next() {
+		var trans models.StorageTransaction
+
+		err = rows.Scan(
+			&trans.ID,
+			&trans.OrderID,
+			&trans.UserID,
+			&trans.Type,
+			&trans.CreatedAt,
+			&trans.ExpiredAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		transactions = append(transactions, &trans)
+	}
+
+	return transactions, rows.Err()
+}
+
+func (dao *PostgresTransactionsDAO) MarkExpiryAnnounced(ctx context.Context, reservationID uint) error {
+	_, err := dao.db.Exec(ctx, "mark_expiry_announced", reservationID)
+
+	return err
+}
+
+// Reservation of completed or released order is kept forever.
+func (dao *PostgresTransactionsDAO) ClearReservationExpiry(ctx context.Context, orderID uint) error {
+	_, err := dao.db.Exec(ctx, "clear_reservation_expiry", orderID, models.Reservation)
+
+	return err
+}
+
 func (dao *PostgresTransactionsDAO) Create(
 	ctx context.Context,
 	data *in.CreateStorageTransactionDTO,
@@ -241,12 +896,14 @@ func (dao *PostgresTransactionsDAO) Create(
 		err = tx.QueryRow(
 			ctx,
 			"create_transaction_item",
+			v.WarehouseID,
 			v.ProductID,
 			trans.ID,
 			trans.OrderID,
 			v.Count,
 		).Scan(
 			&item.ID,
+			&item.WarehouseID,
 			&item.ProductID,
 			&item.TransactionID,
 			&item.Count,
@@ -277,41 +934,181 @@ func (dao *PostgresTransactionsDAO) HealthCheck(ctx context.Context) error {
 }
 
 func (dao *PostgresTransactionsDAO) Close() {
-	dao.db.Close()
+	pg.Release(dao.db)
 }
 
 func NewPostgresStorageTransDAO(ctx context.Context, config *conf.Config) *PostgresTransactionsDAO {
-	dbConn := GetPostgresConnection(ctx, config.WalletDatabaseURI())
-
-	if !migrationsApplied {
-		err := Migrate(ctx, dbConn)
-		if err != nil {
-			panic(err)
-		}
-	}
-
-	defer func() { migrationsApplied = true }()
+	dbConn := pg.MustOpen(ctx, config.StorageDatabaseURI(), migrationsDir)
 
 	queriesMap := map[string]string{
 		"transaction_by_id": `SELECT id, order_id, type 
 			FROM storage_transactions 
 			WHERE id=$1::bigint;`,
-		"transaction_items_by_trans_id": `SELECT id, product_id, transaction_id, count 
+		"transaction_items_by_trans_id": `SELECT id, warehouse_id, product_id, transaction_id, count 
 			FROM storage_transaction_items 
 			WHERE transaction_id=$1::bigint;`,
 		"transaction_by_order_id": `SELECT id, order_id, type 
-			FROM storage_transactions WHERE order_id=$1::bigint;`,
+			FROM storage_transactions WHERE order_id=$1::bigint
+			ORDER BY id
+			LIMIT 1;`,
+		"items_by_order_id": `SELECT i.id, i.warehouse_id, i.product_id, i.transaction_id, i.count
+			FROM storage_transaction_items i
+			JOIN storage_transactions t ON t.id=i.transaction_id
+			WHERE i.order_id=$1::bigint AND t.type=$2::smallint
+			ORDER BY i.id;`,
+		"expired_reservations_list": `SELECT id, order_id, COALESCE(user_id, 0), type, created_at, expires_at
+			FROM storage_transactions
+			WHERE type=$1::smallint AND expires_at < $2::timestamptz
+			ORDER BY expires_at
+			LIMIT $3::bigint;`,
+		"expiry_not_announced_list": `SELECT id, order_id, COALESCE(user_id, 0), type, created_at, expired_at
+			FROM storage_transactions
+			WHERE type=$1::smallint AND expired_at IS NOT NULL AND expiry_announced_at IS NULL
+			ORDER BY expired_at
+			LIMIT $2::bigint;`,
+		"mark_expiry_announced": `UPDATE storage_transactions SET expiry_announced_at=NOW()
+			WHERE id=$1::bigint;`,
+		"clear_reservation_expiry": `UPDATE storage_transactions SET expires_at=NULL
+			WHERE order_id=$1::bigint AND type=$2::smallint AND expires_at IS NOT NULL;`,
 		"create_transaction": `INSERT INTO storage_transactions(order_id, type) VALUES($1::bigint, $2::smallint) RETURNING id, order_id, type;`,
 		"create_transaction_item": `INSERT INTO 
-			storage_transaction_items(product_id, transaction_id, order_id, count) 
-			VALUES($1::int, $2::bigint, $3::bigint, $4::int)
-			RETURNING id, product_id, transaction_id, count;`,
+			storage_transaction_items(warehouse_id, product_id, transaction_id, order_id, count) 
+			VALUES($1::bigint, $2::int, $3::bigint, $4::bigint, $5::int)
+			RETURNING id, warehouse_id, product_id, transaction_id, count;`,
 	}
 
-	submitPreparedStatements(ctx, queriesMap, dbConn)
+	pg.MustPrepare(ctx, dbConn, queriesMap)
 
 	return &PostgresTransactionsDAO{
 		db:                dbConn,
 		transactionsTable: config.StorageDatabase.TransactionsTable,
 	}
 }
+
+// ------------------------------WarehousesDAO------------------------------
+
+type PostgresWarehousesDAO struct {
+	db *pgxpool.Pool
+}
+
+// Warehouses in allocation order, nearest first.
+func (dao *PostgresWarehousesDAO) GetList(ctx context.Context) ([]*models.Warehouse, error) {
+	rows, err := dao.db.Query(ctx, "warehouses_list")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	warehouses := make([]*models.Warehouse, 0, 10)
+
+	for rows.Next() {
+		var warehouse models.Warehouse
+
+		err = rows.Scan(
+			&warehouse.ID,
+			&warehouse.Title,
+			&warehouse.Priority,
+			&warehouse.Active,
+			&warehouse.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		warehouses = append(warehouses, &warehouse)
+	}
+
+	return warehouses, rows.Err()
+}
+
+func (dao *PostgresWarehousesDAO) Create(
+	ctx context.Context,
+	data *in.CreateWarehouseDTO,
+) (*models.Warehouse, error) {
+	var warehouse models.Warehouse
+
+	err := dao.db.QueryRow(ctx, "create_warehouse", data.Title, data.Priority).Scan(
+		&warehouse.ID,
+		&warehouse.Title,
+		&warehouse.Priority,
+		&warehouse.Active,
+		&warehouse.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &warehouse, nil
+}
+
+func (dao *PostgresWarehousesDAO) Update(
+	ctx context.Context,
+	data *in.UpdateWarehouseDTO,
+) (*models.Warehouse, error) {
+	var warehouse models.Warehouse
+
+	err := dao.db.QueryRow(ctx, "update_warehouse", data.ID, data.Priority, data.Active).Scan(
+		&warehouse.ID,
+		&warehouse.Title,
+		&warehouse.Priority,
+		&warehouse.Active,
+		&warehouse.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, in.ErrWarehouseNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &warehouse, nil
+}
+
+func (dao *PostgresWarehousesDAO) HealthCheck(ctx context.Context) error {
+	if err := dao.db.Ping(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (dao *PostgresWarehousesDAO) Close() {
+	pg.Release(dao.db)
+}
+
+func NewPostgresWarehousesDAO(ctx context.Context, config *conf.Config) *PostgresWarehousesDAO {
+	dbConn := pg.MustOpen(ctx, config.StorageDatabaseURI(), migrationsDir)
+
+	queriesMap := map[string]string{
+		"warehouses_list": `SELECT id, title, priority, active, created_at
+			FROM warehouses
+			ORDER BY priority, id;`,
+		"create_warehouse": `INSERT INTO warehouses(title, priority)
+			VALUES ($1::varchar, $2::int)
+			RETURNING id, title, priority, active, created_at;`,
+		"update_warehouse": `UPDATE warehouses
+			SET priority=COALESCE($2::int, priority), active=COALESCE($3::boolean, active)
+			WHERE id=$1::bigint
+			RETURNING id, title, priority, active, created_at;`,
+	}
+
+	pg.MustPrepare(ctx, dbConn, queriesMap)
+
+	return &PostgresWarehousesDAO{
+		db: dbConn,
+	}
+}
+
+// ------------------------------DeadLettersDAO------------------------------
+
+func NewPostgresDeadLettersDAO(ctx context.Context, config *conf.Config) *deadletter.PostgresStore {
+	dbConn := pg.MustOpen(ctx, config.StorageDatabaseURI(), migrationsDir)
+
+	store, err := deadletter.NewPostgresStore(ctx, dbConn)
+	if err != nil {
+		panic(err)
+	}
+
+	return store
+}
@@ -0,0 +1,57 @@
+// Package bootstrap runs Storage inside another process, e.g. in end-to-end tests.
+// Service keeps its data in memory and exchanges msgs with other services over the given bus.
+package bootstrap
+
+import (
+	"common/backend"
+	"common/membus"
+	"context"
+	"net/http"
+	"storage_service/internal/app/api"
+	"storage_service/internal/app/storage"
+	"storage_service/internal/pkg/broker"
+	"storage_service/internal/pkg/conf"
+	"sync"
+)
+
+type Service struct {
+	server *api.Server
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Reads service config, values may be changed before Start.
+func LoadConfig(path string) (*conf.Config, error) {
+	return conf.Load(path)
+}
+
+// Builds app with in-memory backends regardless of config and starts its background loops.
+func Start(ctx context.Context, config *conf.Config, bus membus.Bus) *Service {
+	config.Storage.Backend = backend.Memory
+	config.Broker.Backend = backend.Memory
+
+	app := storage.NewStorageAppWithBroker(ctx, config, broker.NewInMemoryBusClient(bus, config))
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	s := &Service{
+		server: api.NewServer(app),
+		cancel: cancel,
+	}
+
+	s.server.RunWorkers(ctx, &s.wg)
+
+	return s
+}
+
+// Service API, it is not bound to the port from config.
+func (s *Service) Handler() http.Handler {
+	return s.server.Serv.Handler
+}
+
+// Stops background loops and closes app.
+func (s *Service) Close() {
+	s.cancel()
+	s.wg.Wait()
+	s.server.App.Close()
+}
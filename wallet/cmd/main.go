@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	_ "wallet_service/docs"
 	"wallet_service/internal/app/api"
 
 	wal "wallet_service/internal/app/wallet"
@@ -3,6 +3,7 @@ module wallet_service
 go 1.17
 
 require (
+	common v0.0.0
 	github.com/creasty/defaults v1.5.2
 	github.com/gorilla/mux v1.8.0
 	github.com/jackc/pgx v3.6.2+incompatible
@@ -44,3 +45,5 @@ require (
 	golang.org/x/text v0.3.7 // indirect
 	golang.org/x/tools v0.1.7 // indirect
 )
+
+replace common => ../common
@@ -1,10 +1,26 @@
 package api
 
 import (
-	"context"
+	"common/deadletter"
+	"common/web"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
+	in "wallet_service/internal/app/interfaces"
+	"wallet_service/internal/app/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultTransactionsLimit = 20
+	maxTransactionsLimit     = 100
+
+	defaultDeadLettersLimit = 20
+	maxDeadLettersLimit     = 100
 )
 
 // @title Wallet service
@@ -19,48 +35,296 @@ import (
 // @license.name Apache 2.0
 // @license.url http://www.apache.org/licenses/LICENSE-2.0.html
 
-// @Summary Healthcheck
-// @Description Check DB and broker client connections
+// @Summary Get wallet
+// @Description Get user wallet with current balance
 // @Produce json
-// @Tags	ops
-// @Success 200 {object} HealthCheckResposne
+// @Tags	wallets
+// @Success 200 {object} WalletResponse
 // @Failure 400 {object} ErrResponseMsg
+// @Failure 404 {object} ErrResponseMsg
 // @Failure 500 {string} error
-// @Router /health [GET]
-func (s *Server) HealthCheck() http.Handler {
+// @Param user_id path int true "user id"
+// @Router /wallets/{user_id} [GET]
+func (s *Server) GetWallet() http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+		if err != nil || userID <= 0 {
+			msg := ErrResponseMsg{Message: "user id is not correct"}
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
+		}
+
+		wallet, err := s.App.PaymentService.GetWallet(r.Context(), uint(userID))
+
+		switch {
+		case errors.Is(err, in.ErrWalletNotFound):
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusNotFound)
+
+			return
+		case err != nil:
+			web.JSONResponse(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		web.JSONResponse(w, newWalletResponse(wallet), http.StatusOK)
+	}
+
+	return http.HandlerFunc(handler)
+}
+
+// @Summary Top up wallet
+// @Description Top up user wallet. Request is idempotent by Idempotency-Key header:
+// @Description repeated request returns the first top-up, key reused with another amount gives 409
+// @Accept json
+// @Produce json
+// @Tags	wallets
+// @Success 200 {object} TopUpResponse
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 404 {object} ErrResponseMsg
+// @Failure 409 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Param user_id path int true "user id"
+// @Param Idempotency-Key header string true "client key of the top-up"
+// @Param top_up body TopUpRequest true "top-up data"
+// @Router /wallets/{user_id}/top-up [POST]
+func (s *Server) TopUp() http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+		if err != nil || userID <= 0 {
+			msg := ErrResponseMsg{Message: "user id is not correct"}
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
+		}
+
+		idempotencyKey := r.Header.Get("Idempotency-Key")
+		if idempotencyKey == "" || len(idempotencyKey) > 255 {
+			msg := ErrResponseMsg{Message: "Idempotency-Key header is not correct"}
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
+		}
+
+		var topUpData TopUpRequest
+		if err := json.NewDecoder(r.Body).Decode(&topUpData); err != nil {
+			msg := ErrResponseMsg{Message: err.Error()}
+			if err == io.EOF {
+				msg.Message = "Empty body"
+			}
+
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
+		}
+
+		trans, err := s.App.PaymentService.TopUp(r.Context(), uint(userID), topUpData.Amount, idempotencyKey)
+
+		switch {
+		case errors.Is(err, in.ErrInvalidAmount):
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
+		case errors.Is(err, in.ErrWalletNotFound):
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusNotFound)
+
+			return
+		case errors.Is(err, in.ErrIdempotencyKeyReused):
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusConflict)
+
+			return
+		case err != nil:
+			web.JSONResponse(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		response := TopUpResponse{
+			Transaction: newTransactionResponse(trans),
+			Wallet:      newWalletResponse(trans.Wallet),
+		}
+
+		web.JSONResponse(w, response, http.StatusOK)
+	}
+
+	return http.HandlerFunc(handler)
+}
+
+// @Summary List wallet transactions
+// @Description Page of user wallet transactions, newest first
+// @Produce json
+// @Tags	wallets
+// @Success 200 {array} TransactionResponse
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 404 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Param user_id path int true "user id"
+// @Param type query int false "transaction type: 0 - purchase, 1 - cancelation, 2 - top-up, 3 - hold, 4 - capture, 5 - release, 6 - refund"
+// @Param from query string false "created at or after, RFC3339"
+// @Param to query string false "created before, RFC3339"
+// @Param limit query int false "page size, 20 by default, 100 max"
+// @Param offset query int false "page offset"
+// @Router /wallets/{user_id}/transactions [GET]
+func (s *Server) TransactionsList() http.Handler {
 	handler := func(w http.ResponseWriter, r *http.Request) {
-		timeout := 15
+		userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+		if err != nil || userID <= 0 {
+			msg := ErrResponseMsg{Message: "user id is not correct"}
+			web.JSONResponse(w, msg, http.StatusBadRequest)
 
-		timeoutStr := r.FormValue("timeout")
+			return
+		}
+
+		filter, err := parseTransactionsFilter(r)
+		if err != nil {
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusBadRequest)
+
+			return
+		}
+
+		transactions, err := s.App.PaymentService.GetTransactionsList(r.Context(), uint(userID), filter)
+
+		switch {
+		case errors.Is(err, in.ErrWalletNotFound):
+			msg := ErrResponseMsg{Message: err.Error()}
+			web.JSONResponse(w, msg, http.StatusNotFound)
+
+			return
+		case err != nil:
+			web.JSONResponse(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		transactionsResponse := make([]TransactionResponse, 0, len(transactions))
+		for _, v := range transactions {
+			transactionsResponse = append(transactionsResponse, newTransactionResponse(v))
+		}
+
+		web.JSONResponse(w, transactionsResponse, http.StatusOK)
+	}
+
+	return http.HandlerFunc(handler)
+}
 
-		t, err := strconv.Atoi(timeoutStr)
-		if timeoutStr != "" && err == nil {
-			timeout = t
+func parseTransactionsFilter(r *http.Request) (*in.TransactionsFilterDTO, error) {
+	filter := &in.TransactionsFilterDTO{Limit: defaultTransactionsLimit}
+
+	if typeStr := r.FormValue("type"); typeStr != "" {
+		t, err := strconv.ParseUint(typeStr, 10, 8)
+		if err != nil || models.TransactionType(t) > models.Refund {
+			return nil, errors.New("type query param is not correct")
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), time.Duration(timeout)*time.Second)
-		defer cancel()
+		transType := models.TransactionType(t)
+		filter.Type = &transType
+	}
 
-		errToStr := func(err error) string {
+	for param, dst := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := r.FormValue(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
 			if err != nil {
-				return err.Error()
+				return nil, errors.New(param + " query param is not correct, RFC3339 expected")
 			}
 
-			return "ok"
+			*dst = &t
+		}
+	}
+
+	if limitStr := r.FormValue("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxTransactionsLimit {
+			return nil, errors.New("limit query param is not correct")
 		}
 
-		walletsDAOHealth := errToStr(s.App.WalletsDAO.HealthCheck(ctx))
-		walletTransDAOHealth := errToStr(s.App.WalletTransactionsDAO.HealthCheck(ctx))
-		brokerClientHealth := errToStr(s.App.BrokerClient.HealthCheck(ctx))
+		filter.Limit = uint(limit)
+	}
+
+	if offsetStr := r.FormValue("offset"); offsetStr != "" {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return nil, errors.New("offset query param is not correct")
+		}
+
+		filter.Offset = uint(offset)
+	}
+
+	return filter, nil
+}
+
+// @Summary Ledger reconciliation
+// @Description Report wallets which stored balance disagrees with their ledger entries
+// @Description and transactions which ledger entries are not balanced
+// @Produce json
+// @Tags	ops
+// @Success 200 {object} ReconciliationResponse
+// @Failure 500 {string} error
+// @Router /ledger/reconciliation [GET]
+func (s *Server) Reconciliation() http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		report, err := s.App.PaymentService.Reconcile(r.Context())
+		if err != nil {
+			web.JSONResponse(w, err.Error(), http.StatusInternalServerError)
 
-		response := HealthCheckResposne{
-			WalletsConn:     walletsDAOHealth,
-			WalletTransConn: walletTransDAOHealth,
-			BrokerConn:      brokerClientHealth,
+			return
 		}
 
-		JSONResponse(w, response, http.StatusOK)
+		web.JSONResponse(w, newReconciliationResponse(report), http.StatusOK)
 	}
 
 	return http.HandlerFunc(handler)
 }
+
+// @Summary Healthcheck
+// @Description Check DB and broker client connections
+// @Produce json
+// @Tags	ops
+// @Success 200 {object} HealthCheckResposne
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Router /health [GET]
+func (s *Server) HealthCheck() http.Handler {
+	return web.HealthHandler(
+		web.HealthCheck{Name: "wallets_conn", Check: s.App.WalletsDAO.HealthCheck},
+		web.HealthCheck{Name: "wallet_trans_conn", Check: s.App.WalletTransactionsDAO.HealthCheck},
+		web.HealthCheck{Name: "holds_conn", Check: s.App.WalletHoldsDAO.HealthCheck},
+		web.HealthCheck{Name: "ledger_conn", Check: s.App.LedgerDAO.HealthCheck},
+		web.HealthCheck{Name: "broker_conn", Check: s.App.BrokerClient.HealthCheck},
+	)
+}
+
+// @Summary Dead-lettered msgs
+// @Description Msgs of the service which handling failed after all retries, newest first
+// @Produce json
+// @Tags	ops
+// @Success 200 {array} deadletter.Response
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Param limit query int false "page size, up to 100"
+// @Param offset query int false "page offset"
+// @Router /admin/dead-letters [GET]
+func (s *Server) DeadLettersList() http.Handler {
+	return deadletter.ListHandler(s.App.DeadLetters)
+}
+
+// @Summary Replay dead-lettered msg
+// @Description Hand original payload of dead-lettered msg to the handler of its topic in this service, msg failed again is dead-lettered as a new letter.
+// @Description Letter is replayed once, the next replay responds with 409
+// @Produce json
+// @Tags	ops
+// @Success 200 {object} deadletter.Response
+// @Failure 400 {object} ErrResponseMsg
+// @Failure 404 {object} ErrResponseMsg
+// @Failure 409 {object} ErrResponseMsg
+// @Failure 500 {string} error
+// @Param id path int true "dead letter id"
+// @Router /admin/dead-letters/{id}/replay [POST]
+func (s *Server) ReplayDeadLetter() http.Handler {
+	return deadletter.ReplayHandler(s.App.DeadLetters)
+}
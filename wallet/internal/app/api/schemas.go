@@ -1,5 +1,10 @@
 package api
 
+import (
+	"time"
+	"wallet_service/internal/app/models"
+)
+
 type ErrResponseMsg struct {
 	Message string `json:"message"`
 }
@@ -7,5 +12,85 @@ type ErrResponseMsg struct {
 type HealthCheckResposne struct {
 	WalletsConn     string `json:"wallets_conn"`
 	WalletTransConn string `json:"wallet_trans_conn"`
+	HoldsConn       string `json:"holds_conn"`
+	LedgerConn      string `json:"ledger_conn"`
 	BrokerConn      string `json:"broker_conn"`
 }
+
+type WalletResponse struct {
+	ID        uint         `json:"id"`
+	UserID    uint         `json:"user_id"`
+	Balance   models.Money `json:"balance" swaggertype:"string" example:"100.00"`
+	Held      models.Money `json:"held" swaggertype:"string" example:"20.00"`
+	Available models.Money `json:"available" swaggertype:"string" example:"80.00"`
+}
+
+type TopUpRequest struct {
+	Amount models.Money `json:"amount" swaggertype:"string" example:"10.50"`
+}
+
+type TopUpResponse struct {
+	Transaction TransactionResponse `json:"transaction"`
+	Wallet      WalletResponse      `json:"wallet"`
+}
+
+type TransactionResponse struct {
+	ID        uint                   `json:"id"`
+	OrderID   uint                   `json:"order_id,omitempty"`
+	Cost      models.Money           `json:"cost" swaggertype:"string" example:"12.34"`
+	Type      models.TransactionType `json:"type"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+type ReconciliationResponse struct {
+	OK                     bool                      `json:"ok"`
+	Mismatches             []BalanceMismatchResponse `json:"mismatches"`
+	UnbalancedTransactions []uint                    `json:"unbalanced_transactions"`
+	CheckedAt              time.Time                 `json:"checked_at"`
+}
+
+type BalanceMismatchResponse struct {
+	WalletID      uint         `json:"wallet_id"`
+	UserID        uint         `json:"user_id"`
+	Balance       models.Money `json:"balance" swaggertype:"string" example:"100.00"`
+	LedgerBalance models.Money `json:"ledger_balance" swaggertype:"string" example:"90.00"`
+}
+
+func newWalletResponse(wallet *models.Wallet) WalletResponse {
+	return WalletResponse{
+		ID:        wallet.ID,
+		UserID:    wallet.UserID,
+		Balance:   wallet.Balance,
+		Held:      wallet.Held,
+		Available: wallet.Available(),
+	}
+}
+
+func newTransactionResponse(trans *models.WalletTransaction) TransactionResponse {
+	return TransactionResponse{
+		ID:        trans.ID,
+		OrderID:   trans.OrderID,
+		Cost:      trans.Cost,
+		Type:      trans.Type,
+		CreatedAt: trans.CreatedAt,
+	}
+}
+
+func newReconciliationResponse(report *models.ReconciliationReport) ReconciliationResponse {
+	mismatches := make([]BalanceMismatchResponse, 0, len(report.Mismatches))
+	for _, v := range report.Mismatches {
+		mismatches = append(mismatches, BalanceMismatchResponse{
+			WalletID:      v.WalletID,
+			UserID:        v.UserID,
+			Balance:       v.Balance,
+			LedgerBalance: v.LedgerBalance,
+		})
+	}
+
+	return ReconciliationResponse{
+		OK:                     len(report.Mismatches) == 0 && len(report.UnbalancedTransactions) == 0,
+		Mismatches:             mismatches,
+		UnbalancedTransactions: report.UnbalancedTransactions,
+		CheckedAt:              report.CheckedAt,
+	}
+}
@@ -1,14 +1,12 @@
 package api
 
 import (
+	"common/web"
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"sync"
-	_ "wallet_service/docs"
 	"wallet_service/internal/app/wallet"
-	"wallet_service/internal/pkg/log"
 
 	"github.com/gorilla/mux"
 
@@ -25,40 +23,25 @@ func NewServer(app *wallet.App) *Server {
 		App: app,
 	}
 
-	router := createRouter(s)
-	handler := log.LoggingMiddleware(app.Logger)(router)
-
-	server := &http.Server{
-		Addr:    app.Config.ServerAddr(),
-		Handler: handler,
-	}
-
-	s.Serv = server
+	s.Serv = web.NewServer(app.Config.ServerAddr(), createRouter(s), app.Logger)
 
 	return s
 }
 
 func (s *Server) Run(ctx context.Context) error {
-	ctx, cancel := context.WithCancel(ctx)
-
-	wg := sync.WaitGroup{}
-	wg.Add(3)
-
-	go s.App.PaymentService.ConsumeNewOrderMsgLoop(ctx, &wg)
-	go s.App.PaymentService.ConsumeRejectedOrderMsgLoop(ctx, &wg)
-	go s.App.PaymentService.EventPipeProcessor(ctx, &wg)
-
-	if err := s.Serv.ListenAndServe(); err != nil {
-		cancel()
-		wg.Wait()
-
-		return err
-	}
+	return web.Serve(ctx, s.Serv, s.RunWorkers)
+}
 
-	cancel()
-	wg.Wait()
+// Starts background loops of the service, they stop when ctx is done.
+func (s *Server) RunWorkers(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(6)
 
-	return nil
+	go s.App.PaymentService.ConsumeNewOrderMsgLoop(ctx, wg)
+	go s.App.PaymentService.ConsumeRejectedOrderMsgLoop(ctx, wg)
+	go s.App.PaymentService.ConsumeCompletedOrderMsgLoop(ctx, wg)
+	go s.App.PaymentService.ConsumeReturnedOrderMsgLoop(ctx, wg)
+	go s.App.PaymentService.ExpireHoldsLoop(ctx, wg)
+	go s.App.PaymentService.ReconciliationLoop(ctx, wg)
 }
 
 func (s *Server) Shutdown() {
@@ -70,6 +53,12 @@ func createRouter(s *Server) *mux.Router {
 	r := mux.NewRouter()
 	r.Handle("/health", s.HealthCheck()).Queries("timeout", "{[0-9]*?}").Methods(http.MethodGet)
 	r.Handle("/health", s.HealthCheck()).Methods(http.MethodGet)
+	r.Handle("/wallets/{user_id:[0-9]+}", s.GetWallet()).Methods(http.MethodGet)
+	r.Handle("/wallets/{user_id:[0-9]+}/top-up", s.TopUp()).Methods(http.MethodPost)
+	r.Handle("/wallets/{user_id:[0-9]+}/transactions", s.TransactionsList()).Methods(http.MethodGet)
+	r.Handle("/ledger/reconciliation", s.Reconciliation()).Methods(http.MethodGet)
+	r.Handle("/admin/dead-letters", s.DeadLettersList()).Methods(http.MethodGet)
+	r.Handle("/admin/dead-letters/{id:[0-9]+}/replay", s.ReplayDeadLetter()).Methods(http.MethodPost)
 
 	r.PathPrefix("/swagger/").Handler(httpSwagger.Handler(
 		httpSwagger.URL(fmt.Sprintf("http://%s/swagger/doc.json", s.App.Config.ServerAddr())), // The url pointing to API definition
@@ -80,17 +69,3 @@ func createRouter(s *Server) *mux.Router {
 
 	return r
 }
-
-func JSONResponse(w http.ResponseWriter, msg interface{}, code int) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.Header().Set("X-Content-Type-Options", "nosniff")
-
-	err := json.NewEncoder(w).Encode(msg)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-
-		return
-	}
-
-	w.WriteHeader(code)
-}
@@ -1,15 +1,27 @@
 package interfaces
 
 import (
+	"common/consumer"
 	"context"
 )
 
+type BrokerMsg = consumer.Msg
+
 type BrokerClient interface {
-	GetOrderRejectedMsg(ctx context.Context) (*OrderRejectedMsg, error)
-	GetNewOrderMsg(ctx context.Context) (*NewOrderMsg, error)
+	FetchOrderRejectedMsg(ctx context.Context) (*BrokerMsg, error)
+	FetchNewOrderMsg(ctx context.Context) (*BrokerMsg, error)
+	FetchOrderCompletedMsg(ctx context.Context) (*BrokerMsg, error)
+	FetchOrderReturnedMsg(ctx context.Context) (*BrokerMsg, error)
+	// Msg is committed after it is handled, not committed msg is fetched again after restart.
+	CommitMsg(ctx context.Context, msg *BrokerMsg) error
 
 	SendOrderRejectedMsg(ctx context.Context, msg *OrderRejectedMsg) error
 	SendPurchaseSuccess(ctx context.Context, msg *OrderSuccessMsg) error
+	// Acknowledges compensation of rejected order step to the success topic.
+	SendCompensatedMsg(ctx context.Context, msg *OrderCompensatedMsg) error
+
+	// Dead-letter queue, letters are replayed by handlers of the service, not through the topic.
+	SendDeadLetter(ctx context.Context, key, value []byte) error
 
 	CloseReader() error
 	CloseWriter() error
@@ -2,19 +2,41 @@ package interfaces
 
 import (
 	"context"
+	"time"
 	"wallet_service/internal/app/models"
 )
 
 type WalletsDAO interface {
 	GetByUserID(ctx context.Context, userID uint) (*models.Wallet, error)
-	UpdateBalance(ctx context.Context, wallet *models.Wallet) (*models.Wallet, error)
+	TopUp(ctx context.Context, data *TopUpWalletDTO) (*models.WalletTransaction, error)
 	HealthCheck(ctx context.Context) error
 	Close()
 }
 
 type WalletTransactionsDAO interface {
 	GetByOrderID(ctx context.Context, orderID uint) (*models.WalletTransaction, error)
+	GetList(ctx context.Context, filter *TransactionsFilterDTO) ([]*models.WalletTransaction, error)
 	Create(ctx context.Context, trans *CreateWalletTransactionDTO) (*models.WalletTransaction, error)
+	ApplyTransaction(ctx context.Context, trans *CreateWalletTransactionDTO) (*models.WalletTransaction, error)
+	HealthCheck(ctx context.Context) error
+	Close()
+}
+
+type WalletHoldsDAO interface {
+	GetByOrderID(ctx context.Context, orderID uint) (*models.WalletHold, error)
+	GetListExpired(ctx context.Context, now time.Time, limit uint16) ([]*models.WalletHold, error)
+	Place(ctx context.Context, data *PlaceHoldDTO) (*models.WalletHold, error)
+	Capture(ctx context.Context, data *SettleHoldDTO) (*models.WalletHold, error)
+	Release(ctx context.Context, data *SettleHoldDTO) (*models.WalletHold, error)
+	Expire(ctx context.Context, holdID uint) (*models.WalletHold, error)
+	MarkOrderRejected(ctx context.Context, orderID uint) error
+	HealthCheck(ctx context.Context) error
+	Close()
+}
+
+type LedgerDAO interface {
+	GetBalanceMismatches(ctx context.Context) ([]*models.BalanceMismatch, error)
+	GetUnbalancedTransactions(ctx context.Context) ([]uint, error)
 	HealthCheck(ctx context.Context) error
 	Close()
 }
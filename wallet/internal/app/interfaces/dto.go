@@ -1,14 +1,48 @@
 package interfaces
 
-import "wallet_service/internal/app/models"
+import (
+	"common/events"
+	"time"
+	"wallet_service/internal/app/models"
+)
 
 //--------------Data Access Layer DTOs--------------
 
 type CreateWalletTransactionDTO struct {
+	WalletID  uint
+	OrderID   uint
+	Cost      models.Money
+	Type      models.TransactionType
+	MessageID string
+}
+
+type PlaceHoldDTO struct {
+	WalletID  uint
+	OrderID   uint
+	Amount    models.Money
+	ExpiresAt time.Time
+	MessageID string
+}
+
+type SettleHoldDTO struct {
+	OrderID   uint
+	MessageID string
+}
+
+type TopUpWalletDTO struct {
+	WalletID       uint
+	Amount         models.Money
+	IdempotencyKey string
+}
+
+// Nil Type, From and To are not applied.
+type TransactionsFilterDTO struct {
 	WalletID uint
-	OrderID  uint
-	Cost     float32
-	Type     models.TransactionType
+	Type     *models.TransactionType
+	From     *time.Time
+	To       *time.Time
+	Limit    uint
+	Offset   uint
 }
 
 //--------------Interactors Layer DTOs--------------
@@ -16,57 +50,60 @@ type CreateWalletTransactionDTO struct {
 type OrderItemDTO struct {
 	ProductID    uint
 	Count        uint8
-	ProductPrice float32
+	ProductPrice models.Money
 }
 
 type OrderDTO struct {
+	MessageID  string
 	OrderID    uint
 	UserID     uint
 	OrderItems []*OrderItemDTO
 }
 
 type CancelOrderDTO struct {
-	OrderID uint
-	UserID  uint
+	MessageID string
+	OrderID   uint
+	UserID    uint
 }
 
-type Transaction struct {
-	Cost    float32
-	OrderID uint
-	Wallet  *models.Wallet
-	Type    models.TransactionType
+type CompleteOrderDTO struct {
+	MessageID string
+	OrderID   uint
+	UserID    uint
 }
 
-//--------------Broker Layer DTOs--------------
-type ServiceName uint8
-
-const (
-	Wallet ServiceName = iota
-	Storage
-	Registry
-)
-
-type NewOrderMsg struct {
-	UserID     uint              `json:"user_id"`
-	OrderID    uint              `json:"order_id"`
-	OrderItems []NewOrderMsgItem `json:"order_items"`
+type ReturnOrderDTO struct {
+	MessageID string
+	OrderID   uint
+	UserID    uint
+	Amount    models.Money
 }
 
-type NewOrderMsgItem struct {
-	OrderID      uint    `json:"order_id"`
-	ProductID    uint    `json:"product_id"`
-	Count        uint8   `json:"count"`
-	ProductPrice float32 `json:"product_price"`
+type Transaction struct {
+	MessageID string
+	Cost      models.Money
+	OrderID   uint
+	Wallet    *models.Wallet
+	Type      models.TransactionType
 }
 
-type OrderRejectedMsg struct {
-	OrderID    uint                     `json:"order_id"`
-	UserID     uint                     `json:"user_id"`
-	Service    ServiceName              `json:"service"`
-	ReasonCode models.CancelationReason `json:"reason_code"`
-}
+//--------------Broker Layer DTOs--------------
 
-type OrderSuccessMsg struct {
-	OrderID uint        `json:"order_id"`
-	Service ServiceName `json:"service"`
-}
+// Msgs contracts are shared by all services.
+type (
+	ServiceName          = events.ServiceName
+	NewOrderMsg          = events.NewOrderMsg
+	NewOrderMsgItem      = events.NewOrderMsgItem
+	OrderRejectedMsg     = events.OrderRejectedMsg
+	OrderCompletedMsg    = events.OrderCompletedMsg
+	OrderReturnedMsg     = events.OrderReturnedMsg
+	OrderReturnedMsgItem = events.OrderReturnedMsgItem
+	OrderSuccessMsg      = events.OrderSuccessMsg
+	OrderCompensatedMsg  = events.OrderCompensatedMsg
+)
+
+const (
+	Wallet   = events.Wallet
+	Storage  = events.Storage
+	Registry = events.Registry
+)
@@ -3,9 +3,18 @@ package interfaces
 import "errors"
 
 var (
-	ErrNotEnoughMoney             = errors.New("not enough money")
-	ErrNewTransactionTimeoutError = errors.New("new trans timeout error")
-	ErrInvalidBrokerConnParams    = errors.New("invalid broker client params")
-	ErrBrokerConnClosed           = errors.New("broker connection closed")
-	ErrTransNotFound              = errors.New("transaction not found")
+	ErrNotEnoughMoney          = errors.New("not enough money")
+	ErrInvalidBrokerConnParams = errors.New("invalid broker client params")
+	ErrBrokerConnClosed        = errors.New("broker connection closed")
+	ErrUnknownTopic            = errors.New("msg of unknown topic")
+	ErrTransNotFound           = errors.New("transaction not found")
+	ErrMsgAlreadyProcessed     = errors.New("msg already processed")
+	ErrWalletNotFound          = errors.New("wallet not found")
+	ErrInvalidAmount           = errors.New("amount must be positive")
+	ErrHoldNotFound            = errors.New("hold not found")
+	ErrHoldNotActive           = errors.New("hold is not active")
+	ErrRefundExceedsPayment    = errors.New("refund exceeds order payment")
+	ErrLedgerAccountNotFound   = errors.New("ledger account not found")
+	ErrIdempotencyKeyReused    = errors.New("idempotency key already used for another top-up")
+	ErrOrderRejected           = errors.New("order already rejected")
 )
@@ -0,0 +1,78 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"wallet_service/internal/app/models"
+)
+
+// Codes of the system accounts, wallet accounts are coded by WalletAccount.
+const (
+	MerchantRevenueAccount = "merchant_revenue"
+	TopUpSourceAccount     = "top_up_source"
+)
+
+var (
+	ErrUnbalancedPostings  = errors.New("ledger postings are not balanced")
+	ErrUnknownPostingsType = errors.New("no ledger postings for transaction type")
+)
+
+// Signed change of the account balance made by transaction.
+type Posting struct {
+	Account string
+	Amount  models.Money
+}
+
+func WalletAccount(walletID uint) string {
+	return fmt.Sprintf("wallet:%d", walletID)
+}
+
+// Double-entry postings of wallet transaction: amount is moved
+// from one account to another, so postings always sum to zero.
+// Hold and its release move no money and have no postings.
+func Postings(
+	walletID uint,
+	transType models.TransactionType,
+	amount models.Money,
+) ([]Posting, error) {
+	wallet := WalletAccount(walletID)
+
+	var from, to string
+
+	switch transType {
+	case models.Hold, models.Release:
+		return nil, nil
+	case models.Purchase, models.Capture:
+		from, to = wallet, MerchantRevenueAccount
+	case models.Cancelation, models.Refund:
+		from, to = MerchantRevenueAccount, wallet
+	case models.TopUp:
+		from, to = TopUpSourceAccount, wallet
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnknownPostingsType, transType)
+	}
+
+	return []Posting{
+		{Account: from, Amount: -amount},
+		{Account: to, Amount: amount},
+	}, nil
+}
+
+// Checks postings of one transaction sum to zero.
+func Balanced(postings []Posting) error {
+	var sum models.Money
+
+	for _, v := range postings {
+		if v.Amount == 0 {
+			return fmt.Errorf("%w: zero posting to %s", ErrUnbalancedPostings, v.Account)
+		}
+
+		sum += v.Amount
+	}
+
+	if len(postings) < 2 || sum != 0 {
+		return fmt.Errorf("%w: %d postings sum to %s", ErrUnbalancedPostings, len(postings), sum)
+	}
+
+	return nil
+}
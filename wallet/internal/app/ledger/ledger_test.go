@@ -0,0 +1,107 @@
+package ledger
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"wallet_service/internal/app/models"
+)
+
+func TestPostings(t *testing.T) {
+	cases := []struct {
+		transType models.TransactionType
+		want      []Posting
+	}{
+		{
+			transType: models.Purchase,
+			want:      []Posting{{Account: "wallet:1", Amount: -500}, {Account: MerchantRevenueAccount, Amount: 500}},
+		},
+		{
+			transType: models.Capture,
+			want:      []Posting{{Account: "wallet:1", Amount: -500}, {Account: MerchantRevenueAccount, Amount: 500}},
+		},
+		{
+			transType: models.Cancelation,
+			want:      []Posting{{Account: MerchantRevenueAccount, Amount: -500}, {Account: "wallet:1", Amount: 500}},
+		},
+		{
+			transType: models.Refund,
+			want:      []Posting{{Account: MerchantRevenueAccount, Amount: -500}, {Account: "wallet:1", Amount: 500}},
+		},
+		{
+			transType: models.TopUp,
+			want:      []Posting{{Account: TopUpSourceAccount, Amount: -500}, {Account: "wallet:1", Amount: 500}},
+		},
+		{transType: models.Hold},
+		{transType: models.Release},
+	}
+
+	for _, tc := range cases {
+		postings, err := Postings(1, tc.transType, 500)
+		if err != nil {
+			t.Fatalf("postings of type %d err %v", tc.transType, err)
+		}
+
+		if !reflect.DeepEqual(postings, tc.want) {
+			t.Errorf("postings of type %d: expected %+v, got %+v", tc.transType, tc.want, postings)
+		}
+
+		if tc.want != nil {
+			if err := Balanced(postings); err != nil {
+				t.Errorf("postings of type %d are not balanced: %v", tc.transType, err)
+			}
+		}
+	}
+
+	if _, err := Postings(1, models.TransactionType(100), 500); !errors.Is(err, ErrUnknownPostingsType) {
+		t.Error("expected unknown postings type err, got", err)
+	}
+}
+
+func TestBalanced(t *testing.T) {
+	cases := []struct {
+		name     string
+		postings []Posting
+		wantErr  error
+	}{
+		{
+			name:     "two postings sum to zero",
+			postings: []Posting{{Account: "a", Amount: -100}, {Account: "b", Amount: 100}},
+		},
+		{
+			name: "several postings sum to zero",
+			postings: []Posting{
+				{Account: "a", Amount: -100},
+				{Account: "b", Amount: 30},
+				{Account: "c", Amount: 70},
+			},
+		},
+		{
+			name:     "sum is not zero",
+			postings: []Posting{{Account: "a", Amount: -100}, {Account: "b", Amount: 90}},
+			wantErr:  ErrUnbalancedPostings,
+		},
+		{
+			name:     "zero posting",
+			postings: []Posting{{Account: "a", Amount: 0}, {Account: "b", Amount: 0}},
+			wantErr:  ErrUnbalancedPostings,
+		},
+		{
+			name:     "single posting",
+			postings: []Posting{{Account: "a", Amount: 100}},
+			wantErr:  ErrUnbalancedPostings,
+		},
+		{
+			name:    "no postings",
+			wantErr: ErrUnbalancedPostings,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := Balanced(tc.postings); !errors.Is(err, tc.wantErr) {
+				t.Errorf("expected err %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
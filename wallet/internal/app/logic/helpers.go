@@ -1,15 +1,16 @@
 package logic
 
 import (
+	"common/events"
 	"context"
 	in "wallet_service/internal/app/interfaces"
 	"wallet_service/internal/app/models"
 )
 
-func calcOrderSum(orderData *in.OrderDTO) float32 {
-	var sum float32
+func calcOrderSum(orderData *in.OrderDTO) models.Money {
+	var sum models.Money
 	for _, v := range orderData.OrderItems {
-		sum += v.ProductPrice * float32(v.Count)
+		sum += v.ProductPrice.Mul(uint(v.Count))
 	}
 
 	return sum
@@ -17,8 +18,9 @@ func calcOrderSum(orderData *in.OrderDTO) float32 {
 
 func (s *PaymentService) sendSuccessMsg(ctx context.Context, data *in.Transaction) error {
 	err := s.brokerClient.SendPurchaseSuccess(ctx, &in.OrderSuccessMsg{
-		OrderID: data.OrderID,
-		Service: in.Storage,
+		OrderID:     data.OrderID,
+		Service:     in.Wallet,
+		CausationID: data.MessageID,
 	})
 
 	return err
@@ -26,10 +28,22 @@ func (s *PaymentService) sendSuccessMsg(ctx context.Context, data *in.Transactio
 
 func (s *PaymentService) sendRejectedMsg(ctx context.Context, reasonCode models.CancelationReason, data *in.Transaction) error {
 	err := s.brokerClient.SendOrderRejectedMsg(ctx, &in.OrderRejectedMsg{
-		OrderID:    data.OrderID,
-		ReasonCode: reasonCode,
-		Service:    in.Storage,
+		MessageID:   events.RejectedMsgID(in.Wallet, data.OrderID),
+		OrderID:     data.OrderID,
+		UserID:      data.Wallet.UserID,
+		ReasonCode:  reasonCode,
+		Service:     in.Wallet,
+		CausationID: data.MessageID,
 	})
 
 	return err
 }
+
+// Registry records the acknowledgement, so the outcome of order cancelation can be seen on the order.
+func (s *PaymentService) sendCompensatedMsg(ctx context.Context, msg *in.OrderRejectedMsg) error {
+	return s.brokerClient.SendCompensatedMsg(ctx, &in.OrderCompensatedMsg{
+		OrderID:     msg.OrderID,
+		Service:     in.Wallet,
+		CausationID: msg.MessageID,
+	})
+}
@@ -1,6 +1,8 @@
 package logic
 
 import (
+	"common/deadletter"
+	"common/events"
 	"context"
 	"errors"
 	"sync"
@@ -9,6 +11,60 @@ import (
 	"wallet_service/internal/app/models"
 )
 
+// Get user wallet with current balance
+func (s *PaymentService) GetWallet(ctx context.Context, userID uint) (*models.Wallet, error) {
+	return s.walletsDAO.GetByUserID(ctx, userID)
+}
+
+// Entry point to top up user wallet.
+// Request is idempotent by the client key, repeated one returns the first top-up.
+func (s *PaymentService) TopUp(
+	ctx context.Context,
+	userID uint,
+	amount models.Money,
+	idempotencyKey string,
+) (*models.WalletTransaction, error) {
+	s.logger.Info("Topping up wallet of user: ", userID)
+
+	if amount <= 0 {
+		return nil, in.ErrInvalidAmount
+	}
+
+	wallet, err := s.walletsDAO.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	trans, err := s.walletsDAO.TopUp(ctx, &in.TopUpWalletDTO{
+		WalletID:       wallet.ID,
+		Amount:         amount,
+		IdempotencyKey: idempotencyKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Topping up wallet success: ", trans.ID)
+
+	return trans, nil
+}
+
+// Page of user wallet transactions, WalletID of the filter is set by user wallet
+func (s *PaymentService) GetTransactionsList(
+	ctx context.Context,
+	userID uint,
+	filter *in.TransactionsFilterDTO,
+) ([]*models.WalletTransaction, error) {
+	wallet, err := s.walletsDAO.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter.WalletID = wallet.ID
+
+	return s.walletsTransactionsDAO.GetList(ctx, filter)
+}
+
 // Entry point to make purchase
 func (s *PaymentService) MakePurchase(
 	ctx context.Context,
@@ -24,21 +80,14 @@ func (s *PaymentService) MakePurchase(
 	cost := calcOrderSum(orderData)
 
 	trans := &in.Transaction{
-		Cost:    cost,
-		OrderID: orderData.OrderID,
-		Wallet:  wallet,
-		Type:    models.Purchase,
-	}
-
-	select {
-	case s.transactionsPipe <- trans:
-	case <-time.After(s.sendMsgTimeout * time.Second):
-		return in.ErrNewTransactionTimeoutError
+		MessageID: orderData.MessageID,
+		Cost:      cost,
+		OrderID:   orderData.OrderID,
+		Wallet:    wallet,
+		Type:      models.Hold,
 	}
 
-	s.logger.Info("Purchase: send msg to chan success")
-
-	return nil
+	return s.purchaseProcessor(ctx, trans)
 }
 
 // Entry point to cancel purchase
@@ -55,200 +104,482 @@ func (s *PaymentService) MakeCancelation(
 		return err
 	}
 
+	// Rejection may arrive before the new order msg, mark stops the later hold.
+	if err := s.holdsDAO.MarkOrderRejected(ctx, orderData.OrderID); err != nil {
+		s.logger.Error("Cancelation mark order rejected err: ", err)
+
+		return err
+	}
+
 	oldTrans, err := s.walletsTransactionsDAO.GetByOrderID(ctx, orderData.OrderID)
+	if errors.Is(err, in.ErrTransNotFound) {
+		s.logger.Info("Cancelation: order was not paid, skip")
+
+		return nil
+	}
+
 	if err != nil {
-		s.logger.Error("Cancelation wallet old trans not found err: ", err)
+		s.logger.Error("Cancelation wallet old trans get err: ", err)
 
 		return err
 	}
 
 	trans := &in.Transaction{
-		Cost:    oldTrans.Cost,
-		OrderID: orderData.OrderID,
-		Wallet:  wallet,
-		Type:    models.Cancelation,
+		MessageID: orderData.MessageID,
+		Cost:      oldTrans.Cost,
+		OrderID:   orderData.OrderID,
+		Wallet:    wallet,
+		Type:      models.Cancelation,
+	}
+
+	return s.processCancelation(ctx, trans)
+}
+
+// Authorizes purchase by holding its cost on wallet,
+// money is captured when the order is completed.
+func (s *PaymentService) processPurchase(ctx context.Context, trans *in.Transaction) (models.CancelationReason, error) {
+	s.logger.Info("Processing purchase")
+
+	_, err := s.holdsDAO.Place(ctx, &in.PlaceHoldDTO{
+		WalletID:  trans.Wallet.ID,
+		OrderID:   trans.OrderID,
+		Amount:    trans.Cost,
+		ExpiresAt: time.Now().Add(s.holdTTL),
+		MessageID: trans.MessageID,
+	})
+	if errors.Is(err, in.ErrMsgAlreadyProcessed) {
+		s.logger.Info("Processing purchase: msg already processed, skip")
+
+		return models.OK, nil
 	}
 
-	select {
-	case s.transactionsPipe <- trans:
-	case <-time.After(s.sendMsgTimeout * time.Second):
-		return in.ErrNewTransactionTimeoutError
+	if errors.Is(err, in.ErrNotEnoughMoney) {
+		return models.NotEnoughMoney, err
 	}
 
-	s.logger.Info("Cancelation: send msg to chan success")
+	if err != nil {
+		return models.InternalError, err
+	}
 
-	return nil
+	s.logger.Info("Processing purchase success")
+
+	return models.OK, nil
 }
 
-func (s *PaymentService) EventPipeProcessor(ctx context.Context, wg *sync.WaitGroup) {
-	for {
-		select {
-		case trans, ok := <-s.transactionsPipe:
-			if !ok {
-				continue
-			}
+// Releases hold of the rejected order, or refunds it if the hold was already captured.
+func (s *PaymentService) processCancelation(ctx context.Context, trans *in.Transaction) error {
+	s.logger.Info("Processing cancelation")
 
-			switch trans.Type {
-			case models.Purchase:
-				go s.purchaseProcessor(ctx, trans)
+	hold, err := s.holdsDAO.Release(ctx, &in.SettleHoldDTO{
+		OrderID:   trans.OrderID,
+		MessageID: trans.MessageID,
+	})
 
-			case models.Cancelation:
-				go s.cancelationProcessor(ctx, trans)
+	switch {
+	case errors.Is(err, in.ErrMsgAlreadyProcessed):
+		s.logger.Info("Processing cancelation: msg already processed, skip")
 
-			default:
-				go s.invalidTransProcessor(trans)
-			}
-		case <-ctx.Done():
-			return
-		}
+		return nil
+	case errors.Is(err, in.ErrHoldNotFound):
+		// Orders paid before holds were introduced were debited immediately.
+		return s.refund(ctx, trans)
+	case errors.Is(err, in.ErrHoldNotActive):
+		return s.refundCapturedHold(ctx, trans)
+	case err != nil:
+		return err
 	}
+
+	s.logger.Info("Processing cancelation: hold released ", hold.ID)
+
+	return nil
 }
 
-func (s *PaymentService) processPurchase(ctx context.Context, trans *in.Transaction) (models.CancelationReason, error) {
-	s.logger.Info("Processing purchase")
+func (s *PaymentService) refundCapturedHold(ctx context.Context, trans *in.Transaction) error {
+	hold, err := s.holdsDAO.GetByOrderID(ctx, trans.OrderID)
+	if err != nil {
+		return err
+	}
 
-	existingTrans, err := s.walletsTransactionsDAO.GetByOrderID(ctx, trans.OrderID)
-	if err != nil && !errors.Is(err, in.ErrTransNotFound) {
-		s.logger.Error("got process purchase err: ", err)
+	if hold.Status != models.HoldCaptured {
+		s.logger.Info("Processing cancelation: hold already released, skip")
 
-		return models.InternalError, err
+		return nil
 	}
 
-	if existingTrans != nil {
-		return models.OK, nil
+	trans.Cost = hold.Amount
+
+	return s.refund(ctx, trans)
+}
+
+func (s *PaymentService) refund(ctx context.Context, trans *in.Transaction) error {
+	_, err := s.walletsTransactionsDAO.GetByOrderID(ctx, trans.OrderID)
+	if errors.Is(err, in.ErrTransNotFound) {
+		s.logger.Info("Processing cancelation: order was not paid, skip")
+
+		return nil
+	}
+
+	if err != nil {
+		return err
 	}
 
-	newTrans, err := s.walletsTransactionsDAO.Create(ctx, &in.CreateWalletTransactionDTO{
-		WalletID: trans.Wallet.ID,
-		OrderID:  trans.OrderID,
-		Cost:     trans.Cost,
-		Type:     trans.Type,
+	_, err = s.walletsTransactionsDAO.ApplyTransaction(ctx, &in.CreateWalletTransactionDTO{
+		WalletID:  trans.Wallet.ID,
+		OrderID:   trans.OrderID,
+		Cost:      trans.Cost,
+		Type:      trans.Type,
+		MessageID: trans.MessageID,
 	})
+	if errors.Is(err, in.ErrMsgAlreadyProcessed) {
+		s.logger.Info("Processing cancelation: msg already processed, skip")
+
+		return nil
+	}
+
 	if err != nil {
-		return models.InternalError, err
+		return err
 	}
 
-	if trans.Wallet.Balance < newTrans.Cost {
-		return models.NotEnoughMoney, in.ErrNotEnoughMoney
+	s.logger.Info("Processing cancelation: refund success")
+
+	return nil
+}
+
+// Entry point to capture payment of completed order
+func (s *PaymentService) MakeCapture(ctx context.Context, orderData *in.CompleteOrderDTO) error {
+	s.logger.Info("Making capture: ", orderData.OrderID)
+
+	trans := &in.Transaction{
+		MessageID: orderData.MessageID,
+		OrderID:   orderData.OrderID,
+		Type:      models.Capture,
 	}
 
-	trans.Wallet.Balance -= newTrans.Cost
-	if _, err := s.walletsDAO.UpdateBalance(ctx, trans.Wallet); err != nil {
-		return models.InternalError, err
+	return s.processCapture(ctx, trans)
+}
+
+func (s *PaymentService) processCapture(ctx context.Context, trans *in.Transaction) error {
+	s.logger.Info("Processing capture")
+
+	hold, err := s.holdsDAO.Capture(ctx, &in.SettleHoldDTO{
+		OrderID:   trans.OrderID,
+		MessageID: trans.MessageID,
+	})
+
+	switch {
+	case errors.Is(err, in.ErrMsgAlreadyProcessed):
+		s.logger.Info("Processing capture: msg already processed, skip")
+
+		return nil
+	case errors.Is(err, in.ErrHoldNotFound):
+		s.logger.Info("Processing capture: order was paid without hold, skip")
+
+		return nil
+	case errors.Is(err, in.ErrHoldNotActive):
+		s.logger.Info("Processing capture: hold already settled, skip")
+
+		return nil
+	case err != nil:
+		return err
 	}
 
-	s.logger.Info("Processing purchase success")
+	s.logger.Info("Processing capture success: ", hold.ID)
 
-	return models.OK, nil
+	return nil
 }
 
-func (s *PaymentService) processCancelation(ctx context.Context, trans *in.Transaction) error {
-	s.logger.Info("Processing cancelation")
+// Entry point to refund returned items of completed order
+func (s *PaymentService) MakeRefund(ctx context.Context, returnData *in.ReturnOrderDTO) error {
+	s.logger.Info("Making refund: ", returnData.OrderID)
+
+	wallet, err := s.walletsDAO.GetByUserID(ctx, returnData.UserID)
+	if err != nil {
+		s.logger.Error("Refund wallet get by user id err: ", err)
 
-	existingTrans, err := s.walletsTransactionsDAO.GetByOrderID(ctx, trans.OrderID)
-	if err != nil && !errors.Is(err, in.ErrTransNotFound) {
 		return err
 	}
 
-	if existingTrans != nil && existingTrans.Type == models.Cancelation {
-		return nil
+	trans := &in.Transaction{
+		MessageID: returnData.MessageID,
+		Cost:      returnData.Amount,
+		OrderID:   returnData.OrderID,
+		Wallet:    wallet,
+		Type:      models.Refund,
+	}
+
+	return s.processRefund(ctx, trans)
+}
+
+// Refunds value of returned items. Order is completed before its items are returned,
+// so hold which is not captured yet (completed msg is late) is captured first.
+// The capture is saved to inbox under its own msg id derived from the return msg,
+// so redelivered return msg skips it and late completed msg is skipped by order step.
+func (s *PaymentService) processRefund(ctx context.Context, trans *in.Transaction) error {
+	s.logger.Info("Processing refund")
+
+	captureMsgID := ""
+	if trans.MessageID != "" {
+		captureMsgID = "capture:" + trans.MessageID
+	}
+
+	_, err := s.holdsDAO.Capture(ctx, &in.SettleHoldDTO{
+		OrderID:   trans.OrderID,
+		MessageID: captureMsgID,
+	})
+
+	switch {
+	case err == nil:
+		s.logger.Info("Processing refund: hold captured before refund")
+	case errors.Is(err, in.ErrMsgAlreadyProcessed),
+		errors.Is(err, in.ErrHoldNotFound),
+		errors.Is(err, in.ErrHoldNotActive):
+	default:
+		return err
 	}
 
-	newTrans, err := s.walletsTransactionsDAO.Create(ctx, &in.CreateWalletTransactionDTO{
-		WalletID: trans.Wallet.ID,
-		OrderID:  trans.OrderID,
-		Cost:     trans.Cost,
-		Type:     trans.Type,
+	_, err = s.walletsTransactionsDAO.ApplyTransaction(ctx, &in.CreateWalletTransactionDTO{
+		WalletID:  trans.Wallet.ID,
+		OrderID:   trans.OrderID,
+		Cost:      trans.Cost,
+		Type:      trans.Type,
+		MessageID: trans.MessageID,
 	})
+	if errors.Is(err, in.ErrMsgAlreadyProcessed) {
+		s.logger.Info("Processing refund: msg already processed, skip")
+
+		return nil
+	}
+
 	if err != nil {
 		return err
 	}
 
-	trans.Wallet.Balance += newTrans.Cost
-	if _, err := s.walletsDAO.UpdateBalance(ctx, trans.Wallet); err != nil {
+	s.logger.Info("Processing refund success")
+
+	return nil
+}
+
+// Releases holds which were neither captured nor released in time,
+// e.g. when completed or rejected msg is lost.
+func (s *PaymentService) expireHolds(ctx context.Context) error {
+	holds, err := s.holdsDAO.GetListExpired(ctx, time.Now(), s.holdsSweepBatch)
+	if err != nil {
 		return err
 	}
 
-	s.logger.Info("Processing cancelation success")
+	for _, hold := range holds {
+		_, err := s.holdsDAO.Expire(ctx, hold.ID)
+		if errors.Is(err, in.ErrHoldNotActive) {
+			s.logger.Infof("Expire holds: hold %d settled concurrently, skip", hold.ID)
+
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		s.logger.Warnf("Expire holds: hold %d of order %d released by timeout", hold.ID, hold.OrderID)
+	}
 
 	return nil
 }
 
-func (s *PaymentService) ConsumeNewOrderMsgLoop(ctx context.Context, wg *sync.WaitGroup) {
+func (s *PaymentService) ExpireHoldsLoop(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	ticker := time.NewTicker(s.consumeLoopTick)
+	ticker := time.NewTicker(s.holdsSweepInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			msg, err := s.brokerClient.GetNewOrderMsg(ctx)
-			if err != nil {
-				s.logger.Error("got new order msg err: ", err)
+			if err := s.expireHolds(ctx); err != nil {
+				s.logger.Error("Expire holds err: ", err)
 			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
 
-			if msg == nil {
-				continue
-			}
+func (s *PaymentService) handleNewOrderMsg(ctx context.Context, value []byte) error {
+	msg, err := events.DecodeNewOrderMsg(value)
+	if err != nil {
+		return deadletter.Permanent(err)
+	}
 
-			s.logger.Debug("Kafka new order msg: ", msg)
+	s.logger.Debug("Kafka new order msg: ", msg)
 
-			orderItemsData := make([]*in.OrderItemDTO, 0, 10)
-			for _, v := range msg.OrderItems {
-				orderItemsData = append(orderItemsData, &in.OrderItemDTO{
-					ProductID:    v.ProductID,
-					Count:        v.Count,
-					ProductPrice: v.ProductPrice,
-				})
-			}
+	orderItemsData := make([]*in.OrderItemDTO, 0, 10)
+	for _, v := range msg.OrderItems {
+		orderItemsData = append(orderItemsData, &in.OrderItemDTO{
+			ProductID:    v.ProductID,
+			Count:        v.Count,
+			ProductPrice: v.ProductPrice,
+		})
+	}
 
-			orderData := in.OrderDTO{
-				OrderID:    msg.OrderID,
-				UserID:     msg.UserID,
-				OrderItems: orderItemsData,
-			}
+	orderData := in.OrderDTO{
+		MessageID:  msg.MessageID,
+		OrderID:    msg.OrderID,
+		UserID:     msg.UserID,
+		OrderItems: orderItemsData,
+	}
 
-			if purchaseErr := s.MakePurchase(ctx, &orderData); purchaseErr != nil {
-				s.logger.Error("new order make purchase err: ", purchaseErr)
-			}
-		case <-ctx.Done():
-			return
-		}
+	return s.MakePurchase(ctx, &orderData)
+}
+
+func (s *PaymentService) handleRejectedOrderMsg(ctx context.Context, value []byte) error {
+	msg, err := events.DecodeOrderRejectedMsg(value)
+	if err != nil {
+		return deadletter.Permanent(err)
+	}
+
+	s.logger.Debug("Kafka rejected order msg:", msg)
+
+	if msg.Service == in.Wallet {
+		s.logger.Info("Got message for wallet. Skip")
+
+		return nil
+	}
+
+	cancelOrderData := in.CancelOrderDTO{
+		MessageID: msg.MessageID,
+		OrderID:   msg.OrderID,
+		UserID:    msg.UserID,
+	}
+
+	if err := s.MakeCancelation(ctx, cancelOrderData); err != nil {
+		return err
+	}
+
+	return s.sendCompensatedMsg(ctx, msg)
+}
+
+func (s *PaymentService) handleCompletedOrderMsg(ctx context.Context, value []byte) error {
+	msg, err := events.DecodeOrderCompletedMsg(value)
+	if err != nil {
+		return deadletter.Permanent(err)
 	}
+
+	s.logger.Debug("Kafka completed order msg:", msg)
+
+	return s.MakeCapture(ctx, &in.CompleteOrderDTO{
+		MessageID: msg.MessageID,
+		OrderID:   msg.OrderID,
+		UserID:    msg.UserID,
+	})
+}
+
+func (s *PaymentService) handleReturnedOrderMsg(ctx context.Context, value []byte) error {
+	msg, err := events.DecodeOrderReturnedMsg(value)
+	if err != nil {
+		return deadletter.Permanent(err)
+	}
+
+	s.logger.Debug("Kafka returned order msg:", msg)
+
+	return s.MakeRefund(ctx, &in.ReturnOrderDTO{
+		MessageID: msg.MessageID,
+		OrderID:   msg.OrderID,
+		UserID:    msg.UserID,
+		Amount:    msg.Amount,
+	})
+}
+
+func (s *PaymentService) ConsumeNewOrderMsgLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	s.deadLetters.Consume(
+		ctx,
+		s.brokerClient.FetchNewOrderMsg,
+		s.brokerClient.CommitMsg,
+		s.handleNewOrderMsg,
+		s.consumeLoopTick,
+	)
 }
 
 func (s *PaymentService) ConsumeRejectedOrderMsgLoop(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	ticker := time.NewTicker(s.consumeLoopTick)
+	s.deadLetters.Consume(
+		ctx,
+		s.brokerClient.FetchOrderRejectedMsg,
+		s.brokerClient.CommitMsg,
+		s.handleRejectedOrderMsg,
+		s.consumeLoopTick,
+	)
+}
+
+func (s *PaymentService) ConsumeCompletedOrderMsgLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	s.deadLetters.Consume(
+		ctx,
+		s.brokerClient.FetchOrderCompletedMsg,
+		s.brokerClient.CommitMsg,
+		s.handleCompletedOrderMsg,
+		s.consumeLoopTick,
+	)
+}
+
+func (s *PaymentService) ConsumeReturnedOrderMsgLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	s.deadLetters.Consume(
+		ctx,
+		s.brokerClient.FetchOrderReturnedMsg,
+		s.brokerClient.CommitMsg,
+		s.handleReturnedOrderMsg,
+		s.consumeLoopTick,
+	)
+}
+
+// Checks stored wallet balances and transactions against ledger entries
+func (s *PaymentService) Reconcile(ctx context.Context) (*models.ReconciliationReport, error) {
+	mismatches, err := s.ledgerDAO.GetBalanceMismatches(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	unbalanced, err := s.ledgerDAO.GetUnbalancedTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ReconciliationReport{
+		Mismatches:             mismatches,
+		UnbalancedTransactions: unbalanced,
+		CheckedAt:              time.Now(),
+	}, nil
+}
+
+func (s *PaymentService) ReconciliationLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(s.reconcileInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			msg, err := s.brokerClient.GetOrderRejectedMsg(ctx)
+			report, err := s.Reconcile(ctx)
 			if err != nil {
-				s.logger.Error("get order rejected msg err: ", err)
-			}
-
-			if msg == nil {
-				continue
-			}
-
-			s.logger.Debug("Kafka rejected order msg:", msg)
-
-			if msg.Service == in.Wallet {
-				s.logger.Info("Got message for wallet. Skip")
+				s.logger.Error("Reconcile ledger err: ", err)
 
 				continue
 			}
 
-			cancelOrderData := &in.CancelOrderDTO{
-				OrderID: msg.OrderID,
-				UserID:  msg.UserID,
+			for _, v := range report.Mismatches {
+				s.logger.Warnf(
+					"Ledger mismatch: wallet %d of user %d, balance %s, ledger %s",
+					v.WalletID, v.UserID, v.Balance, v.LedgerBalance,
+				)
 			}
 
-			if cancelErr := s.MakeCancelation(ctx, *cancelOrderData); cancelErr != nil {
-				s.logger.Error("rejected order update err: ", cancelErr)
+			for _, id := range report.UnbalancedTransactions {
+				s.logger.Warn("Ledger entries of transaction are not balanced: ", id)
 			}
 		case <-ctx.Done():
 			return
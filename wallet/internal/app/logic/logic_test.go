@@ -0,0 +1,541 @@
+package logic
+
+import (
+	"common/deadletter"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+	in "wallet_service/internal/app/interfaces"
+	"wallet_service/internal/app/models"
+	"wallet_service/internal/pkg/broker"
+	"wallet_service/internal/pkg/conf"
+	"wallet_service/internal/pkg/db"
+
+	"github.com/creasty/defaults"
+	"github.com/sirupsen/logrus"
+)
+
+// Service on in-memory DAOs, wallets 1-3 of users 1-3 have 100.00 each.
+func newPaymentService(t *testing.T) *PaymentService {
+	t.Helper()
+
+	config := &conf.Config{}
+	if err := defaults.Set(config); err != nil {
+		t.Fatal("err config set defaults", err)
+	}
+
+	logEntry := logrus.NewEntry(logrus.New())
+	store := db.NewInMemoryStore()
+	brokerClient := broker.NewInMemoryBrokerClient()
+
+	return NewPaymentService(
+		db.NewInMemoryWalletsDAO(store),
+		db.NewInMemoryWalletTransDAO(store),
+		db.NewInMemoryHoldsDAO(store),
+		db.NewInMemoryLedgerDAO(store),
+		brokerClient,
+		deadletter.NewQueue(
+			config.Kafka.GroupID,
+			deadletter.NewInMemoryStore(),
+			brokerClient,
+			config.RetryPolicy(),
+			logEntry,
+		),
+		logEntry,
+		config,
+	)
+}
+
+func purchase(t *testing.T, s *PaymentService, orderID uint, cost models.Money) {
+	t.Helper()
+
+	err := s.MakePurchase(context.Background(), &in.OrderDTO{
+		MessageID: fmt.Sprintf("new_order:%d", orderID),
+		OrderID:   orderID,
+		UserID:    1,
+		OrderItems: []*in.OrderItemDTO{
+			{ProductID: 1, Count: 1, ProductPrice: cost},
+		},
+	})
+	if err != nil {
+		t.Fatal("make purchase err", err)
+	}
+}
+
+func checkWallet(t *testing.T, s *PaymentService, balance models.Money, held models.Money) {
+	t.Helper()
+
+	wallet, err := s.GetWallet(context.Background(), 1)
+	if err != nil {
+		t.Fatal("get wallet err", err)
+	}
+
+	if wallet.Balance != balance || wallet.Held != held {
+		t.Errorf("wallet balance %s held %s, expected %s and %s", wallet.Balance, wallet.Held, balance, held)
+	}
+}
+
+func checkHoldStatus(t *testing.T, s *PaymentService, orderID uint, status models.HoldStatus) {
+	t.Helper()
+
+	hold, err := s.holdsDAO.GetByOrderID(context.Background(), orderID)
+	if err != nil {
+		t.Fatal("get hold err", err)
+	}
+
+	if hold.Status != status {
+		t.Errorf("hold status %d, expected %d", hold.Status, status)
+	}
+}
+
+func TestPlaceAndCaptureHold(t *testing.T) {
+	ctx := context.Background()
+	s := newPaymentService(t)
+
+	purchase(t, s, 1, 3000)
+
+	checkWallet(t, s, 10000, 3000)
+	checkHoldStatus(t, s, 1, models.HoldActive)
+
+	_, err := s.holdsDAO.Place(ctx, &in.PlaceHoldDTO{
+		WalletID:  1,
+		OrderID:   2,
+		Amount:    8000,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if !errors.Is(err, in.ErrNotEnoughMoney) {
+		t.Error("hold over available balance is placed", err)
+	}
+
+	capture := &in.CompleteOrderDTO{MessageID: "completed:1", OrderID: 1, UserID: 1}
+
+	if err := s.MakeCapture(ctx, capture); err != nil {
+		t.Fatal("make capture err", err)
+	}
+
+	checkWallet(t, s, 7000, 0)
+	checkHoldStatus(t, s, 1, models.HoldCaptured)
+
+	if err := s.MakeCapture(ctx, capture); err != nil {
+		t.Fatal("repeated capture err", err)
+	}
+
+	checkWallet(t, s, 7000, 0)
+}
+
+func TestReleaseHold(t *testing.T) {
+	ctx := context.Background()
+	s := newPaymentService(t)
+
+	purchase(t, s, 1, 3000)
+
+	err := s.MakeCancelation(ctx, in.CancelOrderDTO{MessageID: "rejected:1:1", OrderID: 1, UserID: 1})
+	if err != nil {
+		t.Fatal("make cancelation err", err)
+	}
+
+	checkWallet(t, s, 10000, 0)
+	checkHoldStatus(t, s, 1, models.HoldReleased)
+
+	if _, err := s.holdsDAO.Release(ctx, &in.SettleHoldDTO{OrderID: 1}); !errors.Is(err, in.ErrMsgAlreadyProcessed) {
+		t.Error("hold of the order is released again", err)
+	}
+
+	if _, err := s.holdsDAO.Capture(ctx, &in.SettleHoldDTO{OrderID: 1}); !errors.Is(err, in.ErrHoldNotActive) {
+		t.Error("released hold is captured", err)
+	}
+}
+
+func TestCancelationBeforePurchase(t *testing.T) {
+	ctx := context.Background()
+	s := newPaymentService(t)
+
+	err := s.MakeCancelation(ctx, in.CancelOrderDTO{MessageID: "rejected:1:1", OrderID: 1, UserID: 1})
+	if err != nil {
+		t.Fatal("make cancelation err", err)
+	}
+
+	purchase(t, s, 1, 3000)
+
+	checkWallet(t, s, 10000, 0)
+
+	if _, err := s.holdsDAO.GetByOrderID(ctx, 1); !errors.Is(err, in.ErrHoldNotFound) {
+		t.Error("hold is placed for rejected order", err)
+	}
+}
+
+func TestExpireHold(t *testing.T) {
+	ctx := context.Background()
+	s := newPaymentService(t)
+
+	s.holdTTL = -time.Second
+
+	purchase(t, s, 1, 3000)
+	purchase(t, s, 2, 5000)
+
+	if err := s.expireHolds(ctx); err != nil {
+		t.Fatal("expire holds err", err)
+	}
+
+	checkWallet(t, s, 10000, 0)
+	checkHoldStatus(t, s, 1, models.HoldExpired)
+	checkHoldStatus(t, s, 2, models.HoldExpired)
+
+	if _, err := s.holdsDAO.Expire(ctx, 1); !errors.Is(err, in.ErrHoldNotActive) {
+		t.Error("expired hold is expired again", err)
+	}
+
+	// Expired hold is captured from available balance while it covers the amount.
+	if _, err := s.holdsDAO.Capture(ctx, &in.SettleHoldDTO{OrderID: 2}); err != nil {
+		t.Fatal("capture expired hold err", err)
+	}
+
+	checkWallet(t, s, 5000, 0)
+	checkHoldStatus(t, s, 2, models.HoldCaptured)
+
+	// Available balance is short for the other one.
+	s.holdTTL = time.Hour
+
+	purchase(t, s, 3, 4000)
+
+	if _, err := s.holdsDAO.Capture(ctx, &in.SettleHoldDTO{OrderID: 1}); !errors.Is(err, in.ErrNotEnoughMoney) {
+		t.Error("expired hold is captured over available balance", err)
+	}
+
+	checkWallet(t, s, 5000, 4000)
+	checkHoldStatus(t, s, 1, models.HoldExpired)
+}
+
+func TestExpireHoldsLoop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newPaymentService(t)
+
+	s.holdTTL = -time.Second
+	s.holdsSweepInterval = time.Millisecond
+
+	purchase(t, s, 1, 3000)
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	go s.ExpireHoldsLoop(ctx, &wg)
+
+	deadline := time.Now().Add(time.Second)
+
+	for {
+		hold, err := s.holdsDAO.GetByOrderID(ctx, 1)
+		if err != nil {
+			t.Fatal("get hold err", err)
+		}
+
+		if hold.Status == models.HoldExpired {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("hold is not expired by the loop")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	wg.Wait()
+
+	checkWallet(t, s, 10000, 0)
+}
+
+func TestRefundBeforeCapture(t *testing.T) {
+	ctx := context.Background()
+	s := newPaymentService(t)
+
+	purchase(t, s, 1, 3000)
+
+	refund := &in.ReturnOrderDTO{MessageID: "returned:1", OrderID: 1, UserID: 1, Amount: 1000}
+
+	if err := s.MakeRefund(ctx, refund); err != nil {
+		t.Fatal("make refund err", err)
+	}
+
+	checkWallet(t, s, 8000, 0)
+	checkHoldStatus(t, s, 1, models.HoldCaptured)
+
+	// Redelivered return msg and late completed msg change nothing.
+	if err := s.MakeRefund(ctx, refund); err != nil {
+		t.Fatal("repeated refund err", err)
+	}
+
+	if err := s.MakeCapture(ctx, &in.CompleteOrderDTO{MessageID: "completed:1", OrderID: 1, UserID: 1}); err != nil {
+		t.Fatal("late capture err", err)
+	}
+
+	checkWallet(t, s, 8000, 0)
+
+	// Next return of the order is refunded.
+	refund.MessageID = "returned:2"
+
+	if err := s.MakeRefund(ctx, refund); err != nil {
+		t.Fatal("next refund err", err)
+	}
+
+	checkWallet(t, s, 9000, 0)
+}
+
+type failingHoldsDAO struct {
+	in.WalletHoldsDAO
+	err error
+}
+
+func (dao *failingHoldsDAO) Place(ctx context.Context, data *in.PlaceHoldDTO) (*models.WalletHold, error) {
+	return nil, dao.err
+}
+
+// Only lack of money rejects the order, other errors are returned to be retried.
+func TestPurchaseRejectsOnNotEnoughMoneyOnly(t *testing.T) {
+	s := newPaymentService(t)
+	holdsDAO := s.holdsDAO
+
+	errUnavailable := errors.New("db is unavailable")
+	s.holdsDAO = &failingHoldsDAO{WalletHoldsDAO: holdsDAO, err: errUnavailable}
+
+	err := s.MakePurchase(context.Background(), &in.OrderDTO{
+		MessageID:  "new_order:1",
+		OrderID:    1,
+		UserID:     1,
+		OrderItems: []*in.OrderItemDTO{{ProductID: 1, Count: 1, ProductPrice: 3000}},
+	})
+	if !errors.Is(err, errUnavailable) {
+		t.Fatal("expected db err to be returned, got", err)
+	}
+
+	s.holdsDAO = holdsDAO
+
+	purchase(t, s, 1, 3000)
+	checkHoldStatus(t, s, 1, models.HoldActive)
+
+	purchase(t, s, 2, 20000)
+	checkWallet(t, s, 10000, 3000)
+}
+
+// Redelivered new order msg is found in the inbox, the order is held once.
+func TestRedeliveredNewOrderMsgHeldOnce(t *testing.T) {
+	s := newPaymentService(t)
+
+	purchase(t, s, 1, 3000)
+	purchase(t, s, 1, 3000)
+
+	checkWallet(t, s, 10000, 3000)
+
+	// Msg resent with another id is deduplicated by the order and step.
+	err := s.MakePurchase(context.Background(), &in.OrderDTO{
+		MessageID: "new_order:1:resent",
+		OrderID:   1,
+		UserID:    1,
+		OrderItems: []*in.OrderItemDTO{
+			{ProductID: 1, Count: 1, ProductPrice: 3000},
+		},
+	})
+	if err != nil {
+		t.Fatal("make purchase err", err)
+	}
+
+	checkWallet(t, s, 10000, 3000)
+}
+
+// Concurrent orders of one user are held only while available balance covers them.
+func TestConcurrentPurchasesKeepBalanceNonNegative(t *testing.T) {
+	s := newPaymentService(t)
+
+	var wg sync.WaitGroup
+
+	for orderID := uint(1); orderID <= 10; orderID++ {
+		wg.Add(1)
+
+		go func(orderID uint) {
+			defer wg.Done()
+
+			err := s.MakePurchase(context.Background(), &in.OrderDTO{
+				MessageID: fmt.Sprintf("new_order:%d", orderID),
+				OrderID:   orderID,
+				UserID:    1,
+				OrderItems: []*in.OrderItemDTO{
+					{ProductID: 1, Count: 1, ProductPrice: 3000},
+				},
+			})
+			if err != nil {
+				t.Error("make purchase err", err)
+			}
+		}(orderID)
+	}
+
+	wg.Wait()
+
+	checkWallet(t, s, 10000, 9000)
+}
+
+// Concurrent debits are decided by the DAO under lock, balance never goes below zero.
+func TestConcurrentDebitsKeepBalanceNonNegative(t *testing.T) {
+	ctx := context.Background()
+	s := newPaymentService(t)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+
+	for orderID := uint(1); orderID <= 10; orderID++ {
+		wg.Add(1)
+
+		go func(orderID uint) {
+			defer wg.Done()
+
+			_, err := s.walletsTransactionsDAO.ApplyTransaction(ctx, &in.CreateWalletTransactionDTO{
+				WalletID:  1,
+				OrderID:   orderID,
+				Cost:      3000,
+				Type:      models.Purchase,
+				MessageID: fmt.Sprintf("new_order:%d", orderID),
+			})
+
+			switch {
+			case errors.Is(err, in.ErrNotEnoughMoney):
+			case err != nil:
+				t.Error("apply transaction err", err)
+			default:
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}(orderID)
+	}
+
+	wg.Wait()
+
+	if succeeded != 3 {
+		t.Errorf("%d debits succeeded, expected 3", succeeded)
+	}
+
+	checkWallet(t, s, 1000, 0)
+}
+
+func TestTopUpIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	s := newPaymentService(t)
+
+	first, err := s.TopUp(ctx, 1, 2500, "key-1")
+	if err != nil {
+		t.Fatal("top up err", err)
+	}
+
+	repeated, err := s.TopUp(ctx, 1, 2500, "key-1")
+	if err != nil {
+		t.Fatal("repeated top up err", err)
+	}
+
+	if repeated.ID != first.ID {
+		t.Errorf("repeated top up created transaction %d, expected %d", repeated.ID, first.ID)
+	}
+
+	checkWallet(t, s, 12500, 0)
+
+	if _, err := s.TopUp(ctx, 1, 1000, "key-1"); !errors.Is(err, in.ErrIdempotencyKeyReused) {
+		t.Error("expected idempotency key reused err, got", err)
+	}
+
+	if _, err := s.TopUp(ctx, 2, 2500, "key-1"); !errors.Is(err, in.ErrIdempotencyKeyReused) {
+		t.Error("key of another wallet is reused, got", err)
+	}
+
+	if _, err := s.TopUp(ctx, 1, 0, "key-2"); !errors.Is(err, in.ErrInvalidAmount) {
+		t.Error("expected invalid amount err, got", err)
+	}
+
+	checkWallet(t, s, 12500, 0)
+}
+
+func TestTransactionsListFilters(t *testing.T) {
+	ctx := context.Background()
+	s := newPaymentService(t)
+
+	// Wallet is seeded with a 100.00 top-up before the test ones.
+	from := time.Now()
+
+	for i, amount := range []models.Money{1000, 2000, 3000} {
+		if _, err := s.TopUp(ctx, 1, amount, fmt.Sprintf("key-%d", i)); err != nil {
+			t.Fatal("top up err", err)
+		}
+	}
+
+	purchase(t, s, 1, 500)
+
+	to := time.Now().Add(time.Second)
+	topUp := models.TopUp
+	hold := models.Hold
+
+	cases := []struct {
+		name   string
+		filter in.TransactionsFilterDTO
+		want   []models.Money
+	}{
+		{
+			name:   "newest first",
+			filter: in.TransactionsFilterDTO{Limit: 10},
+			want:   []models.Money{500, 3000, 2000, 1000, 10000},
+		},
+		{
+			name:   "by type",
+			filter: in.TransactionsFilterDTO{Type: &topUp, Limit: 10},
+			want:   []models.Money{3000, 2000, 1000, 10000},
+		},
+		{
+			name:   "page",
+			filter: in.TransactionsFilterDTO{Type: &topUp, Limit: 1, Offset: 1},
+			want:   []models.Money{2000},
+		},
+		{
+			name:   "offset after the last one",
+			filter: in.TransactionsFilterDTO{Limit: 10, Offset: 5},
+			want:   []models.Money{},
+		},
+		{
+			name:   "within dates",
+			filter: in.TransactionsFilterDTO{Type: &hold, From: &from, To: &to, Limit: 10},
+			want:   []models.Money{500},
+		},
+		{
+			name:   "before dates",
+			filter: in.TransactionsFilterDTO{To: &from, Limit: 10},
+			want:   []models.Money{10000},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter := tc.filter
+
+			transactions, err := s.GetTransactionsList(ctx, 1, &filter)
+			if err != nil {
+				t.Fatal("get transactions err", err)
+			}
+
+			got := make([]models.Money, 0, len(transactions))
+			for _, v := range transactions {
+				got = append(got, v.Cost)
+			}
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected transactions %v, got %v", tc.want, got)
+			}
+		})
+	}
+
+	if _, err := s.GetTransactionsList(ctx, 4, &in.TransactionsFilterDTO{Limit: 10}); !errors.Is(err, in.ErrWalletNotFound) {
+		t.Error("expected wallet not found err, got", err)
+	}
+}
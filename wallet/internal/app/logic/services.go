@@ -1,6 +1,7 @@
 package logic
 
 import (
+	"common/deadletter"
 	"time"
 	in "wallet_service/internal/app/interfaces"
 	"wallet_service/internal/pkg/conf"
@@ -11,34 +12,49 @@ import (
 type PaymentService struct {
 	walletsDAO             in.WalletsDAO
 	walletsTransactionsDAO in.WalletTransactionsDAO
+	holdsDAO               in.WalletHoldsDAO
+	ledgerDAO              in.LedgerDAO
 	brokerClient           in.BrokerClient
-	transactionsPipe       chan *in.Transaction
+	deadLetters            *deadletter.Queue
 
-	sendMsgTimeout  time.Duration
-	consumeLoopTick time.Duration
-	logger          *logrus.Entry
+	consumeLoopTick    time.Duration
+	holdTTL            time.Duration
+	holdsSweepInterval time.Duration
+	holdsSweepBatch    uint16
+	reconcileInterval  time.Duration
+	logger             *logrus.Entry
 }
 
 func NewPaymentService(
 	walletsDAO in.WalletsDAO,
 	walletsTransactionsDAO in.WalletTransactionsDAO,
+	holdsDAO in.WalletHoldsDAO,
+	ledgerDAO in.LedgerDAO,
 	brokerClient in.BrokerClient,
+	deadLetters *deadletter.Queue,
 	logger *logrus.Entry,
 	config *conf.Config,
 ) *PaymentService {
-	transactionsPipe := make(chan *in.Transaction, config.Server.TransactionsPipeCapacity)
-
-	return &PaymentService{
+	s := &PaymentService{
 		walletsDAO:             walletsDAO,
 		walletsTransactionsDAO: walletsTransactionsDAO,
+		holdsDAO:               holdsDAO,
+		ledgerDAO:              ledgerDAO,
 		brokerClient:           brokerClient,
-		transactionsPipe:       transactionsPipe,
-		sendMsgTimeout:         time.Duration(config.Kafka.SendMsgTimeout) * time.Second,
+		deadLetters:            deadLetters,
 		consumeLoopTick:        time.Duration(config.Kafka.ConsumeLoopTick) * time.Millisecond,
+		holdTTL:                time.Duration(config.Holds.TTL) * time.Second,
+		holdsSweepInterval:     time.Duration(config.Holds.SweepInterval) * time.Second,
+		holdsSweepBatch:        config.Holds.SweepBatch,
+		reconcileInterval:      time.Duration(config.Ledger.ReconcileInterval) * time.Second,
 		logger:                 logger,
 	}
-}
 
-func (s *PaymentService) Close() {
-	close(s.transactionsPipe)
+	// Letters are replayed by the handlers msgs of their topics are consumed with.
+	deadLetters.Register(config.Kafka.NewOrdersTopic, s.handleNewOrderMsg)
+	deadLetters.Register(config.Kafka.RejectedOrdersTopic, s.handleRejectedOrderMsg)
+	deadLetters.Register(config.Kafka.CompletedOrdersTopic, s.handleCompletedOrderMsg)
+	deadLetters.Register(config.Kafka.ReturnedOrdersTopic, s.handleReturnedOrderMsg)
+
+	return s
 }
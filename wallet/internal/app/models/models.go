@@ -1,9 +1,22 @@
 package models
 
+import (
+	"common/events"
+	"common/money"
+	"time"
+)
+
 type (
 	OrderStatus       uint8
 	TransactionType   uint8
-	CancelationReason uint8
+	LedgerAccountType uint8
+	HoldStatus        uint8
+)
+
+// Shared with other services through msgs.
+type (
+	Money             = money.Money
+	CancelationReason = events.CancelationReason
 )
 
 const (
@@ -16,26 +29,82 @@ const (
 const (
 	Purchase TransactionType = iota
 	Cancelation
+	TopUp
+	Hold
+	Capture
+	Release
+	Refund
 )
 
 const (
-	OK CancelationReason = iota
-	NotEnoughMoney
-	OutOfStock
-	InternalError
+	HoldActive HoldStatus = iota
+	HoldCaptured
+	HoldReleased
+	HoldExpired
 )
 
+const (
+	OK                 = events.OK
+	NotEnoughMoney     = events.NotEnoughMoney
+	OutOfStock         = events.OutOfStock
+	InternalError      = events.InternalError
+	Timeout            = events.Timeout
+	CanceledByUser     = events.CanceledByUser
+	ReservationExpired = events.ReservationExpired
+)
+
+const (
+	WalletAccount LedgerAccountType = iota
+	MerchantRevenueAccount
+	TopUpSourceAccount
+)
+
+// Balance is ledger balance, Held part of it is reserved by active holds.
 type Wallet struct {
 	ID      uint
 	UserID  uint
-	Balance float32
+	Balance Money
+	Held    Money
+}
+
+// Money which can be held or spent.
+func (w *Wallet) Available() Money {
+	return w.Balance - w.Held
 }
 
 type WalletTransaction struct {
-	ID       uint
-	WalletID uint
-	OrderID  uint
-	Cost     float32
-	Wallet   *Wallet
-	Type     TransactionType
+	ID        uint
+	WalletID  uint
+	OrderID   uint
+	Cost      Money
+	Wallet    *Wallet
+	Type      TransactionType
+	CreatedAt time.Time
+}
+
+// Money of the order held on wallet until the order is completed or rejected.
+type WalletHold struct {
+	ID        uint
+	WalletID  uint
+	OrderID   uint
+	Amount    Money
+	Status    HoldStatus
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// Wallet which stored balance disagrees with the sum of its ledger entries.
+type BalanceMismatch struct {
+	WalletID      uint
+	UserID        uint
+	Balance       Money
+	LedgerBalance Money
+}
+
+// Result of ledger reconciliation, empty when ledger and balances agree.
+type ReconciliationReport struct {
+	Mismatches []*BalanceMismatch
+	// Ids of wallet transactions which ledger entries don't sum to zero.
+	UnbalancedTransactions []uint
+	CheckedAt              time.Time
 }
@@ -1,7 +1,10 @@
 package wallet
 
 import (
+	"common/backend"
+	"common/deadletter"
 	"context"
+	"fmt"
 	in "wallet_service/internal/app/interfaces"
 	"wallet_service/internal/app/logic"
 	"wallet_service/internal/pkg/broker"
@@ -14,8 +17,11 @@ import (
 type App struct {
 	WalletsDAO            in.WalletsDAO
 	WalletTransactionsDAO in.WalletTransactionsDAO
+	WalletHoldsDAO        in.WalletHoldsDAO
+	LedgerDAO             in.LedgerDAO
 	BrokerClient          in.BrokerClient
 
+	DeadLetters    *deadletter.Queue
 	PaymentService *logic.PaymentService
 
 	Logger *logrus.Entry
@@ -24,6 +30,17 @@ type App struct {
 
 func NewWalletApp(ctx context.Context) *App {
 	config := conf.New()
+
+	brokerClient, err := newBrokerClient(config)
+	if err != nil {
+		panic(err)
+	}
+
+	return NewWalletAppWithBroker(ctx, config, brokerClient)
+}
+
+// Builds app around given broker client, used to run services in one process.
+func NewWalletAppWithBroker(ctx context.Context, config *conf.Config, brokerClient in.BrokerClient) *App {
 	logger := logrus.New()
 	// logger.SetFormatter(&logrus.JSONFormatter{})
 	logEntry := logrus.NewEntry(logger)
@@ -31,18 +48,31 @@ func NewWalletApp(ctx context.Context) *App {
 		parseLogLevel(config.Logger.LogLevel),
 	)
 
-	brokerClient, err := broker.NewKafkaClient(config)
+	appDAOs, err := newDAOs(ctx, config)
 	if err != nil {
 		panic(err)
 	}
 
-	walletsDAO := db.NewPostgresWalletsDAO(ctx, config)
-	walletTransDAO := db.NewPostgresWalletTransDAO(ctx, config)
+	walletsDAO := appDAOs.WalletsDAO
+	walletTransDAO := appDAOs.WalletTransactionsDAO
+	holdsDAO := appDAOs.WalletHoldsDAO
+	ledgerDAO := appDAOs.LedgerDAO
+
+	deadLetters := deadletter.NewQueue(
+		config.Kafka.GroupID,
+		appDAOs.DeadLettersStore,
+		brokerClient,
+		config.RetryPolicy(),
+		logEntry,
+	)
 
 	paymentService := logic.NewPaymentService(
 		walletsDAO,
 		walletTransDAO,
+		holdsDAO,
+		ledgerDAO,
 		brokerClient,
+		deadLetters,
 		logEntry,
 		config,
 	)
@@ -53,16 +83,65 @@ func NewWalletApp(ctx context.Context) *App {
 		BrokerClient:          brokerClient,
 		WalletsDAO:            walletsDAO,
 		WalletTransactionsDAO: walletTransDAO,
+		WalletHoldsDAO:        holdsDAO,
+		LedgerDAO:             ledgerDAO,
+		DeadLetters:           deadLetters,
 		PaymentService:        paymentService,
 	}
 
 	return &app
 }
 
+func newBrokerClient(config *conf.Config) (in.BrokerClient, error) {
+	switch config.Broker.Backend {
+	case backend.Kafka:
+		return broker.NewKafkaClient(config)
+	case backend.Memory:
+		return broker.NewInMemoryBrokerClient(), nil
+	default:
+		return nil, fmt.Errorf("%w: broker %q", backend.ErrUnknown, config.Broker.Backend)
+	}
+}
+
+type daos struct {
+	WalletsDAO            in.WalletsDAO
+	WalletTransactionsDAO in.WalletTransactionsDAO
+	WalletHoldsDAO        in.WalletHoldsDAO
+	LedgerDAO             in.LedgerDAO
+	DeadLettersStore      deadletter.Store
+}
+
+func newDAOs(ctx context.Context, config *conf.Config) (*daos, error) {
+	switch config.Storage.Backend {
+	case backend.Postgres:
+		return &daos{
+			WalletsDAO:            db.NewPostgresWalletsDAO(ctx, config),
+			WalletTransactionsDAO: db.NewPostgresWalletTransDAO(ctx, config),
+			WalletHoldsDAO:        db.NewPostgresHoldsDAO(ctx, config),
+			LedgerDAO:             db.NewPostgresLedgerDAO(ctx, config),
+			DeadLettersStore:      db.NewPostgresDeadLettersDAO(ctx, config),
+		}, nil
+	case backend.Memory:
+		store := db.NewInMemoryStore()
+
+		return &daos{
+			WalletsDAO:            db.NewInMemoryWalletsDAO(store),
+			WalletTransactionsDAO: db.NewInMemoryWalletTransDAO(store),
+			WalletHoldsDAO:        db.NewInMemoryHoldsDAO(store),
+			LedgerDAO:             db.NewInMemoryLedgerDAO(store),
+			DeadLettersStore:      deadletter.NewInMemoryStore(),
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: storage %q", backend.ErrUnknown, config.Storage.Backend)
+	}
+}
+
 func (app *App) Close() {
-	app.PaymentService.Close()
 	app.BrokerClient.CloseReader()
 	app.BrokerClient.CloseWriter()
 	app.WalletsDAO.Close()
 	app.WalletTransactionsDAO.Close()
+	app.WalletHoldsDAO.Close()
+	app.LedgerDAO.Close()
+	app.DeadLetters.Close()
 }
@@ -1,9 +1,10 @@
 package broker
 
 import (
+	"common/events"
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"time"
 	in "wallet_service/internal/app/interfaces"
@@ -12,13 +13,20 @@ import (
 	"github.com/segmentio/kafka-go"
 )
 
+// Producer name written to envelopes of the msgs sent by the service.
+const producer = "wallet"
+
 type KafkaClient struct {
-	NewOrdersReader      *kafka.Reader
-	RejectedOrdersReader *kafka.Reader
+	NewOrdersReader       *kafka.Reader
+	RejectedOrdersReader  *kafka.Reader
+	CompletedOrdersReader *kafka.Reader
+	ReturnedOrdersReader  *kafka.Reader
 
 	WriterFails   *kafka.Writer
 	WriterSuccess *kafka.Writer
 
+	WriterDeadLetters *kafka.Writer
+
 	brokers          []string
 	healthCheckTopic string
 }
@@ -31,6 +39,9 @@ func NewKafkaClient(config *conf.Config) (*KafkaClient, error) {
 		c.NewOrdersTopic == "" ||
 		c.RejectedOrdersTopic == "" ||
 		c.SuccessTopic == "" ||
+		c.CompletedOrdersTopic == "" ||
+		c.ReturnedOrdersTopic == "" ||
+		c.DeadLettersTopic == "" ||
 		c.GroupID == "" {
 		return nil, in.ErrInvalidBrokerConnParams
 	}
@@ -58,15 +69,34 @@ func NewKafkaClient(config *conf.Config) (*KafkaClient, error) {
 		MaxWait:  time.Duration(c.MaxWait) * time.Millisecond,
 	})
 
+	client.CompletedOrdersReader = kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  c.Brokers,
+		Topic:    c.CompletedOrdersTopic,
+		GroupID:  c.GroupID,
+		MinBytes: 10e1,
+		MaxBytes: 10e6,
+		MaxWait:  time.Duration(c.MaxWait) * time.Millisecond,
+	})
+
+	client.ReturnedOrdersReader = kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  c.Brokers,
+		Topic:    c.ReturnedOrdersTopic,
+		GroupID:  c.GroupID,
+		MinBytes: 10e1,
+		MaxBytes: 10e6,
+		MaxWait:  time.Duration(c.MaxWait) * time.Millisecond,
+	})
+
 	dialer := &kafka.Dialer{
 		Timeout:   10 * time.Second,
 		DualStack: true,
 	}
 
+	// Order msgs are keyed by order id, Hash balancer writes msgs of one order to one partition.
 	client.WriterFails = kafka.NewWriter(kafka.WriterConfig{
 		Brokers:      c.Brokers,
 		Topic:        c.RejectedOrdersTopic,
-		Balancer:     &kafka.LeastBytes{},
+		Balancer:     &kafka.Hash{},
 		Dialer:       dialer,
 		RequiredAcks: -1,
 	})
@@ -74,7 +104,15 @@ func NewKafkaClient(config *conf.Config) (*KafkaClient, error) {
 	client.WriterSuccess = kafka.NewWriter(kafka.WriterConfig{
 		Brokers:      c.Brokers,
 		Topic:        c.SuccessTopic,
-		Balancer:     &kafka.LeastBytes{},
+		Balancer:     &kafka.Hash{},
+		Dialer:       dialer,
+		RequiredAcks: -1,
+	})
+
+	client.WriterDeadLetters = kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      c.Brokers,
+		Topic:        c.DeadLettersTopic,
+		Balancer:     &kafka.Hash{},
 		Dialer:       dialer,
 		RequiredAcks: -1,
 	})
@@ -83,12 +121,13 @@ func NewKafkaClient(config *conf.Config) (*KafkaClient, error) {
 }
 
 func (c *KafkaClient) SendOrderRejectedMsg(ctx context.Context, msg *in.OrderRejectedMsg) error {
-	value, err := json.Marshal(msg)
+	value, err := events.EncodeOrderRejectedMsg(producer, msg)
 	if err != nil {
 		return err
 	}
 
 	data := kafka.Message{
+		Key:   events.OrderKey(msg.OrderID),
 		Value: value,
 	}
 
@@ -98,12 +137,13 @@ func (c *KafkaClient) SendOrderRejectedMsg(ctx context.Context, msg *in.OrderRej
 }
 
 func (c *KafkaClient) SendPurchaseSuccess(ctx context.Context, msg *in.OrderSuccessMsg) error {
-	value, err := json.Marshal(msg)
+	value, err := events.EncodeOrderSuccessMsg(producer, msg)
 	if err != nil {
 		return err
 	}
 
 	data := kafka.Message{
+		Key:   events.OrderKey(msg.OrderID),
 		Value: value,
 	}
 
@@ -112,28 +152,86 @@ func (c *KafkaClient) SendPurchaseSuccess(ctx context.Context, msg *in.OrderSucc
 	return err
 }
 
-func (c *KafkaClient) GetNewOrderMsg(ctx context.Context) (*in.NewOrderMsg, error) {
-	data, err := c.NewOrdersReader.ReadMessage(ctx)
+func (c *KafkaClient) SendCompensatedMsg(ctx context.Context, msg *in.OrderCompensatedMsg) error {
+	value, err := events.EncodeOrderCompensatedMsg(producer, msg)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var msg in.NewOrderMsg
-	err = json.Unmarshal(data.Value, &msg)
+	data := kafka.Message{
+		Key:   events.OrderKey(msg.OrderID),
+		Value: value,
+	}
+
+	return c.WriterSuccess.WriteMessages(ctx, data)
+}
 
-	return &msg, err
+func (c *KafkaClient) FetchNewOrderMsg(ctx context.Context) (*in.BrokerMsg, error) {
+	return fetch(ctx, c.NewOrdersReader)
 }
 
-func (c *KafkaClient) GetOrderRejectedMsg(ctx context.Context) (*in.OrderRejectedMsg, error) {
-	data, err := c.RejectedOrdersReader.ReadMessage(ctx)
+func (c *KafkaClient) FetchOrderRejectedMsg(ctx context.Context) (*in.BrokerMsg, error) {
+	return fetch(ctx, c.RejectedOrdersReader)
+}
+
+func (c *KafkaClient) FetchOrderCompletedMsg(ctx context.Context) (*in.BrokerMsg, error) {
+	return fetch(ctx, c.CompletedOrdersReader)
+}
+
+func (c *KafkaClient) FetchOrderReturnedMsg(ctx context.Context) (*in.BrokerMsg, error) {
+	return fetch(ctx, c.ReturnedOrdersReader)
+}
+
+// Offset of fetched msg is not committed, consumer commits it by CommitMsg after handling.
+func fetch(ctx context.Context, reader *kafka.Reader) (*in.BrokerMsg, error) {
+	data, err := reader.FetchMessage(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	var msg in.OrderRejectedMsg
-	err = json.Unmarshal(data.Value, &msg)
+	return &in.BrokerMsg{
+		Topic:     data.Topic,
+		Partition: data.Partition,
+		Offset:    data.Offset,
+		Key:       data.Key,
+		Value:     data.Value,
+	}, nil
+}
 
-	return &msg, err
+func (c *KafkaClient) CommitMsg(ctx context.Context, msg *in.BrokerMsg) error {
+	reader, err := c.reader(msg.Topic)
+	if err != nil {
+		return err
+	}
+
+	return reader.CommitMessages(ctx, kafka.Message{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+	})
+}
+
+// Offsets are committed by the group of the reader which fetched msg.
+func (c *KafkaClient) reader(topic string) (*kafka.Reader, error) {
+	for _, reader := range []*kafka.Reader{
+		c.NewOrdersReader,
+		c.RejectedOrdersReader,
+		c.CompletedOrdersReader,
+		c.ReturnedOrdersReader,
+	} {
+		if reader.Config().Topic == topic {
+			return reader, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", in.ErrUnknownTopic, topic)
+}
+
+func (c *KafkaClient) SendDeadLetter(ctx context.Context, key, value []byte) error {
+	return c.WriterDeadLetters.WriteMessages(ctx, kafka.Message{
+		Key:   key,
+		Value: value,
+	})
 }
 
 func (c *KafkaClient) CloseReader() error {
@@ -145,6 +243,14 @@ func (c *KafkaClient) CloseReader() error {
 		return err
 	}
 
+	if err := c.CompletedOrdersReader.Close(); err != nil {
+		return err
+	}
+
+	if err := c.ReturnedOrdersReader.Close(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -157,6 +263,10 @@ func (c *KafkaClient) CloseWriter() error {
 		return err
 	}
 
+	if err := c.WriterDeadLetters.Close(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
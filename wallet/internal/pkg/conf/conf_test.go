@@ -0,0 +1,27 @@
+package conf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	if _, err := Load("../../../config.yaml"); err != nil {
+		t.Fatal("load service config err", err)
+	}
+}
+
+func TestLoadHoldTTLNotExceedingSagaTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	data := []byte("holds:\n  ttl: 300\nsaga:\n  timeout: 300\n")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path); !errors.Is(err, ErrHoldTTLTooShort) {
+		t.Error("expected hold ttl error, got", err)
+	}
+}
@@ -0,0 +1,730 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	in "wallet_service/internal/app/interfaces"
+	"wallet_service/internal/app/ledger"
+	"wallet_service/internal/app/models"
+)
+
+// ------------------------------InMemoryStore------------------------------
+
+// Tables shared by in-memory DAOs. Every DAO method holds the store lock
+// for its whole run and validates before changing anything,
+// so it is applied atomically like a db transaction.
+type InMemoryStore struct {
+	wallets        map[uint]*models.Wallet
+	transactions   []*models.WalletTransaction
+	holds          map[uint]*models.WalletHold
+	ledgerEntries  []*inMemoryLedgerEntry
+	processedMsgs  map[string]struct{}
+	processedSteps map[inMemoryStep]struct{}
+	topUpKeys      map[string]*models.WalletTransaction
+	rejectedOrders map[uint]struct{}
+	lastHoldID     uint
+	mu             sync.RWMutex
+}
+
+type inMemoryStep struct {
+	orderID uint
+	step    models.TransactionType
+}
+
+type inMemoryLedgerEntry struct {
+	transactionID uint
+	account       string
+	amount        models.Money
+}
+
+// Seeds the same wallets as migrations do, their balances are posted as opening top-ups.
+func NewInMemoryStore() *InMemoryStore {
+	store := &InMemoryStore{
+		wallets:        make(map[uint]*models.Wallet),
+		holds:          make(map[uint]*models.WalletHold),
+		processedMsgs:  make(map[string]struct{}),
+		processedSteps: make(map[inMemoryStep]struct{}),
+		topUpKeys:      make(map[string]*models.WalletTransaction),
+		rejectedOrders: make(map[uint]struct{}),
+	}
+
+	for id := uint(1); id <= 3; id++ {
+		store.wallets[id] = &models.Wallet{ID: id, UserID: id}
+
+		store.topUp(&in.TopUpWalletDTO{
+			WalletID:       id,
+			Amount:         10000,
+			IdempotencyKey: fmt.Sprintf("opening_balance:%d", id),
+		})
+	}
+
+	return store
+}
+
+// Saves msg to inbox, ErrMsgAlreadyProcessed is returned for the msg id or order step seen before.
+// Refunds are unique by msg id only, order may have several of them.
+func (s *InMemoryStore) createProcessedMsg(messageID string, orderID uint, step models.TransactionType) error {
+	key := inMemoryStep{orderID: orderID, step: step}
+
+	if _, exists := s.processedMsgs[messageID]; exists && messageID != "" {
+		return in.ErrMsgAlreadyProcessed
+	}
+
+	if _, exists := s.processedSteps[key]; exists && step != models.Refund {
+		return in.ErrMsgAlreadyProcessed
+	}
+
+	if messageID != "" {
+		s.processedMsgs[messageID] = struct{}{}
+	}
+
+	if step != models.Refund {
+		s.processedSteps[key] = struct{}{}
+	}
+
+	return nil
+}
+
+// Inbox check without saving, for methods which may still fail after it.
+func (s *InMemoryStore) checkProcessedMsg(messageID string, orderID uint, step models.TransactionType) error {
+	if _, exists := s.processedMsgs[messageID]; exists && messageID != "" {
+		return in.ErrMsgAlreadyProcessed
+	}
+
+	if _, exists := s.processedSteps[inMemoryStep{orderID: orderID, step: step}]; exists && step != models.Refund {
+		return in.ErrMsgAlreadyProcessed
+	}
+
+	return nil
+}
+
+func (s *InMemoryStore) createTransaction(data *in.CreateWalletTransactionDTO) *models.WalletTransaction {
+	trans := &models.WalletTransaction{
+		ID:        uint(len(s.transactions)) + 1,
+		WalletID:  data.WalletID,
+		OrderID:   data.OrderID,
+		Cost:      data.Cost,
+		Type:      data.Type,
+		CreatedAt: time.Now(),
+	}
+
+	s.transactions = append(s.transactions, trans)
+
+	transCopy := *trans
+
+	return &transCopy
+}
+
+// Records balanced ledger entries of wallet transaction.
+func (s *InMemoryStore) postLedgerEntries(trans *models.WalletTransaction) error {
+	if trans.Cost == 0 {
+		return nil
+	}
+
+	postings, err := ledger.Postings(trans.WalletID, trans.Type, trans.Cost)
+	if err != nil {
+		return err
+	}
+
+	if len(postings) == 0 {
+		return nil
+	}
+
+	if err := ledger.Balanced(postings); err != nil {
+		return err
+	}
+
+	for _, v := range postings {
+		s.ledgerEntries = append(s.ledgerEntries, &inMemoryLedgerEntry{
+			transactionID: trans.ID,
+			account:       v.Account,
+			amount:        v.Amount,
+		})
+	}
+
+	return nil
+}
+
+func (s *InMemoryStore) accountBalance(account string) models.Money {
+	var balance models.Money
+
+	for _, v := range s.ledgerEntries {
+		if v.account == account {
+			balance += v.amount
+		}
+	}
+
+	return balance
+}
+
+func (s *InMemoryStore) topUp(data *in.TopUpWalletDTO) *models.WalletTransaction {
+	trans := s.createTransaction(&in.CreateWalletTransactionDTO{
+		WalletID: data.WalletID,
+		Cost:     data.Amount,
+		Type:     models.TopUp,
+	})
+
+	s.wallets[data.WalletID].Balance += data.Amount
+	s.topUpKeys[data.IdempotencyKey] = trans
+
+	// Top-up postings are always balanced.
+	_ = s.postLedgerEntries(trans)
+
+	return trans
+}
+
+// Refunds of the order can't exceed its payment.
+func (s *InMemoryStore) checkRefundable(data *in.CreateWalletTransactionDTO) error {
+	var refundable models.Money
+
+	for _, v := range s.transactions {
+		if v.OrderID != data.OrderID {
+			continue
+		}
+
+		switch v.Type {
+		case models.Purchase, models.Capture:
+			refundable += v.Cost
+		case models.Cancelation, models.Refund:
+			refundable -= v.Cost
+		}
+	}
+
+	if data.Cost > refundable {
+		return fmt.Errorf("%w: refund %s, refundable %s", in.ErrRefundExceedsPayment, data.Cost, refundable)
+	}
+
+	return nil
+}
+
+func (s *InMemoryStore) holdByOrderID(orderID uint) (*models.WalletHold, error) {
+	for _, hold := range s.holds {
+		if hold.OrderID == orderID {
+			return hold, nil
+		}
+	}
+
+	return nil, in.ErrHoldNotFound
+}
+
+// Hold is changed in place, callers get its copy.
+func (s *InMemoryStore) releaseHold(hold *models.WalletHold, status models.HoldStatus) error {
+	if hold.Status != models.HoldActive {
+		return in.ErrHoldNotActive
+	}
+
+	s.wallets[hold.WalletID].Held -= hold.Amount
+	hold.Status = status
+
+	s.createTransaction(&in.CreateWalletTransactionDTO{
+		WalletID: hold.WalletID,
+		OrderID:  hold.OrderID,
+		Cost:     hold.Amount,
+		Type:     models.Release,
+	})
+
+	return nil
+}
+
+// ------------------------------WalletsDAO------------------------------
+
+type InMemoryWalletsDAO struct {
+	store *InMemoryStore
+}
+
+func (dao *InMemoryWalletsDAO) GetByUserID(ctx context.Context, userID uint) (*models.Wallet, error) {
+	dao.store.mu.RLock()
+	defer dao.store.mu.RUnlock()
+
+	for _, wallet := range dao.store.wallets {
+		if wallet.UserID == userID {
+			walletCopy := *wallet
+
+			return &walletCopy, nil
+		}
+	}
+
+	return nil, in.ErrWalletNotFound
+}
+
+// Top-up is idempotent by the client key like the Postgres one.
+func (dao *InMemoryWalletsDAO) TopUp(
+	ctx context.Context,
+	data *in.TopUpWalletDTO,
+) (*models.WalletTransaction, error) {
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	wallet, exists := dao.store.wallets[data.WalletID]
+	if !exists {
+		return nil, in.ErrWalletNotFound
+	}
+
+	trans, replayed := dao.store.topUpKeys[data.IdempotencyKey]
+	if replayed && (trans.WalletID != data.WalletID || trans.Cost != data.Amount) {
+		return nil, in.ErrIdempotencyKeyReused
+	}
+
+	if !replayed {
+		trans = dao.store.topUp(data)
+	}
+
+	transCopy := *trans
+	walletCopy := *wallet
+	transCopy.Wallet = &walletCopy
+
+	return &transCopy, nil
+}
+
+func (dao *InMemoryWalletsDAO) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+func (dao *InMemoryWalletsDAO) Close() {
+}
+
+func NewInMemoryWalletsDAO(store *InMemoryStore) *InMemoryWalletsDAO {
+	return &InMemoryWalletsDAO{
+		store: store,
+	}
+}
+
+// ------------------------------TransactionsDAO------------------------------
+
+type InMemoryTransactionsDAO struct {
+	store *InMemoryStore
+}
+
+func (dao *InMemoryTransactionsDAO) GetByOrderID(ctx context.Context, orderID uint) (*models.WalletTransaction, error) {
+	dao.store.mu.RLock()
+	defer dao.store.mu.RUnlock()
+
+	for _, trans := range dao.store.transactions {
+		if trans.OrderID == orderID {
+			transCopy := *trans
+
+			return &transCopy, nil
+		}
+	}
+
+	return nil, in.ErrTransNotFound
+}
+
+// Wallet transactions page, newest first.
+func (dao *InMemoryTransactionsDAO) GetList(
+	ctx context.Context,
+	filter *in.TransactionsFilterDTO,
+) ([]*models.WalletTransaction, error) {
+	dao.store.mu.RLock()
+	defer dao.store.mu.RUnlock()
+
+	transactions := make([]*models.WalletTransaction, 0, filter.Limit)
+
+	for i := len(dao.store.transactions) - 1; i >= 0; i-- {
+		trans := dao.store.transactions[i]
+
+		switch {
+		case trans.WalletID != filter.WalletID,
+			filter.Type != nil && trans.Type != *filter.Type,
+			filter.From != nil && trans.CreatedAt.Before(*filter.From),
+			filter.To != nil && !trans.CreatedAt.Before(*filter.To):
+			continue
+		}
+
+		transCopy := *trans
+		transactions = append(transactions, &transCopy)
+	}
+
+	if uint(len(transactions)) <= filter.Offset {
+		return transactions[:0], nil
+	}
+
+	transactions = transactions[filter.Offset:]
+	if uint(len(transactions)) > filter.Limit {
+		transactions = transactions[:filter.Limit]
+	}
+
+	return transactions, nil
+}
+
+func (dao *InMemoryTransactionsDAO) Create(
+	ctx context.Context,
+	data *in.CreateWalletTransactionDTO,
+) (*models.WalletTransaction, error) {
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	return dao.store.createTransaction(data), nil
+}
+
+// Same checks as the Postgres one: inbox, refundable amount and available balance for purchase.
+func (dao *InMemoryTransactionsDAO) ApplyTransaction(
+	ctx context.Context,
+	data *in.CreateWalletTransactionDTO,
+) (*models.WalletTransaction, error) {
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	wallet, exists := dao.store.wallets[data.WalletID]
+	if !exists {
+		return nil, in.ErrWalletNotFound
+	}
+
+	if err := dao.store.checkProcessedMsg(data.MessageID, data.OrderID, data.Type); err != nil {
+		return nil, err
+	}
+
+	if data.Type == models.Refund {
+		if err := dao.store.checkRefundable(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if data.Type == models.Purchase && wallet.Available() < data.Cost {
+		return nil, in.ErrNotEnoughMoney
+	}
+
+	if _, err := ledger.Postings(data.WalletID, data.Type, data.Cost); err != nil {
+		return nil, err
+	}
+
+	if err := dao.store.createProcessedMsg(data.MessageID, data.OrderID, data.Type); err != nil {
+		return nil, err
+	}
+
+	trans := dao.store.createTransaction(data)
+
+	if data.Type == models.Purchase {
+		wallet.Balance -= data.Cost
+	} else {
+		wallet.Balance += data.Cost
+	}
+
+	if err := dao.store.postLedgerEntries(trans); err != nil {
+		return nil, err
+	}
+
+	return trans, nil
+}
+
+func (dao *InMemoryTransactionsDAO) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+func (dao *InMemoryTransactionsDAO) Close() {
+}
+
+func NewInMemoryWalletTransDAO(store *InMemoryStore) *InMemoryTransactionsDAO {
+	return &InMemoryTransactionsDAO{
+		store: store,
+	}
+}
+
+// ------------------------------WalletHoldsDAO------------------------------
+
+type InMemoryHoldsDAO struct {
+	store *InMemoryStore
+}
+
+func (dao *InMemoryHoldsDAO) GetByOrderID(ctx context.Context, orderID uint) (*models.WalletHold, error) {
+	dao.store.mu.RLock()
+	defer dao.store.mu.RUnlock()
+
+	hold, err := dao.store.holdByOrderID(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	holdCopy := *hold
+
+	return &holdCopy, nil
+}
+
+// Active holds which expired before now, oldest first.
+func (dao *InMemoryHoldsDAO) GetListExpired(
+	ctx context.Context,
+	now time.Time,
+	limit uint16,
+) ([]*models.WalletHold, error) {
+	dao.store.mu.RLock()
+	defer dao.store.mu.RUnlock()
+
+	holds := make([]*models.WalletHold, 0, limit)
+
+	for _, hold := range dao.store.holds {
+		if hold.Status == models.HoldActive && hold.ExpiresAt.Before(now) {
+			holdCopy := *hold
+			holds = append(holds, &holdCopy)
+		}
+	}
+
+	sort.Slice(holds, func(i, j int) bool {
+		return holds[i].ExpiresAt.Before(holds[j].ExpiresAt)
+	})
+
+	if len(holds) > int(limit) {
+		holds = holds[:limit]
+	}
+
+	return holds, nil
+}
+
+// Holds order amount on wallet, ErrNotEnoughMoney is returned when available balance is short.
+func (dao *InMemoryHoldsDAO) Place(ctx context.Context, data *in.PlaceHoldDTO) (*models.WalletHold, error) {
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	wallet, exists := dao.store.wallets[data.WalletID]
+	if !exists {
+		return nil, in.ErrWalletNotFound
+	}
+
+	if err := dao.store.checkProcessedMsg(data.MessageID, data.OrderID, models.Hold); err != nil {
+		return nil, err
+	}
+
+	if _, rejected := dao.store.rejectedOrders[data.OrderID]; rejected {
+		return nil, in.ErrOrderRejected
+	}
+
+	if _, err := dao.store.holdByOrderID(data.OrderID); err == nil {
+		return nil, in.ErrMsgAlreadyProcessed
+	}
+
+	if wallet.Available() < data.Amount {
+		return nil, in.ErrNotEnoughMoney
+	}
+
+	if err := dao.store.createProcessedMsg(data.MessageID, data.OrderID, models.Hold); err != nil {
+		return nil, err
+	}
+
+	dao.store.lastHoldID++
+
+	hold := &models.WalletHold{
+		ID:        dao.store.lastHoldID,
+		WalletID:  data.WalletID,
+		OrderID:   data.OrderID,
+		Amount:    data.Amount,
+		Status:    models.HoldActive,
+		ExpiresAt: data.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	dao.store.holds[hold.ID] = hold
+	wallet.Held += data.Amount
+
+	dao.store.createTransaction(&in.CreateWalletTransactionDTO{
+		WalletID: data.WalletID,
+		OrderID:  data.OrderID,
+		Cost:     data.Amount,
+		Type:     models.Hold,
+	})
+
+	holdCopy := *hold
+
+	return &holdCopy, nil
+}
+
+// Debits held amount from wallet, expired hold is captured only if available balance still covers it.
+func (dao *InMemoryHoldsDAO) Capture(ctx context.Context, data *in.SettleHoldDTO) (*models.WalletHold, error) {
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	if err := dao.store.checkProcessedMsg(data.MessageID, data.OrderID, models.Capture); err != nil {
+		return nil, err
+	}
+
+	hold, err := dao.store.holdByOrderID(data.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet := dao.store.wallets[hold.WalletID]
+
+	switch hold.Status {
+	case models.HoldActive:
+	case models.HoldExpired:
+		if wallet.Available() < hold.Amount {
+			return nil, in.ErrNotEnoughMoney
+		}
+	default:
+		return nil, in.ErrHoldNotActive
+	}
+
+	if err := dao.store.createProcessedMsg(data.MessageID, data.OrderID, models.Capture); err != nil {
+		return nil, err
+	}
+
+	if hold.Status == models.HoldActive {
+		wallet.Held -= hold.Amount
+	}
+
+	wallet.Balance -= hold.Amount
+	hold.Status = models.HoldCaptured
+
+	trans := dao.store.createTransaction(&in.CreateWalletTransactionDTO{
+		WalletID: hold.WalletID,
+		OrderID:  hold.OrderID,
+		Cost:     hold.Amount,
+		Type:     models.Capture,
+	})
+
+	if err := dao.store.postLedgerEntries(trans); err != nil {
+		return nil, err
+	}
+
+	holdCopy := *hold
+
+	return &holdCopy, nil
+}
+
+// Returns held amount to available balance of the wallet.
+func (dao *InMemoryHoldsDAO) Release(ctx context.Context, data *in.SettleHoldDTO) (*models.WalletHold, error) {
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	if err := dao.store.checkProcessedMsg(data.MessageID, data.OrderID, models.Release); err != nil {
+		return nil, err
+	}
+
+	hold, err := dao.store.holdByOrderID(data.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if hold.Status != models.HoldActive {
+		return nil, in.ErrHoldNotActive
+	}
+
+	if err := dao.store.createProcessedMsg(data.MessageID, data.OrderID, models.Release); err != nil {
+		return nil, err
+	}
+
+	if err := dao.store.releaseHold(hold, models.HoldReleased); err != nil {
+		return nil, err
+	}
+
+	holdCopy := *hold
+
+	return &holdCopy, nil
+}
+
+// Later holds of the order are refused with ErrOrderRejected.
+func (dao *InMemoryHoldsDAO) MarkOrderRejected(ctx context.Context, orderID uint) error {
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	dao.store.rejectedOrders[orderID] = struct{}{}
+
+	return nil
+}
+
+// Releases hold not settled in time.
+func (dao *InMemoryHoldsDAO) Expire(ctx context.Context, holdID uint) (*models.WalletHold, error) {
+	dao.store.mu.Lock()
+	defer dao.store.mu.Unlock()
+
+	hold, exists := dao.store.holds[holdID]
+	if !exists {
+		return nil, in.ErrHoldNotFound
+	}
+
+	if err := dao.store.releaseHold(hold, models.HoldExpired); err != nil {
+		return nil, err
+	}
+
+	holdCopy := *hold
+
+	return &holdCopy, nil
+}
+
+func (dao *InMemoryHoldsDAO) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+func (dao *InMemoryHoldsDAO) Close() {
+}
+
+func NewInMemoryHoldsDAO(store *InMemoryStore) *InMemoryHoldsDAO {
+	return &InMemoryHoldsDAO{
+		store: store,
+	}
+}
+
+// ------------------------------LedgerDAO------------------------------
+
+type InMemoryLedgerDAO struct {
+	store *InMemoryStore
+}
+
+func (dao *InMemoryLedgerDAO) GetBalanceMismatches(ctx context.Context) ([]*models.BalanceMismatch, error) {
+	dao.store.mu.RLock()
+	defer dao.store.mu.RUnlock()
+
+	mismatches := make([]*models.BalanceMismatch, 0)
+
+	for _, wallet := range dao.store.wallets {
+		ledgerBalance := dao.store.accountBalance(ledger.WalletAccount(wallet.ID))
+		if ledgerBalance == wallet.Balance {
+			continue
+		}
+
+		mismatches = append(mismatches, &models.BalanceMismatch{
+			WalletID:      wallet.ID,
+			UserID:        wallet.UserID,
+			Balance:       wallet.Balance,
+			LedgerBalance: ledgerBalance,
+		})
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].WalletID < mismatches[j].WalletID
+	})
+
+	return mismatches, nil
+}
+
+// Holds and releases move no money and are skipped.
+func (dao *InMemoryLedgerDAO) GetUnbalancedTransactions(ctx context.Context) ([]uint, error) {
+	dao.store.mu.RLock()
+	defer dao.store.mu.RUnlock()
+
+	counts := make(map[uint]int)
+	sums := make(map[uint]models.Money)
+
+	for _, v := range dao.store.ledgerEntries {
+		counts[v.transactionID]++
+		sums[v.transactionID] += v.amount
+	}
+
+	ids := make([]uint, 0)
+
+	for _, trans := range dao.store.transactions {
+		if trans.Type == models.Hold || trans.Type == models.Release {
+			continue
+		}
+
+		if counts[trans.ID] < 2 || sums[trans.ID] != 0 {
+			ids = append(ids, trans.ID)
+		}
+	}
+
+	return ids, nil
+}
+
+func (dao *InMemoryLedgerDAO) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+func (dao *InMemoryLedgerDAO) Close() {
+}
+
+func NewInMemoryLedgerDAO(store *InMemoryStore) *InMemoryLedgerDAO {
+	return &InMemoryLedgerDAO{
+		store: store,
+	}
+}
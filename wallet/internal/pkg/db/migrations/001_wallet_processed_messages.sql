@@ -0,0 +1,12 @@
+-- Steps which may repeat for an order (returns) are marked repeatable and deduplicated by message id only.
+CREATE TABLE IF NOT EXISTS wallet_processed_messages (
+  id SERIAL PRIMARY KEY,
+  message_id varchar(255) UNIQUE,
+  order_id bigint NOT NULL,
+  step smallint NOT NULL,
+  repeatable boolean NOT NULL DEFAULT false,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS wallet_processed_messages_order_id_step_idx
+  ON wallet_processed_messages (order_id, step) WHERE NOT repeatable;
@@ -0,0 +1,2 @@
+ALTER TABLE wallets ALTER COLUMN balance TYPE numeric(12, 2);
+ALTER TABLE wallet_transactions ALTER COLUMN cost TYPE numeric(12, 2);
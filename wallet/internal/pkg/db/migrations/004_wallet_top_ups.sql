@@ -0,0 +1,4 @@
+ALTER TABLE wallet_transactions ADD COLUMN IF NOT EXISTS idempotency_key varchar(255) UNIQUE;
+
+CREATE INDEX IF NOT EXISTS wallet_transactions_wallet_id_created_at_idx
+  ON wallet_transactions (wallet_id, created_at DESC, id DESC);
@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+  id SERIAL PRIMARY KEY,
+  code varchar(255) NOT NULL UNIQUE,
+  type smallint NOT NULL,
+  wallet_id bigint UNIQUE REFERENCES wallets ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+  id BIGSERIAL PRIMARY KEY,
+  transaction_id bigint NOT NULL REFERENCES wallet_transactions ON DELETE RESTRICT,
+  account_id bigint NOT NULL REFERENCES ledger_accounts ON DELETE RESTRICT,
+  amount numeric(12, 2) NOT NULL CHECK (amount <> 0),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ledger_entries_account_id_idx ON ledger_entries (account_id);
+CREATE INDEX IF NOT EXISTS ledger_entries_transaction_id_idx ON ledger_entries (transaction_id);
+
+INSERT INTO ledger_accounts(code, type)
+VALUES ('merchant_revenue', 1), ('top_up_source', 2)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO ledger_accounts(code, type, wallet_id)
+SELECT 'wallet:' || id, 0, id FROM wallets
+ON CONFLICT DO NOTHING;
+
+-- Balances accumulated before the ledger are posted as opening top-ups.
+WITH opening AS (
+  INSERT INTO wallet_transactions(wallet_id, cost, type, idempotency_key)
+  SELECT id, balance, 2, 'opening_balance:' || id FROM wallets WHERE balance > 0
+  ON CONFLICT (idempotency_key) DO NOTHING
+  RETURNING id, wallet_id, cost
+)
+INSERT INTO ledger_entries(transaction_id, account_id, amount)
+SELECT o.id, a.id, o.cost
+FROM opening o JOIN ledger_accounts a ON a.wallet_id=o.wallet_id
+UNION ALL
+SELECT o.id, a.id, -o.cost
+FROM opening o JOIN ledger_accounts a ON a.code='top_up_source';
@@ -0,0 +1,16 @@
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS held numeric(12, 2) NOT NULL DEFAULT 0;
+ALTER TABLE wallets ADD CONSTRAINT wallets_held_within_balance CHECK (held >= 0 AND held <= balance);
+
+CREATE TABLE IF NOT EXISTS wallet_holds (
+  id SERIAL PRIMARY KEY,
+  wallet_id bigint NOT NULL REFERENCES wallets ON DELETE RESTRICT,
+  order_id bigint NOT NULL UNIQUE,
+  amount numeric(12, 2) NOT NULL CHECK (amount >= 0),
+  status smallint NOT NULL DEFAULT 0,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS wallet_holds_active_expires_at_idx
+  ON wallet_holds (expires_at) WHERE status = 0;
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS wallet_rejected_orders (
+  order_id bigint PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
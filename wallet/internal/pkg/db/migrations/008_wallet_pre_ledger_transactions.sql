@@ -0,0 +1,8 @@
+-- Transactions made before the ledger have no entries and are skipped by reconciliation.
+-- They are those without entries and with no ledger entries of earlier transactions,
+-- since the ledger migration posted opening balances after all of them.
+ALTER TABLE wallet_transactions ADD COLUMN IF NOT EXISTS pre_ledger boolean NOT NULL DEFAULT false;
+
+UPDATE wallet_transactions t SET pre_ledger=true
+WHERE NOT EXISTS (SELECT 1 FROM ledger_entries e WHERE e.transaction_id=t.id)
+  AND NOT EXISTS (SELECT 1 FROM ledger_entries e WHERE e.transaction_id < t.id);
@@ -1,9 +1,14 @@
 package db
 
 import (
+	"common/deadletter"
+	"common/pg"
 	"context"
 	"errors"
+	"fmt"
+	"time"
 	in "wallet_service/internal/app/interfaces"
+	"wallet_service/internal/app/ledger"
 	"wallet_service/internal/app/models"
 	"wallet_service/internal/pkg/conf"
 
@@ -11,7 +16,35 @@ import (
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-var migrationsApplied bool
+const migrationsDir = "./internal/pkg/db/migrations"
+
+// Statements used by every DAO which changes wallet balance.
+var sharedQueriesMap = map[string]string{
+	"create_transaction": `INSERT INTO wallet_transactions(wallet_id, order_id, cost, type) 
+		VALUES ($1::bigint, $2::bigint, $3::decimal, $4::smallint)
+		RETURNING id, wallet_id, order_id, cost, type;`,
+	"create_processed_msg": `INSERT INTO wallet_processed_messages(message_id, order_id, step, repeatable)
+		VALUES (NULLIF($1::varchar, ''), $2::bigint, $3::smallint, $4::boolean)
+		ON CONFLICT DO NOTHING
+		RETURNING id;`,
+	"debit_wallet": `UPDATE wallets SET balance=balance - $1::decimal
+		WHERE id=$2::bigint AND balance - held >= $1::decimal
+		RETURNING balance;`,
+	"ensure_wallet_ledger_account": `INSERT INTO ledger_accounts(code, type, wallet_id)
+		VALUES ($1::varchar, $2::smallint, $3::bigint)
+		ON CONFLICT (code) DO NOTHING;`,
+	"create_ledger_entry": `INSERT INTO ledger_entries(transaction_id, account_id, amount)
+		SELECT $1::bigint, id, $3::decimal FROM ledger_accounts WHERE code=$2::varchar
+		RETURNING id;`,
+}
+
+func withSharedQueries(queriesMap map[string]string) map[string]string {
+	for k, v := range sharedQueriesMap {
+		queriesMap[k] = v
+	}
+
+	return queriesMap
+}
 
 // ------------------------------WalletsDAO------------------------------
 
@@ -27,20 +60,104 @@ func (dao *PostgresWalletsDAO) GetByUserID(ctx context.Context, userID uint) (*m
 		&wallet.ID,
 		&wallet.UserID,
 		&wallet.Balance,
+		&wallet.Held,
 	)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, in.ErrWalletNotFound
+	}
+
 	return &wallet, err
 }
 
-func (dao *PostgresWalletsDAO) UpdateBalance(ctx context.Context, wallet *models.Wallet) (*models.Wallet, error) {
-	var updatedWallet models.Wallet
-	err := dao.db.QueryRow(ctx, "update_wallet", wallet.Balance, wallet.ID).Scan(
-		&updatedWallet.ID,
-		&updatedWallet.UserID,
-		&updatedWallet.Balance,
+// Credits wallet and records top-up transaction in one db transaction.
+// Top-up is idempotent by the client key: repeated request returns transaction
+// created by the first one with the current wallet state, key reused for
+// another wallet or amount gives ErrIdempotencyKeyReused.
+func (dao *PostgresWalletsDAO) TopUp(
+	ctx context.Context,
+	data *in.TopUpWalletDTO,
+) (*models.WalletTransaction, error) {
+	tx, err := dao.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	var trans models.WalletTransaction
+
+	err = tx.QueryRow(
+		ctx,
+		"create_top_up_transaction",
+		data.WalletID,
+		data.Amount,
+		models.TopUp,
+		data.IdempotencyKey,
+	).Scan(
+		&trans.ID,
+		&trans.WalletID,
+		&trans.OrderID,
+		&trans.Cost,
+		&trans.Type,
+		&trans.CreatedAt,
+	)
+
+	replayed := errors.Is(err, pgx.ErrNoRows)
+	if replayed {
+		err = tx.QueryRow(ctx, "get_transaction_by_idempotency_key", data.IdempotencyKey).Scan(
+			&trans.ID,
+			&trans.WalletID,
+			&trans.OrderID,
+			&trans.Cost,
+			&trans.Type,
+			&trans.CreatedAt,
+		)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if replayed && (trans.WalletID != data.WalletID || trans.Cost != data.Amount || trans.Type != models.TopUp) {
+		return nil, in.ErrIdempotencyKeyReused
+	}
+
+	var row pgx.Row
+	if replayed {
+		row = tx.QueryRow(ctx, "get_wallet_by_id", data.WalletID)
+	} else {
+		row = tx.QueryRow(ctx, "top_up_wallet", data.WalletID, data.Amount)
+	}
+
+	var wallet models.Wallet
+
+	err = row.Scan(
+		&wallet.ID,
+		&wallet.UserID,
+		&wallet.Balance,
+		&wallet.Held,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, in.ErrWalletNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !replayed {
+		if err := postLedgerEntries(ctx, tx, &trans); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
 
-	return &updatedWallet, err
+	trans.Wallet = &wallet
+
+	return &trans, nil
 }
 
 func (dao *PostgresWalletsDAO) HealthCheck(ctx context.Context) error {
@@ -52,30 +169,29 @@ func (dao *PostgresWalletsDAO) HealthCheck(ctx context.Context) error {
 }
 
 func (dao *PostgresWalletsDAO) Close() {
-	dao.db.Close()
+	pg.Release(dao.db)
 }
 
 func NewPostgresWalletsDAO(ctx context.Context, config *conf.Config) *PostgresWalletsDAO {
-	dbConn := GetPostgresConnection(ctx, config.WalletDatabaseURI())
-
-	if !migrationsApplied {
-		err := Migrate(ctx, dbConn)
-		if err != nil {
-			panic(err)
-		}
-	}
-
-	defer func() { migrationsApplied = true }()
+	dbConn := pg.MustOpen(ctx, config.WalletDatabaseURI(), migrationsDir)
 
 	queriesMap := map[string]string{
-		"get_wallet_by_user_id": `SELECT id, user_id, balance 
+		"get_wallet_by_user_id": `SELECT id, user_id, balance, held
 			FROM wallets WHERE user_id=$1::bigint;`,
-		"update_wallet": `UPDATE wallets SET balance=$1::decimal
-			WHERE id=$2::bigint
-			RETURNING id, user_id, balance;`,
+		"get_wallet_by_id": `SELECT id, user_id, balance, held
+			FROM wallets WHERE id=$1::bigint;`,
+		"top_up_wallet": `UPDATE wallets SET balance=balance + $2::decimal
+			WHERE id=$1::bigint
+			RETURNING id, user_id, balance, held;`,
+		"create_top_up_transaction": `INSERT INTO wallet_transactions(wallet_id, cost, type, idempotency_key)
+			VALUES ($1::bigint, $2::decimal, $3::smallint, $4::varchar)
+			ON CONFLICT (idempotency_key) DO NOTHING
+			RETURNING id, wallet_id, COALESCE(order_id, 0), cost, type, created_at;`,
+		"get_transaction_by_idempotency_key": `SELECT id, wallet_id, COALESCE(order_id, 0), cost, type, created_at
+			FROM wallet_transactions WHERE idempotency_key=$1::varchar;`,
 	}
 
-	submitPreparedStatements(ctx, queriesMap, dbConn)
+	pg.MustPrepare(ctx, dbConn, withSharedQueries(queriesMap))
 
 	return &PostgresWalletsDAO{
 		db:           dbConn,
@@ -108,6 +224,49 @@ func (dao *PostgresTransactionsDAO) GetByOrderID(ctx context.Context, orderID ui
 	return &trans, err
 }
 
+// Wallet transactions page, newest first.
+func (dao *PostgresTransactionsDAO) GetList(
+	ctx context.Context,
+	filter *in.TransactionsFilterDTO,
+) ([]*models.WalletTransaction, error) {
+	rows, err := dao.db.Query(
+		ctx,
+		"transactions_list",
+		filter.WalletID,
+		filter.Type,
+		filter.From,
+		filter.To,
+		filter.Limit,
+		filter.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := make([]*models.WalletTransaction, 0, filter.Limit)
+
+	for rows.Next() {
+		var trans models.WalletTransaction
+
+		err := rows.Scan(
+			&trans.ID,
+			&trans.WalletID,
+			&trans.OrderID,
+			&trans.Cost,
+			&trans.Type,
+			&trans.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		transactions = append(transactions, &trans)
+	}
+
+	return transactions, rows.Err()
+}
+
 func (dao *PostgresTransactionsDAO) Create(
 	ctx context.Context,
 	data *in.CreateWalletTransactionDTO,
@@ -131,42 +290,705 @@ func (dao *PostgresTransactionsDAO) Create(
 	return &trans, err
 }
 
-func (dao *PostgresTransactionsDAO) HealthCheck(ctx context.Context) error {
-	if err := dao.db.Ping(ctx); err != nil {
+// Debits wallet for purchase and credits it for cancelation.
+// Debit is conditional on the available balance, so money check is decided by db
+// against the current balance instead of the one read before.
+func changeBalance(ctx context.Context, tx pgx.Tx, data *in.CreateWalletTransactionDTO) error {
+	if data.Type != models.Purchase {
+		_, err := tx.Exec(ctx, "credit_wallet", data.Cost, data.WalletID)
+
 		return err
 	}
 
+	var balance models.Money
+
+	err := tx.QueryRow(ctx, "debit_wallet", data.Cost, data.WalletID).Scan(&balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return in.ErrNotEnoughMoney
+	}
+
+	return err
+}
+
+// Records balanced ledger entries of wallet transaction,
+// should be called in the db transaction which changes wallet balance.
+func postLedgerEntries(ctx context.Context, tx pgx.Tx, trans *models.WalletTransaction) error {
+	if trans.Cost == 0 {
+		return nil
+	}
+
+	postings, err := ledger.Postings(trans.WalletID, trans.Type, trans.Cost)
+	if err != nil {
+		return err
+	}
+
+	if len(postings) == 0 {
+		return nil
+	}
+
+	if err := ledger.Balanced(postings); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		"ensure_wallet_ledger_account",
+		ledger.WalletAccount(trans.WalletID),
+		models.WalletAccount,
+		trans.WalletID,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range postings {
+		var entryID uint
+
+		err := tx.QueryRow(ctx, "create_ledger_entry", trans.ID, v.Account, v.Amount).Scan(&entryID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: %s", in.ErrLedgerAccountNotFound, v.Account)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (dao *PostgresTransactionsDAO) Close() {
-	dao.db.Close()
+// Saves msg to inbox, ErrMsgAlreadyProcessed is returned for the msg id or order step seen before.
+// Refunds are repeatable steps, unique by msg id only.
+func createProcessedMsg(
+	ctx context.Context,
+	tx pgx.Tx,
+	messageID string,
+	orderID uint,
+	step models.TransactionType,
+) error {
+	var msgID uint
+
+	err := tx.QueryRow(ctx, "create_processed_msg", messageID, orderID, step, step == models.Refund).Scan(&msgID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return in.ErrMsgAlreadyProcessed
+	}
+
+	return err
 }
 
-func NewPostgresWalletTransDAO(ctx context.Context, config *conf.Config) *PostgresTransactionsDAO {
-	dbConn := GetPostgresConnection(ctx, config.WalletDatabaseURI())
+func createTransaction(
+	ctx context.Context,
+	tx pgx.Tx,
+	data *in.CreateWalletTransactionDTO,
+) (*models.WalletTransaction, error) {
+	var trans models.WalletTransaction
 
-	if !migrationsApplied {
-		err := Migrate(ctx, dbConn)
-		if err != nil {
-			panic(err)
+	err := tx.QueryRow(
+		ctx,
+		"create_transaction",
+		data.WalletID,
+		data.OrderID,
+		data.Cost,
+		data.Type,
+	).Scan(
+		&trans.ID,
+		&trans.WalletID,
+		&trans.OrderID,
+		&trans.Cost,
+		&trans.Type,
+	)
+
+	return &trans, err
+}
+
+// Creates transaction and changes wallet balance by its cost in one db transaction.
+// Msg which caused the transaction is saved to inbox in the same db transaction,
+// ErrMsgAlreadyProcessed is returned for the msg id or order step seen before,
+// ErrNotEnoughMoney - when purchase cost exceeds wallet balance.
+func (dao *PostgresTransactionsDAO) ApplyTransaction(
+	ctx context.Context,
+	data *in.CreateWalletTransactionDTO,
+) (*models.WalletTransaction, error) {
+	tx, err := dao.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if err := createProcessedMsg(ctx, tx, data.MessageID, data.OrderID, data.Type); err != nil {
+		return nil, err
+	}
+
+	if data.Type == models.Refund {
+		if err := checkRefundable(ctx, tx, data); err != nil {
+			return nil, err
 		}
 	}
 
-	defer func() { migrationsApplied = true }()
+	trans, err := createTransaction(ctx, tx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := changeBalance(ctx, tx, data); err != nil {
+		return nil, err
+	}
+
+	if err := postLedgerEntries(ctx, tx, trans); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return trans, nil
+}
+
+// Refunds of the order can't exceed its payment, wallet row is locked
+// until the end of transaction, so concurrent refunds are checked one by one.
+func checkRefundable(ctx context.Context, tx pgx.Tx, data *in.CreateWalletTransactionDTO) error {
+	if _, err := tx.Exec(ctx, "lock_wallet", data.WalletID); err != nil {
+		return err
+	}
+
+	var refundable models.Money
+
+	err := tx.QueryRow(
+		ctx,
+		"order_refundable_amount",
+		data.OrderID,
+		models.Purchase,
+		models.Capture,
+		models.Cancelation,
+		models.Refund,
+	).Scan(&refundable)
+	if err != nil {
+		return err
+	}
+
+	if data.Cost > refundable {
+		return fmt.Errorf("%w: refund %s, refundable %s", in.ErrRefundExceedsPayment, data.Cost, refundable)
+	}
+
+	return nil
+}
+
+func (dao *PostgresTransactionsDAO) HealthCheck(ctx context.Context) error {
+	if err := dao.db.Ping(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (dao *PostgresTransactionsDAO) Close() {
+	pg.Release(dao.db)
+}
+
+func NewPostgresWalletTransDAO(ctx context.Context, config *conf.Config) *PostgresTransactionsDAO {
+	dbConn := pg.MustOpen(ctx, config.WalletDatabaseURI(), migrationsDir)
 
 	queriesMap := map[string]string{
 		"get_transaction_by_order_id": `SELECT id, wallet_id, order_id, cost, type 
 			FROM wallet_transactions WHERE order_id=$1::bigint;`,
-		"create_transaction": `INSERT INTO wallet_transactions(wallet_id, order_id, cost, type) 
-			VALUES ($1::bigint, $2::bigint, $3::decimal, $4::smallint)
-			RETURNING id, wallet_id, order_id, cost, type;`,
+		"transactions_list": `SELECT id, wallet_id, COALESCE(order_id, 0), cost, type, created_at
+			FROM wallet_transactions
+			WHERE wallet_id=$1::bigint
+				AND ($2::smallint IS NULL OR type=$2::smallint)
+				AND ($3::timestamptz IS NULL OR created_at >= $3::timestamptz)
+				AND ($4::timestamptz IS NULL OR created_at < $4::timestamptz)
+			ORDER BY created_at DESC, id DESC
+			LIMIT $5::bigint OFFSET $6::bigint;`,
+		"credit_wallet": `UPDATE wallets SET balance=balance + $1::decimal
+			WHERE id=$2::bigint;`,
+		"lock_wallet": `SELECT id FROM wallets WHERE id=$1::bigint FOR UPDATE;`,
+		"order_refundable_amount": `SELECT COALESCE(SUM(
+				CASE WHEN type IN ($2::smallint, $3::smallint) THEN cost ELSE -cost END
+			), 0)
+			FROM wallet_transactions
+			WHERE order_id=$1::bigint
+				AND type IN ($2::smallint, $3::smallint, $4::smallint, $5::smallint);`,
 	}
 
-	submitPreparedStatements(ctx, queriesMap, dbConn)
+	pg.MustPrepare(ctx, dbConn, withSharedQueries(queriesMap))
 
 	return &PostgresTransactionsDAO{
 		db:                dbConn,
 		transactionsTable: config.WalletDatabase.TransactionsTable,
 	}
 }
+
+// ------------------------------WalletHoldsDAO------------------------------
+
+type PostgresHoldsDAO struct {
+	db *pgxpool.Pool
+}
+
+func scanHold(row pgx.Row) (*models.WalletHold, error) {
+	var hold models.WalletHold
+
+	err := row.Scan(
+		&hold.ID,
+		&hold.WalletID,
+		&hold.OrderID,
+		&hold.Amount,
+		&hold.Status,
+		&hold.ExpiresAt,
+		&hold.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, in.ErrHoldNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+func (dao *PostgresHoldsDAO) GetByOrderID(ctx context.Context, orderID uint) (*models.WalletHold, error) {
+	return scanHold(dao.db.QueryRow(ctx, "hold_by_order_id", orderID))
+}
+
+// Active holds which expired before now, oldest first.
+func (dao *PostgresHoldsDAO) GetListExpired(
+	ctx context.Context,
+	now time.Time,
+	limit uint16,
+) ([]*models.WalletHold, error) {
+	rows, err := dao.db.Query(ctx, "expired_holds_list", models.HoldActive, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds := make([]*models.WalletHold, 0, limit)
+
+	for rows.Next() {
+		hold, err := scanHold(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		holds = append(holds, hold)
+	}
+
+	return holds, rows.Err()
+}
+
+// Holds order amount on wallet: available balance is reduced, ledger balance is kept.
+// Hold is conditional on the available balance, ErrNotEnoughMoney is returned when it is short.
+// Msg which caused the hold is saved to inbox in the same db transaction.
+func (dao *PostgresHoldsDAO) Place(ctx context.Context, data *in.PlaceHoldDTO) (*models.WalletHold, error) {
+	tx, err := dao.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if err := createProcessedMsg(ctx, tx, data.MessageID, data.OrderID, models.Hold); err != nil {
+		return nil, err
+	}
+
+	if err := checkOrderNotRejected(ctx, tx, data.OrderID); err != nil {
+		return nil, err
+	}
+
+	hold, err := scanHold(tx.QueryRow(
+		ctx,
+		"create_hold",
+		data.WalletID,
+		data.OrderID,
+		data.Amount,
+		data.ExpiresAt,
+	))
+	if errors.Is(err, in.ErrHoldNotFound) {
+		return nil, in.ErrMsgAlreadyProcessed
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var held models.Money
+
+	err = tx.QueryRow(ctx, "hold_wallet_funds", data.Amount, data.WalletID).Scan(&held)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, in.ErrNotEnoughMoney
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = createTransaction(ctx, tx, &in.CreateWalletTransactionDTO{
+		WalletID: data.WalletID,
+		OrderID:  data.OrderID,
+		Cost:     data.Amount,
+		Type:     models.Hold,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+// Debits held amount from wallet and posts it to the ledger.
+// Expired hold is captured only if available balance still covers it,
+// ErrHoldNotActive is returned for hold already captured or released.
+func (dao *PostgresHoldsDAO) Capture(ctx context.Context, data *in.SettleHoldDTO) (*models.WalletHold, error) {
+	tx, err := dao.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if err := createProcessedMsg(ctx, tx, data.MessageID, data.OrderID, models.Capture); err != nil {
+		return nil, err
+	}
+
+	hold, err := scanHold(tx.QueryRow(ctx, "lock_hold_by_order_id", data.OrderID))
+	if err != nil {
+		return nil, err
+	}
+
+	switch hold.Status {
+	case models.HoldActive:
+		_, err = tx.Exec(ctx, "capture_wallet_funds", hold.Amount, hold.WalletID)
+	case models.HoldExpired:
+		err = changeBalance(ctx, tx, &in.CreateWalletTransactionDTO{
+			WalletID: hold.WalletID,
+			Cost:     hold.Amount,
+			Type:     models.Purchase,
+		})
+	default:
+		return nil, in.ErrHoldNotActive
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setHoldStatus(ctx, tx, hold, models.HoldCaptured); err != nil {
+		return nil, err
+	}
+
+	trans, err := createTransaction(ctx, tx, &in.CreateWalletTransactionDTO{
+		WalletID: hold.WalletID,
+		OrderID:  hold.OrderID,
+		Cost:     hold.Amount,
+		Type:     models.Capture,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := postLedgerEntries(ctx, tx, trans); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+// Returns held amount to available balance of the wallet,
+// ErrHoldNotActive is returned for hold already captured or released.
+func (dao *PostgresHoldsDAO) Release(ctx context.Context, data *in.SettleHoldDTO) (*models.WalletHold, error) {
+	tx, err := dao.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if err := createProcessedMsg(ctx, tx, data.MessageID, data.OrderID, models.Release); err != nil {
+		return nil, err
+	}
+
+	hold, err := scanHold(tx.QueryRow(ctx, "lock_hold_by_order_id", data.OrderID))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := releaseHold(ctx, tx, hold, models.HoldReleased); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+// Rejection may be consumed before the new order msg, later holds of the order
+// are refused with ErrOrderRejected. Order lock makes the mark and Place serial,
+// so hold placed concurrently is committed before the caller looks for it.
+func (dao *PostgresHoldsDAO) MarkOrderRejected(ctx context.Context, orderID uint) error {
+	tx, err := dao.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if _, err := tx.Exec(ctx, "lock_rejected_order", orderID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "create_rejected_order", orderID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func checkOrderNotRejected(ctx context.Context, tx pgx.Tx, orderID uint) error {
+	if _, err := tx.Exec(ctx, "lock_rejected_order", orderID); err != nil {
+		return err
+	}
+
+	var rejected bool
+
+	if err := tx.QueryRow(ctx, "order_rejected", orderID).Scan(&rejected); err != nil {
+		return err
+	}
+
+	if rejected {
+		return in.ErrOrderRejected
+	}
+
+	return nil
+}
+
+// Releases hold not settled in time.
+func (dao *PostgresHoldsDAO) Expire(ctx context.Context, holdID uint) (*models.WalletHold, error) {
+	tx, err := dao.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	hold, err := scanHold(tx.QueryRow(ctx, "lock_hold_by_id", holdID))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := releaseHold(ctx, tx, hold, models.HoldExpired); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+// Hold row should be locked by the transaction.
+func releaseHold(ctx context.Context, tx pgx.Tx, hold *models.WalletHold, status models.HoldStatus) error {
+	if hold.Status != models.HoldActive {
+		return in.ErrHoldNotActive
+	}
+
+	if _, err := tx.Exec(ctx, "release_wallet_funds", hold.Amount, hold.WalletID); err != nil {
+		return err
+	}
+
+	if err := setHoldStatus(ctx, tx, hold, status); err != nil {
+		return err
+	}
+
+	_, err := createTransaction(ctx, tx, &in.CreateWalletTransactionDTO{
+		WalletID: hold.WalletID,
+		OrderID:  hold.OrderID,
+		Cost:     hold.Amount,
+		Type:     models.Release,
+	})
+
+	return err
+}
+
+func setHoldStatus(ctx context.Context, tx pgx.Tx, hold *models.WalletHold, status models.HoldStatus) error {
+	if _, err := tx.Exec(ctx, "set_hold_status", status, hold.ID); err != nil {
+		return err
+	}
+
+	hold.Status = status
+
+	return nil
+}
+
+func (dao *PostgresHoldsDAO) HealthCheck(ctx context.Context) error {
+	if err := dao.db.Ping(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (dao *PostgresHoldsDAO) Close() {
+	pg.Release(dao.db)
+}
+
+func NewPostgresHoldsDAO(ctx context.Context, config *conf.Config) *PostgresHoldsDAO {
+	dbConn := pg.MustOpen(ctx, config.WalletDatabaseURI(), migrationsDir)
+
+	queriesMap := map[string]string{
+		"hold_by_order_id": `SELECT id, wallet_id, order_id, amount, status, expires_at, created_at
+			FROM wallet_holds WHERE order_id=$1::bigint;`,
+		"lock_hold_by_order_id": `SELECT id, wallet_id, order_id, amount, status, expires_at, created_at
+			FROM wallet_holds WHERE order_id=$1::bigint
+			FOR UPDATE;`,
+		"lock_hold_by_id": `SELECT id, wallet_id, order_id, amount, status, expires_at, created_at
+			FROM wallet_holds WHERE id=$1::bigint
+			FOR UPDATE;`,
+		"expired_holds_list": `SELECT id, wallet_id, order_id, amount, status, expires_at, created_at
+			FROM wallet_holds
+			WHERE status=$1::smallint AND expires_at < $2::timestamptz
+			ORDER BY expires_at
+			LIMIT $3::bigint;`,
+		"create_hold": `INSERT INTO wallet_holds(wallet_id, order_id, amount, expires_at)
+			VALUES ($1::bigint, $2::bigint, $3::decimal, $4::timestamptz)
+			ON CONFLICT (order_id) DO NOTHING
+			RETURNING id, wallet_id, order_id, amount, status, expires_at, created_at;`,
+		"set_hold_status": `UPDATE wallet_holds SET status=$1::smallint, updated_at=NOW()
+			WHERE id=$2::bigint;`,
+		"hold_wallet_funds": `UPDATE wallets SET held=held + $1::decimal
+			WHERE id=$2::bigint AND balance - held >= $1::decimal
+			RETURNING held;`,
+		"capture_wallet_funds": `UPDATE wallets SET balance=balance - $1::decimal, held=held - $1::decimal
+			WHERE id=$2::bigint;`,
+		"release_wallet_funds": `UPDATE wallets SET held=held - $1::decimal
+			WHERE id=$2::bigint;`,
+		"lock_rejected_order": `SELECT pg_advisory_xact_lock('wallet_rejected_orders'::regclass::oid::int, $1::int);`,
+		"create_rejected_order": `INSERT INTO wallet_rejected_orders(order_id)
+			VALUES ($1::bigint)
+			ON CONFLICT DO NOTHING;`,
+		"order_rejected": `SELECT EXISTS(SELECT 1 FROM wallet_rejected_orders WHERE order_id=$1::bigint);`,
+	}
+
+	pg.MustPrepare(ctx, dbConn, withSharedQueries(queriesMap))
+
+	return &PostgresHoldsDAO{
+		db: dbConn,
+	}
+}
+
+// ------------------------------LedgerDAO------------------------------
+
+type PostgresLedgerDAO struct {
+	db *pgxpool.Pool
+}
+
+func (dao *PostgresLedgerDAO) GetBalanceMismatches(ctx context.Context) ([]*models.BalanceMismatch, error) {
+	rows, err := dao.db.Query(ctx, "ledger_balance_mismatches")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mismatches := make([]*models.BalanceMismatch, 0)
+
+	for rows.Next() {
+		var mismatch models.BalanceMismatch
+
+		err := rows.Scan(
+			&mismatch.WalletID,
+			&mismatch.UserID,
+			&mismatch.Balance,
+			&mismatch.LedgerBalance,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		mismatches = append(mismatches, &mismatch)
+	}
+
+	return mismatches, rows.Err()
+}
+
+// Transactions marked pre_ledger were made before the ledger was introduced and have no entries,
+// they are skipped as well as holds and releases, which move no money.
+func (dao *PostgresLedgerDAO) GetUnbalancedTransactions(ctx context.Context) ([]uint, error) {
+	rows, err := dao.db.Query(ctx, "ledger_unbalanced_transactions", models.Hold, models.Release)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]uint, 0)
+
+	for rows.Next() {
+		var id uint
+
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (dao *PostgresLedgerDAO) HealthCheck(ctx context.Context) error {
+	if err := dao.db.Ping(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (dao *PostgresLedgerDAO) Close() {
+	pg.Release(dao.db)
+}
+
+func NewPostgresLedgerDAO(ctx context.Context, config *conf.Config) *PostgresLedgerDAO {
+	dbConn := pg.MustOpen(ctx, config.WalletDatabaseURI(), migrationsDir)
+
+	queriesMap := map[string]string{
+		"ledger_balance_mismatches": `SELECT w.id, w.user_id, w.balance, COALESCE(SUM(e.amount), 0)
+			FROM wallets w
+			LEFT JOIN ledger_accounts a ON a.wallet_id=w.id
+			LEFT JOIN ledger_entries e ON e.account_id=a.id
+			GROUP BY w.id
+			HAVING w.balance <> COALESCE(SUM(e.amount), 0)
+			ORDER BY w.id;`,
+		"ledger_unbalanced_transactions": `SELECT t.id
+			FROM wallet_transactions t
+			LEFT JOIN ledger_entries e ON e.transaction_id=t.id
+			WHERE NOT t.pre_ledger AND t.type NOT IN ($1::smallint, $2::smallint)
+			GROUP BY t.id
+			HAVING COUNT(e.id) < 2 OR SUM(e.amount) <> 0
+			ORDER BY t.id;`,
+	}
+
+	pg.MustPrepare(ctx, dbConn, queriesMap)
+
+	return &PostgresLedgerDAO{
+		db: dbConn,
+	}
+}
+
+// ------------------------------DeadLettersDAO------------------------------
+
+func NewPostgresDeadLettersDAO(ctx context.Context, config *conf.Config) *deadletter.PostgresStore {
+	dbConn := pg.MustOpen(ctx, config.WalletDatabaseURI(), migrationsDir)
+
+	store, err := deadletter.NewPostgresStore(ctx, dbConn)
+	if err != nil {
+		panic(err)
+	}
+
+	return store
+}